@@ -16,6 +16,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/controller"
 	"github.com/sky-uk/feed/util"
+	"github.com/sky-uk/feed/util/awscreds"
 )
 
 // New creates a controller.Updater for attaching to ALB target groups on first update.
@@ -30,6 +31,7 @@ func New(region string, targetGroupNames []string, targetGroupDeregistrationDela
 	if err != nil {
 		return nil, fmt.Errorf("unable to create ALB updater: %v", err)
 	}
+	awscreds.UseWebIdentity(session)
 
 	return &alb{
 		metadata:                       ec2metadata.New(session),
@@ -2,35 +2,118 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
+	"regexp"
+	"strings"
+	"text/template"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/controller"
 	"github.com/sky-uk/feed/dns"
 	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
 	"github.com/sky-uk/feed/elb"
 	"github.com/sky-uk/feed/k8s"
+	"github.com/sky-uk/feed/util/awspartition"
+	"github.com/sky-uk/feed/util/awsretry"
 	"github.com/sky-uk/feed/util/cmd"
 	"github.com/sky-uk/feed/util/metrics"
+	"github.com/sky-uk/feed/util/tracing"
+	"github.com/sky-uk/feed/util/useragent"
+	"k8s.io/client-go/pkg/labels"
 )
 
 var (
 	debug                      bool
-	kubeconfig                 string
+	logFormat                  string
+	kubeconfig                 k8s.Kubeconfig
 	resyncPeriod               time.Duration
+	resyncJitter               float64
+	healthBindAddress          string
 	healthPort                 int
 	albNames                   cmd.CommaSeparatedValues
+	nlbNames                   cmd.CommaSeparatedValues
+	nlbLabelValue              string
 	elbLabelValue              string
+	elbTags                    cmd.KeyValues
 	elbRegion                  string
-	r53HostedZone              string
+	r53Region                  string
+	awsPartition               string
+	r53HostedZones             cmd.CommaSeparatedValues
+	r53InternalZone            string
+	r53ExternalZone            string
 	pushgatewayURL             string
 	pushgatewayIntervalSeconds int
+	metricsListen              string
 	pushgatewayLabels          cmd.KeyValues
 	awsAPIRetries              int
 	internalHostname           string
 	externalHostname           string
+	lbHostnames                cmd.KeyValues
+	internalIPs                cmd.CommaSeparatedValues
+	externalIPs                cmd.CommaSeparatedValues
+	useIngressStatus           bool
 	cnameTimeToLive            time.Duration
+	internalCnameTimeToLive    time.Duration
+	externalCnameTimeToLive    time.Duration
+	dnsRecordType              string
+	enableIPv6                 bool
+	enableCloudFront           bool
+	enableTXTRecords           bool
+	managedRecordTypes         = cmd.CommaSeparatedValues(append([]string{}, dns.DefaultManagedRecordTypes...))
+	r53AssumeRoleARN           string
+	lbAssumeRoleARN            string
+	r53AssumeRoleARNAlias      string
+	lbAssumeRoleARNAlias       string
+	r53HealthCheckID           string
+	r53ManageHealthChecks      bool
+	r53BatchSize               int
+	r53WaitForSync             bool
+	r53SyncTimeout             time.Duration
+	dryRun                     bool
+	enableLeaderElection       bool
+	leaderElectionNamespace    string
+	deleteRecordsOnShutdown    bool
+	noDelete                   bool
+	shutdownTimeout            time.Duration
+	deleteGracePeriod          time.Duration
+	txtOwnerID                 string
+	recordEvents               bool
+	hostFilter                 string
+	hostFilterRegexp           *regexp.Regexp
+	r53SetIdentifier           string
+	setIdentifierTemplate      *template.Template
+	recordNameTemplateText     string
+	recordNameTemplate         *template.Template
+	clusterName                string
+	reconcileBackoffInitial    time.Duration
+	reconcileBackoffMax        time.Duration
+	updaterConcurrency         int
+	reconcileTokenFile         string
+	changeWebhookURL           string
+	changeWebhookSecretFile    string
+	changeWebhookSecret        string
+	otelEndpoint               string
+	ingressClass               string
+	namespace                  string
+	namespaceSelector          string
+	namespaceLabelSelector     labels.Selector
+	serviceWatchNamespace      string
+	serviceWatchSelector       string
+	serviceSelector            labels.Selector
+	awsEndpointURL             string
+	userAgent                  string
+	awsRetryBaseDelay          time.Duration
+	awsRetryMaxDelay           time.Duration
+	lbDiscoveryInterval        time.Duration
+	once                       bool
+	dnsProvider                string
+	configFile                 string
+	maxRecords                 int
 )
 
 func init() {
@@ -39,70 +122,335 @@ func init() {
 		defaultHealthPort                 = 12082
 		defaultElbRegion                  = "eu-west-1"
 		defaultElbLabelValue              = ""
-		defaultHostedZone                 = ""
 		defaultPushgatewayIntervalSeconds = 60
 		defaultAwsAPIRetries              = 5
 		defaultCnameTTL                   = 5 * time.Minute
+		defaultLeaderElectionNamespace    = "kube-system"
+		defaultShutdownTimeout            = 20 * time.Second
 	)
 
+	flag.StringVar(&configFile, "config-file", "",
+		"YAML or JSON file of flag names to values, e.g. \"r53-hosted-zone: Z1234\". Flags on the command line "+
+			"take precedence over the file.")
 	flag.BoolVar(&debug, "debug", false,
 		"Enable debug logging.")
-	flag.StringVar(&kubeconfig, "kubeconfig", "",
+	flag.StringVar(&logFormat, "log-format", cmd.TextLogFormat,
+		"Format of log output, either "+cmd.TextLogFormat+" or "+cmd.JSONLogFormat+".")
+	flag.StringVar(&kubeconfig.Path, "kubeconfig", "",
 		"Path to kubeconfig for connecting to the apiserver. Leave blank to connect inside a cluster.")
+	flag.StringVar(&kubeconfig.Context, "kube-context", "",
+		"Context of the kubeconfig to connect to the apiserver with. Leave blank to use the current context.")
 	flag.DurationVar(&resyncPeriod, "resync-period", defaultResyncPeriod,
 		"Resync with the apiserver periodically to handle missed updates.")
+	flag.Float64Var(&resyncJitter, "resync-jitter", 0,
+		"Fraction of the resync period to randomly add to it, e.g. 0.2 to resync every 15-18m, so replicas "+
+			"don't resync at the same time.")
+	flag.StringVar(&healthBindAddress, "health-bind-address", "",
+		"Address to bind the health port to, e.g. 127.0.0.1 to only serve it on loopback. Leave blank to bind to "+
+			"all interfaces.")
 	flag.IntVar(&healthPort, "health-port", defaultHealthPort,
 		"Port for checking the health of the ingress controller.")
 	flag.Var(&albNames, "alb-names",
 		"Comma delimited list of ALB names to use for Route53 updates. Should only include a single ALB name per LB scheme.")
+	flag.Var(&nlbNames, "nlb-names",
+		"Comma delimited list of NLB names to use for Route53 updates. Should only include a single NLB name per LB scheme.")
+	flag.StringVar(&nlbLabelValue, "nlb-label-value", "",
+		"Alias to NLBs tagged with "+elb.ElbTag+"=value. Route53 entries will be created to these, "+
+			"depending on the scheme. Can be combined with nlb-names.")
 	flag.StringVar(&elbRegion, "elb-region", defaultElbRegion,
-		"AWS region for ELBs.")
+		"AWS region for ELBs, ALBs and NLBs.")
+	flag.StringVar(&r53Region, "r53-region", r53.DefaultRegion,
+		"AWS region of the Route53 client, independent of elb-region. Route53 is global, so requests to it are "+
+			"signed for this region, which is also used to assume assume-role-arn. Defaults to the region of "+
+			"the global Route53 endpoint of aws-partition.")
+	flag.StringVar(&awsPartition, "aws-partition", awspartition.Standard,
+		"AWS partition of the hosted zones and load balancers, either "+strings.Join(awspartition.IDs, ", ")+
+			". elb-region and r53-region must be in the partition.")
 	flag.StringVar(&elbLabelValue, "elb-label-value", defaultElbLabelValue,
 		"Alias to ELBs tagged with "+elb.ElbTag+"=value. Route53 entries will be created to these,"+
 			"depending on the scheme.")
-	flag.StringVar(&r53HostedZone, "r53-hosted-zone", defaultHostedZone,
-		"Route53 hosted zone id to manage.")
+	flag.Var(&elbTags, "elb-tags",
+		"Alias to ELBs tagged with all of the key=value tags. Can be repeated. Takes precedence over "+
+			"elb-label-value.")
+	flag.Var(&r53HostedZones, "r53-hosted-zone",
+		"Comma delimited list of Route53 hosted zone ids to manage. Each ingress host is managed in the zone "+
+			"with the longest matching domain.")
+	flag.StringVar(&r53InternalZone, "r53-internal-zone", "",
+		"Route53 hosted zone id of the records of internal ingresses, e.g. for split-horizon DNS. Their records are "+
+			"only managed in this zone. Other ingresses are managed in r53-external-zone or r53-hosted-zone.")
+	flag.StringVar(&r53ExternalZone, "r53-external-zone", "",
+		"Route53 hosted zone id of the records of internet-facing ingresses, e.g. for split-horizon DNS. Their "+
+			"records are only managed in this zone. Other ingresses are managed in r53-internal-zone or "+
+			"r53-hosted-zone.")
 	flag.StringVar(&pushgatewayURL, "pushgateway", "",
 		"Prometheus pushgateway URL for pushing metrics. Leave blank to not push metrics.")
 	flag.IntVar(&pushgatewayIntervalSeconds, "pushgateway-interval", defaultPushgatewayIntervalSeconds,
 		"Interval in seconds for pushing metrics.")
 	flag.Var(&pushgatewayLabels, "pushgateway-label",
 		"A label=value pair to attach to metrics pushed to prometheus. Specify multiple times for multiple labels.")
+	flag.StringVar(&metricsListen, "metrics-listen", "",
+		"Address to serve metrics on for Prometheus to scrape, e.g. :9090. Leave blank to only serve metrics on "+
+			"the health port. Can be used together with pushgateway.")
 	flag.IntVar(&awsAPIRetries, "aws-api-retries", defaultAwsAPIRetries,
-		"Number of times a request to the AWS API is retried.")
+		"Number of times a throttled, timed out or 5xx request to the AWS API is retried.")
 	flag.StringVar(&internalHostname, "internal-hostname", "",
 		"Hostname of the internal facing load-balancer. If specified, external-hostname must also be given.")
 	flag.StringVar(&externalHostname, "external-hostname", "",
 		"Hostname of the internet facing load-balancer. If specified, internal-hostname must also be given.")
+	flag.Var(&lbHostnames, "lb-hostname",
+		"Named load balancer as name=hostname, for ingresses with the "+adapter.LBNameAnnotation+" annotation "+
+			"set to the name. Can be repeated. Other ingresses use internal-hostname or external-hostname.")
+	flag.Var(&internalIPs, "internal-ips",
+		"Comma delimited list of IPv4 addresses of the internal facing load-balancer, to create A records for "+
+			"instead of CNAMEs.")
+	flag.Var(&externalIPs, "external-ips",
+		"Comma delimited list of IPv4 addresses of the internet facing load-balancer, to create A records for "+
+			"instead of CNAMEs.")
+	flag.BoolVar(&useIngressStatus, "use-ingress-status", false,
+		"Point each ingress's hosts at the load balancer in the ingress's status, set by the ingress controller, "+
+			"instead of discovering the load balancers.")
 	flag.DurationVar(&cnameTimeToLive, "cname-ttl", defaultCnameTTL,
 		"Time-to-live of CNAME records")
+	flag.DurationVar(&internalCnameTimeToLive, "internal-cname-ttl", 0,
+		"Time-to-live of CNAME records for internal-hostname. Defaults to cname-ttl.")
+	flag.DurationVar(&externalCnameTimeToLive, "external-cname-ttl", 0,
+		"Time-to-live of CNAME records for external-hostname. Defaults to cname-ttl.")
+	flag.StringVar(&dnsRecordType, "dns-record-type", adapter.AliasRecordType,
+		"Type of record to create for ELBs/ALBs, either "+adapter.AliasRecordType+" or "+adapter.CNAMERecordType+
+			". Records for internal-hostname and external-hostname are always CNAMEs.")
+	flag.BoolVar(&enableIPv6, "enable-ipv6", false,
+		"Create AAAA alias records for load balancers which have IPv6 addresses.")
+	flag.BoolVar(&enableCloudFront, "enable-cloudfront", false,
+		"Alias hosts of ingresses with the sky.uk/cloudfront-distribution annotation to the distribution. "+
+			"Distributions are listed on startup.")
+	flag.BoolVar(&enableTXTRecords, "enable-txt-records", false,
+		"Create TXT records requested by the sky.uk/dns-txt annotation, such as ACME dns-01 challenges. "+
+			"TXT records are deleted once no ingress requests them.")
+	flag.Var(&managedRecordTypes, "managed-record-types",
+		"Comma delimited list of record types feed-dns may create, update or delete, out of CNAME, A and AAAA. "+
+			"Changes to other types are refused with a warning.")
+	flag.StringVar(&r53AssumeRoleARN, "assume-role-arn", "",
+		"ARN of a role to assume for Route53 requests, e.g. for hosted zones in another account. "+
+			"Leave blank to use the local credentials.")
+	flag.StringVar(&lbAssumeRoleARN, "lb-assume-role-arn", "",
+		"ARN of a role to assume when discovering ELBs/ALBs/NLBs. Leave blank to use the local credentials.")
+	// The roles are assumed separately with the local credentials, rather than one through the other, so each
+	// refreshes independently, e.g. for load balancers and hosted zones in two accounts.
+	flag.StringVar(&r53AssumeRoleARNAlias, "r53-assume-role-arn", "",
+		"Same as assume-role-arn.")
+	flag.StringVar(&lbAssumeRoleARNAlias, "elb-assume-role-arn", "",
+		"Same as lb-assume-role-arn.")
+	flag.StringVar(&r53HealthCheckID, "r53-health-check-id", "",
+		"Id of the Route53 health check to associate with failover records, created with the "+
+			"sky.uk/dns-failover-role annotation.")
+	flag.BoolVar(&r53ManageHealthChecks, "r53-manage-health-checks", false,
+		"Create Route53 health checks for records with the sky.uk/dns-healthcheck-path, -port and -interval "+
+			"annotations, and delete them once no record uses them. Needs txt-owner-id or cluster-name to "+
+			"identify the health checks owned by this feed-dns.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Log the DNS changes that would be made, without making them.")
+	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
+		"Elect a leader between feed-dns replicas, so only one of them updates DNS at a time.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", defaultLeaderElectionNamespace,
+		"Namespace of the "+leaderLockName+" config map used for leader election.")
+	flag.DurationVar(&deleteGracePeriod, "delete-grace-period", 0,
+		"How long a record must have had no ingress before it's deleted, across consecutive updates, e.g. so "+
+			"records survive an ingress being recreated. Leave as 0 to delete records straight away.")
+	flag.BoolVar(&deleteRecordsOnShutdown, "delete-records-on-shutdown", false,
+		"Delete all the records managed by feed-dns when it's stopped, e.g. when the deployment is deleted.")
+	flag.BoolVar(&noDelete, "no-delete", false,
+		"Never delete records, only create and update them, e.g. while rolling out feed-dns. Records of deleted "+
+			"ingresses are left in place, and counted by the skipped_deletes metric.")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", defaultShutdownTimeout,
+		"Maximum time to spend deleting records on shutdown. Should be less than the pod's termination grace period.")
+	flag.BoolVar(&recordEvents, "record-events", false,
+		"Record Kubernetes events on ingresses when their records are changed, or fail to change. "+
+			"feed-dns needs permission to create events.")
+	flag.StringVar(&hostFilter, "host-filter", "",
+		"Regular expression which hosts must match to be managed, e.g. '\\.dev\\.example\\.com$'. Records for "+
+			"other hosts are never created, updated or deleted. Leave blank to manage all hosts.")
+	flag.StringVar(&txtOwnerID, "txt-owner-id", "",
+		"Only manage records with an ownership TXT record for this id, and create ownership records for new "+
+			"records. Leave blank to manage all records pointing at the load balancers.")
+	flag.StringVar(&r53SetIdentifier, "r53-set-identifier", "",
+		"Go template for the set identifier of weighted, failover and latency records, e.g. "+
+			"{{.Region}}-{{.Cluster}}. Fields are Region, Cluster, Host, Scheme, LoadBalancer, Namespace and Ingress. "+
+			"Leave blank to identify records by the load balancer they point to.")
+	flag.StringVar(&recordNameTemplateText, "record-name-template", "",
+		"Go template for the record name of each ingress host, e.g. {{.Host | trimSuffix \".eu-west-1\"}} to strip "+
+			"a cluster-specific subdomain. Fields are Host, Cluster, Scheme, Namespace and Ingress, and trimPrefix, "+
+			"trimSuffix, replace and lower transform strings. Hosts whose record name can't be rendered are skipped. "+
+			"Leave blank to use the hosts as they are.")
+	flag.StringVar(&clusterName, "cluster-name", "",
+		"Name of the cluster, the Cluster field of r53-set-identifier.")
+	flag.IntVar(&r53BatchSize, "r53-batch-size", r53.MaxBatchSize,
+		"Maximum number of record changes sent to Route53 in a single request. Throttled requests are retried "+
+			"up to aws-api-retries times.")
+	flag.IntVar(&maxRecords, "max-records", 0,
+		"Maximum number of records computed for a hosted zone. Updates of a zone with more records are refused, "+
+			"and feed-dns is unhealthy, rather than changing the zone. 0 for no maximum.")
+	flag.BoolVar(&r53WaitForSync, "r53-wait-for-sync", false,
+		"Wait for the changes of each update to be in sync on all Route53 name servers before the update "+
+			"completes. Updates fail if the changes aren't in sync within r53-sync-timeout.")
+	flag.DurationVar(&r53SyncTimeout, "r53-sync-timeout", r53.DefaultSyncTimeout,
+		"How long to wait for changes to be in sync, with r53-wait-for-sync.")
+	flag.DurationVar(&reconcileBackoffInitial, "reconcile-backoff-initial", controller.DefaultReconcileBackoffInitial,
+		"Delay before retrying a failed update, doubling after each consecutive failure.")
+	flag.DurationVar(&reconcileBackoffMax, "reconcile-backoff-max", controller.DefaultReconcileBackoffMax,
+		"Maximum delay between retries of a failed update.")
+	flag.IntVar(&updaterConcurrency, "updater-concurrency", 0,
+		"Maximum number of updaters updated at the same time. Leave as 0 to update all of them at once.")
+	flag.StringVar(&otelEndpoint, "otel-endpoint", "",
+		"OpenTelemetry collector OTLP/HTTP endpoint to export traces of each update to, e.g. "+
+			"http://otel-collector:4318. Leave blank to disable tracing.")
+	flag.StringVar(&reconcileTokenFile, "reconcile-token-file", "",
+		"File containing a token for POST /reconcile on the health port, which updates straight away. "+
+			"Leave blank to disable the endpoint.")
+	flag.StringVar(&changeWebhookURL, "change-webhook-url", "",
+		"URL to POST a JSON summary of the records changed by each update to. Leave blank to disable.")
+	flag.StringVar(&changeWebhookSecretFile, "change-webhook-secret-file", "",
+		"File containing a shared secret to sign change-webhook-url requests with, in the "+
+			dns.WebhookSignatureHeader+" header.")
+	flag.StringVar(&ingressClass, "ingress-class", "",
+		"Only manage records for ingresses with the kubernetes.io/ingress.class annotation set to this class. "+
+			"Leave blank to manage records for all ingresses.")
+	flag.StringVar(&namespace, "namespace", "",
+		"Only manage records for ingresses in this namespace. Leave blank for ingresses in all namespaces.")
+	flag.StringVar(&namespaceSelector, "namespace-selector", "",
+		"Only manage records for ingresses in namespaces matching this label selector, e.g. env=prod. Needs "+
+			"permission to list and watch namespaces. Leave blank for ingresses in all namespaces.")
+	flag.StringVar(&serviceWatchNamespace, "service-watch-namespace", "",
+		"Only update straight away when the load balancer of a service in this namespace changes, e.g. the "+
+			"namespace of the ingress controller's service. Leave blank to watch services in all namespaces.")
+	flag.StringVar(&serviceWatchSelector, "service-watch-selector", "",
+		"Only update straight away when the load balancer of a service matching this label selector changes, "+
+			"e.g. app=feed-ingress. Leave blank to watch all services.")
+	flag.StringVar(&awsEndpointURL, "aws-endpoint-url", "",
+		"URL of the endpoint used for all AWS requests, e.g. http://localstack:4566 to test against LocalStack. "+
+			"Leave blank to use the default AWS endpoints.")
+	flag.StringVar(&userAgent, "user-agent", useragent.Default("feed-dns"),
+		"Appended to the User-Agent of all AWS requests, to identify them in CloudTrail.")
+	flag.DurationVar(&awsRetryBaseDelay, "aws-retry-base-delay", awsretry.DefaultBaseDelay,
+		"Delay before retrying a throttled or failed AWS request, doubling after each retry.")
+	flag.DurationVar(&awsRetryMaxDelay, "aws-retry-max-delay", awsretry.DefaultMaxDelay,
+		"Maximum delay between retries of an AWS request.")
+	flag.DurationVar(&lbDiscoveryInterval, "lb-discovery-interval", 0,
+		"How often to discover the ELBs, ALBs or NLBs again, so records follow recreated load balancers. "+
+			"0 only discovers them at startup.")
+	flag.BoolVar(&once, "once", false,
+		"Update the records once and exit, with a non-zero exit code if the update fails, e.g. in a CronJob. "+
+			"The health port isn't served.")
+	flag.StringVar(&dnsProvider, "dns-provider", route53Provider,
+		"Where the hosted zones are, one of "+strings.Join(providerNames(), ", ")+". Providers other than "+
+			route53Provider+" and "+fakeProvider+" are configured by the flags prefixed with their name, and their "+
+			"hosted zone ids are the names of their zones unless those flags say otherwise. "+fakeProvider+
+			" holds the zones in memory, starting out empty, and treats each hosted zone id as the domain of its "+
+			"zone, so no credentials are needed, e.g. with plan.")
+	defineProviderFlags()
 }
 
+const (
+	leaderLockName      = "feed-dns-leader"
+	leaderLeaseDuration = 15 * time.Second
+	leaderRetryPeriod   = 5 * time.Second
+	// onceSyncTimeout is how long -once waits for the ingresses and services to sync before giving up.
+	onceSyncTimeout  = time.Minute
+	syncPollInterval = 100 * time.Millisecond
+
+	planCommand = "plan"
+)
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == planCommand {
+		plan(os.Args[2:])
+		return
+	}
+
 	flag.Parse()
+	loadConfigFile()
 	validateConfig()
 
-	cmd.ConfigureLogging(debug)
+	if err := cmd.ConfigureLogging(debug, logFormat); err != nil {
+		log.Fatal(err)
+	}
 	cmd.ConfigureMetrics("feed-dns", pushgatewayLabels, pushgatewayURL, pushgatewayIntervalSeconds)
+	cmd.AddMetricsListener(metricsListen)
 
-	client, err := k8s.New(kubeconfig, resyncPeriod)
+	client, err := k8s.NewWithOptions(kubeconfig, k8s.JitterResyncPeriod(resyncPeriod, resyncJitter), k8s.Options{
+		IngressClass:      ingressClass,
+		Namespace:         namespace,
+		NamespaceSelector: namespaceLabelSelector,
+		ServiceWatch: k8s.ServiceWatch{
+			AddressChangesOnly: true,
+			Namespace:          serviceWatchNamespace,
+			Selector:           serviceSelector,
+		},
+	})
 	if err != nil {
 		log.Fatal("Unable to create k8s client: ", err)
 	}
 
+	var eventRecorder k8s.EventRecorder
+	if recordEvents {
+		eventRecorder, err = k8s.NewEventRecorder(kubeconfig, "feed-dns")
+		if err != nil {
+			log.Fatal("Unable to create event recorder: ", err)
+		}
+	}
+
 	var lbAdapter, lbErr = createFrontendAdapter()
 	if lbErr != nil {
 		log.Fatal("Error during initialisation: ", lbErr)
 	}
-	dnsUpdater := dns.New(r53HostedZone, lbAdapter, awsAPIRetries)
+	dnsUpdater, err := createDNSUpdater(lbAdapter, eventRecorder)
+	if err != nil {
+		log.Fatal("Unable to create dns updater: ", err)
+	}
+
+	var leaderLock k8s.LeaderLock
+	if enableLeaderElection {
+		leaderLock, err = createLeaderLock()
+		if err != nil {
+			log.Fatal("Unable to create leader lock: ", err)
+		}
+	}
 
 	controller := controller.New(controller.Config{
-		KubernetesClient: client,
-		Updaters:         []controller.Updater{dnsUpdater},
+		KubernetesClient:        client,
+		Updaters:                []controller.Updater{dnsUpdater},
+		DryRun:                  dryRun,
+		LeaderLock:              leaderLock,
+		LeaderRetryPeriod:       leaderRetryPeriod,
+		DrainOnStop:             deleteRecordsOnShutdown,
+		DrainTimeout:            shutdownTimeout,
+		ReconcileBackoffInitial: reconcileBackoffInitial,
+		ReconcileBackoffMax:     reconcileBackoffMax,
+		UpdaterConcurrency:      updaterConcurrency,
+		MetricsSubsystem:        metrics.PrometheusDNSSubsystem,
+		Tracer:                  tracing.New(otelEndpoint, "feed-dns"),
 	})
 
+	if once {
+		if err := updateOnce(client, controller); err != nil {
+			log.Fatal("Unable to update records: ", err)
+		}
+		log.Info("Records updated")
+		return
+	}
+
 	cmd.AddHealthMetrics(controller, metrics.PrometheusDNSSubsystem)
-	cmd.AddHealthPort(controller, healthPort)
+	if err := cmd.AddReconcileEndpoint(controller, reconcileTokenFile); err != nil {
+		log.Fatal(err)
+	}
+	if lister, ok := dnsUpdater.(dns.RecordLister); ok {
+		cmd.AddRecordsEndpoint(func() interface{} { return lister.Records() })
+	}
+	if reporter, ok := dnsUpdater.(dns.CapabilityReporter); ok {
+		cmd.AddCapabilitiesEndpoint(func() interface{} { return reporter.Capabilities() })
+	}
+	if err := cmd.AddHealthPort(controller, healthBindAddress, healthPort); err != nil {
+		log.Fatal(err)
+	}
 	cmd.AddSignalHandler(controller)
 
 	if err := controller.Start(); err != nil {
@@ -112,42 +460,395 @@ func main() {
 	select {}
 }
 
+func loadConfigFile() {
+	if configFile == "" {
+		return
+	}
+	if err := cmd.LoadConfigFile(flag.CommandLine, configFile); err != nil {
+		log.Error(err)
+		os.Exit(-1)
+	}
+}
+
+// createDNSUpdater creates the dns updater of the hosted zones, with the clients of dns-provider.
+func createDNSUpdater(lbAdapter adapter.FrontendAdapter, events k8s.EventRecorder) (controller.Updater, error) {
+	provider, err := lookupProvider(dnsProvider)
+	if err != nil {
+		return nil, err
+	}
+	return provider.newUpdater(lbAdapter, dns.Config{
+		HostedZoneIDs:         r53HostedZones,
+		InternalHostedZoneID:  r53InternalZone,
+		ExternalHostedZoneID:  r53ExternalZone,
+		TXTOwnerID:            txtOwnerID,
+		EventRecorder:         events,
+		HostFilter:            hostFilterRegexp,
+		ManageTXTRecords:      enableTXTRecords,
+		SetIdentifierTemplate: setIdentifierTemplate,
+		RecordNameTemplate:    recordNameTemplate,
+		ClusterName:           clusterName,
+		DeleteGracePeriod:     deleteGracePeriod,
+		ManagedRecordTypes:    managedRecordTypes,
+		ChangeWebhookURL:      changeWebhookURL,
+		ChangeWebhookSecret:   changeWebhookSecret,
+		MaxRecords:            maxRecords,
+		ManageHealthChecks:    r53ManageHealthChecks,
+		NoDelete:              noDelete,
+	})
+}
+
+// updateOnce starts the controller, updates once the ingresses and services have synced, then stops it.
+func updateOnce(client k8s.Client, controller controller.Controller) error {
+	if err := controller.Start(); err != nil {
+		return fmt.Errorf("unable to start controller: %v", err)
+	}
+	defer controller.Stop()
+
+	deadline := time.Now().Add(onceSyncTimeout)
+	for !client.HasSynced() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("ingresses and services didn't sync within %v", onceSyncTimeout)
+		}
+		time.Sleep(syncPollInterval)
+	}
+
+	return controller.Reconcile()
+}
+
 func createFrontendAdapter() (adapter.FrontendAdapter, error) {
-	if internalHostname != "" || externalHostname != "" {
+	if useIngressStatus {
+		return adapter.NewIngressStatusAdapter(cnameTimeToLive), nil
+	}
+
+	if len(internalIPs) > 0 || len(externalIPs) > 0 {
+		ipsWithScheme := make(map[string][]string)
+		if len(internalIPs) > 0 {
+			ipsWithScheme["internal"] = internalIPs
+		}
+
+		if len(externalIPs) > 0 {
+			ipsWithScheme["internet-facing"] = externalIPs
+		}
+
+		return adapter.NewStaticIPAdapter(ipsWithScheme, cnameTimeToLive), nil
+	}
+
+	if internalHostname != "" || externalHostname != "" || len(lbHostnames) > 0 {
 		addressesWithScheme := make(map[string]string)
+		ttlsWithScheme := make(map[string]time.Duration)
 		if internalHostname != "" {
 			addressesWithScheme["internal"] = internalHostname
+			ttlsWithScheme["internal"] = internalCnameTimeToLive
 		}
 
 		if externalHostname != "" {
 			addressesWithScheme["internet-facing"] = externalHostname
+			ttlsWithScheme["internet-facing"] = externalCnameTimeToLive
 		}
 
-		return adapter.NewStaticHostnameAdapter(addressesWithScheme, cnameTimeToLive), nil
+		return adapter.NewNamedStaticHostnameAdapter(addressesWithScheme, lbHostnames.Map(), cnameTimeToLive,
+			ttlsWithScheme), nil
 	}
 
 	config := adapter.AWSAdapterConfig{
-		Region:        elbRegion,
-		HostedZoneID:  r53HostedZone,
-		ELBLabelValue: elbLabelValue,
-		ALBNames:      albNames,
+		Region:            elbRegion,
+		Partition:         awsPartition,
+		AssumeRoleARN:     lbAssumeRoleARN,
+		EndpointURL:       awsEndpointURL,
+		UserAgent:         userAgent,
+		Retries:           awsAPIRetries,
+		RetryBaseDelay:    awsRetryBaseDelay,
+		RetryMaxDelay:     awsRetryMaxDelay,
+		HostedZoneIDs:     r53HostedZones,
+		ELBLabelValue:     elbLabelValue,
+		ELBTags:           elbTags.Map(),
+		ALBNames:          albNames,
+		NLBNames:          nlbNames,
+		NLBLabelValue:     nlbLabelValue,
+		RecordType:        dnsRecordType,
+		CNAMETTL:          cnameTimeToLive,
+		EnableIPv6:        enableIPv6,
+		HealthCheckID:     r53HealthCheckID,
+		EnableCloudFront:  enableCloudFront,
+		DiscoveryInterval: lbDiscoveryInterval,
 	}
 	return adapter.NewAWSAdapter(&config)
 }
 
+func createLeaderLock() (k8s.LeaderLock, error) {
+	// The pod name is the hostname, so identifies the leader uniquely.
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return k8s.NewLeaderLock(kubeconfig, leaderElectionNamespace, leaderLockName, identity, leaderLeaseDuration)
+}
+
 func validateConfig() {
-	if r53HostedZone == "" {
-		log.Error("Must supply r53-hosted-zone")
+	if len(r53HostedZones) == 0 && r53InternalZone == "" && r53ExternalZone == "" {
+		log.Error("Must supply r53-hosted-zone, or r53-internal-zone and r53-external-zone")
+		os.Exit(-1)
+	}
+
+	if hostFilter != "" {
+		var err error
+		if hostFilterRegexp, err = regexp.Compile(hostFilter); err != nil {
+			log.Errorf("Invalid host-filter: %v", err)
+			os.Exit(-1)
+		}
+	}
+
+	if namespaceSelector != "" {
+		var err error
+		if namespaceLabelSelector, err = labels.Parse(namespaceSelector); err != nil {
+			log.Errorf("Invalid namespace-selector: %v", err)
+			os.Exit(-1)
+		}
+	}
+
+	if serviceWatchSelector != "" {
+		var err error
+		if serviceSelector, err = labels.Parse(serviceWatchSelector); err != nil {
+			log.Errorf("Invalid service-watch-selector: %v", err)
+			os.Exit(-1)
+		}
+	}
+
+	if recordNameTemplateText != "" {
+		var err error
+		if recordNameTemplate, err = dns.ParseRecordNameTemplate(recordNameTemplateText); err != nil {
+			log.Errorf("Invalid record-name-template: %v", err)
+			os.Exit(-1)
+		}
+	}
+
+	if r53SetIdentifier != "" {
+		var err error
+		if setIdentifierTemplate, err = dns.ParseSetIdentifierTemplate(r53SetIdentifier); err != nil {
+			log.Errorf("Invalid r53-set-identifier: %v", err)
+			os.Exit(-1)
+		}
+	}
+
+	if noDelete && deleteRecordsOnShutdown {
+		log.Error("no-delete can't be used with delete-records-on-shutdown")
 		os.Exit(-1)
 	}
 
-	if elbLabelValue == "" && len(albNames) == 0 && internalHostname == "" && externalHostname == "" {
-		log.Error("Must specify at least one of alb-names, elb-label-value, internal-hostname or external-hostname")
+	if once && (enableLeaderElection || deleteRecordsOnShutdown) {
+		log.Error("Can't use once with leader election or deleting records on shutdown")
 		os.Exit(-1)
 	}
 
-	if (internalHostname != "" || externalHostname != "") && (elbLabelValue != "" || len(albNames) > 0) {
-		log.Error("Can't supply both ELB/ALB and non-ALB/ELB hostname. Choose one or the other.")
+	for _, recordType := range managedRecordTypes {
+		if !isDefaultManagedRecordType(recordType) {
+			log.Errorf("Invalid managed-record-types %q, must be one of %v", recordType, dns.DefaultManagedRecordTypes)
+			os.Exit(-1)
+		}
+	}
+
+	if changeWebhookSecretFile != "" {
+		if changeWebhookURL == "" {
+			log.Error("change-webhook-secret-file requires change-webhook-url")
+			os.Exit(-1)
+		}
+		contents, err := ioutil.ReadFile(changeWebhookSecretFile)
+		if err != nil {
+			log.Errorf("Unable to read change-webhook-secret-file: %v", err)
+			os.Exit(-1)
+		}
+		changeWebhookSecret = strings.TrimSpace(string(contents))
+	}
+
+	provider, err := lookupProvider(dnsProvider)
+	if err != nil {
+		log.Errorf("Invalid dns-provider: %v", err)
 		os.Exit(-1)
 	}
+	if provider.validate != nil {
+		if err := provider.validate(); err != nil {
+			log.Errorf("dns-provider %s: %v", provider.name, err)
+			os.Exit(-1)
+		}
+	}
+
+	if r53SyncTimeout <= 0 {
+		log.Error("r53-sync-timeout must be positive")
+		os.Exit(-1)
+	}
+
+	if r53BatchSize < 1 || r53BatchSize > r53.MaxBatchSize {
+		log.Errorf("r53-batch-size must be between 1 and %d", r53.MaxBatchSize)
+		os.Exit(-1)
+	}
+
+	if maxRecords < 0 {
+		log.Error("max-records can't be negative")
+		os.Exit(-1)
+	}
+
+	if r53ManageHealthChecks {
+		if !provider.capabilities.HealthChecks {
+			log.Errorf("r53-manage-health-checks needs a dns-provider with health checks, such as %s, not %s",
+				route53Provider, provider.name)
+			os.Exit(-1)
+		}
+		if txtOwnerID == "" && clusterName == "" {
+			log.Error("r53-manage-health-checks needs txt-owner-id or cluster-name")
+			os.Exit(-1)
+		}
+	}
+
+	usesELBs := elbLabelValue != "" || len(elbTags) > 0
+	usesLoadBalancers := usesELBs || len(albNames) > 0 || len(nlbNames) > 0 || nlbLabelValue != ""
+
+	if r53AssumeRoleARN, err = assumeRoleARNOf("assume-role-arn", r53AssumeRoleARN, "r53-assume-role-arn",
+		r53AssumeRoleARNAlias); err != nil {
+		log.Error(err)
+		os.Exit(-1)
+	}
+	if lbAssumeRoleARN, err = assumeRoleARNOf("lb-assume-role-arn", lbAssumeRoleARN, "elb-assume-role-arn",
+		lbAssumeRoleARNAlias); err != nil {
+		log.Error(err)
+		os.Exit(-1)
+	}
+
+	partition, err := awspartition.Lookup(awsPartition)
+	if err != nil {
+		log.Errorf("Invalid aws-partition: %v", err)
+		os.Exit(-1)
+	}
+	if !isFlagSet("r53-region") {
+		r53Region = partition.Route53Region
+	}
+	if dnsProvider == route53Provider {
+		if err := partition.ValidateRegion(r53Region); err != nil {
+			log.Errorf("Invalid r53-region: %v", err)
+			os.Exit(-1)
+		}
+	}
+	for flagName, arn := range map[string]string{"assume-role-arn": r53AssumeRoleARN,
+		"lb-assume-role-arn": lbAssumeRoleARN} {
+		if arn == "" {
+			continue
+		}
+		if err := partition.ValidateARN(arn); err != nil {
+			log.Errorf("Invalid %s: %v", flagName, err)
+			os.Exit(-1)
+		}
+	}
+	if usesLoadBalancers {
+		if err := partition.ValidateRegion(elbRegion); err != nil {
+			log.Errorf("Invalid elb-region: %v", err)
+			os.Exit(-1)
+		}
+		if enableCloudFront && partition.CloudFrontHostedZoneID == "" {
+			log.Errorf("Can't use enable-cloudfront in the %s partition, it has no CloudFront", partition.ID)
+			os.Exit(-1)
+		}
+	}
+
+	usesHostnames := internalHostname != "" || externalHostname != "" || len(lbHostnames) > 0
+	usesIPs := len(internalIPs) > 0 || len(externalIPs) > 0
+
+	if useIngressStatus && (usesLoadBalancers || usesHostnames || usesIPs) {
+		log.Error("Can't use use-ingress-status with load balancers, hostnames or IPs. Choose one or the other.")
+		os.Exit(-1)
+	}
+
+	if !useIngressStatus && !usesLoadBalancers && !usesHostnames && !usesIPs {
+		log.Error("Must specify at least one of alb-names, elb-label-value, elb-tags, nlb-names, nlb-label-value, " +
+			"internal-hostname, external-hostname, lb-hostname, internal-ips, external-ips or use-ingress-status")
+		os.Exit(-1)
+	}
+
+	for name, hostname := range lbHostnames.Map() {
+		if name == "" || hostname == "" {
+			log.Errorf("Invalid lb-hostname %q=%q, must be name=hostname", name, hostname)
+			os.Exit(-1)
+		}
+	}
+
+	if (usesHostnames || usesIPs) && usesLoadBalancers {
+		log.Error("Can't supply both ELB/ALB/NLB and non-ELB/ALB/NLB hostname or IPs. Choose one or the other.")
+		os.Exit(-1)
+	}
+
+	if usesHostnames && usesIPs {
+		log.Error("Can't supply both hostnames and IPs for load-balancers. Choose one or the other.")
+		os.Exit(-1)
+	}
+
+	for _, ip := range append(append([]string{}, internalIPs...), externalIPs...) {
+		if parsed := net.ParseIP(ip); parsed == nil || parsed.To4() == nil {
+			log.Errorf("%q is not an IPv4 address", ip)
+			os.Exit(-1)
+		}
+	}
+
+	if (len(nlbNames) > 0 || nlbLabelValue != "") && (usesELBs || len(albNames) > 0) {
+		log.Error("Can't supply NLBs together with ELBs or ALBs. Choose one type of load balancer.")
+		os.Exit(-1)
+	}
+
+	if dnsRecordType != adapter.AliasRecordType && dnsRecordType != adapter.CNAMERecordType {
+		log.Errorf("dns-record-type must be %s or %s, not %q", adapter.AliasRecordType, adapter.CNAMERecordType,
+			dnsRecordType)
+		os.Exit(-1)
+	}
+
+	if (usesHostnames || usesIPs || useIngressStatus) && isFlagSet("dns-record-type") &&
+		dnsRecordType == adapter.AliasRecordType {
+		log.Error("Can't create ALIAS records for internal-hostname, external-hostname, internal-ips, " +
+			"external-ips or use-ingress-status.")
+		os.Exit(-1)
+	}
+
+	if !provider.capabilities.Alias && usesLoadBalancers && dnsRecordType == adapter.AliasRecordType {
+		log.Errorf("dns-provider %s can't create ALIAS records, use dns-record-type %s", provider.name,
+			adapter.CNAMERecordType)
+		os.Exit(-1)
+	}
+
+	if usesLoadBalancers {
+		if dnsRecordType == adapter.AliasRecordType && isFlagSet("cname-ttl") {
+			log.Warn("cname-ttl is ignored as ALIAS records have no TTL.")
+		}
+		if isFlagSet("internal-cname-ttl") || isFlagSet("external-cname-ttl") {
+			log.Warn("internal-cname-ttl and external-cname-ttl are only used with internal-hostname and " +
+				"external-hostname, use cname-ttl instead.")
+		}
+	}
+}
+
+func isDefaultManagedRecordType(recordType string) bool {
+	for _, managed := range dns.DefaultManagedRecordTypes {
+		if strings.EqualFold(recordType, managed) {
+			return true
+		}
+	}
+	return false
+}
+
+// assumeRoleARNOf returns the role of a flag or its alias. It fails if they're set to different roles, as it isn't
+// clear which should be assumed.
+func assumeRoleARNOf(name, arn, aliasName, alias string) (string, error) {
+	if alias == "" {
+		return arn, nil
+	}
+	if arn != "" && arn != alias {
+		return "", fmt.Errorf("%s and %s are the same flag, but are set to different roles, %s and %s",
+			name, aliasName, arn, alias)
+	}
+	return alias, nil
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
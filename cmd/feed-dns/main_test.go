@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssumeRoleARNOfAcceptsAFlagOrItsAliasButNotDifferentRoles(t *testing.T) {
+	const role = "arn:aws:iam::123456789012:role/dns"
+	const other = "arn:aws:iam::123456789012:role/other"
+
+	var tests = []struct {
+		name          string
+		arn, alias    string
+		expected      string
+		expectedError string
+	}{
+		{"Neither", "", "", "", ""},
+		{"Flag", role, "", role, ""},
+		{"Alias", "", role, role, ""},
+		{"Both the same", role, role, role, ""},
+		{"Different roles", role, other, "",
+			"assume-role-arn and r53-assume-role-arn are the same flag, but are set to different roles, " + role +
+				" and " + other},
+	}
+
+	for _, test := range tests {
+		fmt.Printf("=== test: %s\n", test.name)
+		arn, err := assumeRoleARNOf("assume-role-arn", test.arn, "r53-assume-role-arn", test.alias)
+		if test.expectedError == "" {
+			assert.NoError(t, err, test.name)
+			assert.Equal(t, test.expected, arn, test.name)
+		} else {
+			assert.EqualError(t, err, test.expectedError, test.name)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/k8s"
+	"github.com/sky-uk/feed/util/cmd"
+)
+
+// plan prints the records feed-dns computes for the ingresses and services in a file of manifests as JSON, without
+// connecting to the apiserver. It takes the same flags as feed-dns, plus -from-file. Nothing is changed, as in
+// -dry-run, and the changes which would be made are logged to stderr.
+func plan(args []string) {
+	var fromFile string
+	flag.StringVar(&fromFile, "from-file", "",
+		"File of YAML or JSON ingress and service manifests to plan the records of.")
+	flag.CommandLine.Parse(args)
+	loadConfigFile()
+	if fromFile == "" {
+		log.Error("Must supply from-file")
+		os.Exit(-1)
+	}
+	validateConfig()
+
+	if err := cmd.ConfigureLogging(debug, logFormat); err != nil {
+		log.Fatal(err)
+	}
+	// Stdout is the plan.
+	log.SetOutput(os.Stderr)
+	cmd.ConfigureMetrics("feed-dns", pushgatewayLabels, "", 0)
+
+	client, err := k8s.NewFromFile(fromFile, ingressClass)
+	if err != nil {
+		log.Fatal("Unable to read manifests: ", err)
+	}
+
+	lbAdapter, err := createFrontendAdapter()
+	if err != nil {
+		log.Fatal("Error during initialisation: ", err)
+	}
+	dnsUpdater, err := createDNSUpdater(lbAdapter, nil)
+	if err != nil {
+		log.Fatal("Unable to create dns updater: ", err)
+	}
+
+	planner := controller.New(controller.Config{
+		KubernetesClient: client,
+		Updaters:         []controller.Updater{dnsUpdater},
+		DryRun:           true,
+	})
+	if err := updateOnce(client, planner); err != nil {
+		log.Fatal("Unable to plan records: ", err)
+	}
+
+	plan, err := json.MarshalIndent(dnsUpdater.(dns.RecordLister).Records(), "", "  ")
+	if err != nil {
+		log.Fatal("Unable to print plan: ", err)
+	}
+	fmt.Println(string(plan))
+}
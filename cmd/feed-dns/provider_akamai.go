@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/akamai"
+)
+
+const akamaiProvider = "akamai"
+
+var (
+	akamaiHost             string
+	akamaiClientToken      string
+	akamaiClientSecretFile string
+	akamaiClientSecret     string
+	akamaiAccessTokenFile  string
+	akamaiAccessToken      string
+)
+
+var _ = registerProvider(provider{
+	name: akamaiProvider,
+	flags: func() {
+		flag.StringVar(&akamaiHost, "akamai-host", "",
+			"Host of the EdgeGrid credentials of the Akamai API client, e.g. akab-xxx.luna.akamaiapis.net, for "+
+				"dns-provider "+akamaiProvider+".")
+		flag.StringVar(&akamaiClientToken, "akamai-client-token", "",
+			"Client token of the EdgeGrid credentials of the Akamai API client, for dns-provider "+
+				akamaiProvider+".")
+		flag.StringVar(&akamaiClientSecretFile, "akamai-client-secret-file", "",
+			"File containing the client secret of the EdgeGrid credentials of the Akamai API client, for "+
+				"dns-provider "+akamaiProvider+".")
+		flag.StringVar(&akamaiAccessTokenFile, "akamai-access-token-file", "",
+			"File containing the access token of the EdgeGrid credentials of the Akamai API client, for "+
+				"dns-provider "+akamaiProvider+".")
+	},
+	validate: func() (err error) {
+		if err = requireFlag("akamai-host", akamaiHost); err != nil {
+			return err
+		}
+		if err = requireFlag("akamai-client-token", akamaiClientToken); err != nil {
+			return err
+		}
+		if akamaiClientSecret, err = readCredentialFile("akamai-client-secret-file",
+			akamaiClientSecretFile); err != nil {
+			return err
+		}
+		akamaiAccessToken, err = readCredentialFile("akamai-access-token-file", akamaiAccessTokenFile)
+		return err
+	},
+	newUpdater: func(lbAdapter adapter.FrontendAdapter, config dns.Config) (controller.Updater, error) {
+		return akamai.NewUpdater(lbAdapter, config, akamai.Config{
+			Host:         akamaiHost,
+			ClientToken:  akamaiClientToken,
+			ClientSecret: akamaiClientSecret,
+			AccessToken:  akamaiAccessToken,
+		}), nil
+	},
+	capabilities: akamai.Capabilities,
+})
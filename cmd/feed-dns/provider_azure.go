@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/azuredns"
+)
+
+const azureProvider = "azure"
+
+var (
+	azureTenantID         string
+	azureClientID         string
+	azureClientSecretFile string
+	azureClientSecret     string
+	azureSubscriptionID   string
+	azureResourceGroup    string
+	azureLoginURL         string
+	azureManagementURL    string
+)
+
+var _ = registerProvider(provider{
+	name: azureProvider,
+	flags: func() {
+		flag.StringVar(&azureTenantID, "azure-tenant-id", "",
+			"Tenant id of the Azure service principal, for dns-provider "+azureProvider+".")
+		flag.StringVar(&azureClientID, "azure-client-id", "",
+			"Client id of the Azure service principal, for dns-provider "+azureProvider+".")
+		flag.StringVar(&azureClientSecretFile, "azure-client-secret-file", "",
+			"File containing the client secret of the Azure service principal, for dns-provider "+
+				azureProvider+".")
+		flag.StringVar(&azureSubscriptionID, "azure-subscription-id", "",
+			"Id of the Azure subscription of the DNS zones, for dns-provider "+azureProvider+".")
+		flag.StringVar(&azureResourceGroup, "azure-resource-group", "",
+			"Resource group of the Azure DNS zones, for dns-provider "+azureProvider+".")
+		flag.StringVar(&azureLoginURL, "azure-login-url", azuredns.DefaultLoginURL,
+			"URL of Azure Active Directory, e.g. for other Azure clouds, for dns-provider "+azureProvider+".")
+		flag.StringVar(&azureManagementURL, "azure-management-url", azuredns.DefaultManagementURL,
+			"URL of Azure Resource Manager, e.g. for other Azure clouds, for dns-provider "+azureProvider+".")
+	},
+	validate: func() (err error) {
+		for _, flag := range []struct{ name, value string }{
+			{"azure-tenant-id", azureTenantID},
+			{"azure-client-id", azureClientID},
+			{"azure-subscription-id", azureSubscriptionID},
+			{"azure-resource-group", azureResourceGroup},
+		} {
+			if err = requireFlag(flag.name, flag.value); err != nil {
+				return err
+			}
+		}
+		azureClientSecret, err = readCredentialFile("azure-client-secret-file", azureClientSecretFile)
+		return err
+	},
+	newUpdater: func(lbAdapter adapter.FrontendAdapter, config dns.Config) (controller.Updater, error) {
+		return azuredns.NewUpdater(lbAdapter, config, azuredns.Config{
+			TenantID:       azureTenantID,
+			ClientID:       azureClientID,
+			ClientSecret:   azureClientSecret,
+			SubscriptionID: azureSubscriptionID,
+			ResourceGroup:  azureResourceGroup,
+			LoginURL:       azureLoginURL,
+			ManagementURL:  azureManagementURL,
+		}), nil
+	},
+	capabilities: azuredns.Capabilities,
+})
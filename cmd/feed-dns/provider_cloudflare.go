@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/cloudflare"
+)
+
+const cloudflareProvider = "cloudflare"
+
+var (
+	cloudflareTokenFile string
+	cloudflareToken     string
+	cloudflareProxied   bool
+	cloudflareAPIURL    string
+)
+
+var _ = registerProvider(provider{
+	name: cloudflareProvider,
+	flags: func() {
+		flag.StringVar(&cloudflareTokenFile, "cloudflare-api-token-file", "",
+			"File containing a Cloudflare API token with permission to edit the zones' DNS records, for "+
+				"dns-provider "+cloudflareProvider+", whose hosted zone ids are Cloudflare zone ids.")
+		flag.BoolVar(&cloudflareProxied, "cloudflare-proxied", false,
+			"Proxy the CNAME, A and AAAA records feed-dns creates through Cloudflare, for dns-provider "+
+				cloudflareProvider+".")
+		flag.StringVar(&cloudflareAPIURL, "cloudflare-api-url", cloudflare.DefaultAPIURL,
+			"URL of the Cloudflare v4 API, for dns-provider "+cloudflareProvider+".")
+	},
+	validate: func() (err error) {
+		cloudflareToken, err = readCredentialFile("cloudflare-api-token-file", cloudflareTokenFile)
+		return err
+	},
+	newUpdater: func(lbAdapter adapter.FrontendAdapter, config dns.Config) (controller.Updater, error) {
+		return cloudflare.NewUpdater(lbAdapter, config, cloudflare.Config{
+			Token:   cloudflareToken,
+			Proxied: cloudflareProxied,
+			APIURL:  cloudflareAPIURL,
+		}), nil
+	},
+	capabilities: cloudflare.Capabilities,
+})
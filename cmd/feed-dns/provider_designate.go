@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/designate"
+)
+
+const designateProvider = "designate"
+
+var (
+	designateAuthURL       string
+	designateUsername      string
+	designatePasswordFile  string
+	designatePassword      string
+	designateUserDomain    string
+	designateProject       string
+	designateProjectDomain string
+	designateRegion        string
+)
+
+var _ = registerProvider(provider{
+	name: designateProvider,
+	flags: func() {
+		flag.StringVar(&designateAuthURL, "designate-auth-url", "",
+			"URL of the Keystone identity API, e.g. https://keystone:5000/v3, for dns-provider "+
+				designateProvider+".")
+		flag.StringVar(&designateUsername, "designate-username", "",
+			"Name of the OpenStack user, for dns-provider "+designateProvider+".")
+		flag.StringVar(&designatePasswordFile, "designate-password-file", "",
+			"File containing the password of the OpenStack user, for dns-provider "+designateProvider+".")
+		flag.StringVar(&designateUserDomain, "designate-user-domain", designate.DefaultDomain,
+			"Keystone domain of the OpenStack user, for dns-provider "+designateProvider+".")
+		flag.StringVar(&designateProject, "designate-project", "",
+			"Name of the OpenStack project of the Designate zones, for dns-provider "+designateProvider+".")
+		flag.StringVar(&designateProjectDomain, "designate-project-domain", designate.DefaultDomain,
+			"Keystone domain of the OpenStack project, for dns-provider "+designateProvider+".")
+		flag.StringVar(&designateRegion, "designate-region", "",
+			"OpenStack region of the Designate endpoint, or any region if empty, for dns-provider "+
+				designateProvider+".")
+	},
+	validate: func() (err error) {
+		for _, flag := range []struct{ name, value string }{
+			{"designate-auth-url", designateAuthURL},
+			{"designate-username", designateUsername},
+			{"designate-project", designateProject},
+		} {
+			if err = requireFlag(flag.name, flag.value); err != nil {
+				return err
+			}
+		}
+		designatePassword, err = readCredentialFile("designate-password-file", designatePasswordFile)
+		return err
+	},
+	newUpdater: func(lbAdapter adapter.FrontendAdapter, config dns.Config) (controller.Updater, error) {
+		return designate.NewUpdater(lbAdapter, config, designate.Config{
+			AuthURL:       designateAuthURL,
+			Username:      designateUsername,
+			Password:      designatePassword,
+			UserDomain:    designateUserDomain,
+			Project:       designateProject,
+			ProjectDomain: designateProjectDomain,
+			Region:        designateRegion,
+		}), nil
+	},
+	capabilities: designate.Capabilities,
+})
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/digitalocean"
+)
+
+const digitalOceanProvider = "digitalocean"
+
+var (
+	digitalOceanTokenFile string
+	digitalOceanToken     string
+	digitalOceanAPIURL    string
+)
+
+var _ = registerProvider(provider{
+	name: digitalOceanProvider,
+	flags: func() {
+		flag.StringVar(&digitalOceanTokenFile, "digitalocean-api-token-file", "",
+			"File containing the DigitalOcean API token, for dns-provider "+digitalOceanProvider+".")
+		flag.StringVar(&digitalOceanAPIURL, "digitalocean-api-url", digitalocean.DefaultAPIURL,
+			"URL of the DigitalOcean API, for dns-provider "+digitalOceanProvider+".")
+	},
+	validate: func() (err error) {
+		digitalOceanToken, err = readCredentialFile("digitalocean-api-token-file", digitalOceanTokenFile)
+		return err
+	},
+	newUpdater: func(lbAdapter adapter.FrontendAdapter, config dns.Config) (controller.Updater, error) {
+		return digitalocean.NewUpdater(lbAdapter, config, digitalocean.Config{Token: digitalOceanToken,
+			APIURL: digitalOceanAPIURL}), nil
+	},
+	capabilities: digitalocean.Capabilities,
+})
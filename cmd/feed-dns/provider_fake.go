@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+)
+
+const fakeProvider = "fake"
+
+// The fake provider holds the hosted zones in memory, so it needs no flags or credentials.
+var _ = registerProvider(provider{
+	name: fakeProvider,
+	newUpdater: func(lbAdapter adapter.FrontendAdapter, config dns.Config) (controller.Updater, error) {
+		config.InMemory = true
+		return dns.New(lbAdapter, config), nil
+	},
+	capabilities: r53.InMemoryCapabilities,
+})
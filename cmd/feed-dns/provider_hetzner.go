@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/hetzner"
+)
+
+const hetznerProvider = "hetzner"
+
+var (
+	hetznerTokenFile string
+	hetznerToken     string
+	hetznerAPIURL    string
+)
+
+var _ = registerProvider(provider{
+	name: hetznerProvider,
+	flags: func() {
+		flag.StringVar(&hetznerTokenFile, "hetzner-api-token-file", "",
+			"File containing the Hetzner DNS API token, for dns-provider "+hetznerProvider+".")
+		flag.StringVar(&hetznerAPIURL, "hetzner-api-url", hetzner.DefaultAPIURL,
+			"URL of the Hetzner DNS API, for dns-provider "+hetznerProvider+".")
+	},
+	validate: func() (err error) {
+		hetznerToken, err = readCredentialFile("hetzner-api-token-file", hetznerTokenFile)
+		return err
+	},
+	newUpdater: func(lbAdapter adapter.FrontendAdapter, config dns.Config) (controller.Updater, error) {
+		return hetzner.NewUpdater(lbAdapter, config, hetzner.Config{Token: hetznerToken, APIURL: hetznerAPIURL}), nil
+	},
+	capabilities: hetzner.Capabilities,
+})
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/ns1"
+)
+
+const ns1Provider = "ns1"
+
+var (
+	ns1APIKeyFile string
+	ns1APIKey     string
+	ns1APIURL     string
+)
+
+var _ = registerProvider(provider{
+	name: ns1Provider,
+	flags: func() {
+		flag.StringVar(&ns1APIKeyFile, "ns1-api-key-file", "",
+			"File containing the NS1 API key, for dns-provider "+ns1Provider+".")
+		flag.StringVar(&ns1APIURL, "ns1-api-url", ns1.DefaultAPIURL,
+			"URL of the NS1 API, e.g. of a private NS1 deployment, for dns-provider "+ns1Provider+".")
+	},
+	validate: func() (err error) {
+		ns1APIKey, err = readCredentialFile("ns1-api-key-file", ns1APIKeyFile)
+		return err
+	},
+	newUpdater: func(lbAdapter adapter.FrontendAdapter, config dns.Config) (controller.Updater, error) {
+		return ns1.NewUpdater(lbAdapter, config, ns1.Config{APIKey: ns1APIKey, APIURL: ns1APIURL}), nil
+	},
+	capabilities: ns1.Capabilities,
+})
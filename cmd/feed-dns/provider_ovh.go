@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/ovh"
+)
+
+const ovhProvider = "ovh"
+
+var (
+	ovhApplicationKey        string
+	ovhApplicationSecretFile string
+	ovhApplicationSecret     string
+	ovhConsumerKeyFile       string
+	ovhConsumerKey           string
+	ovhEndpoint              string
+)
+
+var _ = registerProvider(provider{
+	name: ovhProvider,
+	flags: func() {
+		flag.StringVar(&ovhApplicationKey, "ovh-application-key", "",
+			"Application key of the OVH API, for dns-provider "+ovhProvider+".")
+		flag.StringVar(&ovhApplicationSecretFile, "ovh-application-secret-file", "",
+			"File containing the application secret of the OVH API, for dns-provider "+ovhProvider+".")
+		flag.StringVar(&ovhConsumerKeyFile, "ovh-consumer-key-file", "",
+			"File containing a consumer key of the OVH API with access to the zones, for dns-provider "+
+				ovhProvider+".")
+		flag.StringVar(&ovhEndpoint, "ovh-endpoint", ovh.DefaultEndpoint,
+			"URL of the OVH API, e.g. https://ca.api.ovh.com/1.0 for OVH Canada, for dns-provider "+ovhProvider+".")
+	},
+	validate: func() (err error) {
+		if err = requireFlag("ovh-application-key", ovhApplicationKey); err != nil {
+			return err
+		}
+		if ovhApplicationSecret, err = readCredentialFile("ovh-application-secret-file",
+			ovhApplicationSecretFile); err != nil {
+			return err
+		}
+		ovhConsumerKey, err = readCredentialFile("ovh-consumer-key-file", ovhConsumerKeyFile)
+		return err
+	},
+	newUpdater: func(lbAdapter adapter.FrontendAdapter, config dns.Config) (controller.Updater, error) {
+		return ovh.NewUpdater(lbAdapter, config, ovh.Config{
+			ApplicationKey:    ovhApplicationKey,
+			ApplicationSecret: ovhApplicationSecret,
+			ConsumerKey:       ovhConsumerKey,
+			Endpoint:          ovhEndpoint,
+		}), nil
+	},
+	capabilities: ovh.Capabilities,
+})
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/powerdns"
+)
+
+const powerDNSProvider = "powerdns"
+
+var (
+	powerDNSAPIURL     string
+	powerDNSAPIKeyFile string
+	powerDNSAPIKey     string
+	powerDNSServerID   string
+)
+
+var _ = registerProvider(provider{
+	name: powerDNSProvider,
+	flags: func() {
+		flag.StringVar(&powerDNSAPIURL, "powerdns-api-url", "",
+			"URL of the PowerDNS HTTP API, e.g. http://pdns:8081, for dns-provider "+powerDNSProvider+".")
+		flag.StringVar(&powerDNSAPIKeyFile, "powerdns-api-key-file", "",
+			"File containing the PowerDNS API key, for dns-provider "+powerDNSProvider+".")
+		flag.StringVar(&powerDNSServerID, "powerdns-server-id", powerdns.DefaultServerID,
+			"Server id of the PowerDNS HTTP API, for dns-provider "+powerDNSProvider+".")
+	},
+	validate: func() (err error) {
+		if err = requireFlag("powerdns-api-url", powerDNSAPIURL); err != nil {
+			return err
+		}
+		powerDNSAPIKey, err = readCredentialFile("powerdns-api-key-file", powerDNSAPIKeyFile)
+		return err
+	},
+	newUpdater: func(lbAdapter adapter.FrontendAdapter, config dns.Config) (controller.Updater, error) {
+		return powerdns.NewUpdater(lbAdapter, config, powerdns.Config{
+			APIURL:   powerDNSAPIURL,
+			APIKey:   powerDNSAPIKey,
+			ServerID: powerDNSServerID,
+		}), nil
+	},
+	capabilities: powerdns.Capabilities,
+})
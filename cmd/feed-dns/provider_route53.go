@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+)
+
+const route53Provider = "route53"
+
+// Route53 is configured by the AWS flags shared with load balancer discovery, and the r53- flags defined in init.
+var _ = registerProvider(provider{
+	name: route53Provider,
+	newUpdater: func(lbAdapter adapter.FrontendAdapter, config dns.Config) (controller.Updater, error) {
+		config.Route53 = route53Config()
+		return dns.New(lbAdapter, config), nil
+	},
+	capabilities: r53.Route53Capabilities,
+})
+
+// route53Config is the config of Route53 clients.
+func route53Config() r53.Config {
+	return r53.Config{
+		Retries:        awsAPIRetries,
+		RetryBaseDelay: awsRetryBaseDelay,
+		RetryMaxDelay:  awsRetryMaxDelay,
+		BatchSize:      r53BatchSize,
+		WaitForSync:    r53WaitForSync,
+		SyncTimeout:    r53SyncTimeout,
+		AssumeRoleARN:  r53AssumeRoleARN,
+		Partition:      awsPartition,
+		Region:         r53Region,
+		EndpointURL:    awsEndpointURL,
+		UserAgent:      userAgent,
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+)
+
+// provider is a DNS provider of -dns-provider. Each provider is in its own provider_<name>.go file, with the
+// variables of its flags, and adds itself to the registry with registerProvider.
+type provider struct {
+	// name is the value of -dns-provider selecting the provider.
+	name string
+	// flags, if set, defines the flags of the provider. It's called before the flags are parsed.
+	flags func()
+	// validate, if set, checks the flags the provider needs once they're parsed, reading its credential files.
+	validate func() error
+	// newUpdater creates the dns updater of the hosted zones of the config, with clients of the provider.
+	newUpdater func(lbAdapter adapter.FrontendAdapter, config dns.Config) (controller.Updater, error)
+	// capabilities are those the provider's clients declare, so flags can be checked against them.
+	capabilities r53.Capabilities
+}
+
+// providers is the registry of DNS providers by name.
+var providers = make(map[string]provider)
+
+// registerProvider adds a provider to the registry. Providers register themselves as package variables are
+// initialised, so they're all registered before init defines the flags.
+func registerProvider(p provider) provider {
+	if _, exists := providers[p.name]; exists {
+		panic("dns-provider " + p.name + " is registered twice")
+	}
+	providers[p.name] = p
+	return p
+}
+
+// defineProviderFlags defines the flags of every provider.
+func defineProviderFlags() {
+	for _, name := range providerNames() {
+		if flags := providers[name].flags; flags != nil {
+			flags()
+		}
+	}
+}
+
+// lookupProvider returns the provider of a -dns-provider.
+func lookupProvider(name string) (provider, error) {
+	p, ok := providers[name]
+	if !ok {
+		return provider{}, fmt.Errorf("must be one of %s, not %q", strings.Join(providerNames(), ", "), name)
+	}
+	return p, nil
+}
+
+// providerNames are the names of the providers, in alphabetical order.
+func providerNames() []string {
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// requireFlag fails if a flag the provider needs isn't set.
+func requireFlag(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("requires %s", name)
+	}
+	return nil
+}
+
+// readCredentialFile reads the credential in the file of a flag the provider needs.
+func readCredentialFile(name, path string) (string, error) {
+	if err := requireFlag(name, path); err != nil {
+		return "", err
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read %s: %v", name, err)
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+func TestEveryProviderIsRegisteredWithAnUpdaterAndCapabilities(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{"akamai", "azure", "cloudflare", "designate", "digitalocean", "fake", "hetzner", "ns1",
+		"ovh", "powerdns", "route53"}, providerNames())
+
+	for _, name := range providerNames() {
+		p, err := lookupProvider(name)
+		assert.NoError(err)
+		assert.Equal(name, p.name)
+		assert.NotNil(p.newUpdater, name)
+		assert.NotEmpty(p.capabilities.Provider, name)
+	}
+}
+
+func TestLookupProviderFailsForUnknownProviders(t *testing.T) {
+	_, err := lookupProvider("bind")
+
+	assert.EqualError(t, err, `must be one of akamai, azure, cloudflare, designate, digitalocean, fake, hetzner, `+
+		`ns1, ovh, powerdns, route53, not "bind"`)
+}
+
+func TestProvidersCreateUpdatersWithTheirOwnClients(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{"internal": "lb.example.net"}, time.Minute, nil)
+	config := dns.Config{HostedZoneIDs: []string{"example.com"}}
+
+	for _, name := range []string{fakeProvider, hetznerProvider, cloudflareProvider} {
+		// when
+		p, _ := lookupProvider(name)
+		updater, err := p.newUpdater(lbAdapter, config)
+
+		// then
+		assert.NoError(err)
+		assert.Equal(p.capabilities, capabilitiesOf(updater), name)
+	}
+}
+
+func capabilitiesOf(updater controller.Updater) r53.Capabilities {
+	return updater.(dns.CapabilityReporter).Capabilities().Capabilities
+}
+
+func TestFakeProviderComputesRecordsWithoutCredentials(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{"internal": "lb.example.net"}, time.Minute, nil)
+	p, _ := lookupProvider(fakeProvider)
+	updater, err := p.newUpdater(lbAdapter, dns.Config{HostedZoneIDs: []string{"example.com"}})
+	assert.NoError(err)
+
+	// when
+	assert.NoError(updater.Start())
+	assert.NoError(updater.Update(controller.IngressEntries{
+		{Namespace: "default", Name: "foo", Host: "foo.example.com", LbScheme: "internal"},
+	}))
+
+	// then
+	assert.Equal([]dns.Record{{Zone: "example.com.", Host: "foo.example.com.", Type: "CNAME",
+		Target: "lb.example.net", TTL: 60}}, updater.(dns.RecordLister).Records())
+}
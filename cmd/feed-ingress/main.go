@@ -20,15 +20,19 @@ import (
 	"github.com/sky-uk/feed/nginx"
 	"github.com/sky-uk/feed/util/cmd"
 	"github.com/sky-uk/feed/util/metrics"
+	"github.com/sky-uk/feed/util/tracing"
 )
 
 var (
 	debug                          bool
-	kubeconfig                     string
+	logFormat                      string
+	kubeconfig                     k8s.Kubeconfig
 	resyncPeriod                   time.Duration
+	resyncJitter                   float64
 	ingressPort                    int
 	ingressHTTPSPort               int
 	ingressHealthPort              int
+	healthBindAddress              string
 	healthPort                     int
 	region                         string
 	elbLabelValue                  string
@@ -38,6 +42,9 @@ var (
 	targetGroupDeregistrationDelay time.Duration
 	pushgatewayURL                 string
 	pushgatewayIntervalSeconds     int
+	metricsListen                  string
+	reconcileTokenFile             string
+	otelEndpoint                   string
 	pushgatewayLabels              cmd.KeyValues
 	controllerConfig               controller.Config
 	nginxConfig                    nginx.Conf
@@ -138,10 +145,17 @@ func init() {
 	// general flags
 	flag.BoolVar(&debug, "debug", false,
 		"Enable debug logging.")
-	flag.StringVar(&kubeconfig, "kubeconfig", "",
+	flag.StringVar(&logFormat, "log-format", cmd.TextLogFormat,
+		"Format of log output, either "+cmd.TextLogFormat+" or "+cmd.JSONLogFormat+".")
+	flag.StringVar(&kubeconfig.Path, "kubeconfig", "",
 		"Path to kubeconfig for connecting to the apiserver. Leave blank to connect inside a cluster.")
+	flag.StringVar(&kubeconfig.Context, "kube-context", "",
+		"Context of the kubeconfig to connect to the apiserver with. Leave blank to use the current context.")
 	flag.DurationVar(&resyncPeriod, "resync-period", defaultResyncPeriod,
 		"Resync with the apiserver periodically to handle missed updates.")
+	flag.Float64Var(&resyncJitter, "resync-jitter", 0,
+		"Fraction of the resync period to randomly add to it, e.g. 0.2 to resync every 15-18m, so replicas "+
+			"don't resync at the same time.")
 	flag.IntVar(&ingressPort, "ingress-port", defaultIngressPort,
 		"Port to serve ingress traffic to backend services.")
 	flag.IntVar(&ingressHTTPSPort, "ingress-https-port", defaultIngressHTTPSPort,
@@ -158,6 +172,9 @@ func init() {
 			"limitations. URL encoded characters will not work correctly in some cases, and backend services will "+
 			"need to take care to properly construct URLs, such as by using the 'X-Original-URI' header."+
 			"Can be overridden with the sky.uk/strip-path annotation per ingress")
+	flag.StringVar(&healthBindAddress, "health-bind-address", "",
+		"Address to bind the health port to, e.g. 127.0.0.1 to only serve it on loopback. Leave blank to bind to "+
+			"all interfaces.")
 	flag.IntVar(&healthPort, "health-port", defaultHealthPort,
 		"Port for checking the health of the ingress controller on /health. Also provides /debug/pprof.")
 
@@ -193,6 +210,19 @@ func init() {
 	flag.IntVar(&controllerConfig.DefaultProxyBufferBlocks, "nginx-default-proxy-buffer-blocks",
 		defaultNginxProxyBufferBlocks,
 		"Proxy buffer blocks for response. Can be overridden per ingress with the sky.uk/proxy-buffer-blocks annotation.")
+	flag.DurationVar(&controllerConfig.ReconcileBackoffInitial, "reconcile-backoff-initial",
+		controller.DefaultReconcileBackoffInitial,
+		"Delay before retrying a failed update, doubling after each consecutive failure.")
+	flag.DurationVar(&controllerConfig.ReconcileBackoffMax, "reconcile-backoff-max", controller.DefaultReconcileBackoffMax,
+		"Maximum delay between retries of a failed update.")
+	flag.IntVar(&controllerConfig.UpdaterConcurrency, "updater-concurrency", 0,
+		"Maximum number of updaters updated at the same time. Leave as 0 to update all of them at once.")
+	flag.StringVar(&otelEndpoint, "otel-endpoint", "",
+		"OpenTelemetry collector OTLP/HTTP endpoint to export traces of each update to, e.g. "+
+			"http://otel-collector:4318. Leave blank to disable tracing.")
+	flag.StringVar(&reconcileTokenFile, "reconcile-token-file", "",
+		"File containing a token for POST /reconcile on the health port, which updates straight away. "+
+			"Leave blank to disable the endpoint.")
 	flag.StringVar(&nginxConfig.LogLevel, "nginx-loglevel", defaultNginxLogLevel,
 		"Log level for nginx. See http://nginx.org/en/docs/ngx_core_module.html#error_log for levels.")
 	flag.IntVar(&nginxConfig.ServerNamesHashBucketSize, "nginx-server-names-hash-bucket-size", defaultNginxServerNamesHashBucketSize,
@@ -252,6 +282,9 @@ func init() {
 		"Interval in seconds for pushing metrics.")
 	flag.Var(&pushgatewayLabels, "pushgateway-label",
 		"A label=value pair to attach to metrics pushed to prometheus. Specify multiple times for multiple labels.")
+	flag.StringVar(&metricsListen, "metrics-listen", "",
+		"Address to serve metrics on for Prometheus to scrape, e.g. :9090. Leave blank to only serve metrics on "+
+			"the health port. Can be used together with pushgateway.")
 
 	// gorb flags
 	flag.StringVar(&gorbEndpoint, "gorb-endpoint", defaultGorbEndpoint, "Define the endpoint to talk to gorb for registration.")
@@ -307,10 +340,13 @@ func init() {
 func main() {
 	flag.Parse()
 
-	cmd.ConfigureLogging(debug)
+	if err := cmd.ConfigureLogging(debug, logFormat); err != nil {
+		log.Fatal(err)
+	}
 	cmd.ConfigureMetrics("feed-ingress", pushgatewayLabels, pushgatewayURL, pushgatewayIntervalSeconds)
+	cmd.AddMetricsListener(metricsListen)
 
-	client, err := k8s.New(kubeconfig, resyncPeriod)
+	client, err := k8s.New(kubeconfig, k8s.JitterResyncPeriod(resyncPeriod, resyncJitter))
 	if err != nil {
 		log.Fatal("Unable to create k8s client: ", err)
 	}
@@ -326,10 +362,16 @@ func main() {
 		controllerConfig.DefaultBackendTimeoutSeconds = legacyBackendKeepaliveSeconds
 	}
 
+	controllerConfig.Tracer = tracing.New(otelEndpoint, "feed-ingress")
 	feedController := controller.New(controllerConfig)
 
 	cmd.AddHealthMetrics(feedController, metrics.PrometheusIngressSubsystem)
-	cmd.AddHealthPort(feedController, healthPort)
+	if err := cmd.AddReconcileEndpoint(feedController, reconcileTokenFile); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.AddHealthPort(feedController, healthBindAddress, healthPort); err != nil {
+		log.Fatal(err)
+	}
 	cmd.AddSignalHandler(feedController)
 
 	if err = feedController.Start(); err != nil {
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// backoff calculates the delay before retrying a failed update. The delay doubles after each consecutive
+// failure, up to max, and is jittered so replicas of a controller don't retry in lockstep.
+type backoff struct {
+	sync.Mutex
+	initial  time.Duration
+	max      time.Duration
+	failures int
+	delay    time.Duration
+}
+
+func newBackoff(initial, max time.Duration) *backoff {
+	return &backoff{initial: initial, max: max}
+}
+
+// next records a failure and returns the delay before retrying.
+func (b *backoff) next() time.Duration {
+	b.Lock()
+	defer b.Unlock()
+
+	ceiling := b.initial
+	for i := 0; i < b.failures && ceiling < b.max; i++ {
+		ceiling *= 2
+	}
+	if ceiling > b.max {
+		ceiling = b.max
+	}
+	b.failures++
+	// Use a random delay between half and all of the ceiling.
+	b.delay = ceiling/2 + time.Duration(rand.Int63n(int64(ceiling/2)+1))
+	return b.delay
+}
+
+// reset the backoff after a successful update.
+func (b *backoff) reset() {
+	b.Lock()
+	defer b.Unlock()
+	b.failures = 0
+	b.delay = 0
+}
+
+// state returns the number of consecutive failures and the current retry delay.
+func (b *backoff) state() (int, time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	return b.failures, b.delay
+}
@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffDoublesUpToMaxAndResets(t *testing.T) {
+	assert := assert.New(t)
+	b := newBackoff(time.Second, 4*time.Second)
+
+	for _, ceiling := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		delay := b.next()
+		assert.True(delay >= ceiling/2 && delay <= ceiling, "%v should be jittered within %v", delay, ceiling)
+	}
+	failures, _ := b.state()
+	assert.Equal(4, failures)
+
+	b.reset()
+	failures, delay := b.state()
+	assert.Equal(0, failures)
+	assert.Equal(time.Duration(0), delay)
+	assert.True(b.next() <= time.Second, "should restart from the initial delay")
+}
@@ -10,10 +10,12 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/k8s"
 	"github.com/sky-uk/feed/util"
+	"github.com/sky-uk/feed/util/tracing"
 	"k8s.io/client-go/pkg/api/v1"
 )
 
@@ -31,6 +33,14 @@ const (
 	proxyBufferSizeAnnotation     = "sky.uk/proxy-buffer-size-in-kb"
 	proxyBufferBlocksAnnotation   = "sky.uk/proxy-buffer-blocks"
 
+	defaultLeaderRetryPeriod = 5 * time.Second
+	defaultDrainTimeout      = 20 * time.Second
+
+	// DefaultReconcileBackoffInitial is the default delay before retrying a failed update.
+	DefaultReconcileBackoffInitial = time.Second
+	// DefaultReconcileBackoffMax is the default maximum delay between retries of a failed update.
+	DefaultReconcileBackoffMax = 5 * time.Minute
+
 	maxAllowedProxyBufferSize   = 32
 	maxAllowedProxyBufferBlocks = 8
 
@@ -46,6 +56,17 @@ type Controller interface {
 	Stop() error
 	// Healthy returns true for a healthy controller, false for unhealthy.
 	Health() error
+	// UpdaterHealth returns the current health of each updater by name, nil if healthy.
+	UpdaterHealth() map[string]error
+	// SyncStatus returns whether the initial sync with the apiserver has completed, when an update last succeeded,
+	// zero if none have, and the error of the last failed update, kept after later updates succeed.
+	SyncStatus() (synced bool, lastSuccess time.Time, lastErr error)
+	// Ready returns nil once the controller has updated its updaters at least once, after syncing with the
+	// apiserver. A controller which isn't the leader is ready as soon as it starts, as it doesn't update.
+	Ready() error
+	// Reconcile updates the updaters straight away, blocking until the update completes. Requests made while
+	// another update is in progress are combined into a single update.
+	Reconcile() error
 }
 
 type controller struct {
@@ -57,11 +78,28 @@ type controller struct {
 	defaultBackendMaxConnections int
 	defaultProxyBufferSize       int
 	defaultProxyBufferBlocks     int
+	dryRun                       bool
+	leaderLock                   k8s.LeaderLock
+	leaderRetryPeriod            time.Duration
+	leader                       util.SafeBool
+	leaderCh                     chan struct{}
+	reconcileCh                  chan chan error
+	leaderDone                   sync.WaitGroup
+	stopElectionCh               chan struct{}
+	drainOnStop                  bool
+	drainTimeout                 time.Duration
 	watcher                      k8s.Watcher
 	doneCh                       chan struct{}
 	watcherDone                  sync.WaitGroup
 	started                      bool
 	updatesHealth                util.SafeError
+	updated                      util.SafeBool
+	lastUpdateError              util.SafeError
+	lastUpdateSuccess            util.SafeTime
+	backoff                      *backoff
+	metrics                      *updateMetrics
+	updaterConcurrency           int
+	tracer                       *tracing.Tracer
 	sync.Mutex
 }
 
@@ -75,10 +113,61 @@ type Config struct {
 	DefaultBackendMaxConnections int
 	DefaultProxyBufferSize       int
 	DefaultProxyBufferBlocks     int
+	// DryRun makes each Updater log the changes it would make instead of making them. All updaters must
+	// implement DryRunner.
+	DryRun bool
+	// LeaderLock enables leader election if set. Updaters are only updated while this controller holds the lock.
+	LeaderLock k8s.LeaderLock
+	// LeaderRetryPeriod is how often the lock is acquired or renewed, which should be well within its lease duration.
+	LeaderRetryPeriod time.Duration
+	// DrainOnStop makes each Updater remove what it owns when the controller stops, within DrainTimeout.
+	// All updaters must implement Drainer. With leader election, only the leader drains.
+	DrainOnStop  bool
+	DrainTimeout time.Duration
+	// ReconcileBackoffInitial is the delay before retrying a failed update, doubling after each consecutive
+	// failure up to ReconcileBackoffMax.
+	ReconcileBackoffInitial time.Duration
+	ReconcileBackoffMax     time.Duration
+	// UpdaterConcurrency caps how many updaters are updated at the same time. If 0, all of them are.
+	UpdaterConcurrency int
+	// MetricsSubsystem, if set, is the Prometheus subsystem of metrics recording when updates were last attempted
+	// and last succeeded.
+	MetricsSubsystem string
+	// Tracer, if set, records a span of each update, with a span of each updater's update within it. It's stopped
+	// when the controller stops, exporting the remaining spans.
+	Tracer *tracing.Tracer
 }
 
 // New creates an ingress controller.
 func New(conf Config) Controller {
+	leaderRetryPeriod := conf.LeaderRetryPeriod
+	if leaderRetryPeriod == 0 {
+		leaderRetryPeriod = defaultLeaderRetryPeriod
+	}
+
+	drainTimeout := conf.DrainTimeout
+	if drainTimeout == 0 {
+		drainTimeout = defaultDrainTimeout
+	}
+
+	backoffInitial := conf.ReconcileBackoffInitial
+	if backoffInitial == 0 {
+		backoffInitial = DefaultReconcileBackoffInitial
+	}
+
+	backoffMax := conf.ReconcileBackoffMax
+	if backoffMax == 0 {
+		backoffMax = DefaultReconcileBackoffMax
+	}
+	if backoffMax < backoffInitial {
+		backoffMax = backoffInitial
+	}
+
+	var updateMetrics *updateMetrics
+	if conf.MetricsSubsystem != "" {
+		updateMetrics = newUpdateMetrics(conf.MetricsSubsystem)
+	}
+
 	return &controller{
 		client:                       conf.KubernetesClient,
 		updaters:                     conf.Updaters,
@@ -88,7 +177,19 @@ func New(conf Config) Controller {
 		defaultBackendMaxConnections: conf.DefaultBackendMaxConnections,
 		defaultProxyBufferSize:       conf.DefaultProxyBufferSize,
 		defaultProxyBufferBlocks:     conf.DefaultProxyBufferBlocks,
+		dryRun:                       conf.DryRun,
+		leaderLock:                   conf.LeaderLock,
+		leaderRetryPeriod:            leaderRetryPeriod,
+		leaderCh:                     make(chan struct{}, 1),
+		reconcileCh:                  make(chan chan error),
+		drainOnStop:                  conf.DrainOnStop,
+		drainTimeout:                 drainTimeout,
 		doneCh:                       make(chan struct{}),
+		stopElectionCh:               make(chan struct{}),
+		backoff:                      newBackoff(backoffInitial, backoffMax),
+		metrics:                      updateMetrics,
+		updaterConcurrency:           conf.UpdaterConcurrency,
+		tracer:                       conf.Tracer,
 	}
 }
 
@@ -104,6 +205,24 @@ func (c *controller) Start() error {
 		return errors.New("can't restart controller")
 	}
 
+	if c.dryRun {
+		for _, u := range c.updaters {
+			dryRunner, ok := u.(DryRunner)
+			if !ok {
+				return fmt.Errorf("%v doesn't support dry-run", u)
+			}
+			dryRunner.EnableDryRun()
+		}
+	}
+
+	if c.drainOnStop {
+		for _, u := range c.updaters {
+			if _, ok := u.(Drainer); !ok {
+				return fmt.Errorf("%v doesn't support draining", u)
+			}
+		}
+	}
+
 	var startedUpdaters []Updater
 	for _, u := range c.updaters {
 		if err := u.Start(); err != nil {
@@ -118,6 +237,12 @@ func (c *controller) Start() error {
 		startedUpdaters = append(startedUpdaters, u)
 	}
 
+	if c.leaderLock == nil {
+		c.leader.Set(true)
+	} else {
+		c.leaderDone.Add(1)
+		go c.elect()
+	}
 	c.watchForUpdates()
 
 	c.started = true
@@ -133,17 +258,33 @@ func (c *controller) watchForUpdates() {
 }
 
 func (c *controller) handleUpdates() {
+	defer c.watcherDone.Done()
 	defer log.Debug("Controller stopped watching for updates")
 
+	// retry fires when a failed update should be retried, and is nil otherwise.
+	var retry <-chan time.Time
 	for {
 		select {
 		case <-c.watcher.Updates():
 			log.Info("Received update on watcher")
-			if err := c.updateIngresses(); err != nil {
-				c.updatesHealth.Set(err)
-				log.Errorf("Unable to update ingresses: %v", err)
-			} else {
-				c.updatesHealth.Set(nil)
+			retry = c.updateIfLeader()
+		case <-c.leaderCh:
+			log.Info("Became leader, updating")
+			retry = c.updateIfLeader()
+		case <-retry:
+			log.Info("Retrying failed update")
+			retry = c.updateIfLeader()
+		case result := <-c.reconcileCh:
+			log.Info("Reconcile requested, updating")
+			results := []chan error{result}
+			results = append(results, c.pendingReconciles()...)
+			retry = c.updateIfLeader()
+			err := c.updatesHealth.Get()
+			if !c.leader.Get() {
+				err = errors.New("not the leader, another replica is updating")
+			}
+			for _, result := range results {
+				result <- err
 			}
 		case <-c.doneCh:
 			return
@@ -151,7 +292,103 @@ func (c *controller) handleUpdates() {
 	}
 }
 
+// pendingReconciles returns the reconcile requests waiting to be sent, so they can share an update.
+func (c *controller) pendingReconciles() []chan error {
+	var pending []chan error
+	for {
+		select {
+		case result := <-c.reconcileCh:
+			pending = append(pending, result)
+		default:
+			return pending
+		}
+	}
+}
+
+// updateIfLeader updates the updaters, unless leader election is enabled and another replica is the leader.
+// Leadership is checked just before updating so a former leader stops updating as soon as it loses the lock.
+// Returns a channel which fires when a failed update should be retried, or nil if there's nothing to retry.
+func (c *controller) updateIfLeader() <-chan time.Time {
+	if !c.leader.Get() {
+		log.Debug("Not the leader, ignoring update")
+		c.backoff.reset()
+		c.updatesHealth.Set(nil)
+		return nil
+	}
+	if c.metrics != nil {
+		c.metrics.lastAttempt.Set(float64(time.Now().Unix()))
+	}
+	if err := c.updateIngresses(); err != nil {
+		c.updatesHealth.Set(err)
+		c.lastUpdateError.Set(err)
+		delay := c.backoff.next()
+		log.Errorf("Unable to update ingresses, retrying in %v: %v", delay, err)
+		return time.After(delay)
+	}
+	if c.metrics != nil {
+		c.metrics.lastSuccess.Set(float64(time.Now().Unix()))
+	}
+	c.backoff.reset()
+	c.updatesHealth.Set(nil)
+	c.updated.Set(true)
+	c.lastUpdateSuccess.Set(time.Now())
+	return nil
+}
+
+func (c *controller) elect() {
+	defer c.leaderDone.Done()
+	ticker := time.NewTicker(c.leaderRetryPeriod)
+	defer ticker.Stop()
+
+	for {
+		held, err := c.leaderLock.TryAcquireOrRenew()
+		if err != nil {
+			log.Warnf("Unable to acquire or renew leader lock: %v", err)
+		}
+
+		if held != c.leader.Get() {
+			c.leader.Set(held)
+			if held {
+				log.Info("Acquired leader lock")
+				select {
+				case c.leaderCh <- struct{}{}:
+				default:
+				}
+			} else {
+				log.Warn("Lost leader lock, no longer updating")
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-c.stopElectionCh:
+			if c.leader.Get() {
+				c.leader.Set(false)
+				if err := c.leaderLock.Release(); err != nil {
+					log.Warnf("Unable to release leader lock: %v", err)
+				}
+			}
+			return
+		}
+	}
+}
+
 func (c *controller) updateIngresses() error {
+	start := time.Now()
+	span := c.tracer.Start("reconcile")
+	defer span.End()
+	err := c.updateIngressesTraced(span)
+	span.SetError(err)
+
+	duration := time.Since(start)
+	log.Infof("Reconciled in %v", duration)
+	if c.metrics != nil {
+		c.metrics.duration.Observe(duration.Seconds())
+	}
+	return err
+}
+
+func (c *controller) updateIngressesTraced(span *tracing.Span) error {
 	ingresses, err := c.client.GetIngresses()
 	log.Infof("Found %d ingresses", len(ingresses))
 	if err != nil {
@@ -265,16 +502,75 @@ func (c *controller) updateIngresses() error {
 	if len(skipped) > 0 {
 		log.Infof("Skipped %d invalid: %s", len(skipped), strings.Join(skipped, ", "))
 	}
+	span.SetAttribute("ingresses", len(ingresses))
+	span.SetAttribute("entries", len(entries))
+	span.SetAttribute("entries.skipped", len(skipped))
 
-	for _, u := range c.updaters {
-		if err := u.Update(entries); err != nil {
-			return err
+	return c.updateUpdaters(span, entries)
+}
+
+// updateUpdaters updates the updaters concurrently, so a slow updater doesn't delay the others. It waits for all of
+// them to finish, and fails if any of them failed.
+func (c *controller) updateUpdaters(span *tracing.Span, entries []IngressEntry) error {
+	concurrency := c.updaterConcurrency
+	if concurrency <= 0 || concurrency > len(c.updaters) {
+		concurrency = len(c.updaters)
+	}
+
+	slots := make(chan struct{}, concurrency)
+	errs := make([]error, len(c.updaters))
+	var wg sync.WaitGroup
+	for i, u := range c.updaters {
+		wg.Add(1)
+		slots <- struct{}{}
+		// Each updater gets its own copy of the entries, as updaters may sort them.
+		go func(i int, u Updater, entries IngressEntries) {
+			defer wg.Done()
+			start := time.Now()
+			errs[i] = update(span, u, entries)
+			duration := time.Since(start)
+			log.Debugf("Updated %v in %v", u, duration)
+			if c.metrics != nil {
+				c.metrics.updaterDuration.WithLabelValues(u.String()).Observe(duration.Seconds())
+			}
+			<-slots
+		}(i, u, append(IngressEntries(nil), entries...))
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%v: %v", c.updaters[i], err))
 		}
 	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d updaters failed: %s", len(failed), len(c.updaters), strings.Join(failed, "; "))
+	}
 
 	return nil
 }
 
+// update updates the updater, within a span of the update if tracing is enabled.
+func update(parent *tracing.Span, u Updater, entries IngressEntries) error {
+	if parent == nil {
+		return u.Update(entries)
+	}
+
+	span := parent.Child("update")
+	defer span.End()
+	span.SetAttribute("updater", u.String())
+	span.SetAttribute("entries", len(entries))
+	var err error
+	if traced, ok := u.(TracedUpdater); ok {
+		err = traced.UpdateTraced(entries, span)
+	} else {
+		err = u.Update(entries)
+	}
+	span.SetError(err)
+	return err
+}
+
 type serviceName struct {
 	namespace string
 	name      string
@@ -300,8 +596,16 @@ func (c *controller) Stop() error {
 	}
 
 	log.Info("Stopping controller")
+	leader := c.leader.Get()
 	close(c.doneCh)
 
+	// The leader lock is only released once drained, so another replica can't update the records being deleted.
+	if c.drainOnStop && leader {
+		c.drain()
+	}
+	close(c.stopElectionCh)
+	c.leaderDone.Wait()
+
 	for i := range c.updaters {
 		u := c.updaters[len(c.updaters)-1-i]
 		if err := u.Stop(); err != nil {
@@ -309,11 +613,52 @@ func (c *controller) Stop() error {
 		}
 	}
 
+	c.tracer.Stop()
 	c.started = false
 	log.Info("Controller has stopped")
 	return nil
 }
 
+// drain drains each updater in turn, giving up if still draining after the drain timeout.
+func (c *controller) drain() {
+	deadline := time.After(c.drainTimeout)
+
+	// Updaters aren't thread safe, so wait for any update in progress to finish first.
+	updatesDone := make(chan struct{})
+	go func() {
+		c.watcherDone.Wait()
+		close(updatesDone)
+	}()
+	select {
+	case <-updatesDone:
+	case <-deadline:
+		log.Warnf("Timed out after %v waiting for updates to finish, not draining", c.drainTimeout)
+		return
+	}
+
+	for _, u := range c.updaters {
+		if !c.leader.Get() {
+			log.Warnf("Lost leader lock, not draining %v", u)
+			return
+		}
+		log.Infof("Draining %v", u)
+		done := make(chan error, 1)
+		go func(d Drainer) {
+			done <- d.Drain()
+		}(u.(Drainer))
+
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Warnf("Error while draining %v: %v", u, err)
+			}
+		case <-deadline:
+			log.Warnf("Timed out after %v draining %v", c.drainTimeout, u)
+			return
+		}
+	}
+}
+
 func (c *controller) Health() error {
 	c.Lock()
 	defer c.Unlock()
@@ -329,7 +674,64 @@ func (c *controller) Health() error {
 	}
 
 	if err := c.updatesHealth.Get(); err != nil {
-		return fmt.Errorf("updates failed to apply: %v", err)
+		failures, delay := c.backoff.state()
+		return fmt.Errorf("updates failed to apply %d times, retrying in %v: %v", failures, delay, err)
+	}
+
+	return nil
+}
+
+func (c *controller) UpdaterHealth() map[string]error {
+	health := make(map[string]error)
+	for _, u := range c.updaters {
+		health[u.String()] = u.Health()
+	}
+	return health
+}
+
+func (c *controller) SyncStatus() (bool, time.Time, error) {
+	c.Lock()
+	started := c.started
+	c.Unlock()
+
+	synced := started && c.client.HasSynced()
+	return synced, c.lastUpdateSuccess.Get(), c.lastUpdateError.Get()
+}
+
+func (c *controller) Reconcile() error {
+	c.Lock()
+	started := c.started
+	c.Unlock()
+	if !started {
+		return errors.New("controller has not started")
+	}
+
+	// Buffered so the controller never blocks on a caller which has given up.
+	result := make(chan error, 1)
+	select {
+	case c.reconcileCh <- result:
+	case <-c.doneCh:
+		return errors.New("controller is stopping")
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-c.doneCh:
+		return errors.New("controller is stopping")
+	}
+}
+
+func (c *controller) Ready() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.started {
+		return errors.New("controller has not started")
+	}
+
+	if c.leader.Get() && !c.updated.Get() {
+		return errors.New("initial update has not completed")
 	}
 
 	return nil
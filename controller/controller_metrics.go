@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/util/metrics"
+)
+
+// durationBuckets cover updates from well under a second to several minutes, for slow or throttled cloud APIs.
+var durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// updateMetrics records when the updaters were last updated, so alerts can tell a controller that isn't updating
+// apart from one whose updates are failing, and how long updates take.
+type updateMetrics struct {
+	lastAttempt     prometheus.Gauge
+	lastSuccess     prometheus.Gauge
+	duration        prometheus.Histogram
+	updaterDuration *prometheus.HistogramVec
+}
+
+func newUpdateMetrics(subsystem string) *updateMetrics {
+	return &updateMetrics{
+		lastAttempt: prometheus.MustRegisterOrGet(prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace:   metrics.PrometheusNamespace,
+				Subsystem:   subsystem,
+				Name:        "last_reconcile_attempt_timestamp_seconds",
+				Help:        "The Unix time of the last attempt to update the updaters.",
+				ConstLabels: metrics.ConstLabels(),
+			})).(prometheus.Gauge),
+		lastSuccess: prometheus.MustRegisterOrGet(prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace:   metrics.PrometheusNamespace,
+				Subsystem:   subsystem,
+				Name:        "last_reconcile_success_timestamp_seconds",
+				Help:        "The Unix time of the last update where every updater succeeded.",
+				ConstLabels: metrics.ConstLabels(),
+			})).(prometheus.Gauge),
+		duration: prometheus.MustRegisterOrGet(prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace:   metrics.PrometheusNamespace,
+				Subsystem:   subsystem,
+				Name:        "reconcile_duration_seconds",
+				Help:        "How long each update of all the updaters took, including listing the ingresses.",
+				Buckets:     durationBuckets,
+				ConstLabels: metrics.ConstLabels(),
+			})).(prometheus.Histogram),
+		updaterDuration: prometheus.MustRegisterOrGet(prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace:   metrics.PrometheusNamespace,
+				Subsystem:   subsystem,
+				Name:        "updater_duration_seconds",
+				Help:        "How long each update of an updater took.",
+				Buckets:     durationBuckets,
+				ConstLabels: metrics.ConstLabels(),
+			}, []string{"updater"})).(*prometheus.HistogramVec),
+	}
+}
@@ -3,12 +3,20 @@ package controller
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/sky-uk/feed/k8s"
+	"github.com/sky-uk/feed/util"
+	"github.com/sky-uk/feed/util/metrics"
 	fake "github.com/sky-uk/feed/util/test"
+	"github.com/sky-uk/feed/util/tracing"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"k8s.io/client-go/pkg/api/v1"
@@ -18,6 +26,10 @@ import (
 
 const smallWaitTime = time.Millisecond * 50
 
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
 type fakeUpdater struct {
 	mock.Mock
 }
@@ -165,6 +177,214 @@ func TestControllerStopsAnyStartedUpdatersIfOneFailsToStart(t *testing.T) {
 	updater2.AssertExpectations(t)
 }
 
+type fakeDryRunUpdater struct {
+	fakeUpdater
+}
+
+func (lb *fakeDryRunUpdater) EnableDryRun() {
+	lb.Called()
+}
+
+func TestControllerEnablesDryRunOnUpdaters(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	_, client := createDefaultStubs()
+	updater := new(fakeDryRunUpdater)
+	updater.On("EnableDryRun").Return()
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	controller := New(Config{
+		Updaters:         []Updater{updater},
+		KubernetesClient: client,
+		DryRun:           true,
+	})
+
+	// when
+	assert.NoError(controller.Start())
+	assert.NoError(controller.Stop())
+
+	// then
+	updater.AssertExpectations(t)
+}
+
+func TestControllerDryRunFailsIfUpdaterDoesNotSupportIt(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	updater, client := createDefaultStubs()
+	controller := New(Config{
+		Updaters:         []Updater{updater},
+		KubernetesClient: client,
+		DryRun:           true,
+	})
+
+	// expect
+	assert.Error(controller.Start())
+	updater.AssertNotCalled(t, "Start")
+}
+
+type fakeLeaderLock struct {
+	held     util.SafeBool
+	released util.SafeBool
+}
+
+func (l *fakeLeaderLock) TryAcquireOrRenew() (bool, error) {
+	return l.held.Get(), nil
+}
+
+func (l *fakeLeaderLock) Release() error {
+	l.released.Set(true)
+	return nil
+}
+
+func TestControllerOnlyUpdatesWhileLeader(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	updater, client := createDefaultStubs()
+	lock := &fakeLeaderLock{}
+	controller := New(Config{
+		Updaters:          []Updater{updater},
+		KubernetesClient:  client,
+		LeaderLock:        lock,
+		LeaderRetryPeriod: time.Millisecond,
+	})
+
+	// when
+	assert.NoError(controller.Start())
+	time.Sleep(smallWaitTime)
+
+	// then
+	updater.AssertNotCalled(t, "Update", mock.Anything)
+	assert.NoError(controller.Health(), "followers should be healthy")
+
+	// when
+	lock.held.Set(true)
+	time.Sleep(smallWaitTime)
+
+	// then
+	updater.AssertCalled(t, "Update", mock.Anything)
+	assert.NoError(controller.Stop())
+	assert.True(lock.released.Get(), "should release the lock on stop")
+}
+
+type fakeDrainUpdater struct {
+	fakeUpdater
+}
+
+func (lb *fakeDrainUpdater) Drain() error {
+	r := lb.Called()
+	return r.Error(0)
+}
+
+func TestControllerDrainsUpdatersOnStop(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	_, client := createDefaultStubs()
+	updater := new(fakeDrainUpdater)
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Drain").Return(nil)
+	controller := New(Config{
+		Updaters:         []Updater{updater},
+		KubernetesClient: client,
+		DrainOnStop:      true,
+	})
+
+	// when
+	assert.NoError(controller.Start())
+	assert.NoError(controller.Stop())
+
+	// then
+	updater.AssertExpectations(t)
+}
+
+// orderedLeaderLock is a held leader lock which records when it's released in events.
+type orderedLeaderLock struct {
+	events *[]string
+	sync.Mutex
+}
+
+func (l *orderedLeaderLock) TryAcquireOrRenew() (bool, error) {
+	return true, nil
+}
+
+func (l *orderedLeaderLock) Release() error {
+	l.Lock()
+	defer l.Unlock()
+	*l.events = append(*l.events, "release")
+	return nil
+}
+
+func TestControllerDrainsBeforeReleasingTheLeaderLock(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	_, client := createDefaultStubs()
+	var events []string
+	lock := &orderedLeaderLock{events: &events}
+	updater := new(fakeDrainUpdater)
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Update", mock.Anything).Return(nil)
+	updater.On("Drain").Return(nil).Run(func(mock.Arguments) {
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, "drain")
+	})
+	controller := New(Config{
+		Updaters:          []Updater{updater},
+		KubernetesClient:  client,
+		LeaderLock:        lock,
+		LeaderRetryPeriod: time.Millisecond,
+		DrainOnStop:       true,
+	})
+
+	// when
+	assert.NoError(controller.Start())
+	time.Sleep(smallWaitTime)
+	assert.NoError(controller.Stop())
+
+	// then
+	updater.AssertCalled(t, "Drain")
+	assert.Equal([]string{"drain", "release"}, events, "should hold the lock while draining")
+}
+
+func TestControllerGivesUpDrainingAfterTimeout(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	_, client := createDefaultStubs()
+	updater := new(fakeDrainUpdater)
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Drain").After(time.Second).Return(nil)
+	controller := New(Config{
+		Updaters:         []Updater{updater},
+		KubernetesClient: client,
+		DrainOnStop:      true,
+		DrainTimeout:     smallWaitTime,
+	})
+
+	// when
+	assert.NoError(controller.Start())
+	start := time.Now()
+	assert.NoError(controller.Stop())
+
+	// then
+	assert.True(time.Since(start) < time.Second, "should not wait for drain to finish")
+}
+
+func TestControllerDrainFailsIfUpdaterDoesNotSupportIt(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	updater, client := createDefaultStubs()
+	controller := New(Config{
+		Updaters:         []Updater{updater},
+		KubernetesClient: client,
+		DrainOnStop:      true,
+	})
+
+	// expect
+	assert.Error(controller.Start())
+}
+
 func TestControllerCannotBeRestarted(t *testing.T) {
 	// given
 	assert := assert.New(t)
@@ -205,6 +425,47 @@ func TestControllerIsUnhealthyUntilStarted(t *testing.T) {
 	assert.Error(controller.Health(), "should be unhealthy after stopped")
 }
 
+func TestControllerIsNotReadyUntilUpdated(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	updater, client := createDefaultStubs()
+	ingressWatcher, updateCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	client.ExpectedCalls = nil
+	client.On("GetIngresses").Return([]*v1beta1.Ingress{}, nil)
+	client.On("GetServices").Return([]*v1.Service{}, nil)
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	controller := newController(updater, client)
+
+	// expect
+	assert.Error(controller.Ready(), "should not be ready until started")
+	assert.NoError(controller.Start())
+	assert.Error(controller.Ready(), "should not be ready until updated")
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+	assert.NoError(controller.Ready(), "should be ready after updating")
+	assert.NoError(controller.Stop())
+}
+
+func TestControllerIsReadyWhileNotLeader(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	updater, client := createDefaultStubs()
+	controller := New(Config{
+		Updaters:          []Updater{updater},
+		KubernetesClient:  client,
+		LeaderLock:        &fakeLeaderLock{},
+		LeaderRetryPeriod: time.Millisecond,
+	})
+
+	// expect
+	assert.NoError(controller.Start())
+	time.Sleep(smallWaitTime)
+	assert.NoError(controller.Ready(), "followers should be ready")
+	assert.NoError(controller.Stop())
+}
+
 func TestControllerIsUnhealthyIfUpdaterIsUnhealthy(t *testing.T) {
 	assert := assert.New(t)
 	_, client := createDefaultStubs()
@@ -226,6 +487,16 @@ func TestControllerIsUnhealthyIfUpdaterIsUnhealthy(t *testing.T) {
 	controller.Stop()
 }
 
+func TestUpdaterHealthIsReportedByName(t *testing.T) {
+	assert := assert.New(t)
+	_, client := createDefaultStubs()
+	updater := new(fakeUpdater)
+	controller := newController(updater, client)
+	updater.On("Health").Return(fmt.Errorf("dead"))
+
+	assert.Equal(map[string]error{"FakeUpdater": fmt.Errorf("dead")}, controller.UpdaterHealth())
+}
+
 func TestControllerReturnsErrorIfUpdaterFails(t *testing.T) {
 	// given
 	_, client := createDefaultStubs()
@@ -273,6 +544,308 @@ func TestUnhealthyIfUpdaterFails(t *testing.T) {
 	controller.Stop()
 }
 
+func TestFailedUpdatesAreRetriedWithBackoff(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	updater := new(fakeUpdater)
+	client := new(fake.FakeClient)
+	controller := New(Config{
+		Updaters:                []Updater{updater},
+		KubernetesClient:        client,
+		ReconcileBackoffInitial: smallWaitTime,
+		ReconcileBackoffMax:     smallWaitTime * 2,
+	})
+
+	ingressWatcher, updateCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Update", mock.Anything).Return(fmt.Errorf("kaboom, update failed :(")).Twice()
+	updater.On("Update", mock.Anything).Return(nil)
+	updater.On("Health").Return(nil)
+
+	client.On("GetIngresses").Return([]*v1beta1.Ingress{}, nil)
+	client.On("GetServices").Return([]*v1.Service{}, nil)
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	assert.NoError(controller.Start())
+
+	// when
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime / 5)
+
+	// then
+	err := controller.Health()
+	if assert.Error(err, "should be unhealthy while retrying") {
+		assert.Contains(err.Error(), "failed to apply 1 times")
+	}
+	time.Sleep(smallWaitTime * 4)
+	updater.AssertNumberOfCalls(t, "Update", 3)
+	assert.NoError(controller.Health(), "should be healthy after a retry succeeds")
+
+	// cleanup
+	controller.Stop()
+}
+
+func TestReconcileTimestampsAreRecorded(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	updater := new(fakeUpdater)
+	client := new(fake.FakeClient)
+	c := New(Config{
+		Updaters:                []Updater{updater},
+		KubernetesClient:        client,
+		ReconcileBackoffInitial: time.Hour,
+		MetricsSubsystem:        "test",
+	})
+
+	ingressWatcher, updateCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Update", mock.Anything).Return(nil).Once()
+	updater.On("Update", mock.Anything).Return(fmt.Errorf("kaboom, update failed :("))
+	updater.On("Health").Return(nil)
+
+	client.On("GetIngresses").Return([]*v1beta1.Ingress{}, nil)
+	client.On("GetServices").Return([]*v1.Service{}, nil)
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	assert.NoError(c.Start())
+	updateMetrics := c.(*controller).metrics
+
+	// when
+	before := float64(time.Now().Unix())
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+	succeeded := gaugeValue(updateMetrics.lastSuccess)
+
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+
+	// then
+	assert.True(succeeded >= before, "last success should be recorded")
+	assert.True(gaugeValue(updateMetrics.lastAttempt) >= succeeded, "last attempt should be recorded")
+	assert.Equal(succeeded, gaugeValue(updateMetrics.lastSuccess), "failed update shouldn't record a success")
+
+	// cleanup
+	c.Stop()
+}
+
+func TestSyncStatusReportsLastSuccessAndError(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	updater := new(fakeUpdater)
+	client := new(fake.FakeClient)
+	c := New(Config{
+		Updaters:                []Updater{updater},
+		KubernetesClient:        client,
+		ReconcileBackoffInitial: time.Hour,
+	})
+
+	ingressWatcher, updateCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Update", mock.Anything).Return(nil).Once()
+	updater.On("Update", mock.Anything).Return(fmt.Errorf("kaboom, update failed :("))
+	updater.On("Health").Return(nil)
+
+	client.On("GetIngresses").Return([]*v1beta1.Ingress{}, nil)
+	client.On("GetServices").Return([]*v1.Service{}, nil)
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("HasSynced").Return(true)
+
+	synced, lastSuccess, lastErr := c.SyncStatus()
+	assert.False(synced, "shouldn't be synced before starting")
+	assert.True(lastSuccess.IsZero())
+	assert.NoError(lastErr)
+	assert.NoError(c.Start())
+
+	// when
+	before := time.Now()
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+	_, succeeded, _ := c.SyncStatus()
+
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+
+	// then
+	synced, lastSuccess, lastErr = c.SyncStatus()
+	assert.True(synced)
+	assert.False(succeeded.Before(before), "last success should be recorded")
+	assert.Equal(succeeded, lastSuccess, "failed update shouldn't record a success")
+	if assert.Error(lastErr) {
+		assert.Contains(lastErr.Error(), "kaboom, update failed :(")
+	}
+
+	// cleanup
+	c.Stop()
+}
+
+// blockingUpdater blocks each update until released.
+type blockingUpdater struct {
+	fakeUpdater
+	release chan struct{}
+}
+
+func (lb *blockingUpdater) Update(update IngressEntries) error {
+	<-lb.release
+	return lb.fakeUpdater.Update(update)
+}
+
+func TestSlowUpdaterDoesNotBlockOtherUpdaters(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	slow := &blockingUpdater{release: make(chan struct{})}
+	slow.On("Update", mock.Anything).Return(nil)
+	fast := new(fakeUpdater)
+	fast.On("Update", mock.Anything).Return(nil)
+	c := New(Config{Updaters: []Updater{slow, fast}}).(*controller)
+
+	// when
+	done := make(chan error)
+	go func() { done <- c.updateUpdaters(nil, nil) }()
+	time.Sleep(smallWaitTime)
+
+	// then
+	fast.AssertNumberOfCalls(t, "Update", 1)
+	close(slow.release)
+	assert.NoError(<-done)
+	slow.AssertNumberOfCalls(t, "Update", 1)
+}
+
+func TestUpdaterConcurrencyIsLimited(t *testing.T) {
+	// given
+	slow := &blockingUpdater{release: make(chan struct{})}
+	slow.On("Update", mock.Anything).Return(nil)
+	fast := new(fakeUpdater)
+	fast.On("Update", mock.Anything).Return(nil)
+	c := New(Config{Updaters: []Updater{slow, fast}, UpdaterConcurrency: 1}).(*controller)
+
+	// when
+	done := make(chan error)
+	go func() { done <- c.updateUpdaters(nil, nil) }()
+	time.Sleep(smallWaitTime)
+
+	// then
+	fast.AssertNumberOfCalls(t, "Update", 0)
+	close(slow.release)
+	assert.NoError(t, <-done)
+	fast.AssertNumberOfCalls(t, "Update", 1)
+}
+
+func TestErrorsOfAllFailedUpdatersAreReturned(t *testing.T) {
+	// given
+	first := new(fakeUpdater)
+	first.On("Update", mock.Anything).Return(errors.New("first failed"))
+	second := new(fakeUpdater)
+	second.On("Update", mock.Anything).Return(nil)
+	third := new(fakeUpdater)
+	third.On("Update", mock.Anything).Return(errors.New("third failed"))
+	c := New(Config{Updaters: []Updater{first, second, third}}).(*controller)
+
+	// when
+	err := c.updateUpdaters(nil, nil)
+
+	// then
+	assert.EqualError(t, err, "2 of 3 updaters failed: FakeUpdater: first failed; FakeUpdater: third failed")
+	second.AssertNumberOfCalls(t, "Update", 1)
+}
+
+func TestConcurrentReconcilesAreCombined(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	updater := &blockingUpdater{release: make(chan struct{})}
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Update", mock.Anything).Return(nil)
+	updater.On("Health").Return(nil)
+	_, client := createDefaultStubs()
+	c := newController(updater, client)
+	assert.Error(c.Reconcile(), "should fail before starting")
+	assert.NoError(c.Start())
+
+	// when
+	results := make(chan error, 3)
+	go func() { results <- c.Reconcile() }()
+	time.Sleep(smallWaitTime)
+	go func() { results <- c.Reconcile() }()
+	go func() { results <- c.Reconcile() }()
+	time.Sleep(smallWaitTime)
+	close(updater.release)
+
+	// then
+	for i := 0; i < 3; i++ {
+		assert.NoError(<-results)
+	}
+	updater.AssertNumberOfCalls(t, "Update", 2)
+
+	// cleanup
+	c.Stop()
+}
+
+func TestReconcileReturnsUpdateErrors(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	updater := new(fakeUpdater)
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Update", mock.Anything).Return(errors.New("kaboom"))
+	updater.On("Health").Return(nil)
+	_, client := createDefaultStubs()
+	c := newController(updater, client)
+	assert.NoError(c.Start())
+
+	// when
+	err := c.Reconcile()
+
+	// then
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "kaboom")
+	}
+
+	// cleanup
+	c.Stop()
+}
+
+func histogramCount(h prometheus.Histogram) uint64 {
+	var metric dto.Metric
+	h.Write(&metric)
+	return metric.Histogram.GetSampleCount()
+}
+
+func TestReconcileDurationsAreRecorded(t *testing.T) {
+	// given
+	updater := new(fakeUpdater)
+	updater.On("Update", mock.Anything).Return(nil)
+	client := new(fake.FakeClient)
+	client.On("GetIngresses").Return([]*v1beta1.Ingress{}, nil)
+	client.On("GetServices").Return([]*v1.Service{}, nil)
+	c := New(Config{Updaters: []Updater{updater}, KubernetesClient: client, MetricsSubsystem: "test"}).(*controller)
+	reconciles := histogramCount(c.metrics.duration)
+	updates := histogramCount(c.metrics.updaterDuration.WithLabelValues("FakeUpdater").(prometheus.Histogram))
+
+	// when
+	assert.NoError(t, c.updateIngresses())
+
+	// then
+	assert.Equal(t, reconciles+1, histogramCount(c.metrics.duration))
+	assert.Equal(t, updates+1,
+		histogramCount(c.metrics.updaterDuration.WithLabelValues("FakeUpdater").(prometheus.Histogram)))
+}
+
+func gaugeValue(g prometheus.Gauge) float64 {
+	var metric dto.Metric
+	g.Write(&metric)
+	return metric.Gauge.GetValue()
+}
+
 func defaultConfig() Config {
 	return Config{
 		DefaultAllow:                 ingressDefaultAllow,
@@ -831,3 +1404,36 @@ func createServiceFixture(name string, namespace string, clusterIP string) []*v1
 		},
 	}
 }
+
+type fakeTracedUpdater struct {
+	fakeUpdater
+	spans []*tracing.Span
+}
+
+func (lb *fakeTracedUpdater) UpdateTraced(update IngressEntries, span *tracing.Span) error {
+	lb.spans = append(lb.spans, span)
+	return lb.fakeUpdater.Update(update)
+}
+
+func TestTracedUpdatersAreOnlyGivenASpanWhenTracingIsEnabled(t *testing.T) {
+	// given
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer collector.Close()
+	untraced := new(fakeTracedUpdater)
+	untraced.On("Update", mock.Anything).Return(nil)
+	traced := new(fakeTracedUpdater)
+	traced.On("Update", mock.Anything).Return(nil)
+	tracer := tracing.New(collector.URL, "test")
+	defer tracer.Stop()
+
+	// when
+	assert.NoError(t, New(Config{Updaters: []Updater{untraced}}).(*controller).updateUpdaters(nil, nil))
+	span := tracer.Start("reconcile")
+	assert.NoError(t, New(Config{Updaters: []Updater{traced}}).(*controller).updateUpdaters(span, nil))
+
+	// then
+	untraced.AssertNumberOfCalls(t, "Update", 1)
+	assert.Empty(t, untraced.spans)
+	assert.Len(t, traced.spans, 1)
+	assert.NotNil(t, traced.spans[0])
+}
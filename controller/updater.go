@@ -1,5 +1,7 @@
 package controller
 
+import "github.com/sky-uk/feed/util/tracing"
+
 // Updater that the Controller delegates to.
 type Updater interface {
 	// Start the ingress updater, returning immediately after it's started.
@@ -12,4 +14,24 @@ type Updater interface {
 	// Health returns nil if healthy, otherwise an error. Should be fast to respond, as it
 	// may be called often. Any long running checks should be done separately.
 	Health() error
+	// String names the updater, e.g. in logs and on the health endpoint.
+	String() string
+}
+
+// DryRunner is implemented by Updaters which can log the changes they would make, without making them.
+type DryRunner interface {
+	// EnableDryRun stops the updater from making changes. Called before Start.
+	EnableDryRun()
+}
+
+// Drainer is implemented by Updaters which can remove what they've created, such as DNS records.
+type Drainer interface {
+	// Drain removes everything the updater owns. Called when stopping, before Stop.
+	Drain() error
+}
+
+// TracedUpdater is implemented by Updaters which add detail, such as each change they make, to the span of an update.
+type TracedUpdater interface {
+	// UpdateTraced is Update, recording what it does within the span. The span may be nil if tracing is disabled.
+	UpdateTraced(IngressEntries, *tracing.Span) error
 }
@@ -0,0 +1,339 @@
+package adapter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// Annotations of an ingress which configure the records for its hosts. They're parsed by ParseAnnotations, so every
+// frontend adapter interprets them in the same way.
+const (
+	// WeightAnnotation makes the records for an ingress host weighted, with the given relative weight.
+	WeightAnnotation = "sky.uk/dns-weight"
+	// FailoverRoleAnnotation makes the records for an ingress host failover records, with the role primary or
+	// secondary.
+	FailoverRoleAnnotation = "sky.uk/dns-failover-role"
+	// RoutingPolicyAnnotation selects a routing policy for the records of an ingress host. Only latency is
+	// supported, which routes to the closest region.
+	RoutingPolicyAnnotation = "sky.uk/dns-routing-policy"
+	// GeoAnnotation makes the records for an ingress host geolocation records, for clients in the location given as
+	// a country code, e.g. GB, continent: and a continent code, e.g. continent:EU, or * for clients elsewhere.
+	GeoAnnotation = "sky.uk/dns-geo"
+	// TTLAnnotation overrides the TTL in seconds of the CNAME records for an ingress host.
+	TTLAnnotation = "sky.uk/dns-ttl"
+	// CloudFrontDistributionAnnotation aliases the records for an ingress host to the CloudFront distribution with
+	// the given id, instead of the load balancer.
+	CloudFrontDistributionAnnotation = "sky.uk/cloudfront-distribution"
+	// TXTAnnotation requests TXT records, as comma separated name=value pairs, e.g. for ACME dns-01 challenges.
+	TXTAnnotation = "sky.uk/dns-txt"
+	// ExcludeAnnotation, when "true", makes feed-dns leave the records for an ingress's hosts alone, e.g. as
+	// they're managed by another controller.
+	ExcludeAnnotation = "sky.uk/feed-dns-exclude"
+	// LBNameAnnotation points the records for an ingress host to the named load balancer, instead of the one for
+	// the ingress's scheme.
+	LBNameAnnotation = "sky.uk/lb-name"
+	// ZonesAnnotation publishes the records for an ingress host to the comma separated logical zones, InternalZone
+	// and ExternalZone, instead of the zone of the ingress's scheme.
+	ZonesAnnotation = "sky.uk/dns-zones"
+	// HealthCheckPathAnnotation, HealthCheckPortAnnotation and HealthCheckIntervalAnnotation request a Route53
+	// health check of the load balancer for the records of an ingress host, which feed-dns creates and deletes.
+	// Each is optional, defaulting to DefaultHealthCheckPath, DefaultHealthCheckPort and
+	// DefaultHealthCheckInterval.
+	HealthCheckPathAnnotation     = "sky.uk/dns-healthcheck-path"
+	HealthCheckPortAnnotation     = "sky.uk/dns-healthcheck-port"
+	HealthCheckIntervalAnnotation = "sky.uk/dns-healthcheck-interval"
+)
+
+const (
+	// LatencyRoutingPolicy is the RoutingPolicyAnnotation value for latency records.
+	LatencyRoutingPolicy = "latency"
+	// DefaultGeoLocation is the GeoAnnotation value for the geolocation record of clients in no other location.
+	DefaultGeoLocation = "*"
+	// continentPrefix distinguishes continent codes from country codes, as some are the same, e.g. NA.
+	continentPrefix = "continent:"
+	// DefaultWeight is the weight of weighted records without a valid WeightAnnotation.
+	DefaultWeight = 100
+	// MaxWeight is the highest weight Route53 accepts.
+	MaxWeight = 255
+	// InternalZone is the ZonesAnnotation value for the zone of internal ingresses.
+	InternalZone = "internal"
+	// ExternalZone is the ZonesAnnotation value for the zone of internet-facing ingresses.
+	ExternalZone = "external"
+	// DefaultHealthCheckPath is the path health checks request without a valid HealthCheckPathAnnotation.
+	DefaultHealthCheckPath = "/"
+	// DefaultHealthCheckPort is the port health checks request without a valid HealthCheckPortAnnotation.
+	DefaultHealthCheckPort = 80
+	// DefaultHealthCheckInterval is the seconds between health checks without a valid
+	// HealthCheckIntervalAnnotation. Route53 supports 10 and 30.
+	DefaultHealthCheckInterval = 30
+	fastHealthCheckInterval    = 10
+)
+
+// recordAnnotations are all the annotations parsed by ParseAnnotations.
+var recordAnnotations = []string{WeightAnnotation, FailoverRoleAnnotation, RoutingPolicyAnnotation, GeoAnnotation,
+	TTLAnnotation, CloudFrontDistributionAnnotation, TXTAnnotation, ExcludeAnnotation, LBNameAnnotation, ZonesAnnotation,
+	HealthCheckPathAnnotation, HealthCheckPortAnnotation, HealthCheckIntervalAnnotation}
+
+// continents are the continent codes Route53 supports for geolocation records.
+var continents = map[string]bool{"AF": true, "AN": true, "AS": true, "EU": true, "NA": true, "OC": true, "SA": true}
+
+// RecordAnnotations are the record settings of an ingress, parsed from its annotations. The zero value is an
+// ingress without any of the annotations.
+type RecordAnnotations struct {
+	// TTL overrides the TTL of the records, if positive.
+	TTL time.Duration
+	// Weighted is true if the records are weighted, with the relative Weight.
+	Weighted bool
+	Weight   int64
+	// Failover is true if the records are failover records. FailoverRole is PRIMARY or SECONDARY, or empty if the
+	// role is invalid.
+	Failover     bool
+	FailoverRole string
+	// Latency is true if the records are latency records.
+	Latency bool
+	// Geo is true if the records are geolocation records. GeoLocation is a country code, continent: and a
+	// continent code, or DefaultGeoLocation, or empty if the location is invalid.
+	Geo         bool
+	GeoLocation string
+	// CloudFrontDistribution is the id of the distribution to alias the records to, if any.
+	CloudFrontDistribution string
+	// TXT is the unparsed list of requested TXT records, if any.
+	TXT string
+	// Exclude is true if the records for the ingress's hosts should be left alone.
+	Exclude bool
+	// LBName is the name of the load balancer to point the records to, if any.
+	LBName string
+	// Zones are the logical zones to publish the records to, InternalZone or ExternalZone, without duplicates. Empty
+	// publishes them to the zone of the ingress's scheme.
+	Zones []string
+	// HealthCheck is true if the records need a health check, of the HealthCheckPath on the HealthCheckPort every
+	// HealthCheckInterval seconds.
+	HealthCheck         bool
+	HealthCheckPath     string
+	HealthCheckPort     int64
+	HealthCheckInterval int64
+}
+
+// ParseAnnotations parses the record annotations of an ingress. Invalid values are ignored, and described by the
+// returned warnings.
+func ParseAnnotations(annotations map[string]string) (RecordAnnotations, []string) {
+	var parsed RecordAnnotations
+	var warnings []string
+
+	if value, ok := annotations[TTLAnnotation]; ok {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds <= 0 {
+			warnings = append(warnings, fmt.Sprintf("invalid %s annotation: %s. Using the default TTL",
+				TTLAnnotation, value))
+		} else {
+			parsed.TTL = time.Duration(seconds) * time.Second
+		}
+	}
+
+	if value, ok := annotations[WeightAnnotation]; ok {
+		parsed.Weighted = true
+		weight, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || weight < 0 || weight > MaxWeight {
+			warnings = append(warnings, fmt.Sprintf("invalid %s annotation: %s. Using default of %d",
+				WeightAnnotation, value, DefaultWeight))
+			weight = DefaultWeight
+		}
+		parsed.Weight = weight
+	}
+
+	if value, ok := annotations[FailoverRoleAnnotation]; ok {
+		parsed.Failover = true
+		role := strings.ToUpper(value)
+		if role == route53.ResourceRecordSetFailoverPrimary || role == route53.ResourceRecordSetFailoverSecondary {
+			parsed.FailoverRole = role
+		} else {
+			warnings = append(warnings, fmt.Sprintf("invalid %s annotation: %q, must be primary or secondary",
+				FailoverRoleAnnotation, value))
+		}
+	}
+
+	if value, ok := annotations[RoutingPolicyAnnotation]; ok {
+		if strings.EqualFold(value, LatencyRoutingPolicy) {
+			parsed.Latency = true
+		} else {
+			warnings = append(warnings, fmt.Sprintf("unsupported %s annotation: %q, ignoring",
+				RoutingPolicyAnnotation, value))
+		}
+	}
+
+	if value, ok := annotations[GeoAnnotation]; ok {
+		parsed.Geo = true
+		if location, valid := parseGeoLocation(value); valid {
+			parsed.GeoLocation = location
+		} else {
+			warnings = append(warnings, fmt.Sprintf("invalid %s annotation: %q, must be a country code, "+
+				"continent: and a continent code, or %s", GeoAnnotation, value, DefaultGeoLocation))
+		}
+	}
+
+	parsed.CloudFrontDistribution = annotations[CloudFrontDistributionAnnotation]
+	parsed.TXT = annotations[TXTAnnotation]
+	parsed.Exclude = annotations[ExcludeAnnotation] == "true"
+	parsed.LBName = annotations[LBNameAnnotation]
+
+	if value, ok := annotations[ZonesAnnotation]; ok {
+		seen := make(map[string]bool)
+		for _, zone := range strings.Split(value, ",") {
+			zone = strings.ToLower(strings.TrimSpace(zone))
+			if zone != InternalZone && zone != ExternalZone {
+				warnings = append(warnings, fmt.Sprintf("invalid zone in %s annotation: %q, must be %s or %s",
+					ZonesAnnotation, zone, InternalZone, ExternalZone))
+				continue
+			}
+			if !seen[zone] {
+				seen[zone] = true
+				parsed.Zones = append(parsed.Zones, zone)
+			}
+		}
+	}
+
+	warnings = append(warnings, parseHealthCheck(annotations, &parsed)...)
+
+	return parsed, warnings
+}
+
+// parseHealthCheck parses the health check annotations, if there are any.
+func parseHealthCheck(annotations map[string]string, parsed *RecordAnnotations) []string {
+	var warnings []string
+	path, hasPath := annotations[HealthCheckPathAnnotation]
+	port, hasPort := annotations[HealthCheckPortAnnotation]
+	interval, hasInterval := annotations[HealthCheckIntervalAnnotation]
+	if !hasPath && !hasPort && !hasInterval {
+		return nil
+	}
+
+	parsed.HealthCheck = true
+	parsed.HealthCheckPath = DefaultHealthCheckPath
+	parsed.HealthCheckPort = DefaultHealthCheckPort
+	parsed.HealthCheckInterval = DefaultHealthCheckInterval
+
+	if hasPath {
+		if strings.HasPrefix(path, "/") {
+			parsed.HealthCheckPath = path
+		} else {
+			warnings = append(warnings, fmt.Sprintf("invalid %s annotation: %q, must start with /. Using %s",
+				HealthCheckPathAnnotation, path, DefaultHealthCheckPath))
+		}
+	}
+
+	if hasPort {
+		value, err := strconv.ParseInt(port, 10, 64)
+		if err != nil || value < 1 || value > 65535 {
+			warnings = append(warnings, fmt.Sprintf("invalid %s annotation: %s. Using default of %d",
+				HealthCheckPortAnnotation, port, DefaultHealthCheckPort))
+		} else {
+			parsed.HealthCheckPort = value
+		}
+	}
+
+	if hasInterval {
+		value, err := strconv.ParseInt(interval, 10, 64)
+		if err != nil || (value != fastHealthCheckInterval && value != DefaultHealthCheckInterval) {
+			warnings = append(warnings, fmt.Sprintf("invalid %s annotation: %s, must be %d or %d. Using "+
+				"default of %d", HealthCheckIntervalAnnotation, interval, fastHealthCheckInterval,
+				DefaultHealthCheckInterval, DefaultHealthCheckInterval))
+		} else {
+			parsed.HealthCheckInterval = value
+		}
+	}
+
+	return warnings
+}
+
+// parseGeoLocation normalises a geolocation, returning false if it isn't a two letter country code, a continent code
+// with continentPrefix, or DefaultGeoLocation.
+func parseGeoLocation(value string) (string, bool) {
+	if value == DefaultGeoLocation {
+		return value, true
+	}
+	if strings.HasPrefix(strings.ToLower(value), continentPrefix) {
+		continent := strings.ToUpper(value[len(continentPrefix):])
+		return continentPrefix + continent, continents[continent]
+	}
+	country := strings.ToUpper(value)
+	if len(country) != 2 || strings.Trim(country, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", false
+	}
+	return country, true
+}
+
+// AnnotationSupporter is implemented by frontend adapters which only support some of the record annotations.
+// Adapters which don't implement it support all of them.
+type AnnotationSupporter interface {
+	// SupportedAnnotations returns the record annotations the adapter supports.
+	SupportedAnnotations() []string
+}
+
+// AnnotationsSupportedBy returns the record annotations the adapter supports, in order.
+func AnnotationsSupportedBy(adapter FrontendAdapter) []string {
+	supported := recordAnnotations
+	if supporter, ok := adapter.(AnnotationSupporter); ok {
+		supported = supporter.SupportedAnnotations()
+	}
+	sorted := append([]string(nil), supported...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// UnsupportedAnnotations returns the record annotations present which the adapter doesn't support, in order.
+func UnsupportedAnnotations(adapter FrontendAdapter, annotations map[string]string) []string {
+	if _, ok := adapter.(AnnotationSupporter); !ok {
+		return nil
+	}
+
+	supported := make(map[string]bool)
+	for _, name := range AnnotationsSupportedBy(adapter) {
+		supported[name] = true
+	}
+
+	var unsupported []string
+	for _, name := range recordAnnotations {
+		if _, present := annotations[name]; present && !supported[name] {
+			unsupported = append(unsupported, name)
+		}
+	}
+	sort.Strings(unsupported)
+	return unsupported
+}
+
+// UnsupportedAnnotationError describes a record annotation which the frontend adapter of a DNS provider doesn't
+// support, so it's ignored.
+type UnsupportedAnnotationError struct {
+	Annotation string
+	Provider   string
+	Frontend   string
+}
+
+func (e *UnsupportedAnnotationError) Error() string {
+	return fmt.Sprintf("%s annotation isn't supported by the %s provider with the %s frontend", e.Annotation,
+		e.Provider, e.Frontend)
+}
+
+// FrontendName describes the frontend of the adapter, with its String method if it has one.
+func FrontendName(adapter FrontendAdapter) string {
+	if stringer, ok := adapter.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return "load balancer"
+}
+
+// CheckAnnotations returns an UnsupportedAnnotationError for each record annotation present which the adapter
+// doesn't support, in order. The frontend is described by FrontendName.
+func CheckAnnotations(adapter FrontendAdapter, provider string, annotations map[string]string) []error {
+	frontend := FrontendName(adapter)
+	var errs []error
+	for _, name := range UnsupportedAnnotations(adapter, annotations) {
+		errs = append(errs, &UnsupportedAnnotationError{Annotation: name, Provider: provider, Frontend: frontend})
+	}
+	return errs
+}
@@ -2,76 +2,282 @@ package adapter
 
 import (
 	"fmt"
+	"net"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
 	aws_elb "github.com/aws/aws-sdk-go/service/elb"
 	aws_alb "github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/elb"
+	"github.com/sky-uk/feed/util"
+	"github.com/sky-uk/feed/util/awscreds"
+	"github.com/sky-uk/feed/util/awspartition"
+	"github.com/sky-uk/feed/util/awsretry"
+	"github.com/sky-uk/feed/util/useragent"
+)
+
+const (
+	// AliasRecordType creates ALIAS (A) records pointing at the load balancers.
+	AliasRecordType = "alias"
+	// CNAMERecordType creates CNAME records pointing at the load balancers.
+	CNAMERecordType = "cname"
+
+	nlbType                 = "network"
+	maxTagQuery             = 20
+	credentialsExpiryWindow = time.Minute
 )
 
 // FindELBsFunc defines a function which find ELBs based on a label
 type FindELBsFunc func(elb.ELB, string) (map[string]elb.LoadBalancerDetails, error)
 
+// FindELBsByTagsFunc defines a function which find ELBs with all of a set of tags
+type FindELBsByTagsFunc func(elb.ELB, map[string]string) (map[string]elb.LoadBalancerDetails, error)
+
+// LookupIPFunc defines a function which resolves the IP addresses of a host
+type LookupIPFunc func(host string) ([]net.IP, error)
+
 // ALB represents the subset of AWS operations needed for dns_updater.go
 type ALB interface {
 	DescribeLoadBalancers(input *aws_alb.DescribeLoadBalancersInput) (*aws_alb.DescribeLoadBalancersOutput, error)
 }
 
-// AWSAdapterConfig describes the configuration of a FrontendAdapter which uses AWS ELBs and/or ALBs
+// NLB represents the subset of AWS operations needed for discovering NLBs
+type NLB interface {
+	ALB
+	DescribeTags(input *aws_alb.DescribeTagsInput) (*aws_alb.DescribeTagsOutput, error)
+}
+
+// CloudFront represents the subset of AWS operations needed for aliasing to CloudFront distributions
+type CloudFront interface {
+	ListDistributions(input *cloudfront.ListDistributionsInput) (*cloudfront.ListDistributionsOutput, error)
+}
+
+// AWSAdapterConfig describes the configuration of a FrontendAdapter which uses AWS ELBs, ALBs or NLBs.
+// ELBs are found by ELBTags, or by ELBLabelValue if there are no ELBTags. NLBs can be found by NLBNames, NLBLabelValue
+// or both. If EnableIPv6 is set, load balancers which resolve to
+// IPv6 addresses will also have AAAA records created for them.
+// RecordType is either AliasRecordType (the default) or CNAMERecordType. CNAMETTL is only used for CNAME records,
+// as ALIAS records have no TTL.
+// HealthCheckID is the Route53 health check associated with failover records. Region is also the region of
+// latency records.
+// If EnableCloudFront is set, CloudFront distributions are listed when the adapter is initialised, so hosts can
+// be aliased to them instead of the load balancers.
+// If AssumeRoleARN is set, the role is assumed when discovering load balancers. Otherwise the local credentials are
+// used, even if Route53 is accessed through a role in another account.
+// Partition is the id of the AWS partition of Region, which resolves the endpoints of the load balancer and CloudFront
+// clients, and the hosted zone of CloudFront distributions. Empty is the standard partition.
+// EndpointURL overrides the endpoint of the load balancer and CloudFront clients, e.g. to test against LocalStack.
+// Empty uses the default endpoints for Region.
+// UserAgent is appended to the User-Agent of the load balancer and CloudFront requests. Empty leaves it unchanged.
+// Retries is the number of times a failed request is retried, with the delay doubling from RetryBaseDelay up to
+// RetryMaxDelay, which default to the awsretry defaults.
+// DiscoveryInterval is how long discovered load balancers are cached for, before Frontends discovers them again.
+// Zero caches them forever, so they're only discovered by Initialise.
 type AWSAdapterConfig struct {
-	Region        string
-	HostedZoneID  string
-	ELBLabelValue string
-	ALBNames      []string
-	ALBClient     ALB
-	ELBClient     elb.ELB
-	ELBFinder     FindELBsFunc
+	Region            string
+	Partition         string
+	AssumeRoleARN     string
+	EndpointURL       string
+	UserAgent         string
+	Retries           int
+	RetryBaseDelay    time.Duration
+	RetryMaxDelay     time.Duration
+	HostedZoneIDs     []string
+	ELBLabelValue     string
+	ELBTags           map[string]string
+	ALBNames          []string
+	NLBNames          []string
+	NLBLabelValue     string
+	RecordType        string
+	CNAMETTL          time.Duration
+	EnableIPv6        bool
+	HealthCheckID     string
+	EnableCloudFront  bool
+	DiscoveryInterval time.Duration
+	ALBClient         ALB
+	NLBClient         NLB
+	ELBClient         elb.ELB
+	ELBFinder         FindELBsFunc
+	ELBTagsFinder     FindELBsByTagsFunc
+	LookupIP          LookupIPFunc
+	CloudFrontClient  CloudFront
 }
 
 type awsAdapter struct {
-	hostedZoneID     *string
+	hostedZoneIDs    []string
 	elbLabelValue    string
+	elbTags          map[string]string
 	albNames         []string
+	nlbNames         []string
+	nlbLabelValue    string
 	elb              elb.ELB
 	alb              ALB
+	nlb              NLB
 	findFrontEndElbs FindELBsFunc
+	findElbsByTags   FindELBsByTagsFunc
+	cnames           FrontendAdapter
+	enableIPv6       bool
+	lookupIP         LookupIPFunc
+	healthCheckID    string
+	region           string
+	cloudFront       CloudFront
+	cloudFrontZoneID string
+	distributions    map[string]DNSDetails
+	discovery        discoveryCache
 }
 
-// NewAWSAdapter creates a FrontendAdapter which interacts with AWS ELBs or ALBs.
+// discoveryCache holds the load balancers found by the last discovery.
+type discoveryCache struct {
+	sync.Mutex
+	interval     time.Duration
+	now          func() time.Time
+	frontends    map[string]DNSDetails
+	discoveredAt time.Time
+}
+
+// NewAWSAdapter creates a FrontendAdapter which interacts with AWS ELBs, ALBs or NLBs.
 func NewAWSAdapter(config *AWSAdapterConfig) (FrontendAdapter, error) {
-	if config.ALBClient == nil && config.ELBClient == nil {
-		session, err := session.NewSession(&aws.Config{Region: &config.Region})
+	partition, err := awspartition.Lookup(config.Partition)
+	if err != nil {
+		return nil, err
+	}
+	if config.EnableCloudFront && partition.CloudFrontHostedZoneID == "" {
+		return nil, fmt.Errorf("the %s partition has no CloudFront", partition.ID)
+	}
+
+	if config.ALBClient == nil && config.ELBClient == nil && config.NLBClient == nil {
+		sessionConfig := &aws.Config{Region: &config.Region, EndpointResolver: partition}
+		if config.EndpointURL != "" {
+			sessionConfig.Endpoint = aws.String(config.EndpointURL)
+		}
+		session, err := session.NewSession(sessionConfig)
 		if err != nil {
 			return nil, fmt.Errorf("unable to open AWS session: %v", err)
 		}
+		useragent.Add(session, config.UserAgent)
+		awscreds.UseWebIdentity(session)
+		lbConfig := request.WithRetryer(aws.NewConfig(),
+			awsretry.New(config.Retries, config.RetryBaseDelay, config.RetryMaxDelay))
+		if config.AssumeRoleARN != "" {
+			lbConfig.Credentials = stscreds.NewCredentials(session, config.AssumeRoleARN,
+				func(p *stscreds.AssumeRoleProvider) {
+					p.ExpiryWindow = credentialsExpiryWindow
+				})
+		}
 
-		config.ALBClient = aws_alb.New(session)
-		config.ELBClient = aws_elb.New(session)
+		elbv2 := aws_alb.New(session, lbConfig)
+		config.ALBClient = elbv2
+		config.NLBClient = elbv2
+		config.ELBClient = aws_elb.New(session, lbConfig)
+		config.CloudFrontClient = cloudfront.New(session, lbConfig)
 	}
 
 	if config.ELBFinder == nil {
 		config.ELBFinder = elb.FindFrontEndElbs
 	}
 
+	if config.ELBTagsFinder == nil {
+		config.ELBTagsFinder = elb.FindFrontEndElbsWithTags
+	}
+
+	elbLabelValue := config.ELBLabelValue
+	if len(config.ELBTags) > 0 && elbLabelValue != "" {
+		log.Warnf("Both elb tags %v and elb label value %s are set, ignoring the elb label value", config.ELBTags,
+			elbLabelValue)
+		elbLabelValue = ""
+	}
+
+	if config.LookupIP == nil {
+		config.LookupIP = net.LookupIP
+	}
+
+	var cnames FrontendAdapter
+	switch config.RecordType {
+	case "", AliasRecordType:
+	case CNAMERecordType:
+		cnames = NewStaticHostnameAdapter(nil, config.CNAMETTL, nil)
+	default:
+		return nil, fmt.Errorf("unknown record type %q, must be %s or %s", config.RecordType, AliasRecordType,
+			CNAMERecordType)
+	}
+
+	var cloudFront CloudFront
+	if config.EnableCloudFront {
+		cloudFront = config.CloudFrontClient
+	}
+
 	return &awsAdapter{
-		hostedZoneID:     aws.String(config.HostedZoneID),
-		elbLabelValue:    config.ELBLabelValue,
+		hostedZoneIDs:    config.HostedZoneIDs,
+		elbLabelValue:    elbLabelValue,
+		elbTags:          config.ELBTags,
 		albNames:         config.ALBNames,
+		nlbNames:         config.NLBNames,
+		nlbLabelValue:    config.NLBLabelValue,
 		elb:              config.ELBClient,
 		alb:              config.ALBClient,
+		nlb:              config.NLBClient,
 		findFrontEndElbs: config.ELBFinder,
+		findElbsByTags:   config.ELBTagsFinder,
+		cnames:           cnames,
+		enableIPv6:       config.EnableIPv6,
+		lookupIP:         config.LookupIP,
+		healthCheckID:    config.HealthCheckID,
+		region:           config.Region,
+		cloudFront:       cloudFront,
+		cloudFrontZoneID: partition.CloudFrontHostedZoneID,
+		discovery:        discoveryCache{interval: config.DiscoveryInterval, now: time.Now},
 	}, nil
 }
 
 func (a *awsAdapter) Initialise() (map[string]DNSDetails, error) {
-	if a.elbLabelValue != "" && len(a.albNames) > 0 {
-		return nil, fmt.Errorf("can't specify both elb label value (%s) and alb names (%v) - only one or the other may be"+
-			" specified", a.elbLabelValue, a.albNames)
+	if a.usesELBs() && len(a.albNames) > 0 {
+		return nil, fmt.Errorf("can't specify both elb label value (%s) or tags (%v) and alb names (%v) - only one or"+
+			" the other may be specified", a.elbLabelValue, a.elbTags, a.albNames)
+	}
+
+	if a.usesNLBs() && (a.usesELBs() || len(a.albNames) > 0) {
+		return nil, fmt.Errorf("can't specify nlbs together with elb label value (%s), elb tags (%v) or alb names (%v)"+
+			" - only one type of load balancer may be specified", a.elbLabelValue, a.elbTags, a.albNames)
 	}
 
+	a.discovery.Lock()
+	defer a.discovery.Unlock()
+	schemeToFrontendMap, err := a.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.initCloudFront(); err != nil {
+		return nil, err
+	}
+
+	return schemeToFrontendMap, nil
+}
+
+// Frontends returns the load balancers found by the last discovery, discovering them again if they were found more
+// than the discovery interval ago.
+func (a *awsAdapter) Frontends() (map[string]DNSDetails, error) {
+	a.discovery.Lock()
+	defer a.discovery.Unlock()
+	if a.discovery.frontends != nil &&
+		(a.discovery.interval <= 0 || a.discovery.now().Sub(a.discovery.discoveredAt) < a.discovery.interval) {
+		return copyFrontends(a.discovery.frontends), nil
+	}
+
+	log.Debug("Discovering load balancers")
+	return a.discover()
+}
+
+// discover queries AWS for the load balancers, and caches them. The discovery lock must be held.
+func (a *awsAdapter) discover() (map[string]DNSDetails, error) {
 	schemeToFrontendMap := make(map[string]DNSDetails)
 	if err := a.initELBs(schemeToFrontendMap); err != nil {
 		return nil, err
@@ -81,15 +287,77 @@ func (a *awsAdapter) Initialise() (map[string]DNSDetails, error) {
 		return nil, err
 	}
 
-	return schemeToFrontendMap, nil
+	if err := a.initNLBs(schemeToFrontendMap); err != nil {
+		return nil, err
+	}
+
+	if a.enableIPv6 {
+		a.detectIPv6(schemeToFrontendMap)
+	}
+
+	for scheme, details := range schemeToFrontendMap {
+		details.HealthCheckID = a.healthCheckID
+		details.Region = a.region
+		schemeToFrontendMap[scheme] = details
+	}
+
+	a.discovery.frontends = schemeToFrontendMap
+	a.discovery.discoveredAt = a.discovery.now()
+	return copyFrontends(schemeToFrontendMap), nil
+}
+
+func copyFrontends(frontends map[string]DNSDetails) map[string]DNSDetails {
+	copied := make(map[string]DNSDetails, len(frontends))
+	for scheme, details := range frontends {
+		copied[scheme] = details
+	}
+	return copied
+}
+
+func (a *awsAdapter) detectIPv6(schemeToFrontendMap map[string]DNSDetails) {
+	for scheme, details := range schemeToFrontendMap {
+		host := strings.TrimSuffix(details.DNSName, ".")
+		ips, err := a.lookupIP(host)
+		if err != nil {
+			log.Warnf("Unable to resolve %s, not creating AAAA records for it: %v", host, err)
+			continue
+		}
+
+		for _, ip := range ips {
+			if ip.To4() == nil {
+				details.IPv6 = true
+			}
+		}
+
+		if details.IPv6 {
+			log.Infof("Load balancer %s has IPv6 addresses, AAAA records will be created", host)
+			schemeToFrontendMap[scheme] = details
+		} else {
+			log.Debugf("Load balancer %s has no IPv6 addresses, skipping AAAA records", host)
+		}
+	}
+}
+
+func (a *awsAdapter) usesELBs() bool {
+	return a.elbLabelValue != "" || len(a.elbTags) > 0
+}
+
+func (a *awsAdapter) usesNLBs() bool {
+	return len(a.nlbNames) > 0 || a.nlbLabelValue != ""
 }
 
 func (a *awsAdapter) initELBs(schemeToFrontendMap map[string]DNSDetails) error {
-	if a.elbLabelValue == "" {
+	if !a.usesELBs() {
 		return nil
 	}
 
-	elbs, err := a.findFrontEndElbs(a.elb, a.elbLabelValue)
+	var elbs map[string]elb.LoadBalancerDetails
+	var err error
+	if len(a.elbTags) > 0 {
+		elbs, err = a.findElbsByTags(a.elb, a.elbTags)
+	} else {
+		elbs, err = a.findFrontEndElbs(a.elb, a.elbLabelValue)
+	}
 	if err != nil {
 		return fmt.Errorf("unable to find front end load balancers: %v", err)
 	}
@@ -132,8 +400,155 @@ func (a *awsAdapter) initALBs(schemeToFrontendMap map[string]DNSDetails) error {
 	return nil
 }
 
+func (a *awsAdapter) initNLBs(schemeToFrontendMap map[string]DNSDetails) error {
+	if !a.usesNLBs() {
+		return nil
+	}
+
+	nlbs, err := a.findNLBs()
+	if err != nil {
+		return fmt.Errorf("unable to find front end network load balancers: %v", err)
+	}
+
+	for _, lb := range nlbs {
+		log.Infof("Found frontend nlb %s", *lb.LoadBalancerName)
+		schemeToFrontendMap[*lb.Scheme] = DNSDetails{DNSName: *lb.DNSName + ".", HostedZoneID: *lb.CanonicalHostedZoneId}
+	}
+
+	return nil
+}
+
+// findNLBs returns the NLBs matching the configured names, filtered by the elb.ElbTag label if one was given.
+func (a *awsAdapter) findNLBs() ([]*aws_alb.LoadBalancer, error) {
+	req := &aws_alb.DescribeLoadBalancersInput{}
+	if len(a.nlbNames) > 0 {
+		req.Names = aws.StringSlice(a.nlbNames)
+	}
+
+	var nlbs []*aws_alb.LoadBalancer
+	for {
+		resp, err := a.nlb.DescribeLoadBalancers(req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, lb := range resp.LoadBalancers {
+			if aws.StringValue(lb.Type) == nlbType {
+				nlbs = append(nlbs, lb)
+			}
+		}
+
+		if resp.NextMarker == nil {
+			break
+		}
+
+		req.Marker = resp.NextMarker
+	}
+
+	if a.nlbLabelValue == "" {
+		return nlbs, nil
+	}
+
+	return a.filterByLabel(nlbs)
+}
+
+func (a *awsAdapter) filterByLabel(lbs []*aws_alb.LoadBalancer) ([]*aws_alb.LoadBalancer, error) {
+	byArn := make(map[string]*aws_alb.LoadBalancer)
+	var arns []*string
+	for _, lb := range lbs {
+		byArn[*lb.LoadBalancerArn] = lb
+		arns = append(arns, lb.LoadBalancerArn)
+	}
+
+	var labelled []*aws_alb.LoadBalancer
+	for _, partition := range util.Partition(len(arns), maxTagQuery) {
+		output, err := a.nlb.DescribeTags(&aws_alb.DescribeTagsInput{
+			ResourceArns: arns[partition.Low:partition.High],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to describe tags: %v", err)
+		}
+
+		for _, description := range output.TagDescriptions {
+			for _, tag := range description.Tags {
+				if *tag.Key == elb.ElbTag && *tag.Value == a.nlbLabelValue {
+					labelled = append(labelled, byArn[*description.ResourceArn])
+				}
+			}
+		}
+	}
+
+	return labelled, nil
+}
+
+// initCloudFront caches the domain of each CloudFront distribution, so hosts can be aliased to them without
+// querying CloudFront on every update.
+func (a *awsAdapter) initCloudFront() error {
+	if a.cloudFront == nil {
+		return nil
+	}
+
+	distributions := make(map[string]DNSDetails)
+	req := &cloudfront.ListDistributionsInput{}
+	for {
+		resp, err := a.cloudFront.ListDistributions(req)
+		if err != nil {
+			return fmt.Errorf("unable to list cloudfront distributions: %v", err)
+		}
+
+		for _, distribution := range resp.DistributionList.Items {
+			distributions[*distribution.Id] = DNSDetails{
+				DNSName:      *distribution.DomainName + ".",
+				HostedZoneID: a.cloudFrontZoneID,
+			}
+		}
+
+		if !aws.BoolValue(resp.DistributionList.IsTruncated) {
+			break
+		}
+
+		req.Marker = resp.DistributionList.NextMarker
+	}
+
+	log.Infof("Found %d cloudfront distributions", len(distributions))
+	a.distributions = distributions
+	return nil
+}
+
+func (a *awsAdapter) CloudFrontDistributions() map[string]DNSDetails {
+	return a.distributions
+}
+
+func (a *awsAdapter) String() string {
+	return "AWS load balancer"
+}
+
+// SupportedAnnotations leaves out the TTL of ALIAS records, which have none, and CloudFront unless it's enabled.
+func (a *awsAdapter) SupportedAnnotations() []string {
+	supported := []string{WeightAnnotation, FailoverRoleAnnotation, RoutingPolicyAnnotation, GeoAnnotation,
+		TXTAnnotation, ExcludeAnnotation, ZonesAnnotation, HealthCheckPathAnnotation, HealthCheckPortAnnotation,
+		HealthCheckIntervalAnnotation}
+	if a.cnames != nil {
+		supported = append(supported, TTLAnnotation)
+	}
+	if a.cloudFront != nil {
+		supported = append(supported, CloudFrontDistributionAnnotation)
+	}
+	return supported
+}
+
 func (a *awsAdapter) CreateChange(action string, host string, details DNSDetails, recordExists bool, existingRecord *ConsolidatedRecord) *route53.Change {
+	// Distributions and apex hosts are always aliased, even when load balancers have CNAMEs.
+	if a.cnames != nil && details.HostedZoneID != a.cloudFrontZoneID && !details.Apex {
+		return a.cnames.CreateChange(action, host, details, recordExists, existingRecord)
+	}
+
 	if !recordExists {
+		if a.cnames != nil && details.Apex && action != "DELETE" {
+			log.Infof("Creating an ALIAS record instead of a CNAME for %s, as CNAMEs aren't allowed at the zone apex",
+				host)
+		}
+
 		set := &route53.ResourceRecordSet{
 			Name: aws.String(host),
 		}
@@ -156,7 +571,12 @@ func (a *awsAdapter) CreateChange(action string, host string, details DNSDetails
 }
 
 func (a *awsAdapter) IsManaged(rrs *route53.ResourceRecordSet) (*ConsolidatedRecord, bool) {
-	if *rrs.Type == route53.RRTypeA && rrs.AliasTarget != nil {
+	// Alias records exist alongside CNAMEs for distributions and apex hosts.
+	if a.cnames != nil && rrs.AliasTarget == nil {
+		return a.cnames.IsManaged(rrs)
+	}
+
+	if (*rrs.Type == route53.RRTypeA || *rrs.Type == route53.RRTypeAaaa) && rrs.AliasTarget != nil {
 		return &ConsolidatedRecord{
 			Name:            *rrs.Name,
 			PointsTo:        *rrs.AliasTarget.DNSName,
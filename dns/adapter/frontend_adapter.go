@@ -1,6 +1,11 @@
 package adapter
 
-import "github.com/aws/aws-sdk-go/service/route53"
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/route53"
+	"k8s.io/client-go/pkg/api/v1"
+)
 
 // FrontendAdapter defines operations which vary based on the type of load balancer being used for ingress.
 type FrontendAdapter interface {
@@ -9,16 +14,62 @@ type FrontendAdapter interface {
 	IsManaged(*route53.ResourceRecordSet) (*ConsolidatedRecord, bool)
 }
 
-// DNSDetails defines a DNS name and, optionally, how it maps to an AWS Route53 zone
+// CloudFrontAdapter is implemented by frontend adapters which can alias hosts to CloudFront distributions instead of
+// the load balancers.
+type CloudFrontAdapter interface {
+	// CloudFrontDistributions returns the details of an alias to each distribution found when the adapter was
+	// initialised, by distribution id.
+	CloudFrontDistributions() map[string]DNSDetails
+}
+
+// NamedFrontendAdapter is implemented by frontend adapters with load balancers which ingresses select by name, with
+// the LBNameAnnotation, instead of by scheme.
+type NamedFrontendAdapter interface {
+	// NamedFrontends returns the details of each named load balancer, by name.
+	NamedFrontends() map[string]DNSDetails
+}
+
+// StatusFrontendAdapter is implemented by frontend adapters which point the hosts of each ingress at the load
+// balancer in the ingress's status, instead of by scheme.
+type StatusFrontendAdapter interface {
+	// StatusFrontend returns the details of the load balancer in an ingress's status, or false if it has none.
+	StatusFrontend(status v1.LoadBalancerStatus) (DNSDetails, bool)
+}
+
+// DiscoveringAdapter is implemented by frontend adapters which discover their load balancers, so they can be
+// rediscovered while running, e.g. if a load balancer is recreated.
+type DiscoveringAdapter interface {
+	// Frontends returns the load balancers by scheme, as Initialise does. They're cached, and only rediscovered once
+	// the cache expires.
+	Frontends() (map[string]DNSDetails, error)
+}
+
+// DNSDetails defines a DNS name and, optionally, how it maps to an AWS Route53 zone.
+// IPv6 is true if the load balancer has IPv6 addresses, so AAAA records should be created for it.
+// TTL overrides the adapter's TTL for CNAME records, if set. ALIAS records have no TTL.
+// HealthCheckID is the Route53 health check to associate with failover records, if any.
+// Region is the AWS region of the load balancer, used for latency records.
+// Apex is true if the host is the domain of its hosted zone, where CNAMEs aren't allowed, so adapters which create
+// CNAMEs create ALIAS records instead if they can.
 type DNSDetails struct {
-	DNSName      string
-	HostedZoneID string
+	DNSName       string
+	HostedZoneID  string
+	IPv6          bool
+	TTL           time.Duration
+	HealthCheckID string
+	Region        string
+	Apex          bool
 }
 
 // ConsolidatedRecord describes how a DNS name maps to a static load balancer or AWS ELBs or ALBs.
+// AutomaticTTL is true if the provider sets the record's TTL itself, e.g. for proxied Cloudflare records, so its TTL
+// isn't managed.
 type ConsolidatedRecord struct {
 	Name            string
+	Type            string
 	PointsTo        string
 	AliasHostedZone string
 	TTL             int64
+	AutomaticTTL    bool
+	RoutingPolicy
 }
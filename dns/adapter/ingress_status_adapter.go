@@ -0,0 +1,128 @@
+package adapter
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+type ingressStatusAdapter struct {
+	ttl *int64
+}
+
+// NewIngressStatusAdapter creates a FrontendAdapter which points the hosts of each ingress at the load balancer in
+// the ingress's status, as set by the ingress controller. Load balancers with a hostname get CNAME records, and those
+// with only IPv4 addresses get A records containing all the addresses.
+func NewIngressStatusAdapter(ttl time.Duration) FrontendAdapter {
+	return &ingressStatusAdapter{aws.Int64(int64(ttl.Seconds()))}
+}
+
+// Initialise returns no load balancers, as they're found in the status of each ingress.
+func (s *ingressStatusAdapter) Initialise() (map[string]DNSDetails, error) {
+	return make(map[string]DNSDetails), nil
+}
+
+// StatusFrontend returns the load balancer in the status. CNAMEs can only have one value, so the first hostname is
+// used if there are any, otherwise all the IPv4 addresses are.
+func (s *ingressStatusAdapter) StatusFrontend(status v1.LoadBalancerStatus) (DNSDetails, bool) {
+	var ips []string
+	for _, ingress := range status.Ingress {
+		if ingress.Hostname != "" {
+			return DNSDetails{DNSName: strings.TrimSuffix(ingress.Hostname, ".")}, true
+		}
+		if ip := net.ParseIP(ingress.IP); ip != nil && ip.To4() != nil {
+			ips = append(ips, ingress.IP)
+		}
+	}
+
+	if len(ips) == 0 {
+		return DNSDetails{}, false
+	}
+	return DNSDetails{DNSName: joinIPs(ips)}, true
+}
+
+func (s *ingressStatusAdapter) CreateChange(action string, host string, details DNSDetails,
+	recordExists bool, existingRecord *ConsolidatedRecord) *route53.Change {
+
+	ttl := s.ttl
+	if details.TTL > 0 {
+		ttl = aws.Int64(int64(details.TTL.Seconds()))
+	}
+
+	if recordExists && existingRecord.TTL == *ttl && action != "DELETE" {
+		return nil
+	}
+
+	rrs := &route53.ResourceRecordSet{
+		Name: aws.String(host),
+		TTL:  ttl,
+	}
+	if isIPs(details.DNSName) {
+		rrs.Type = aws.String(route53.RRTypeA)
+		for _, ip := range strings.Split(details.DNSName, ipSeparator) {
+			rrs.ResourceRecords = append(rrs.ResourceRecords, &route53.ResourceRecord{Value: aws.String(ip)})
+		}
+	} else {
+		rrs.Type = aws.String(route53.RRTypeCname)
+		rrs.ResourceRecords = []*route53.ResourceRecord{{Value: aws.String(details.DNSName)}}
+	}
+
+	return &route53.Change{
+		Action:            aws.String(action),
+		ResourceRecordSet: rrs,
+	}
+}
+
+func (s *ingressStatusAdapter) String() string {
+	return "ingress status"
+}
+
+// SupportedAnnotations leaves out latency records, as the region of the load balancers is unknown, CloudFront, and
+// named load balancers, as the load balancer is always the one in the ingress's status. Health checks are left out
+// too, as the status may only have IPs.
+func (s *ingressStatusAdapter) SupportedAnnotations() []string {
+	return []string{WeightAnnotation, FailoverRoleAnnotation, GeoAnnotation, TTLAnnotation, TXTAnnotation,
+		ExcludeAnnotation, ZonesAnnotation}
+}
+
+func (s *ingressStatusAdapter) IsManaged(rrs *route53.ResourceRecordSet) (*ConsolidatedRecord, bool) {
+	if rrs.AliasTarget != nil || len(rrs.ResourceRecords) == 0 {
+		return nil, false
+	}
+
+	var values []string
+	for _, rr := range rrs.ResourceRecords {
+		values = append(values, aws.StringValue(rr.Value))
+	}
+
+	var pointsTo string
+	switch aws.StringValue(rrs.Type) {
+	case route53.RRTypeCname:
+		pointsTo = strings.TrimSuffix(values[0], ".")
+	case route53.RRTypeA:
+		pointsTo = joinIPs(values)
+	default:
+		return nil, false
+	}
+
+	record := ConsolidatedRecord{
+		Name:     aws.StringValue(rrs.Name),
+		PointsTo: pointsTo,
+		TTL:      aws.Int64Value(rrs.TTL),
+	}
+	return &record, true
+}
+
+// isIPs returns true if the DNS name is a list of IPv4 addresses, rather than a hostname.
+func isIPs(dnsName string) bool {
+	for _, value := range strings.Split(dnsName, ipSeparator) {
+		if ip := net.ParseIP(value); ip == nil || ip.To4() == nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package adapter
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// RoutingPolicy describes how Route53 chooses between record sets sharing the same name and type.
+// The zero value describes a simple record set.
+type RoutingPolicy struct {
+	// SetIdentifier differentiates record sets which share the same name and type.
+	SetIdentifier string
+	// Weight of a weighted record set, nil if the record set isn't weighted.
+	Weight *int64
+	// Failover is PRIMARY or SECONDARY for failover record sets, empty otherwise.
+	Failover string
+	// HealthCheckID is the health check which determines if the record set is healthy, if any.
+	HealthCheckID string
+	// Region of a latency record set, empty otherwise.
+	Region string
+	// GeoLocation of a geolocation record set, empty otherwise. It's a country code, e.g. GB, with the subdivision
+	// if there is one, e.g. US-CA, continent: and a continent code, e.g. continent:EU, or * for the default record set.
+	GeoLocation string
+}
+
+// RoutingPolicyOf returns the routing policy of an existing record set.
+func RoutingPolicyOf(rrs *route53.ResourceRecordSet) RoutingPolicy {
+	return RoutingPolicy{
+		SetIdentifier: aws.StringValue(rrs.SetIdentifier),
+		Weight:        rrs.Weight,
+		Failover:      aws.StringValue(rrs.Failover),
+		HealthCheckID: aws.StringValue(rrs.HealthCheckId),
+		Region:        aws.StringValue(rrs.Region),
+		GeoLocation:   geoLocationOf(rrs.GeoLocation),
+	}
+}
+
+func geoLocationOf(location *route53.GeoLocation) string {
+	switch {
+	case location == nil:
+		return ""
+	case location.ContinentCode != nil:
+		return continentPrefix + aws.StringValue(location.ContinentCode)
+	case location.SubdivisionCode != nil:
+		return aws.StringValue(location.CountryCode) + "-" + aws.StringValue(location.SubdivisionCode)
+	default:
+		return aws.StringValue(location.CountryCode)
+	}
+}
+
+func geoLocation(location string) *route53.GeoLocation {
+	if strings.HasPrefix(location, continentPrefix) {
+		return &route53.GeoLocation{ContinentCode: aws.String(strings.TrimPrefix(location, continentPrefix))}
+	}
+	parts := strings.SplitN(location, "-", 2)
+	geo := &route53.GeoLocation{CountryCode: aws.String(parts[0])}
+	if len(parts) == 2 {
+		geo.SubdivisionCode = aws.String(parts[1])
+	}
+	return geo
+}
+
+// Apply sets the routing policy on a record set.
+func (p RoutingPolicy) Apply(rrs *route53.ResourceRecordSet) {
+	if p.SetIdentifier != "" {
+		rrs.SetIdentifier = aws.String(p.SetIdentifier)
+	}
+	rrs.Weight = p.Weight
+	if p.Failover != "" {
+		rrs.Failover = aws.String(p.Failover)
+	}
+	if p.HealthCheckID != "" {
+		rrs.HealthCheckId = aws.String(p.HealthCheckID)
+	}
+	if p.Region != "" {
+		rrs.Region = aws.String(p.Region)
+	}
+	if p.GeoLocation != "" {
+		rrs.GeoLocation = geoLocation(p.GeoLocation)
+	}
+}
+
+// IsSimple returns true if the policy describes a simple record set.
+func (p RoutingPolicy) IsSimple() bool {
+	return p.SetIdentifier == ""
+}
+
+// Equal returns true if both policies route traffic in the same way.
+func (p RoutingPolicy) Equal(other RoutingPolicy) bool {
+	return p.SetIdentifier == other.SetIdentifier && equalInt64(p.Weight, other.Weight) &&
+		p.Failover == other.Failover && p.HealthCheckID == other.HealthCheckID && p.Region == other.Region &&
+		p.GeoLocation == other.GeoLocation
+}
+
+func equalInt64(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
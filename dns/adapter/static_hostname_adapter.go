@@ -9,31 +9,56 @@ import (
 
 type staticHostnameAdapter struct {
 	addressesWithScheme map[string]string
+	addressesWithName   map[string]string
+	ttlsWithScheme      map[string]time.Duration
 	ttl                 *int64
 }
 
 // NewStaticHostnameAdapter creates a FrontendAdapter which interacts with load balancers accessed by static hostnames.
-func NewStaticHostnameAdapter(addressesWithScheme map[string]string, ttl time.Duration) FrontendAdapter {
-	return &staticHostnameAdapter{addressesWithScheme, aws.Int64(int64(ttl.Seconds()))}
+// The CNAME records for each scheme have the TTL in ttlsWithScheme, or ttl if the scheme has none.
+func NewStaticHostnameAdapter(addressesWithScheme map[string]string, ttl time.Duration,
+	ttlsWithScheme map[string]time.Duration) FrontendAdapter {
+	return NewNamedStaticHostnameAdapter(addressesWithScheme, nil, ttl, ttlsWithScheme)
+}
+
+// NewNamedStaticHostnameAdapter creates a static hostname FrontendAdapter which also has the load balancers in
+// addressesWithName, which ingresses select with the LBNameAnnotation. Their CNAME records have the TTL ttl.
+func NewNamedStaticHostnameAdapter(addressesWithScheme, addressesWithName map[string]string, ttl time.Duration,
+	ttlsWithScheme map[string]time.Duration) FrontendAdapter {
+	return &staticHostnameAdapter{addressesWithScheme, addressesWithName, ttlsWithScheme,
+		aws.Int64(int64(ttl.Seconds()))}
 }
 
 func (s *staticHostnameAdapter) Initialise() (map[string]DNSDetails, error) {
 	schemeToFrontendMap := make(map[string]DNSDetails)
 	for scheme, address := range s.addressesWithScheme {
-		schemeToFrontendMap[scheme] = DNSDetails{DNSName: address}
+		schemeToFrontendMap[scheme] = DNSDetails{DNSName: address, TTL: s.ttlsWithScheme[scheme]}
 	}
 
 	return schemeToFrontendMap, nil
 }
 
+func (s *staticHostnameAdapter) NamedFrontends() map[string]DNSDetails {
+	named := make(map[string]DNSDetails)
+	for name, address := range s.addressesWithName {
+		named[name] = DNSDetails{DNSName: address}
+	}
+	return named
+}
+
 func (s *staticHostnameAdapter) CreateChange(action string, host string, details DNSDetails,
 	recordExists bool, existingRecord *ConsolidatedRecord) *route53.Change {
 
-	if recordExists && existingRecord.TTL != *s.ttl || !recordExists || action == "DELETE" {
+	ttl := s.ttl
+	if details.TTL > 0 {
+		ttl = aws.Int64(int64(details.TTL.Seconds()))
+	}
+
+	if recordExists && existingRecord.TTL != *ttl || !recordExists || action == "DELETE" {
 		rrs := &route53.ResourceRecordSet{
 			Name: aws.String(host),
 			Type: aws.String("CNAME"),
-			TTL:  s.ttl,
+			TTL:  ttl,
 			ResourceRecords: []*route53.ResourceRecord{
 				{
 					Value: aws.String(details.DNSName),
@@ -50,6 +75,18 @@ func (s *staticHostnameAdapter) CreateChange(action string, host string, details
 	return nil
 }
 
+func (s *staticHostnameAdapter) String() string {
+	return "static hostname"
+}
+
+// SupportedAnnotations leaves out latency records, as the region of the load balancers is unknown, and CloudFront.
+// It's the only adapter with named load balancers.
+func (s *staticHostnameAdapter) SupportedAnnotations() []string {
+	return []string{WeightAnnotation, FailoverRoleAnnotation, GeoAnnotation, TTLAnnotation, TXTAnnotation,
+		ExcludeAnnotation, LBNameAnnotation, ZonesAnnotation, HealthCheckPathAnnotation, HealthCheckPortAnnotation,
+		HealthCheckIntervalAnnotation}
+}
+
 func (s *staticHostnameAdapter) IsManaged(rrs *route53.ResourceRecordSet) (*ConsolidatedRecord, bool) {
 	if *rrs.Type == route53.RRTypeCname {
 		record := ConsolidatedRecord{
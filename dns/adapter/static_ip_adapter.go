@@ -0,0 +1,97 @@
+package adapter
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// ipSeparator joins the IPs of a load balancer into the DNSName used to identify it.
+const ipSeparator = ","
+
+type staticIPAdapter struct {
+	ipsWithScheme map[string][]string
+	ttl           *int64
+}
+
+// NewStaticIPAdapter creates a FrontendAdapter which creates A records for load balancers accessed by a static
+// set of IPv4 addresses. Each record contains all the IPs for its scheme, so resolvers choose between them.
+func NewStaticIPAdapter(ipsWithScheme map[string][]string, ttl time.Duration) FrontendAdapter {
+	return &staticIPAdapter{ipsWithScheme, aws.Int64(int64(ttl.Seconds()))}
+}
+
+func (s *staticIPAdapter) Initialise() (map[string]DNSDetails, error) {
+	schemeToFrontendMap := make(map[string]DNSDetails)
+	for scheme, ips := range s.ipsWithScheme {
+		schemeToFrontendMap[scheme] = DNSDetails{DNSName: joinIPs(ips)}
+	}
+
+	return schemeToFrontendMap, nil
+}
+
+func (s *staticIPAdapter) CreateChange(action string, host string, details DNSDetails,
+	recordExists bool, existingRecord *ConsolidatedRecord) *route53.Change {
+
+	ttl := s.ttl
+	if details.TTL > 0 {
+		ttl = aws.Int64(int64(details.TTL.Seconds()))
+	}
+
+	if recordExists && existingRecord.TTL == *ttl && action != "DELETE" {
+		return nil
+	}
+
+	var values []*route53.ResourceRecord
+	for _, ip := range strings.Split(details.DNSName, ipSeparator) {
+		values = append(values, &route53.ResourceRecord{Value: aws.String(ip)})
+	}
+
+	return &route53.Change{
+		Action: aws.String(action),
+		ResourceRecordSet: &route53.ResourceRecordSet{
+			Name:            aws.String(host),
+			Type:            aws.String(route53.RRTypeA),
+			TTL:             ttl,
+			ResourceRecords: values,
+		},
+	}
+}
+
+func (s *staticIPAdapter) String() string {
+	return "static IP"
+}
+
+// SupportedAnnotations leaves out latency records, as the region of the load balancers is unknown, CloudFront, and
+// health checks, which check a hostname.
+func (s *staticIPAdapter) SupportedAnnotations() []string {
+	return []string{WeightAnnotation, FailoverRoleAnnotation, GeoAnnotation, TTLAnnotation, TXTAnnotation,
+		ExcludeAnnotation, ZonesAnnotation}
+}
+
+func (s *staticIPAdapter) IsManaged(rrs *route53.ResourceRecordSet) (*ConsolidatedRecord, bool) {
+	if aws.StringValue(rrs.Type) != route53.RRTypeA || rrs.AliasTarget != nil || len(rrs.ResourceRecords) == 0 {
+		return nil, false
+	}
+
+	var ips []string
+	for _, rr := range rrs.ResourceRecords {
+		ips = append(ips, aws.StringValue(rr.Value))
+	}
+	record := ConsolidatedRecord{
+		Name:     aws.StringValue(rrs.Name),
+		PointsTo: joinIPs(ips),
+		TTL:      aws.Int64Value(rrs.TTL),
+	}
+	return &record, true
+}
+
+// joinIPs returns the IPs in a consistent order, so records are identified regardless of the order Route53
+// returns their values in.
+func joinIPs(ips []string) string {
+	sorted := append([]string(nil), ips...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ipSeparator)
+}
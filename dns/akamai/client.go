@@ -0,0 +1,287 @@
+/*
+Package akamai is the Akamai Edge DNS provider of feed-dns. Edge DNS keeps each name and type as a record set with
+its rdata, which maps onto a Route53 record set directly, so a change creates, replaces or deletes one record set
+through the config-dns API. Every request is signed with the EdgeGrid credentials of an API client, with a fresh
+nonce and timestamp.
+*/
+package akamai
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/dns/recordset"
+)
+
+const (
+	// pageSize is the number of record sets listed per request.
+	pageSize       = 500
+	requestTimeout = 30 * time.Second
+)
+
+// Capabilities are those of a primary Edge DNS zone through the config-dns API, which has record sets of any TTL but
+// none of Akamai's traffic management.
+var Capabilities = r53.Capabilities{Provider: "akamai", IPv6: true, TXT: true, MaxTTL: r53.MaxTTL}
+
+// Config describes the Edge DNS zone to manage and how to reach the API.
+// Host is the host of the API client's credentials, e.g. akab-xxx.luna.akamaiapis.net, or a URL for testing.
+// ClientToken, ClientSecret and AccessToken are its EdgeGrid credentials, with access to the Zone, which is the
+// zone's domain, e.g. example.com.
+type Config struct {
+	Host         string
+	ClientToken  string
+	ClientSecret string
+	AccessToken  string
+	Zone         string
+}
+
+type client struct {
+	http        *http.Client
+	baseURL     string
+	credentials credentials
+	zone        string
+	now         func() time.Time
+	nonce       func() string
+	lookedUp    bool
+}
+
+// recordSet is a record set of the Edge DNS API, named by its domain name without a trailing period.
+type recordSet struct {
+	Name  string   `json:"name"`
+	Type  string   `json:"type"`
+	TTL   int64    `json:"ttl"`
+	RData []string `json:"rdata"`
+}
+
+type recordSetsResponse struct {
+	Metadata struct {
+		Page          int `json:"page"`
+		PageSize      int `json:"pageSize"`
+		TotalElements int `json:"totalElements"`
+	} `json:"metadata"`
+	RecordSets []recordSet `json:"recordsets"`
+}
+
+// NewUpdater creates a dns updater of Edge DNS zones, named by the hosted zone ids of the updater config, which are
+// all signed for with the EdgeGrid credentials of the config.
+func NewUpdater(lbAdapter adapter.FrontendAdapter, updaterConfig dns.Config, config Config) controller.Updater {
+	updaterConfig.ZoneClient = func(zone string) r53.Route53Client {
+		zoneConfig := config
+		zoneConfig.Zone = zone
+		return New(zoneConfig)
+	}
+	return dns.New(lbAdapter, updaterConfig)
+}
+
+// New creates a client of an Edge DNS zone. Its record sets are listed a page at a time, and each request is signed
+// with the EdgeGrid credentials of the config.
+func New(config Config) r53.Route53Client {
+	baseURL := config.Host
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+	return &client{
+		http:    &http.Client{Timeout: requestTimeout},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		credentials: credentials{
+			clientToken:  config.ClientToken,
+			clientSecret: config.ClientSecret,
+			accessToken:  config.AccessToken,
+		},
+		zone:  strings.TrimSuffix(config.Zone, "."),
+		now:   time.Now,
+		nonce: newNonce,
+	}
+}
+
+// Capabilities of the client.
+func (c *client) Capabilities() r53.Capabilities {
+	return Capabilities
+}
+
+// GetHostedZoneDomain looks up the zone, which fails if the credentials are invalid, and returns its domain with a
+// trailing period.
+func (c *client) GetHostedZoneDomain() (string, error) {
+	if err := c.do(http.MethodGet, c.zonePath(""), nil, nil); err != nil {
+		return "", fmt.Errorf("unable to look up Akamai zone %s: %v", c.zone, err)
+	}
+	c.lookedUp = true
+	return c.zone + ".", nil
+}
+
+// GetRecords returns the CNAME, A and AAAA record sets of the zone.
+func (c *client) GetRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsAddress)
+}
+
+// GetTXTRecords returns the TXT record sets of the zone.
+func (c *client) GetTXTRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsTXT)
+}
+
+func (c *client) listRecordSets(include func(recordType string) bool) ([]*route53.ResourceRecordSet, error) {
+	sets, err := c.listSets()
+	if err != nil {
+		return nil, err
+	}
+	return recordset.RecordSets(sets, include), nil
+}
+
+// listSets lists every record set of the zone, a page at a time.
+func (c *client) listSets() ([]recordset.Set, error) {
+	if !c.lookedUp {
+		return nil, fmt.Errorf("akamai zone %s hasn't been looked up", c.zone)
+	}
+
+	var sets []recordset.Set
+	for page := 1; ; page++ {
+		var resp recordSetsResponse
+		path := c.zonePath(fmt.Sprintf("/recordsets?page=%d&pageSize=%d", page, pageSize))
+		if err := c.do(http.MethodGet, path, nil, &resp); err != nil {
+			return nil, fmt.Errorf("unable to list records of Akamai zone %s: %v", c.zone, err)
+		}
+		for _, set := range resp.RecordSets {
+			rrs := &route53.ResourceRecordSet{
+				Name: aws.String(recordset.Canonical(set.Name)),
+				Type: aws.String(set.Type),
+				TTL:  aws.Int64(set.TTL),
+			}
+			for _, rdata := range set.RData {
+				rrs.ResourceRecords = append(rrs.ResourceRecords,
+					&route53.ResourceRecord{Value: aws.String(valueOf(set.Type, rdata))})
+			}
+			sets = append(sets, recordset.Set{RecordSet: rrs})
+		}
+		if page*pageSize >= resp.Metadata.TotalElements || len(resp.RecordSets) == 0 {
+			return sets, nil
+		}
+	}
+}
+
+// UpdateRecordSets applies the changes in order, as Edge DNS record sets. A change which can't be applied, such as
+// deleting a record set which doesn't exist, fails the update, leaving the changes before it applied.
+func (c *client) UpdateRecordSets(changes []*route53.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	sets, err := c.listSets()
+	if err != nil {
+		return err
+	}
+	_, err = recordset.ApplySets("Akamai Edge DNS", c, sets, changes)
+	return err
+}
+
+// CreateSet creates the Edge DNS record set.
+func (c *client) CreateSet(rrs *route53.ResourceRecordSet) (recordset.Set, error) {
+	if err := c.do(http.MethodPost, c.recordSetPath(rrs), recordSetOf(rrs), nil); err != nil {
+		return recordset.Set{}, err
+	}
+	return recordset.Set{RecordSet: rrs}, nil
+}
+
+// ReplaceSet replaces the Edge DNS record set.
+func (c *client) ReplaceSet(_ recordset.Set, rrs *route53.ResourceRecordSet) (recordset.Set, error) {
+	if err := c.do(http.MethodPut, c.recordSetPath(rrs), recordSetOf(rrs), nil); err != nil {
+		return recordset.Set{}, err
+	}
+	return recordset.Set{RecordSet: rrs}, nil
+}
+
+// DeleteSet deletes the Edge DNS record set.
+func (c *client) DeleteSet(current recordset.Set) error {
+	return c.do(http.MethodDelete, c.recordSetPath(current.RecordSet), nil, nil)
+}
+
+// recordSetOf returns the Edge DNS record set of a record set.
+func recordSetOf(rrs *route53.ResourceRecordSet) recordSet {
+	set := recordSet{
+		Name:  strings.TrimSuffix(aws.StringValue(rrs.Name), "."),
+		Type:  aws.StringValue(rrs.Type),
+		TTL:   aws.Int64Value(rrs.TTL),
+		RData: []string{},
+	}
+	for _, rr := range rrs.ResourceRecords {
+		set.RData = append(set.RData, aws.StringValue(rr.Value))
+	}
+	return set
+}
+
+func (c *client) zonePath(suffix string) string {
+	return "/config-dns/v2/zones/" + url.PathEscape(c.zone) + suffix
+}
+
+func (c *client) recordSetPath(rrs *route53.ResourceRecordSet) string {
+	return c.zonePath("/names/" + url.PathEscape(strings.TrimSuffix(aws.StringValue(rrs.Name), ".")) + "/types/" +
+		url.PathEscape(aws.StringValue(rrs.Type)))
+}
+
+// valueOf returns the record value of Edge DNS rdata, without the trailing period of CNAME targets.
+func valueOf(recordType, rdata string) string {
+	if recordType == route53.RRTypeCname {
+		return strings.TrimSuffix(rdata, ".")
+	}
+	return rdata
+}
+
+// newNonce returns a random UUID, as the nonce of a signature.
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// do sends a request to the API, signed with the credentials, decoding the response into out if it isn't nil.
+func (c *client) do(method, path string, in, out interface{}) error {
+	var encoded []byte
+	if in != nil {
+		var err error
+		if encoded, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", c.credentials.authorization(req, encoded, c.now(), c.nonce()))
+
+	log.Debugf("Akamai Edge DNS API %s %s", method, path)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("akamai API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
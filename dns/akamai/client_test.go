@@ -0,0 +1,352 @@
+package akamai
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/dns/dnstest"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+const (
+	testClientToken  = "akab-client-token-xxx-xxxxxxxxxxxxxxxx"
+	testAccessToken  = "akab-access-token-xxx-xxxxxxxxxxxxxxxx"
+	testClientSecret = "SOMESECRET"
+)
+
+var testCredentials = credentials{clientToken: testClientToken, clientSecret: testClientSecret,
+	accessToken: testAccessToken}
+
+// fakeAPI is an in-memory Edge DNS API of a single zone, which checks the EdgeGrid signature of every request.
+type fakeAPI struct {
+	*dnstest.FakeAPI
+	zone       string
+	recordSets map[string]recordSet
+}
+
+func newFakeAPI(zone string, recordSets ...recordSet) (*fakeAPI, *httptest.Server) {
+	api := &fakeAPI{zone: zone, recordSets: make(map[string]recordSet)}
+	for _, set := range recordSets {
+		api.recordSets[set.Name+"/types/"+set.Type] = set
+	}
+	api.FakeAPI = dnstest.NewFakeAPI(api)
+	return api, api.Server
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	if !a.signed(r, body) {
+		http.Error(w, `{"title":"Unauthorized","detail":"The signature does not match"}`, http.StatusUnauthorized)
+		return
+	}
+	zonePath := "/config-dns/v2/zones/" + a.zone
+	if r.URL.Path != zonePath && !strings.HasPrefix(r.URL.Path, zonePath+"/") {
+		http.Error(w, `{"title":"Not Found","detail":"Zone does not exist"}`, http.StatusNotFound)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, zonePath)
+	key := strings.TrimPrefix(path, "/names/")
+	_, exists := a.recordSets[key]
+	switch {
+	case r.Method == http.MethodGet && path == "":
+		json.NewEncoder(w).Encode(map[string]string{"zone": a.zone, "type": "PRIMARY"})
+	case r.Method == http.MethodGet && path == "/recordsets":
+		a.listRecordSets(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/names/") && !exists:
+		a.putRecordSet(w, key, body, http.StatusCreated)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/names/"):
+		http.Error(w, `{"title":"Conflict","detail":"Record set already exists"}`, http.StatusConflict)
+	case r.Method == http.MethodPut && exists:
+		a.putRecordSet(w, key, body, http.StatusOK)
+	case r.Method == http.MethodDelete && exists:
+		delete(a.recordSets, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, `{"title":"Not Found","detail":"Record set does not exist"}`, http.StatusNotFound)
+	}
+}
+
+// signed is whether the request was signed with the test credentials, as the server received it.
+func (a *fakeAPI) signed(r *http.Request, body []byte) bool {
+	fields := make(map[string]string)
+	for _, field := range strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), edgeGridAlgorithm+" "), ";") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+	timestamp, err := time.Parse(timestampFormat, fields["timestamp"])
+	if err != nil {
+		return false
+	}
+	received, _ := http.NewRequest(r.Method, "http://"+r.Host+r.RequestURI, nil)
+	return r.Header.Get("Authorization") == testCredentials.authorization(received, body, timestamp, fields["nonce"])
+}
+
+func (a *fakeAPI) putRecordSet(w http.ResponseWriter, key string, body []byte, status int) {
+	var set recordSet
+	json.Unmarshal(body, &set)
+	if set.Name+"/types/"+set.Type != key || len(set.RData) == 0 {
+		http.Error(w, `{"title":"Bad Request","detail":"Invalid record set"}`, http.StatusBadRequest)
+		return
+	}
+	a.recordSets[key] = set
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(set)
+}
+
+func (a *fakeAPI) listRecordSets(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	size, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if page < 1 || size < 1 {
+		http.Error(w, `{"title":"Bad Request"}`, http.StatusBadRequest)
+		return
+	}
+
+	all := a.sorted()
+	var resp recordSetsResponse
+	resp.Metadata.Page = page
+	resp.Metadata.PageSize = size
+	resp.Metadata.TotalElements = len(all)
+	for i := (page - 1) * size; i < len(all) && i < page*size; i++ {
+		resp.RecordSets = append(resp.RecordSets, all[i])
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (a *fakeAPI) sorted() []recordSet {
+	var all []recordSet
+	for _, set := range a.recordSets {
+		all = append(all, set)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Name+" "+all[i].Type < all[j].Name+" "+all[j].Type
+	})
+	return all
+}
+
+// values describes the record sets of the fake, as name type ttl rdata.
+func (a *fakeAPI) values() []string {
+	a.Lock()
+	defer a.Unlock()
+	var values []string
+	for _, set := range a.sorted() {
+		values = append(values, fmt.Sprintf("%s %s %d %s", set.Name, set.Type, set.TTL, strings.Join(set.RData, ",")))
+	}
+	return values
+}
+
+func testConfig(server *httptest.Server) Config {
+	return Config{Host: server.URL, ClientToken: testClientToken, ClientSecret: testClientSecret,
+		AccessToken: testAccessToken, Zone: "example.com"}
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) r53.Route53Client {
+	client := New(testConfig(server))
+	domain, err := client.GetHostedZoneDomain()
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com.", domain)
+	return client
+}
+
+func TestRequestsAreSignedWithEdgeGrid(t *testing.T) {
+	// The signatures were computed separately from the steps of the EdgeGrid specification.
+	timestamp := time.Date(2014, 3, 21, 19, 34, 21, 0, time.UTC)
+	nonce := "nonce-xx-xxxx-xxxx-xxxx-xxxxxxxxxxxx"
+	host := "https://akaa-baseurl-xxxxxxxxxxx-xxxxxxxxxxxxx.luna.akamaiapis.net"
+	body := []byte(`{"name":"foo.example.com","type":"CNAME","ttl":60,"rdata":["lb.example.net"]}`)
+
+	var tests = []struct {
+		name      string
+		method    string
+		path      string
+		body      []byte
+		signature string
+	}{
+		{"GET", http.MethodGet, "/", nil, "MY1mmxCqlyWh8XrFw3kxSlb6/AxJUXsjtZm6xqzmkjE="},
+		{"GET with a query", http.MethodGet, "/config-dns/v2/zones/example.com/recordsets?page=1&pageSize=500", nil,
+			"BV3WXVqFkZOu86pK4AV/UHxXiXKyRzZ/mbextUlQviw="},
+		{"POST, whose body is hashed", http.MethodPost,
+			"/config-dns/v2/zones/example.com/names/foo.example.com/types/CNAME", body,
+			"DGwwZZ54JFB4pmbd4yTkkkrC5uCR5zzbxGzizEYGgkY="},
+		{"PUT, whose body isn't hashed", http.MethodPut,
+			"/config-dns/v2/zones/example.com/names/foo.example.com/types/CNAME", body,
+			"2vK96d0TYbTLXJOwrBKrmpKcvXTyRiZLKnV1YpfKZjw="},
+	}
+
+	for _, test := range tests {
+		fmt.Printf("=== test: %s\n", test.name)
+		req, _ := http.NewRequest(test.method, host+test.path, nil)
+		assert.Equal(t, "EG1-HMAC-SHA256 client_token="+testClientToken+";access_token="+testAccessToken+
+			";timestamp=20140321T19:34:21+0000;nonce="+nonce+";signature="+test.signature,
+			testCredentials.authorization(req, test.body, timestamp, nonce), test.name)
+	}
+}
+
+func TestNoncesAreUnique(t *testing.T) {
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, newNonce())
+	assert.NotEqual(t, newNonce(), newNonce())
+}
+
+func TestGetHostedZoneDomainFailsWithInvalidCredentials(t *testing.T) {
+	_, server := newFakeAPI("example.com")
+	defer server.Close()
+	config := testConfig(server)
+	config.ClientSecret = "wrong"
+
+	_, err := New(config).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unable to look up Akamai zone example.com")
+		assert.Contains(t, err.Error(), "401 Unauthorized")
+	}
+}
+
+func TestGetHostedZoneDomainFailsIfTheZoneDoesntExist(t *testing.T) {
+	_, server := newFakeAPI("another.com")
+	defer server.Close()
+
+	_, err := New(testConfig(server)).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "404 Not Found")
+		assert.Contains(t, err.Error(), "Zone does not exist")
+	}
+}
+
+func TestGetRecordsConvertsRecordSets(t *testing.T) {
+	// given
+	_, server := newFakeAPI("example.com",
+		recordSet{Name: "foo.example.com", Type: "CNAME", TTL: 300, RData: []string{"lb.example.net."}},
+		recordSet{Name: "example.com", Type: "A", TTL: 3600, RData: []string{"10.0.0.1", "10.0.0.2"}},
+		recordSet{Name: "foo.example.com", Type: "TXT", TTL: 60, RData: []string{`"hello"`}},
+		recordSet{Name: "example.com", Type: "MX", TTL: 3600, RData: []string{"10 mail.example.com."}},
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	records, err := client.GetRecords()
+	txtRecords, txtErr := client.GetTXTRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*route53.ResourceRecordSet{
+		{
+			Name: aws.String("example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(3600),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.1")},
+				{Value: aws.String("10.0.0.2")},
+			},
+		},
+		dnstest.CNAME("foo.example.com.", "lb.example.net", 300),
+	}, records)
+	assert.NoError(t, txtErr)
+	assert.Equal(t, []*route53.ResourceRecordSet{{
+		Name:            aws.String("foo.example.com."),
+		Type:            aws.String("TXT"),
+		TTL:             aws.Int64(60),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"hello"`)}},
+	}}, txtRecords)
+}
+
+func TestGetRecordsListsEveryPage(t *testing.T) {
+	// given
+	var sets []recordSet
+	for i := 0; i < pageSize*2+1; i++ {
+		sets = append(sets, recordSet{Name: fmt.Sprintf("host-%04d.example.com", i), Type: "CNAME", TTL: 60,
+			RData: []string{"lb.example.net."}})
+	}
+	api, server := newFakeAPI("example.com", sets...)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	recordSets, err := client.GetRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, recordSets, pageSize*2+1)
+	recordSetsPath := "GET /config-dns/v2/zones/example.com/recordsets"
+	assert.Equal(t, []string{"GET /config-dns/v2/zones/example.com", recordSetsPath, recordSetsPath, recordSetsPath},
+		api.Requests())
+}
+
+func TestUpdateRecordSetsCreatesReplacesAndDeletesRecordSets(t *testing.T) {
+	// given
+	api, server := newFakeAPI("example.com",
+		recordSet{Name: "update.example.com", Type: "CNAME", TTL: 300, RData: []string{"old.example.net."}},
+		recordSet{Name: "delete.example.com", Type: "CNAME", TTL: 300, RData: []string{"lb.example.net."}},
+		recordSet{Name: "ips.example.com", Type: "A", TTL: 60, RData: []string{"10.0.0.1", "10.0.0.2"}},
+		recordSet{Name: "example.com", Type: "MX", TTL: 3600, RData: []string{"10 mail.example.com."}},
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{
+		{Action: aws.String("CREATE"), ResourceRecordSet: dnstest.CNAME("create.example.com.", "lb.example.net", 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("update.example.com.", "new.example.net", 60)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name: aws.String("ips.example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.2")},
+				{Value: aws.String("10.0.0.3")},
+			},
+		}},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("*.apps.example.com.", "lb.example.net", 60)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: dnstest.CNAME("delete.example.com.", "lb.example.net", 300)},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"*.apps.example.com CNAME 60 lb.example.net",
+		"create.example.com CNAME 300 lb.example.net",
+		"example.com MX 3600 10 mail.example.com.",
+		"ips.example.com A 60 10.0.0.2,10.0.0.3",
+		"update.example.com CNAME 60 new.example.net",
+	}, api.values())
+}
+
+func TestUpdateRecordSetsFailsForChangesWhichCantBeApplied(t *testing.T) {
+	_, server := newFakeAPI("example.com",
+		recordSet{Name: "foo.example.com", Type: "CNAME", TTL: 60, RData: []string{"lb.example.net."}})
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	dnstest.RunUnappliedChanges(t, client, "Akamai Edge DNS")
+}
+
+func TestConformance(t *testing.T) {
+	dnstest.RunConformance(t, func() (func(id string) r53.Route53Client, func()) {
+		_, server := newFakeAPI(dnstest.Zone)
+		return func(id string) r53.Route53Client {
+			config := testConfig(server)
+			config.Zone = id
+			return New(config)
+		}, server.Close
+	})
+}
@@ -0,0 +1,63 @@
+package akamai
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// edgeGridAlgorithm is the version of Akamai's EdgeGrid request signatures.
+	edgeGridAlgorithm = "EG1-HMAC-SHA256"
+	// timestampFormat is the format of the timestamps of EdgeGrid signatures.
+	timestampFormat = "20060102T15:04:05-0700"
+	// maxBody is the number of bytes of the body of a POST which are hashed in its signature.
+	maxBody = 131072
+)
+
+// credentials are the EdgeGrid credentials of an API client.
+type credentials struct {
+	clientToken  string
+	clientSecret string
+	accessToken  string
+}
+
+// authorization returns the EdgeGrid Authorization header of a request with the body, signed at the timestamp with
+// the nonce. No headers are signed, and only the bodies of POSTs are hashed, as EdgeGrid requires.
+func (c credentials) authorization(req *http.Request, body []byte, timestamp time.Time, nonce string) string {
+	stamp := timestamp.UTC().Format(timestampFormat)
+	header := fmt.Sprintf("%s client_token=%s;access_token=%s;timestamp=%s;nonce=%s;", edgeGridAlgorithm,
+		c.clientToken, c.accessToken, stamp, nonce)
+
+	var contentHash string
+	if req.Method == http.MethodPost && len(body) > 0 {
+		if len(body) > maxBody {
+			body = body[:maxBody]
+		}
+		sum := sha256.Sum256(body)
+		contentHash = base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	data := strings.Join([]string{
+		strings.ToUpper(req.Method),
+		req.URL.Scheme,
+		req.URL.Host,
+		req.URL.RequestURI(),
+		"",
+		contentHash,
+		header,
+	}, "\t")
+	signingKey := sign(c.clientSecret, stamp)
+	return header + "signature=" + sign(signingKey, data)
+}
+
+// sign returns the base64 HMAC-SHA256 of the data with the key.
+func sign(key, data string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,415 @@
+/*
+Package azuredns is the Azure DNS provider of feed-dns, managing the record sets of the zones in a resource group
+through the Azure Resource Manager API. Record sets are addressed by type and relative name, with @ for the apex.
+
+It makes the requests itself rather than with the Azure SDK for Go, which isn't one of feed's dependencies. A token
+from the OAuth client credentials flow and the record set endpoints of the ARM API are all it needs, and the SDK
+would add autorest and its own dependencies for them.
+*/
+package azuredns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/dns/recordset"
+)
+
+const (
+	// DefaultLoginURL is the URL of Azure Active Directory in the public Azure cloud.
+	DefaultLoginURL = "https://login.microsoftonline.com"
+	// DefaultManagementURL is the URL of Azure Resource Manager in the public Azure cloud.
+	DefaultManagementURL = "https://management.azure.com"
+	// apiVersion is the version of the Azure DNS API.
+	apiVersion = "2018-05-01"
+	// pageSize is the number of record sets listed per request.
+	pageSize       = 100
+	requestTimeout = 30 * time.Second
+	// tokenExpiryMargin is how long before it expires an access token is replaced.
+	tokenExpiryMargin = time.Minute
+	// apex is the name of record sets for the zone's domain itself.
+	apex = "@"
+)
+
+// Capabilities are those of Azure DNS record sets, leaving out alias record sets, which point at Azure resources
+// rather than hostnames, and Traffic Manager's routing.
+var Capabilities = r53.Capabilities{Provider: "azure", IPv6: true, TXT: true, MaxTTL: r53.MaxTTL}
+
+// Config describes the Azure DNS zone to manage and how to reach the API.
+// TenantID, ClientID and ClientSecret are the credentials of a service principal with the DNS Zone Contributor role
+// on the Zone, which is the zone's domain, e.g. example.com, in the ResourceGroup of the SubscriptionID. LoginURL and
+// ManagementURL override DefaultLoginURL and DefaultManagementURL, e.g. for other Azure clouds or testing.
+type Config struct {
+	TenantID       string
+	ClientID       string
+	ClientSecret   string
+	SubscriptionID string
+	ResourceGroup  string
+	Zone           string
+	LoginURL       string
+	ManagementURL  string
+}
+
+type client struct {
+	http          *http.Client
+	config        Config
+	loginURL      string
+	managementURL string
+	zoneURL       string
+	zone          string
+	names         recordset.Names
+	now           func() time.Time
+	lookedUp      bool
+
+	tokenLock   sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// recordSet is a record set of the Azure DNS API, named relative to the zone, with the records of its type.
+type recordSet struct {
+	Name       string     `json:"name,omitempty"`
+	Type       string     `json:"type,omitempty"`
+	Properties properties `json:"properties"`
+}
+
+type properties struct {
+	TTL         int64        `json:"TTL"`
+	CNAMERecord *cnameRecord `json:"CNAMERecord,omitempty"`
+	ARecords    []aRecord    `json:"ARecords,omitempty"`
+	AAAARecords []aaaaRecord `json:"AAAARecords,omitempty"`
+	TXTRecords  []txtRecord  `json:"TXTRecords,omitempty"`
+}
+
+type cnameRecord struct {
+	CNAME string `json:"cname"`
+}
+
+type aRecord struct {
+	IPv4Address string `json:"ipv4Address"`
+}
+
+type aaaaRecord struct {
+	IPv6Address string `json:"ipv6Address"`
+}
+
+type txtRecord struct {
+	Value []string `json:"value"`
+}
+
+type recordSetsResponse struct {
+	Value    []recordSet `json:"value"`
+	NextLink string      `json:"nextLink"`
+}
+
+type tokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	ExpiresIn   json.Number `json:"expires_in"`
+}
+
+// NewUpdater creates a dns updater of the Azure DNS zones of the updater config, whose hosted zone ids are the zone
+// names. The Zone of the config is ignored, as each hosted zone has its own client.
+func NewUpdater(lbAdapter adapter.FrontendAdapter, updaterConfig dns.Config, config Config) controller.Updater {
+	updaterConfig.ZoneClient = func(zone string) r53.Route53Client {
+		zoneConfig := config
+		zoneConfig.Zone = zone
+		return New(zoneConfig)
+	}
+	return dns.New(lbAdapter, updaterConfig)
+}
+
+// New creates a client of an Azure DNS zone, authenticated with access tokens of the service principal. The next
+// link of each page of record sets is followed, and record sets are created with If-None-Match so one created since
+// the zone was listed isn't overwritten.
+func New(config Config) r53.Route53Client {
+	loginURL := config.LoginURL
+	if loginURL == "" {
+		loginURL = DefaultLoginURL
+	}
+	managementURL := config.ManagementURL
+	if managementURL == "" {
+		managementURL = DefaultManagementURL
+	}
+	managementURL = strings.TrimSuffix(managementURL, "/")
+	zone := strings.TrimSuffix(config.Zone, ".")
+	return &client{
+		http:          &http.Client{Timeout: requestTimeout},
+		config:        config,
+		loginURL:      strings.TrimSuffix(loginURL, "/"),
+		managementURL: managementURL,
+		zoneURL: managementURL + "/subscriptions/" + url.PathEscape(config.SubscriptionID) + "/resourceGroups/" +
+			url.PathEscape(config.ResourceGroup) + "/providers/Microsoft.Network/dnsZones/" + url.PathEscape(zone),
+		zone:  zone,
+		names: recordset.Names{Zone: zone, Apex: apex},
+		now:   time.Now,
+	}
+}
+
+// Capabilities of the client.
+func (c *client) Capabilities() r53.Capabilities {
+	return Capabilities
+}
+
+// GetHostedZoneDomain looks up the zone, which fails if the credentials are invalid, and returns its domain with a
+// trailing period.
+func (c *client) GetHostedZoneDomain() (string, error) {
+	if err := c.do(http.MethodGet, c.zoneURL, nil, nil, nil); err != nil {
+		return "", fmt.Errorf("unable to look up Azure DNS zone %s: %v", c.zone, err)
+	}
+	c.lookedUp = true
+	return c.zone + ".", nil
+}
+
+// GetRecords returns the CNAME, A and AAAA record sets of the zone.
+func (c *client) GetRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsAddress)
+}
+
+// GetTXTRecords returns the TXT record sets of the zone.
+func (c *client) GetTXTRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsTXT)
+}
+
+func (c *client) listRecordSets(include func(recordType string) bool) ([]*route53.ResourceRecordSet, error) {
+	sets, err := c.listSets()
+	if err != nil {
+		return nil, err
+	}
+	return recordset.RecordSets(sets, include), nil
+}
+
+// listSets lists the CNAME, A, AAAA and TXT record sets of the zone, following the link to each next page.
+func (c *client) listSets() ([]recordset.Set, error) {
+	if !c.lookedUp {
+		return nil, fmt.Errorf("azure DNS zone %s hasn't been looked up", c.zone)
+	}
+
+	var sets []recordset.Set
+	next := fmt.Sprintf("%s/recordsets?api-version=%s&$top=%d", c.zoneURL, apiVersion, pageSize)
+	for next != "" {
+		var resp recordSetsResponse
+		if err := c.do(http.MethodGet, next, nil, nil, &resp); err != nil {
+			return nil, fmt.Errorf("unable to list records of Azure DNS zone %s: %v", c.zone, err)
+		}
+		for _, set := range resp.Value {
+			if rrs := c.recordSetOf(set); rrs != nil {
+				sets = append(sets, recordset.Set{RecordSet: rrs})
+			}
+		}
+		next = resp.NextLink
+	}
+	return sets, nil
+}
+
+// UpdateRecordSets applies the changes in order, as Azure DNS record sets. A change which can't be applied, such as
+// deleting a record set which doesn't exist, fails the update, leaving the changes before it applied.
+func (c *client) UpdateRecordSets(changes []*route53.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	sets, err := c.listSets()
+	if err != nil {
+		return err
+	}
+	_, err = recordset.ApplySets("Azure DNS", c, sets, changes)
+	return err
+}
+
+// CreateSet creates the Azure DNS record set, failing if it already exists.
+func (c *client) CreateSet(rrs *route53.ResourceRecordSet) (recordset.Set, error) {
+	set, err := azureRecordSetOf(rrs)
+	if err != nil {
+		return recordset.Set{}, err
+	}
+	if err := c.do(http.MethodPut, c.recordSetURL(rrs), map[string]string{"If-None-Match": "*"}, set,
+		nil); err != nil {
+		return recordset.Set{}, err
+	}
+	return recordset.Set{RecordSet: rrs}, nil
+}
+
+// ReplaceSet replaces the Azure DNS record set.
+func (c *client) ReplaceSet(_ recordset.Set, rrs *route53.ResourceRecordSet) (recordset.Set, error) {
+	set, err := azureRecordSetOf(rrs)
+	if err != nil {
+		return recordset.Set{}, err
+	}
+	if err := c.do(http.MethodPut, c.recordSetURL(rrs), nil, set, nil); err != nil {
+		return recordset.Set{}, err
+	}
+	return recordset.Set{RecordSet: rrs}, nil
+}
+
+// DeleteSet deletes the Azure DNS record set.
+func (c *client) DeleteSet(current recordset.Set) error {
+	return c.do(http.MethodDelete, c.recordSetURL(current.RecordSet), nil, nil, nil)
+}
+
+func (c *client) recordSetURL(rrs *route53.ResourceRecordSet) string {
+	return c.zoneURL + "/" + url.PathEscape(aws.StringValue(rrs.Type)) + "/" +
+		url.PathEscape(c.names.Relative(aws.StringValue(rrs.Name))) + "?api-version=" + apiVersion
+}
+
+// recordSetOf returns the record set of an Azure DNS record set, or nil if it isn't a CNAME, A, AAAA or TXT record
+// set. TXT values are quoted, as they are in Route53.
+func (c *client) recordSetOf(set recordSet) *route53.ResourceRecordSet {
+	recordType := set.Type[strings.LastIndex(set.Type, "/")+1:]
+	rrs := &route53.ResourceRecordSet{
+		Name: aws.String(c.names.FQDN(set.Name)),
+		Type: aws.String(recordType),
+		TTL:  aws.Int64(set.Properties.TTL),
+	}
+	var values []string
+	switch recordType {
+	case route53.RRTypeCname:
+		if set.Properties.CNAMERecord != nil {
+			values = append(values, strings.TrimSuffix(set.Properties.CNAMERecord.CNAME, "."))
+		}
+	case route53.RRTypeA:
+		for _, rec := range set.Properties.ARecords {
+			values = append(values, rec.IPv4Address)
+		}
+	case route53.RRTypeAaaa:
+		for _, rec := range set.Properties.AAAARecords {
+			values = append(values, rec.IPv6Address)
+		}
+	case route53.RRTypeTxt:
+		for _, rec := range set.Properties.TXTRecords {
+			values = append(values, `"`+strings.Join(rec.Value, "")+`"`)
+		}
+	default:
+		return nil
+	}
+	for _, value := range values {
+		rrs.ResourceRecords = append(rrs.ResourceRecords, &route53.ResourceRecord{Value: aws.String(value)})
+	}
+	return rrs
+}
+
+// azureRecordSetOf returns the Azure DNS record set of a CNAME, A, AAAA or TXT record set.
+func azureRecordSetOf(rrs *route53.ResourceRecordSet) (recordSet, error) {
+	set := recordSet{Properties: properties{TTL: aws.Int64Value(rrs.TTL)}}
+	for _, rr := range rrs.ResourceRecords {
+		value := aws.StringValue(rr.Value)
+		switch aws.StringValue(rrs.Type) {
+		case route53.RRTypeCname:
+			set.Properties.CNAMERecord = &cnameRecord{CNAME: value}
+		case route53.RRTypeA:
+			set.Properties.ARecords = append(set.Properties.ARecords, aRecord{IPv4Address: value})
+		case route53.RRTypeAaaa:
+			set.Properties.AAAARecords = append(set.Properties.AAAARecords, aaaaRecord{IPv6Address: value})
+		case route53.RRTypeTxt:
+			set.Properties.TXTRecords = append(set.Properties.TXTRecords,
+				txtRecord{Value: []string{strings.TrimSuffix(strings.TrimPrefix(value, `"`), `"`)}})
+		default:
+			return recordSet{}, fmt.Errorf("can't change %s, %s records aren't supported", aws.StringValue(rrs.Name),
+				aws.StringValue(rrs.Type))
+		}
+	}
+	return set, nil
+}
+
+// accessToken returns an access token of the service principal for the management API, getting a new one with the
+// client credentials flow once the last one is about to expire.
+func (c *client) accessToken() (string, error) {
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+	if c.token != "" && c.now().Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.config.ClientID},
+		"client_secret": {c.config.ClientSecret},
+		"scope":         {c.managementURL + "/.default"},
+	}
+	tokenURL := c.loginURL + "/" + url.PathEscape(c.config.TenantID) + "/oauth2/v2.0/token"
+	log.Debugf("Azure AD POST %s", tokenURL)
+	resp, err := c.http.PostForm(tokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("unable to get an Azure access token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("unable to get an Azure access token: Azure AD returned %s: %s", resp.Status,
+			strings.TrimSpace(string(message)))
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("unable to get an Azure access token: %v", err)
+	}
+	expiresIn, err := token.ExpiresIn.Int64()
+	if err != nil {
+		return "", fmt.Errorf("unable to get an Azure access token: invalid expires_in %q", token.ExpiresIn)
+	}
+	c.token = token.AccessToken
+	c.tokenExpiry = c.now().Add(time.Duration(expiresIn)*time.Second - tokenExpiryMargin)
+	return c.token, nil
+}
+
+// do sends a request to the management API with the headers, decoding the response into out if it isn't nil.
+func (c *client) do(method, requestURL string, headers map[string]string, in, out interface{}) error {
+	token, err := c.accessToken()
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+	if !strings.Contains(requestURL, "api-version=") {
+		requestURL += "?api-version=" + apiVersion
+	}
+
+	req, err := http.NewRequest(method, requestURL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	log.Debugf("Azure DNS %s %s", method, requestURL)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("azure API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,404 @@
+package azuredns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/dnstest"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+const (
+	testTenantID       = "tenant"
+	testClientID       = "client"
+	testClientSecret   = "secret"
+	testSubscriptionID = "subscription"
+	testResourceGroup  = "dns"
+	testAccessToken    = "token"
+)
+
+// fakeAPI is an in-memory Azure AD token endpoint and Azure DNS API of a single zone.
+type fakeAPI struct {
+	*dnstest.FakeAPI
+	zone          string
+	recordSets    map[string]recordSet
+	pageSize      int
+	tokenRequests int
+}
+
+func newFakeAPI(zone string, recordSets ...recordSet) (*fakeAPI, *httptest.Server) {
+	api := &fakeAPI{zone: zone, recordSets: make(map[string]recordSet)}
+	for _, set := range recordSets {
+		api.recordSets[set.Type[strings.LastIndex(set.Type, "/")+1:]+"/"+set.Name] = set
+	}
+	api.FakeAPI = dnstest.NewFakeAPI(api)
+	return api, api.Server
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/"+testTenantID+"/oauth2/v2.0/token" {
+		a.token(w, r)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+testAccessToken {
+		a.fail(w, http.StatusUnauthorized, "AuthenticationFailed", "Authentication failed.")
+		return
+	}
+	if r.URL.Query().Get("api-version") != apiVersion {
+		a.fail(w, http.StatusBadRequest, "InvalidApiVersionParameter", "The api-version is invalid.")
+		return
+	}
+	zonePath := "/subscriptions/" + testSubscriptionID + "/resourceGroups/" + testResourceGroup +
+		"/providers/Microsoft.Network/dnsZones/" + a.zone
+	if r.URL.Path != zonePath && !strings.HasPrefix(r.URL.Path, zonePath+"/") {
+		a.fail(w, http.StatusNotFound, "ResourceNotFound", "The Resource was not found.")
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, zonePath+"/")
+	current, exists := a.recordSets[key]
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == zonePath:
+		json.NewEncoder(w).Encode(map[string]string{"name": a.zone})
+	case r.Method == http.MethodGet && key == "recordsets":
+		a.listRecordSets(w, r)
+	case r.Method == http.MethodPut && exists && r.Header.Get("If-None-Match") == "*":
+		a.fail(w, http.StatusPreconditionFailed, "PreconditionFailed", "The Record set "+key+" exists already.")
+	case r.Method == http.MethodPut && strings.Count(key, "/") == 1:
+		var set recordSet
+		json.NewDecoder(r.Body).Decode(&set)
+		parts := strings.Split(key, "/")
+		set.Name = parts[1]
+		set.Type = "Microsoft.Network/dnszones/" + parts[0]
+		a.recordSets[key] = set
+		json.NewEncoder(w).Encode(set)
+	case r.Method == http.MethodDelete && exists:
+		delete(a.recordSets, key)
+		json.NewEncoder(w).Encode(current)
+	default:
+		a.fail(w, http.StatusNotFound, "NotFound", "The resource record "+key+" does not exist.")
+	}
+}
+
+func (a *fakeAPI) token(w http.ResponseWriter, r *http.Request) {
+	a.tokenRequests++
+	r.ParseForm()
+	if r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("client_id") != testClientID ||
+		r.PostForm.Get("client_secret") != testClientSecret {
+		http.Error(w, `{"error":"invalid_client","error_description":"AADSTS7000215: Invalid client secret."}`,
+			http.StatusUnauthorized)
+		return
+	}
+	if !strings.HasSuffix(r.PostForm.Get("scope"), "/.default") {
+		http.Error(w, `{"error":"invalid_scope"}`, http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"token_type": "Bearer", "access_token": testAccessToken,
+		"expires_in": 3599})
+}
+
+func (a *fakeAPI) fail(w http.ResponseWriter, status int, code, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"code": code, "message": message}})
+}
+
+func (a *fakeAPI) listRecordSets(w http.ResponseWriter, r *http.Request) {
+	top, _ := strconv.Atoi(r.URL.Query().Get("$top"))
+	skip, _ := strconv.Atoi(r.URL.Query().Get("$skip"))
+	if a.pageSize > 0 {
+		top = a.pageSize
+	}
+
+	all := a.sorted()
+	resp := recordSetsResponse{Value: []recordSet{}}
+	for i := skip; i < len(all) && i < skip+top; i++ {
+		resp.Value = append(resp.Value, all[i])
+	}
+	if skip+top < len(all) {
+		next := *r.URL
+		query := next.Query()
+		query.Set("$skip", strconv.Itoa(skip+top))
+		next.RawQuery = query.Encode()
+		resp.NextLink = "http://" + r.Host + next.RequestURI()
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (a *fakeAPI) sorted() []recordSet {
+	var all []recordSet
+	for _, set := range a.recordSets {
+		all = append(all, set)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Name+" "+all[i].Type < all[j].Name+" "+all[j].Type
+	})
+	return all
+}
+
+// values describes the record sets of the fake, as name type ttl records.
+func (a *fakeAPI) values() []string {
+	a.Lock()
+	defer a.Unlock()
+	var values []string
+	for _, set := range a.sorted() {
+		records, _ := json.Marshal(set.Properties)
+		values = append(values, fmt.Sprintf("%s %s %s", set.Name, set.Type[strings.LastIndex(set.Type, "/")+1:],
+			records))
+	}
+	return values
+}
+
+func cnameSet(name, target string, ttl int64) recordSet {
+	return recordSet{Name: name, Type: "Microsoft.Network/dnszones/CNAME",
+		Properties: properties{TTL: ttl, CNAMERecord: &cnameRecord{CNAME: target}}}
+}
+
+func testConfig(server *httptest.Server) Config {
+	return Config{
+		TenantID:       testTenantID,
+		ClientID:       testClientID,
+		ClientSecret:   testClientSecret,
+		SubscriptionID: testSubscriptionID,
+		ResourceGroup:  testResourceGroup,
+		Zone:           "example.com",
+		LoginURL:       server.URL,
+		ManagementURL:  server.URL,
+	}
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) *client {
+	client := New(testConfig(server)).(*client)
+	domain, err := client.GetHostedZoneDomain()
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com.", domain)
+	return client
+}
+
+func TestGetHostedZoneDomainFailsWithInvalidCredentials(t *testing.T) {
+	_, server := newFakeAPI("example.com")
+	defer server.Close()
+	config := testConfig(server)
+	config.ClientSecret = "wrong"
+
+	_, err := New(config).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unable to look up Azure DNS zone example.com: unable to get an Azure "+
+			"access token: Azure AD returned 401 Unauthorized")
+		assert.Contains(t, err.Error(), "Invalid client secret")
+	}
+}
+
+func TestGetHostedZoneDomainFailsIfTheZoneDoesntExist(t *testing.T) {
+	_, server := newFakeAPI("another.com")
+	defer server.Close()
+
+	_, err := New(testConfig(server)).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "404 Not Found")
+		assert.Contains(t, err.Error(), "ResourceNotFound")
+	}
+}
+
+func TestAccessTokensAreReusedUntilTheyExpire(t *testing.T) {
+	// given
+	api, server := newFakeAPI("example.com")
+	defer server.Close()
+	now := time.Now()
+	client := New(testConfig(server)).(*client)
+	client.now = func() time.Time { return now }
+
+	// when
+	_, err := client.GetHostedZoneDomain()
+	_, _ = client.GetRecords()
+	tokensBeforeExpiry := api.tokenRequests
+	now = now.Add(time.Hour)
+	_, _ = client.GetRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 1, tokensBeforeExpiry)
+	assert.Equal(t, 2, api.tokenRequests)
+}
+
+func TestGetRecordsConvertsRecordSets(t *testing.T) {
+	// given
+	_, server := newFakeAPI("example.com",
+		cnameSet("foo", "lb.example.net", 300),
+		recordSet{Name: "@", Type: "Microsoft.Network/dnszones/A", Properties: properties{TTL: 3600,
+			ARecords: []aRecord{{"10.0.0.1"}, {"10.0.0.2"}}}},
+		recordSet{Name: "foo", Type: "Microsoft.Network/dnszones/AAAA", Properties: properties{TTL: 300,
+			AAAARecords: []aaaaRecord{{"2001:db8::1"}}}},
+		recordSet{Name: "foo", Type: "Microsoft.Network/dnszones/TXT", Properties: properties{TTL: 60,
+			TXTRecords: []txtRecord{{[]string{"hello"}}}}},
+		recordSet{Name: "@", Type: "Microsoft.Network/dnszones/NS", Properties: properties{TTL: 172800}},
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	records, err := client.GetRecords()
+	txtRecords, txtErr := client.GetTXTRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*route53.ResourceRecordSet{
+		{
+			Name: aws.String("example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(3600),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.1")},
+				{Value: aws.String("10.0.0.2")},
+			},
+		},
+		{
+			Name:            aws.String("foo.example.com."),
+			Type:            aws.String("AAAA"),
+			TTL:             aws.Int64(300),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("2001:db8::1")}},
+		},
+		dnstest.CNAME("foo.example.com.", "lb.example.net", 300),
+	}, records)
+	assert.NoError(t, txtErr)
+	assert.Equal(t, []*route53.ResourceRecordSet{{
+		Name:            aws.String("foo.example.com."),
+		Type:            aws.String("TXT"),
+		TTL:             aws.Int64(60),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"hello"`)}},
+	}}, txtRecords)
+}
+
+func TestGetRecordsFollowsTheNextLink(t *testing.T) {
+	// given
+	var sets []recordSet
+	for i := 0; i < 5; i++ {
+		sets = append(sets, cnameSet(fmt.Sprintf("host-%d", i), "lb.example.net", 60))
+	}
+	api, server := newFakeAPI("example.com", sets...)
+	defer server.Close()
+	api.pageSize = 2
+	client := newTestClient(t, server)
+
+	// when
+	recordSets, err := client.GetRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, recordSets, 5)
+	assert.Len(t, api.Requests(), 5, "a token, the zone and three pages of record sets")
+}
+
+func TestUpdateRecordSetsCreatesReplacesAndDeletesRecordSets(t *testing.T) {
+	// given
+	api, server := newFakeAPI("example.com",
+		cnameSet("update", "old.example.net", 300),
+		cnameSet("delete", "lb.example.net", 300),
+		recordSet{Name: "ips", Type: "Microsoft.Network/dnszones/A", Properties: properties{TTL: 60,
+			ARecords: []aRecord{{"10.0.0.1"}, {"10.0.0.2"}}}},
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{
+		{Action: aws.String("CREATE"), ResourceRecordSet: dnstest.CNAME("create.example.com.", "lb.example.net", 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("update.example.com.", "new.example.net", 60)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name: aws.String("ips.example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.2")},
+				{Value: aws.String("10.0.0.3")},
+			},
+		}},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name:            aws.String("_feed-owner.create.example.com."),
+			Type:            aws.String("TXT"),
+			TTL:             aws.Int64(300),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"owner"`)}},
+		}},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("*.apps.example.com.", "lb.example.net", 60)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: dnstest.CNAME("delete.example.com.", "lb.example.net", 300)},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`*.apps CNAME {"TTL":60,"CNAMERecord":{"cname":"lb.example.net"}}`,
+		`_feed-owner.create TXT {"TTL":300,"TXTRecords":[{"value":["owner"]}]}`,
+		`create CNAME {"TTL":300,"CNAMERecord":{"cname":"lb.example.net"}}`,
+		`ips A {"TTL":60,"ARecords":[{"ipv4Address":"10.0.0.2"},{"ipv4Address":"10.0.0.3"}]}`,
+		`update CNAME {"TTL":60,"CNAMERecord":{"cname":"new.example.net"}}`,
+	}, api.values())
+}
+
+func TestUpdateRecordSetsFailsForChangesWhichCantBeApplied(t *testing.T) {
+	api, server := newFakeAPI("example.com", cnameSet("foo", "lb.example.net", 60))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	dnstest.RunUnappliedChanges(t, client, "Azure DNS")
+
+	// Record sets created since they were listed aren't overwritten.
+	api.Lock()
+	api.recordSets["CNAME/bar"] = cnameSet("bar", "other.example.net", 60)
+	api.Unlock()
+	_, err := client.CreateSet(dnstest.CNAME("bar.example.com.", "lb.example.net", 60))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "412 Precondition Failed")
+	}
+}
+
+func TestNewUpdaterManagesTheZonesOfTheHostedZoneIDs(t *testing.T) {
+	// given
+	api, server := newFakeAPI("example.com")
+	defer server.Close()
+	config := testConfig(server)
+	config.Zone = "ignored.com"
+	updater := NewUpdater(adapter.NewStaticHostnameAdapter(map[string]string{"internal": "lb.example.net"},
+		time.Minute, nil), dns.Config{HostedZoneIDs: []string{"example.com"}}, config)
+
+	// when
+	err := updater.Start()
+	if err == nil {
+		err = updater.Update(controller.IngressEntries{{Namespace: "ns", Name: "foo", Host: "foo.example.com",
+			LbScheme: "internal"}})
+	}
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`foo CNAME {"TTL":60,"CNAMERecord":{"cname":"lb.example.net"}}`}, api.values())
+}
+
+func TestConformance(t *testing.T) {
+	dnstest.RunConformance(t, func() (func(id string) r53.Route53Client, func()) {
+		_, server := newFakeAPI(dnstest.Zone)
+		return func(id string) r53.Route53Client {
+			config := testConfig(server)
+			config.Zone = id
+			return New(config)
+		}, server.Close
+	})
+}
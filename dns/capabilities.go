@@ -0,0 +1,133 @@
+package dns
+
+import (
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// routingAnnotations need records the provider may not have, which it would reject. They're dropped from ingresses
+// if the provider can't honour them, so their hosts get simple records instead.
+var routingAnnotations = []string{adapter.CloudFrontDistributionAnnotation, adapter.FailoverRoleAnnotation,
+	adapter.GeoAnnotation, adapter.RoutingPolicyAnnotation, adapter.WeightAnnotation}
+
+// Capabilities are the capabilities of the DNS provider of the updater's hosted zones, with its frontend and the
+// record annotations the updater honours, e.g. for a UI to hide the annotations it would ignore.
+type Capabilities struct {
+	r53.Capabilities
+	Frontend    string   `json:"frontend"`
+	Annotations []string `json:"annotations"`
+}
+
+// CapabilityReporter is implemented by the dns updater, to report the capabilities of its DNS provider.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// Capabilities are those the DNS provider declares, with the annotations the updater honours.
+func (u *updater) Capabilities() Capabilities {
+	capabilities := Capabilities{
+		Capabilities: u.providerCapabilities(),
+		Frontend:     adapter.FrontendName(u.lbAdapter),
+		Annotations:  []string{},
+	}
+
+	for _, annotation := range adapter.AnnotationsSupportedBy(u.lbAdapter) {
+		if u.honours(annotation, capabilities.Capabilities) {
+			capabilities.Annotations = append(capabilities.Annotations, annotation)
+		}
+	}
+	return capabilities
+}
+
+// providerCapabilities are declared by the client of the first hosted zone, as every zone has the same provider. A
+// provider which declares none is unknown, without any capabilities.
+func (u *updater) providerCapabilities() r53.Capabilities {
+	if len(u.zones) > 0 {
+		if declarer, ok := u.zones[0].r53.(r53.CapabilityDeclarer); ok {
+			return declarer.Capabilities()
+		}
+	}
+	return r53.Capabilities{Provider: "unknown"}
+}
+
+// provider names the DNS provider of the hosted zones, which labels the metrics, events and spans of the updater.
+func (u *updater) provider() string {
+	return u.providerCapabilities().Provider
+}
+
+// honours is whether a record annotation supported by the frontend adapter takes effect with the provider.
+func (u *updater) honours(annotation string, provider r53.Capabilities) bool {
+	switch annotation {
+	case adapter.WeightAnnotation:
+		return provider.Weighted
+	case adapter.FailoverRoleAnnotation:
+		return provider.Failover
+	case adapter.RoutingPolicyAnnotation:
+		return provider.Latency
+	case adapter.GeoAnnotation:
+		return provider.Geolocation
+	case adapter.CloudFrontDistributionAnnotation:
+		return provider.Alias
+	case adapter.TXTAnnotation:
+		return provider.TXT && u.txt != nil
+	case adapter.HealthCheckPathAnnotation, adapter.HealthCheckPortAnnotation, adapter.HealthCheckIntervalAnnotation:
+		return provider.HealthChecks && u.healthChecks != nil
+	default:
+		return true
+	}
+}
+
+// unhonouredAnnotations returns the routing annotations present which the frontend adapter supports but the provider
+// can't honour, in order.
+func (u *updater) unhonouredAnnotations(annotations map[string]string) []string {
+	provider := u.providerCapabilities()
+	unsupported := make(map[string]bool)
+	for _, name := range adapter.UnsupportedAnnotations(u.lbAdapter, annotations) {
+		unsupported[name] = true
+	}
+
+	var unhonoured []string
+	for _, name := range routingAnnotations {
+		if _, present := annotations[name]; present && !unsupported[name] && !u.honours(name, provider) {
+			unhonoured = append(unhonoured, name)
+		}
+	}
+	return unhonoured
+}
+
+// dropUnhonouredAnnotations returns the entries with the routing annotations the provider can't honour removed from
+// their ingresses. Each ingress is copied once, so entries of the same ingress still share it.
+func (u *updater) dropUnhonouredAnnotations(entries controller.IngressEntries) controller.IngressEntries {
+	copies := make(map[*v1beta1.Ingress]*v1beta1.Ingress)
+	dropped := make(controller.IngressEntries, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Ingress != nil {
+			ingress, copied := copies[entry.Ingress]
+			if !copied {
+				ingress = entry.Ingress
+				if unhonoured := u.unhonouredAnnotations(ingress.Annotations); len(unhonoured) > 0 {
+					ingress = withoutAnnotations(ingress, unhonoured)
+				}
+				copies[entry.Ingress] = ingress
+			}
+			entry.Ingress = ingress
+		}
+		dropped = append(dropped, entry)
+	}
+	return dropped
+}
+
+// withoutAnnotations returns a copy of the ingress without the annotations.
+func withoutAnnotations(ingress *v1beta1.Ingress, names []string) *v1beta1.Ingress {
+	copied := *ingress
+	copied.Annotations = make(map[string]string, len(ingress.Annotations))
+	for name, value := range ingress.Annotations {
+		copied.Annotations[name] = value
+	}
+	for _, name := range names {
+		delete(copied.Annotations, name)
+	}
+	return &copied
+}
@@ -0,0 +1,119 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/dns/adapter"
+)
+
+const (
+	// WebhookSignatureHeader is the header of change notifications with the hex encoded HMAC-SHA256 of the body,
+	// keyed by the shared secret, as sha256=<signature>.
+	WebhookSignatureHeader = "X-Feed-Signature"
+	webhookTimeout         = 10 * time.Second
+)
+
+// changeWebhook notifies a webhook of the records changed by each update.
+type changeWebhook struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func newChangeWebhook(url, secret string) *changeWebhook {
+	return &changeWebhook{url: url, secret: []byte(secret), client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// changeSummary is the body of a change notification.
+type changeSummary struct {
+	Created int             `json:"created"`
+	Updated int             `json:"updated"`
+	Deleted int             `json:"deleted"`
+	Records []changedRecord `json:"records"`
+}
+
+type changedRecord struct {
+	Zone          string `json:"zone"`
+	Operation     string `json:"operation"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Value         string `json:"value"`
+	SetIdentifier string `json:"setIdentifier,omitempty"`
+}
+
+// add adds the changes applied to a zone to the summary.
+func (s *changeSummary) add(zone *hostedZone, changes []*route53.Change, records []adapter.ConsolidatedRecord) {
+	for i, operation := range operationsOf(changes, records) {
+		switch operation {
+		case "created":
+			s.Created++
+		case "updated":
+			s.Updated++
+		case "deleted":
+			s.Deleted++
+		}
+		rrs := changes[i].ResourceRecordSet
+		s.Records = append(s.Records, changedRecord{
+			Zone:          zone.domain,
+			Operation:     operation,
+			Name:          aws.StringValue(rrs.Name),
+			Type:          aws.StringValue(rrs.Type),
+			Value:         recordValue(rrs),
+			SetIdentifier: aws.StringValue(rrs.SetIdentifier),
+		})
+	}
+}
+
+// notify posts the summary to the webhook, if it has any changes. Failures are logged, as they shouldn't fail the
+// update.
+func (w *changeWebhook) notify(summary *changeSummary) {
+	if len(summary.Records) == 0 {
+		return
+	}
+
+	if err := w.post(summary); err != nil {
+		log.Warnf("Unable to notify %s of %d changed records: %v", w.url, len(summary.Records), err)
+		return
+	}
+	log.Debugf("Notified %s of %d changed records", w.url, len(summary.Records))
+}
+
+func (w *changeWebhook) post(summary *changeSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, "sha256="+sign(w.secret, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
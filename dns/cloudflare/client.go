@@ -0,0 +1,311 @@
+/*
+Package cloudflare is the Cloudflare provider of feed-dns. Cloudflare addresses zones and records by id, so records
+are listed with their ids and each value of a Route53 record set is a Cloudflare record of its own. Records can be
+proxied through Cloudflare, in which case Cloudflare sets their TTL.
+*/
+package cloudflare
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/dns/recordset"
+)
+
+const (
+	// DefaultAPIURL is the URL of the Cloudflare v4 API.
+	DefaultAPIURL = "https://api.cloudflare.com/client/v4"
+	// pageSize is the number of records listed per request.
+	pageSize       = 100
+	requestTimeout = 30 * time.Second
+	// automaticTTL is the TTL of Cloudflare records whose TTL is automatic, which feed-dns has as a TTL of 0.
+	automaticTTL = 1
+	// maxTTL is the largest TTL Cloudflare accepts.
+	maxTTL = 86400
+)
+
+// Capabilities are those of Cloudflare DNS records, with TTLs of up to a day. A TTL of 0 is Cloudflare's automatic
+// TTL. Cloudflare's CNAME flattening isn't used for ALIAS records.
+var Capabilities = r53.Capabilities{Provider: "cloudflare", IPv6: true, TXT: true, MaxTTL: maxTTL}
+
+// Config describes the Cloudflare zone to manage and how to reach the API.
+// Token is an API token with permission to edit the DNS records of the zone whose id is ZoneID. Proxied has the
+// CNAME, A and AAAA records feed-dns creates proxied by Cloudflare. APIURL overrides DefaultAPIURL, e.g. for testing.
+type Config struct {
+	Token   string
+	ZoneID  string
+	Proxied bool
+	APIURL  string
+}
+
+type client struct {
+	http    *http.Client
+	apiURL  string
+	token   string
+	zoneID  string
+	proxied bool
+	zone    string
+	// proxiedSets are the keys of the record sets with proxied records when the zone was last listed.
+	proxiedSets map[string]bool
+}
+
+// record is a DNS record of the Cloudflare API, named by its domain name without a trailing period. Each value of a
+// record set is a separate record.
+type record struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int64  `json:"ttl"`
+	Proxied bool   `json:"proxied,omitempty"`
+}
+
+// response is the envelope of every Cloudflare API response, whose result is decoded into Result.
+type response struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result     interface{} `json:"result"`
+	ResultInfo struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+}
+
+// NewUpdater creates a dns updater of Cloudflare zones. Their hosted zone ids in the updater config are Cloudflare
+// zone ids rather than names, as Cloudflare needs them to address a zone.
+func NewUpdater(lbAdapter adapter.FrontendAdapter, updaterConfig dns.Config, config Config) controller.Updater {
+	updaterConfig.ZoneClient = func(zone string) r53.Route53Client {
+		zoneConfig := config
+		zoneConfig.ZoneID = zone
+		return New(zoneConfig)
+	}
+	return dns.New(lbAdapter, updaterConfig)
+}
+
+// New creates a client of the Cloudflare zone with the ZoneID of the config. Record sets are grouped from records
+// of the same name and type, and the CNAME, A and AAAA records it creates are proxied if the config is.
+func New(config Config) r53.Route53Client {
+	apiURL := config.APIURL
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &client{
+		http:    &http.Client{Timeout: requestTimeout},
+		apiURL:  strings.TrimSuffix(apiURL, "/"),
+		token:   config.Token,
+		zoneID:  config.ZoneID,
+		proxied: config.Proxied,
+	}
+}
+
+// Capabilities of the client.
+func (c *client) Capabilities() r53.Capabilities {
+	return Capabilities
+}
+
+// GetHostedZoneDomain looks up the zone by its id, which fails if the token is invalid, and returns its domain with
+// a trailing period.
+func (c *client) GetHostedZoneDomain() (string, error) {
+	var zone struct {
+		Name string `json:"name"`
+	}
+	if _, err := c.do(http.MethodGet, c.zonePath(""), nil, &zone); err != nil {
+		return "", fmt.Errorf("unable to look up Cloudflare zone %s: %v", c.zoneID, err)
+	}
+	c.zone = strings.TrimSuffix(zone.Name, ".")
+	return c.zone + ".", nil
+}
+
+// GetRecords returns the CNAME, A and AAAA record sets of the zone.
+func (c *client) GetRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsAddress)
+}
+
+// GetTXTRecords returns the TXT record sets of the zone.
+func (c *client) GetTXTRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsTXT)
+}
+
+// HasAutomaticTTL is whether the record set has proxied records, whose TTL Cloudflare sets itself.
+func (c *client) HasAutomaticTTL(rrs *route53.ResourceRecordSet) bool {
+	return c.proxiedSets[recordset.Key(aws.StringValue(rrs.Name), aws.StringValue(rrs.Type))]
+}
+
+func (c *client) listRecordSets(include func(recordType string) bool) ([]*route53.ResourceRecordSet, error) {
+	records, err := c.listRecords()
+	if err != nil {
+		return nil, err
+	}
+	return recordset.Sets(records, include), nil
+}
+
+// listRecords lists every record of the zone, a page at a time.
+func (c *client) listRecords() ([]recordset.Record, error) {
+	if c.zone == "" {
+		return nil, fmt.Errorf("cloudflare zone %s hasn't been looked up", c.zoneID)
+	}
+
+	var records []recordset.Record
+	proxiedSets := make(map[string]bool)
+	for page := 1; ; page++ {
+		var recs []record
+		path := c.zonePath(fmt.Sprintf("/dns_records?page=%d&per_page=%d", page, pageSize))
+		resp, err := c.do(http.MethodGet, path, nil, &recs)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list records of Cloudflare zone %s: %v", c.zone, err)
+		}
+		for _, rec := range recs {
+			record := recordOf(rec)
+			if rec.Proxied {
+				proxiedSets[recordset.Key(record.Name, record.Type)] = true
+			}
+			records = append(records, record)
+		}
+		if resp.ResultInfo.TotalPages <= page || len(recs) == 0 {
+			c.proxiedSets = proxiedSets
+			return records, nil
+		}
+	}
+}
+
+// UpdateRecordSets applies the changes in order, as Cloudflare records. A change which can't be applied, such as
+// deleting a record set which doesn't exist, fails the update, leaving the changes before it applied.
+func (c *client) UpdateRecordSets(changes []*route53.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	records, err := c.listRecords()
+	if err != nil {
+		return err
+	}
+	_, err = recordset.Apply("Cloudflare", c, records, changes)
+	return err
+}
+
+// Create creates a Cloudflare record of the record set with the value, proxied if the client proxies records of
+// its type.
+func (c *client) Create(rrs *route53.ResourceRecordSet, value string) (recordset.Record, error) {
+	recordType := aws.StringValue(rrs.Type)
+	rec := record{
+		Type:    recordType,
+		Name:    strings.TrimSuffix(aws.StringValue(rrs.Name), "."),
+		Content: value,
+		TTL:     cloudflareTTL(aws.Int64Value(rrs.TTL)),
+		Proxied: c.proxied && recordset.IsAddress(recordType),
+	}
+	var created record
+	if _, err := c.do(http.MethodPost, c.zonePath("/dns_records"), rec, &created); err != nil {
+		return recordset.Record{}, err
+	}
+	return recordOf(created), nil
+}
+
+// UpdateTTL changes the TTL of the Cloudflare record. Proxied records always have an automatic TTL, so they're
+// left alone.
+func (c *client) UpdateTTL(rec recordset.Record, ttl int64) (recordset.Record, error) {
+	updated := rec.Native.(record)
+	if updated.Proxied {
+		return rec, nil
+	}
+	updated.TTL = cloudflareTTL(ttl)
+	if _, err := c.do(http.MethodPut, c.recordPath(updated.ID), updated, nil); err != nil {
+		return recordset.Record{}, err
+	}
+	return recordOf(updated), nil
+}
+
+// Delete deletes the Cloudflare record.
+func (c *client) Delete(rec recordset.Record) error {
+	_, err := c.do(http.MethodDelete, c.recordPath(rec.Native.(record).ID), nil, nil)
+	return err
+}
+
+// recordOf returns the value of a record set a Cloudflare record is.
+func recordOf(rec record) recordset.Record {
+	ttl := rec.TTL
+	if ttl == automaticTTL {
+		ttl = 0
+	}
+	return recordset.Record{Name: recordset.Canonical(rec.Name), Type: rec.Type, Value: rec.Content, TTL: ttl,
+		Native: rec}
+}
+
+// cloudflareTTL returns the Cloudflare TTL of a record set's TTL, which is automatic for a TTL of 0.
+func cloudflareTTL(ttl int64) int64 {
+	if ttl == 0 {
+		return automaticTTL
+	}
+	return ttl
+}
+
+func (c *client) zonePath(suffix string) string {
+	return "/zones/" + url.PathEscape(c.zoneID) + suffix
+}
+
+func (c *client) recordPath(id string) string {
+	return c.zonePath("/dns_records/" + url.PathEscape(id))
+}
+
+// do sends a request to the API, decoding the result of the response into result if it isn't nil. It fails with
+// the errors of the response if the request didn't succeed.
+func (c *client) do(method, path string, in, result interface{}) (*response, error) {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, c.apiURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	log.Debugf("Cloudflare API %s %s", method, path)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	decoded := &response{Result: result}
+	if err := json.Unmarshal(contents, decoded); err != nil || resp.StatusCode/100 != 2 || !decoded.Success {
+		var messages []string
+		for _, e := range decoded.Errors {
+			messages = append(messages, fmt.Sprintf("%s (%d)", e.Message, e.Code))
+		}
+		if len(messages) == 0 {
+			messages = append(messages, strings.TrimSpace(string(contents)))
+		}
+		return nil, fmt.Errorf("cloudflare API returned %s: %s", resp.Status, strings.Join(messages, ", "))
+	}
+	return decoded, nil
+}
@@ -0,0 +1,364 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/dns/dnstest"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+const (
+	testToken  = "secret"
+	testZoneID = "023e105f4ecef8ad9ca31a8372d0c353"
+)
+
+// fakeAPI is an in-memory Cloudflare API of a single zone.
+type fakeAPI struct {
+	*dnstest.FakeAPI
+	zoneID  string
+	zone    string
+	records map[string]record
+	nextID  int
+}
+
+func newFakeAPI(zoneID, zone string, records ...record) (*fakeAPI, *httptest.Server) {
+	api := &fakeAPI{zoneID: zoneID, zone: zone, records: make(map[string]record)}
+	for _, rec := range records {
+		api.add(rec)
+	}
+	api.FakeAPI = dnstest.NewFakeAPI(api)
+	return api, api.Server
+}
+
+func (a *fakeAPI) add(rec record) record {
+	a.nextID++
+	rec.ID = strconv.Itoa(a.nextID)
+	if rec.Proxied {
+		rec.TTL = automaticTTL
+	}
+	a.records[rec.ID] = rec
+	return rec
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		a.fail(w, http.StatusBadRequest, 6003, "Invalid request headers")
+		return
+	}
+	zonePath := "/zones/" + a.zoneID
+	if r.URL.Path != zonePath && !strings.HasPrefix(r.URL.Path, zonePath+"/") {
+		a.fail(w, http.StatusNotFound, 7003, "Could not route to "+r.URL.Path)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, zonePath)
+	_, exists := a.records[strings.TrimPrefix(path, "/dns_records/")]
+	switch {
+	case r.Method == http.MethodGet && path == "":
+		a.succeed(w, map[string]string{"id": a.zoneID, "name": a.zone}, nil)
+	case r.Method == http.MethodGet && path == "/dns_records":
+		a.listRecords(w, r)
+	case r.Method == http.MethodPost && path == "/dns_records":
+		var rec record
+		json.NewDecoder(r.Body).Decode(&rec)
+		if !a.valid(w, rec) {
+			return
+		}
+		a.succeed(w, a.add(rec), nil)
+	case r.Method == http.MethodPut && exists:
+		var rec record
+		json.NewDecoder(r.Body).Decode(&rec)
+		if !a.valid(w, rec) {
+			return
+		}
+		rec.ID = strings.TrimPrefix(path, "/dns_records/")
+		a.records[rec.ID] = rec
+		a.succeed(w, rec, nil)
+	case r.Method == http.MethodDelete && exists:
+		id := strings.TrimPrefix(path, "/dns_records/")
+		delete(a.records, id)
+		a.succeed(w, map[string]string{"id": id}, nil)
+	default:
+		a.fail(w, http.StatusNotFound, 81044, "Record does not exist.")
+	}
+}
+
+// valid checks the TTL of a record, which is automatic or between a minute and a day.
+func (a *fakeAPI) valid(w http.ResponseWriter, rec record) bool {
+	if rec.TTL != automaticTTL && (rec.TTL < 60 || rec.TTL > maxTTL) {
+		a.fail(w, http.StatusBadRequest, 9021, "Invalid TTL. Must be between 60 and 86400 seconds, or 1 for Automatic.")
+		return false
+	}
+	return true
+}
+
+func (a *fakeAPI) listRecords(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if page < 1 || perPage < 1 {
+		a.fail(w, http.StatusBadRequest, 1004, "DNS Validation Error")
+		return
+	}
+
+	all := a.sorted()
+	recs := []record{}
+	for i := (page - 1) * perPage; i < len(all) && i < page*perPage; i++ {
+		recs = append(recs, all[i])
+	}
+	a.succeed(w, recs, map[string]int{"page": page, "total_pages": (len(all) + perPage - 1) / perPage})
+}
+
+func (a *fakeAPI) succeed(w http.ResponseWriter, result interface{}, resultInfo interface{}) {
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "errors": []interface{}{}, "result": result,
+		"result_info": resultInfo})
+}
+
+func (a *fakeAPI) fail(w http.ResponseWriter, status, code int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": false,
+		"errors": []map[string]interface{}{{"code": code, "message": message}}})
+}
+
+func (a *fakeAPI) sorted() []record {
+	var all []record
+	for _, rec := range a.records {
+		all = append(all, rec)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return all[i].Content < all[j].Content
+	})
+	return all
+}
+
+// values describes the records of the fake, as name type content ttl, and whether they're proxied.
+func (a *fakeAPI) values() []string {
+	a.Lock()
+	defer a.Unlock()
+	var values []string
+	for _, rec := range a.sorted() {
+		value := fmt.Sprintf("%s %s %s %d", rec.Name, rec.Type, rec.Content, rec.TTL)
+		if rec.Proxied {
+			value += " proxied"
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func newTestClient(t *testing.T, server *httptest.Server, proxied bool) r53.Route53Client {
+	client := New(Config{Token: testToken, ZoneID: testZoneID, Proxied: proxied, APIURL: server.URL})
+	domain, err := client.GetHostedZoneDomain()
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com.", domain)
+	return client
+}
+
+func TestGetHostedZoneDomainFailsIfTheZoneDoesntExist(t *testing.T) {
+	_, server := newFakeAPI("another-zone", "example.com")
+	defer server.Close()
+
+	_, err := New(Config{Token: testToken, ZoneID: testZoneID, APIURL: server.URL}).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unable to look up Cloudflare zone "+testZoneID)
+		assert.Contains(t, err.Error(), "404 Not Found")
+	}
+}
+
+func TestRequestsFailWithTheAPIErrors(t *testing.T) {
+	_, server := newFakeAPI(testZoneID, "example.com")
+	defer server.Close()
+
+	_, err := New(Config{Token: "wrong", ZoneID: testZoneID, APIURL: server.URL}).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "400 Bad Request: Invalid request headers (6003)")
+	}
+}
+
+func TestGetRecordsConvertsRecordsToRecordSets(t *testing.T) {
+	// given
+	_, server := newFakeAPI(testZoneID, "example.com",
+		record{Type: "CNAME", Name: "foo.example.com", Content: "lb.example.net", TTL: 300},
+		record{Type: "A", Name: "example.com", Content: "10.0.0.1", TTL: automaticTTL},
+		record{Type: "A", Name: "example.com", Content: "10.0.0.2", TTL: automaticTTL},
+		record{Type: "TXT", Name: "foo.example.com", Content: `"hello"`, TTL: 60},
+		record{Type: "MX", Name: "example.com", Content: "mail.example.com", TTL: 3600},
+	)
+	defer server.Close()
+	client := newTestClient(t, server, false)
+
+	// when
+	records, err := client.GetRecords()
+	txtRecords, txtErr := client.GetTXTRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*route53.ResourceRecordSet{
+		{
+			Name: aws.String("example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(0),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.1")},
+				{Value: aws.String("10.0.0.2")},
+			},
+		},
+		dnstest.CNAME("foo.example.com.", "lb.example.net", 300),
+	}, records)
+	assert.NoError(t, txtErr)
+	assert.Equal(t, []*route53.ResourceRecordSet{{
+		Name:            aws.String("foo.example.com."),
+		Type:            aws.String("TXT"),
+		TTL:             aws.Int64(60),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"hello"`)}},
+	}}, txtRecords)
+}
+
+func TestGetRecordsListsEveryPage(t *testing.T) {
+	// given
+	var records []record
+	for i := 0; i < pageSize*2+1; i++ {
+		records = append(records, record{Type: "CNAME", Name: fmt.Sprintf("host-%03d.example.com", i),
+			Content: "lb.example.net", TTL: 60})
+	}
+	api, server := newFakeAPI(testZoneID, "example.com", records...)
+	defer server.Close()
+	client := newTestClient(t, server, false)
+
+	// when
+	recordSets, err := client.GetRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, recordSets, pageSize*2+1)
+	recordsPath := "GET /zones/" + testZoneID + "/dns_records"
+	assert.Equal(t, []string{"GET /zones/" + testZoneID, recordsPath, recordsPath, recordsPath}, api.Requests())
+}
+
+func TestUpdateRecordSetsCreatesUpsertsAndDeletesRecords(t *testing.T) {
+	// given
+	api, server := newFakeAPI(testZoneID, "example.com",
+		record{Type: "CNAME", Name: "update.example.com", Content: "old.example.net", TTL: 300},
+		record{Type: "CNAME", Name: "ttl.example.com", Content: "lb.example.net", TTL: 300},
+		record{Type: "CNAME", Name: "delete.example.com", Content: "lb.example.net", TTL: 300},
+		record{Type: "A", Name: "ips.example.com", Content: "10.0.0.1", TTL: 60},
+		record{Type: "A", Name: "ips.example.com", Content: "10.0.0.2", TTL: 60},
+		record{Type: "MX", Name: "example.com", Content: "mail.example.com", TTL: 3600},
+	)
+	defer server.Close()
+	client := newTestClient(t, server, false)
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{
+		{Action: aws.String("CREATE"), ResourceRecordSet: dnstest.CNAME("create.example.com.", "lb.example.net", 300)},
+		{Action: aws.String("CREATE"), ResourceRecordSet: dnstest.CNAME("automatic.example.com.", "lb.example.net", 0)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("update.example.com.", "new.example.net", 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("ttl.example.com.", "lb.example.net", 60)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name: aws.String("ips.example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.2")},
+				{Value: aws.String("10.0.0.3")},
+			},
+		}},
+		{Action: aws.String("DELETE"), ResourceRecordSet: dnstest.CNAME("delete.example.com.", "lb.example.net", 300)},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"automatic.example.com CNAME lb.example.net 1",
+		"create.example.com CNAME lb.example.net 300",
+		"example.com MX mail.example.com 3600",
+		"ips.example.com A 10.0.0.2 60",
+		"ips.example.com A 10.0.0.3 60",
+		"ttl.example.com CNAME lb.example.net 60",
+		"update.example.com CNAME new.example.net 300",
+	}, api.values())
+}
+
+func TestProxiedClientsCreateProxiedAddressRecords(t *testing.T) {
+	// given
+	api, server := newFakeAPI(testZoneID, "example.com",
+		record{Type: "CNAME", Name: "foo.example.com", Content: "lb.example.net", Proxied: true})
+	defer server.Close()
+	client := newTestClient(t, server, true)
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{
+		{Action: aws.String("CREATE"), ResourceRecordSet: dnstest.CNAME("bar.example.com.", "lb.example.net", 0)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("foo.example.com.", "lb.example.net", 300)},
+		{Action: aws.String("CREATE"), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name:            aws.String("_feed-owner.bar.example.com."),
+			Type:            aws.String("TXT"),
+			TTL:             aws.Int64(300),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"owner"`)}},
+		}},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`_feed-owner.bar.example.com TXT "owner" 300`,
+		"bar.example.com CNAME lb.example.net 1 proxied",
+		"foo.example.com CNAME lb.example.net 1 proxied",
+	}, api.values())
+	assert.NotContains(t, api.Requests(), "PUT /zones/"+testZoneID+"/dns_records/1",
+		"proxied records have an automatic TTL, so shouldn't be updated")
+	recordSets, err := client.GetRecords()
+	assert.NoError(t, err)
+	reporter := client.(r53.AutomaticTTLReporter)
+	for _, rrs := range recordSets {
+		assert.True(t, reporter.HasAutomaticTTL(rrs), aws.StringValue(rrs.Name))
+	}
+	assert.False(t, reporter.HasAutomaticTTL(dnstest.CNAME("ttl.example.com.", "lb.example.net", 60)))
+}
+
+func TestUpdateRecordSetsFailsForChangesWhichCantBeApplied(t *testing.T) {
+	_, server := newFakeAPI(testZoneID, "example.com",
+		record{Type: "CNAME", Name: "foo.example.com", Content: "lb.example.net", TTL: 60})
+	defer server.Close()
+	client := newTestClient(t, server, false)
+
+	dnstest.RunUnappliedChanges(t, client, "Cloudflare")
+}
+
+func TestConformance(t *testing.T) {
+	dnstest.RunConformance(t, func() (func(id string) r53.Route53Client, func()) {
+		_, server := newFakeAPI(dnstest.Zone, dnstest.Zone)
+		return func(id string) r53.Route53Client {
+			return New(Config{Token: testToken, ZoneID: id, APIURL: server.URL})
+		}, server.Close
+	})
+}
+
+func TestProxiedConformance(t *testing.T) {
+	dnstest.RunAutomaticTTLConformance(t, func() (func(id string) r53.Route53Client, func()) {
+		_, server := newFakeAPI(dnstest.Zone, dnstest.Zone)
+		return func(id string) r53.Route53Client {
+			return New(Config{Token: testToken, ZoneID: id, Proxied: true, APIURL: server.URL})
+		}, server.Close
+	})
+}
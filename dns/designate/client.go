@@ -0,0 +1,434 @@
+/*
+Package designate is the OpenStack Designate provider of feed-dns, managing the record sets of a zone through the
+Designate v2 API with tokens issued by Keystone v3.
+
+The client speaks the few Keystone v3 and Designate v2 requests it needs over net/http, rather than using gophercloud,
+which isn't a dependency of feed. Only password authentication of a user scoped to a project is supported, and the
+DNS endpoint is found in the catalog of the token Keystone issues, as gophercloud would find it.
+*/
+package designate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/dns/recordset"
+)
+
+const (
+	// DefaultDomain is the name of the Keystone domain of users and projects which don't give one.
+	DefaultDomain = "Default"
+	// tokenHeader authenticates requests with a Keystone token, and has the token Keystone issues.
+	tokenHeader = "X-Auth-Token"
+	// subjectTokenHeader has the token Keystone issues.
+	subjectTokenHeader = "X-Subject-Token"
+	// pageSize is the number of record sets listed per request.
+	pageSize       = 100
+	requestTimeout = 30 * time.Second
+	// tokenExpiryMargin is how long before it expires a token is replaced.
+	tokenExpiryMargin = time.Minute
+)
+
+// Capabilities are those of Designate record sets. Designate has no aliases or routing policies of its own.
+var Capabilities = r53.Capabilities{Provider: "designate", IPv6: true, TXT: true, MaxTTL: r53.MaxTTL}
+
+// Config describes the Designate zone to manage and how to authenticate with Keystone.
+// AuthURL is the URL of the Keystone identity API, e.g. https://keystone:5000/v3. Username and Password are the
+// credentials of a user in the UserDomain with a role in the Project of the ProjectDomain which can manage the
+// Zone, which is the zone's domain, e.g. example.com. The domains default to DefaultDomain. The public DNS endpoint of
+// the Region in Keystone's catalog is used, or of any region if Region isn't set.
+type Config struct {
+	AuthURL       string
+	Username      string
+	Password      string
+	UserDomain    string
+	Project       string
+	ProjectDomain string
+	Region        string
+	Zone          string
+}
+
+type client struct {
+	http       *http.Client
+	config     Config
+	authURL    string
+	zone       string
+	zoneID     string
+	defaultTTL int64
+	now        func() time.Time
+
+	tokenLock   sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	endpoint    string
+}
+
+// recordSet is a record set of the Designate API, with the canonical name of its records, which has a trailing
+// period. Records without a TTL have the TTL of the zone.
+type recordSet struct {
+	ID      string   `json:"id,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Type    string   `json:"type,omitempty"`
+	TTL     *int64   `json:"ttl,omitempty"`
+	Records []string `json:"records"`
+}
+
+type recordSetsResponse struct {
+	RecordSets []recordSet `json:"recordsets"`
+	Links      struct {
+		Next string `json:"next"`
+	} `json:"links"`
+}
+
+type zonesResponse struct {
+	Zones []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		TTL  int64  `json:"ttl"`
+	} `json:"zones"`
+}
+
+type tokenRequest struct {
+	Auth struct {
+		Identity struct {
+			Methods  []string `json:"methods"`
+			Password struct {
+				User struct {
+					Name     string `json:"name"`
+					Domain   domain `json:"domain"`
+					Password string `json:"password"`
+				} `json:"user"`
+			} `json:"password"`
+		} `json:"identity"`
+		Scope struct {
+			Project struct {
+				Name   string `json:"name"`
+				Domain domain `json:"domain"`
+			} `json:"project"`
+		} `json:"scope"`
+	} `json:"auth"`
+}
+
+type domain struct {
+	Name string `json:"name"`
+}
+
+type tokenResponse struct {
+	Token struct {
+		ExpiresAt time.Time `json:"expires_at"`
+		Catalog   []struct {
+			Type      string `json:"type"`
+			Endpoints []struct {
+				Interface string `json:"interface"`
+				Region    string `json:"region"`
+				URL       string `json:"url"`
+			} `json:"endpoints"`
+		} `json:"catalog"`
+	} `json:"token"`
+}
+
+// NewUpdater creates a dns updater of the Designate zones of the project, named by the hosted zone ids of the
+// updater config. Each zone's client authenticates with the credentials of the config separately. Like the
+// updaters of the other providers, it takes the frontend adapter and updater config too, rather than only the
+// Designate config, so the records point at the same frontends and have the same TTLs as with Route53.
+func NewUpdater(lbAdapter adapter.FrontendAdapter, updaterConfig dns.Config, config Config) controller.Updater {
+	updaterConfig.ZoneClient = func(zone string) r53.Route53Client {
+		zoneConfig := config
+		zoneConfig.Zone = zone
+		return New(zoneConfig)
+	}
+	return dns.New(lbAdapter, updaterConfig)
+}
+
+// New creates a client of a Designate zone. It gets a project scoped token from Keystone before the first request
+// and again shortly before the token expires, and follows the next link of each page of record sets.
+func New(config Config) r53.Route53Client {
+	if config.UserDomain == "" {
+		config.UserDomain = DefaultDomain
+	}
+	if config.ProjectDomain == "" {
+		config.ProjectDomain = DefaultDomain
+	}
+	return &client{
+		http:    &http.Client{Timeout: requestTimeout},
+		config:  config,
+		authURL: strings.TrimSuffix(strings.TrimSuffix(config.AuthURL, "/"), "/v3"),
+		zone:    strings.TrimSuffix(config.Zone, "."),
+		now:     time.Now,
+	}
+}
+
+// Capabilities of the client.
+func (c *client) Capabilities() r53.Capabilities {
+	return Capabilities
+}
+
+// GetHostedZoneDomain authenticates with Keystone and looks up the zone, failing if either fails, and returns its
+// domain with a trailing period.
+func (c *client) GetHostedZoneDomain() (string, error) {
+	var zones zonesResponse
+	if err := c.do(http.MethodGet, "/v2/zones?name="+url.QueryEscape(c.zone+"."), nil, &zones); err != nil {
+		return "", fmt.Errorf("unable to look up Designate zone %s: %v", c.zone, err)
+	}
+	for _, zone := range zones.Zones {
+		if zone.Name == c.zone+"." {
+			c.zoneID = zone.ID
+			c.defaultTTL = zone.TTL
+			return zone.Name, nil
+		}
+	}
+	return "", fmt.Errorf("designate zone %s doesn't exist", c.zone)
+}
+
+// GetRecords returns the CNAME, A and AAAA record sets of the zone.
+func (c *client) GetRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsAddress)
+}
+
+// GetTXTRecords returns the TXT record sets of the zone.
+func (c *client) GetTXTRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsTXT)
+}
+
+func (c *client) listRecordSets(include func(recordType string) bool) ([]*route53.ResourceRecordSet, error) {
+	sets, err := c.listSets()
+	if err != nil {
+		return nil, err
+	}
+	return recordset.RecordSets(sets, include), nil
+}
+
+// listSets lists every record set of the zone, following the link to each next page.
+func (c *client) listSets() ([]recordset.Set, error) {
+	if c.zoneID == "" {
+		return nil, fmt.Errorf("designate zone %s hasn't been looked up", c.zone)
+	}
+
+	var sets []recordset.Set
+	next := fmt.Sprintf("%s?limit=%d", c.recordSetsPath(), pageSize)
+	for next != "" {
+		var resp recordSetsResponse
+		if err := c.do(http.MethodGet, next, nil, &resp); err != nil {
+			return nil, fmt.Errorf("unable to list records of Designate zone %s: %v", c.zone, err)
+		}
+		for _, set := range resp.RecordSets {
+			sets = append(sets, recordset.Set{RecordSet: c.resourceRecordSetOf(set), Native: set})
+		}
+		next = resp.Links.Next
+	}
+	return sets, nil
+}
+
+// UpdateRecordSets applies the changes in order, as Designate record sets. A change which can't be applied, such as
+// deleting a record set which doesn't exist, fails the update, leaving the changes before it applied.
+func (c *client) UpdateRecordSets(changes []*route53.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	sets, err := c.listSets()
+	if err != nil {
+		return err
+	}
+	_, err = recordset.ApplySets("Designate", c, sets, changes)
+	return err
+}
+
+// CreateSet creates the Designate record set.
+func (c *client) CreateSet(rrs *route53.ResourceRecordSet) (recordset.Set, error) {
+	set := recordSetOf(rrs)
+	set.Name = recordset.Canonical(aws.StringValue(rrs.Name))
+	set.Type = aws.StringValue(rrs.Type)
+	var created recordSet
+	if err := c.do(http.MethodPost, c.recordSetsPath(), set, &created); err != nil {
+		return recordset.Set{}, err
+	}
+	return recordset.Set{RecordSet: rrs, Native: created}, nil
+}
+
+// ReplaceSet replaces the records and TTL of the Designate record set.
+func (c *client) ReplaceSet(current recordset.Set, rrs *route53.ResourceRecordSet) (recordset.Set, error) {
+	id := current.Native.(recordSet).ID
+	var updated recordSet
+	if err := c.do(http.MethodPut, c.recordSetsPath()+"/"+url.PathEscape(id), recordSetOf(rrs),
+		&updated); err != nil {
+		return recordset.Set{}, err
+	}
+	return recordset.Set{RecordSet: rrs, Native: updated}, nil
+}
+
+// DeleteSet deletes the Designate record set.
+func (c *client) DeleteSet(current recordset.Set) error {
+	return c.do(http.MethodDelete, c.recordSetsPath()+"/"+url.PathEscape(current.Native.(recordSet).ID), nil, nil)
+}
+
+func (c *client) recordSetsPath() string {
+	return "/v2/zones/" + url.PathEscape(c.zoneID) + "/recordsets"
+}
+
+// resourceRecordSetOf returns the record set of a Designate record set.
+func (c *client) resourceRecordSetOf(set recordSet) *route53.ResourceRecordSet {
+	ttl := c.defaultTTL
+	if set.TTL != nil {
+		ttl = *set.TTL
+	}
+	rrs := &route53.ResourceRecordSet{
+		Name: aws.String(set.Name),
+		Type: aws.String(set.Type),
+		TTL:  aws.Int64(ttl),
+	}
+	for _, rec := range set.Records {
+		rrs.ResourceRecords = append(rrs.ResourceRecords, &route53.ResourceRecord{Value: aws.String(valueOf(set.Type,
+			rec))})
+	}
+	return rrs
+}
+
+// recordSetOf returns the records and TTL of a record set, as a Designate record set. CNAME targets are
+// canonical, as Designate requires.
+func recordSetOf(rrs *route53.ResourceRecordSet) recordSet {
+	set := recordSet{TTL: rrs.TTL, Records: []string{}}
+	for _, rr := range rrs.ResourceRecords {
+		value := aws.StringValue(rr.Value)
+		if aws.StringValue(rrs.Type) == route53.RRTypeCname {
+			value = recordset.Canonical(value)
+		}
+		set.Records = append(set.Records, value)
+	}
+	return set
+}
+
+// valueOf returns the record value of a Designate record, without the trailing period of CNAME targets.
+func valueOf(recordType, record string) string {
+	if recordType == route53.RRTypeCname {
+		return strings.TrimSuffix(record, ".")
+	}
+	return record
+}
+
+// authenticate returns a Keystone token of the user scoped to the project, and the DNS endpoint of its catalog,
+// getting a new token once the last one is about to expire.
+func (c *client) authenticate() (string, string, error) {
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+	if c.token != "" && c.now().Before(c.tokenExpiry) {
+		return c.token, c.endpoint, nil
+	}
+
+	var req tokenRequest
+	req.Auth.Identity.Methods = []string{"password"}
+	req.Auth.Identity.Password.User.Name = c.config.Username
+	req.Auth.Identity.Password.User.Domain = domain{Name: c.config.UserDomain}
+	req.Auth.Identity.Password.User.Password = c.config.Password
+	req.Auth.Scope.Project.Name = c.config.Project
+	req.Auth.Scope.Project.Domain = domain{Name: c.config.ProjectDomain}
+	encoded, err := json.Marshal(req)
+	if err != nil {
+		return "", "", err
+	}
+
+	tokenURL := c.authURL + "/v3/auth/tokens"
+	log.Debugf("Keystone POST %s", tokenURL)
+	resp, err := c.http.Post(tokenURL, "application/json", bytes.NewReader(encoded))
+	if err != nil {
+		return "", "", fmt.Errorf("unable to authenticate with Keystone: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", "", fmt.Errorf("unable to authenticate with Keystone: Keystone returned %s: %s", resp.Status,
+			strings.TrimSpace(string(message)))
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", "", fmt.Errorf("unable to authenticate with Keystone: %v", err)
+	}
+	endpoint := c.dnsEndpoint(token)
+	if endpoint == "" {
+		return "", "", fmt.Errorf("keystone's catalog has no public DNS endpoint in region %q", c.config.Region)
+	}
+	c.token = resp.Header.Get(subjectTokenHeader)
+	c.tokenExpiry = token.Token.ExpiresAt.Add(-tokenExpiryMargin)
+	c.endpoint = endpoint
+	return c.token, c.endpoint, nil
+}
+
+// dnsEndpoint returns the URL of the public DNS endpoint of the region in the token's catalog, or "" if there isn't
+// one.
+func (c *client) dnsEndpoint(token tokenResponse) string {
+	for _, service := range token.Token.Catalog {
+		if service.Type != "dns" {
+			continue
+		}
+		for _, endpoint := range service.Endpoints {
+			if endpoint.Interface == "public" && (c.config.Region == "" || endpoint.Region == c.config.Region) {
+				return strings.TrimSuffix(endpoint.URL, "/")
+			}
+		}
+	}
+	return ""
+}
+
+// do sends a request to the DNS endpoint, decoding the response into out if it isn't nil. The path may instead be
+// the URL of a link in an earlier response.
+func (c *client) do(method, path string, in, out interface{}) error {
+	token, endpoint, err := c.authenticate()
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	requestURL := path
+	if !strings.Contains(path, "://") {
+		requestURL = endpoint + path
+	}
+	req, err := http.NewRequest(method, requestURL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(tokenHeader, token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	log.Debugf("Designate %s %s", method, requestURL)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("designate API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
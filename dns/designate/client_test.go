@@ -0,0 +1,431 @@
+package designate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/dns/dnstest"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+const (
+	testUsername = "feed"
+	testPassword = "secret"
+	testProject  = "dns"
+	testToken    = "token"
+	testZoneID   = "a86dba58-0043-4cc6-a1bb-69d5e86f3ca3"
+	testZoneTTL  = 3600
+)
+
+// fakeAPI is an in-memory Keystone token endpoint and Designate API of a single zone.
+type fakeAPI struct {
+	*dnstest.FakeAPI
+	url           string
+	zone          string
+	recordSets    map[string]recordSet
+	nextID        int
+	pageSize      int
+	tokenRequests int
+}
+
+func newFakeAPI(zone string, recordSets ...recordSet) (*fakeAPI, *httptest.Server) {
+	api := &fakeAPI{zone: zone, recordSets: make(map[string]recordSet)}
+	for _, set := range recordSets {
+		api.nextID++
+		set.ID = strconv.Itoa(api.nextID)
+		api.recordSets[set.ID] = set
+	}
+	api.FakeAPI = dnstest.NewFakeAPI(api)
+	server := api.Server
+	api.url = server.URL
+	return api, server
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/identity/v3/auth/tokens" {
+		a.token(w, r)
+		return
+	}
+	if r.Header.Get(tokenHeader) != testToken {
+		a.fail(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	if r.URL.Path == "/dns/v2/zones" {
+		a.listZones(w, r)
+		return
+	}
+	zonePath := "/dns/v2/zones/" + testZoneID + "/recordsets"
+	if r.URL.Path != zonePath && !strings.HasPrefix(r.URL.Path, zonePath+"/") {
+		a.fail(w, http.StatusNotFound, "Could not find Zone")
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, zonePath), "/")
+	current, exists := a.recordSets[id]
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		a.listRecordSets(w, r)
+	case r.Method == http.MethodPost && id == "":
+		a.createRecordSet(w, r)
+	case r.Method == http.MethodPut && exists:
+		var set recordSet
+		json.NewDecoder(r.Body).Decode(&set)
+		if set.Name != "" || set.Type != "" || len(set.Records) == 0 {
+			a.fail(w, http.StatusBadRequest, "Invalid recordset update")
+			return
+		}
+		current.TTL = set.TTL
+		current.Records = set.Records
+		a.recordSets[id] = current
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(current)
+	case r.Method == http.MethodDelete && exists:
+		delete(a.recordSets, id)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(current)
+	default:
+		a.fail(w, http.StatusNotFound, "Could not find RecordSet")
+	}
+}
+
+func (a *fakeAPI) token(w http.ResponseWriter, r *http.Request) {
+	a.tokenRequests++
+	var req tokenRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	user := req.Auth.Identity.Password.User
+	if user.Name != testUsername || user.Password != testPassword || user.Domain.Name != DefaultDomain ||
+		req.Auth.Scope.Project.Name != testProject || req.Auth.Scope.Project.Domain.Name != DefaultDomain {
+		http.Error(w, `{"error":{"code":401,"title":"Unauthorized","message":"The request you have made requires `+
+			`authentication."}}`, http.StatusUnauthorized)
+		return
+	}
+	encoded, _ := json.Marshal(map[string]interface{}{"token": map[string]interface{}{
+		"expires_at": time.Now().Add(time.Hour),
+		"catalog": []interface{}{
+			map[string]interface{}{"type": "identity", "endpoints": []interface{}{
+				map[string]string{"interface": "public", "region": "RegionOne", "url": a.url + "/identity"}}},
+			map[string]interface{}{"type": "dns", "endpoints": []interface{}{
+				map[string]string{"interface": "internal", "region": "RegionOne", "url": "http://designate.internal"},
+				map[string]string{"interface": "public", "region": "RegionOne", "url": a.url + "/dns/"}}},
+		},
+	}})
+	w.Header().Set(subjectTokenHeader, testToken)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(encoded)
+}
+
+func (a *fakeAPI) fail(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": status, "message": message})
+}
+
+func (a *fakeAPI) listZones(w http.ResponseWriter, r *http.Request) {
+	zones := []interface{}{}
+	if name := r.URL.Query().Get("name"); name == "" || name == a.zone+"." {
+		zones = append(zones, map[string]interface{}{"id": testZoneID, "name": a.zone + ".", "ttl": testZoneTTL})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"zones": zones})
+}
+
+func (a *fakeAPI) createRecordSet(w http.ResponseWriter, r *http.Request) {
+	var set recordSet
+	json.NewDecoder(r.Body).Decode(&set)
+	if !strings.HasSuffix(set.Name, "."+a.zone+".") || set.Type == "" || len(set.Records) == 0 {
+		a.fail(w, http.StatusBadRequest, "Invalid recordset")
+		return
+	}
+	for _, existing := range a.recordSets {
+		if existing.Name == set.Name && existing.Type == set.Type {
+			a.fail(w, http.StatusConflict, "Duplicate RecordSet")
+			return
+		}
+	}
+	a.nextID++
+	set.ID = strconv.Itoa(a.nextID)
+	a.recordSets[set.ID] = set
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(set)
+}
+
+func (a *fakeAPI) listRecordSets(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if a.pageSize > 0 {
+		limit = a.pageSize
+	}
+	marker := r.URL.Query().Get("marker")
+
+	all := a.sorted()
+	resp := recordSetsResponse{RecordSets: []recordSet{}}
+	start := 0
+	for i, set := range all {
+		if set.ID == marker {
+			start = i + 1
+		}
+	}
+	for i := start; i < len(all) && i < start+limit; i++ {
+		resp.RecordSets = append(resp.RecordSets, all[i])
+	}
+	if start+limit < len(all) {
+		next := *r.URL
+		query := next.Query()
+		query.Set("marker", all[start+limit-1].ID)
+		next.RawQuery = query.Encode()
+		resp.Links.Next = a.url + next.RequestURI()
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (a *fakeAPI) sorted() []recordSet {
+	var all []recordSet
+	for _, set := range a.recordSets {
+		all = append(all, set)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Name+" "+all[i].Type < all[j].Name+" "+all[j].Type
+	})
+	return all
+}
+
+// values describes the record sets of the fake, as name type ttl records.
+func (a *fakeAPI) values() []string {
+	a.Lock()
+	defer a.Unlock()
+	var values []string
+	for _, set := range a.sorted() {
+		values = append(values, fmt.Sprintf("%s %s %d %s", set.Name, set.Type, aws.Int64Value(set.TTL),
+			strings.Join(set.Records, ",")))
+	}
+	return values
+}
+
+func cnameSet(name, target string, ttl int64) recordSet {
+	return recordSet{Name: name, Type: "CNAME", TTL: aws.Int64(ttl), Records: []string{target}}
+}
+
+func testConfig(server *httptest.Server) Config {
+	return Config{
+		AuthURL:  server.URL + "/identity/v3",
+		Username: testUsername,
+		Password: testPassword,
+		Project:  testProject,
+		Zone:     "example.com",
+	}
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) *client {
+	client := New(testConfig(server)).(*client)
+	domain, err := client.GetHostedZoneDomain()
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com.", domain)
+	return client
+}
+
+func TestGetHostedZoneDomainFailsWithInvalidCredentials(t *testing.T) {
+	_, server := newFakeAPI("example.com")
+	defer server.Close()
+	config := testConfig(server)
+	config.Password = "wrong"
+
+	_, err := New(config).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unable to look up Designate zone example.com: unable to authenticate with "+
+			"Keystone: Keystone returned 401 Unauthorized")
+	}
+}
+
+func TestGetHostedZoneDomainFailsIfTheZoneDoesntExist(t *testing.T) {
+	_, server := newFakeAPI("another.com")
+	defer server.Close()
+
+	_, err := New(testConfig(server)).GetHostedZoneDomain()
+
+	assert.EqualError(t, err, "designate zone example.com doesn't exist")
+}
+
+func TestGetHostedZoneDomainFailsWithoutADNSEndpointInTheRegion(t *testing.T) {
+	_, server := newFakeAPI("example.com")
+	defer server.Close()
+	config := testConfig(server)
+	config.Region = "RegionTwo"
+
+	_, err := New(config).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `keystone's catalog has no public DNS endpoint in region "RegionTwo"`)
+	}
+}
+
+func TestTokensAreReusedUntilTheyExpire(t *testing.T) {
+	// given
+	api, server := newFakeAPI("example.com")
+	defer server.Close()
+	now := time.Now()
+	client := New(testConfig(server)).(*client)
+	client.now = func() time.Time { return now }
+
+	// when
+	_, err := client.GetHostedZoneDomain()
+	_, _ = client.GetRecords()
+	tokensBeforeExpiry := api.tokenRequests
+	now = now.Add(time.Hour)
+	_, _ = client.GetRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 1, tokensBeforeExpiry)
+	assert.Equal(t, 2, api.tokenRequests)
+}
+
+func TestGetRecordsConvertsRecordSets(t *testing.T) {
+	// given
+	_, server := newFakeAPI("example.com",
+		cnameSet("foo.example.com.", "lb.example.net.", 300),
+		recordSet{Name: "example.com.", Type: "A", Records: []string{"10.0.0.1", "10.0.0.2"}},
+		recordSet{Name: "foo.example.com.", Type: "AAAA", TTL: aws.Int64(300), Records: []string{"2001:db8::1"}},
+		recordSet{Name: "foo.example.com.", Type: "TXT", TTL: aws.Int64(60), Records: []string{`"hello"`}},
+		recordSet{Name: "example.com.", Type: "NS", Records: []string{"ns1.example.net."}},
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	records, err := client.GetRecords()
+	txtRecords, txtErr := client.GetTXTRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*route53.ResourceRecordSet{
+		{
+			Name: aws.String("example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(testZoneTTL),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.1")},
+				{Value: aws.String("10.0.0.2")},
+			},
+		},
+		{
+			Name:            aws.String("foo.example.com."),
+			Type:            aws.String("AAAA"),
+			TTL:             aws.Int64(300),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("2001:db8::1")}},
+		},
+		dnstest.CNAME("foo.example.com.", "lb.example.net", 300),
+	}, records)
+	assert.NoError(t, txtErr)
+	assert.Equal(t, []*route53.ResourceRecordSet{{
+		Name:            aws.String("foo.example.com."),
+		Type:            aws.String("TXT"),
+		TTL:             aws.Int64(60),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"hello"`)}},
+	}}, txtRecords)
+}
+
+func TestGetRecordsFollowsTheNextLink(t *testing.T) {
+	// given
+	var sets []recordSet
+	for i := 0; i < 5; i++ {
+		sets = append(sets, cnameSet(fmt.Sprintf("host-%d.example.com.", i), "lb.example.net.", 60))
+	}
+	api, server := newFakeAPI("example.com", sets...)
+	defer server.Close()
+	api.pageSize = 2
+	client := newTestClient(t, server)
+
+	// when
+	recordSets, err := client.GetRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, recordSets, 5)
+	assert.Len(t, api.Requests(), 5, "a token, the zone and three pages of record sets")
+}
+
+func TestUpdateRecordSetsCreatesReplacesAndDeletesRecordSets(t *testing.T) {
+	// given
+	api, server := newFakeAPI("example.com",
+		cnameSet("update.example.com.", "old.example.net.", 300),
+		cnameSet("delete.example.com.", "lb.example.net.", 300),
+		recordSet{Name: "ips.example.com.", Type: "A", TTL: aws.Int64(60), Records: []string{"10.0.0.1", "10.0.0.2"}},
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{
+		{Action: aws.String("CREATE"), ResourceRecordSet: dnstest.CNAME("create.example.com.", "lb.example.net", 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("update.example.com.", "new.example.net", 60)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name: aws.String("ips.example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.2")},
+				{Value: aws.String("10.0.0.3")},
+			},
+		}},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name:            aws.String("_feed-owner.create.example.com."),
+			Type:            aws.String("TXT"),
+			TTL:             aws.Int64(300),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"owner"`)}},
+		}},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("*.apps.example.com.", "lb.example.net", 60)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: dnstest.CNAME("delete.example.com.", "lb.example.net", 300)},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"*.apps.example.com. CNAME 60 lb.example.net.",
+		`_feed-owner.create.example.com. TXT 300 "owner"`,
+		"create.example.com. CNAME 300 lb.example.net.",
+		"ips.example.com. A 60 10.0.0.2,10.0.0.3",
+		"update.example.com. CNAME 60 new.example.net.",
+	}, api.values())
+}
+
+func TestUpdateRecordSetsFailsForChangesWhichCantBeApplied(t *testing.T) {
+	api, server := newFakeAPI("example.com", cnameSet("foo.example.com.", "lb.example.net.", 60))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	dnstest.RunUnappliedChanges(t, client, "Designate")
+
+	// Record sets created since they were listed aren't overwritten.
+	api.Lock()
+	api.recordSets["bar"] = cnameSet("bar.example.com.", "other.example.net.", 60)
+	api.Unlock()
+	_, err := client.CreateSet(dnstest.CNAME("bar.example.com.", "lb.example.net", 60))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "409 Conflict")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	dnstest.RunConformance(t, func() (func(id string) r53.Route53Client, func()) {
+		_, server := newFakeAPI(dnstest.Zone)
+		return func(id string) r53.Route53Client {
+			config := testConfig(server)
+			config.Zone = id
+			return New(config)
+		}, server.Close
+	})
+}
@@ -0,0 +1,96 @@
+package dns
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/sky-uk/feed/dns/adapter"
+)
+
+// Record is a record the updater wants to exist for an ingress host, as computed by the last update of its zone.
+type Record struct {
+	Zone          string `json:"zone"`
+	Host          string `json:"host"`
+	Type          string `json:"type"`
+	Target        string `json:"target"`
+	TTL           int64  `json:"ttl,omitempty"`
+	SetIdentifier string `json:"setIdentifier,omitempty"`
+}
+
+// RecordLister is implemented by the dns updater, to list the records it manages.
+type RecordLister interface {
+	// Records returns the desired records of every hosted zone, computed by the last update of each zone, without
+	// querying Route53. Zones which haven't been updated yet have no records.
+	Records() []Record
+}
+
+// desiredRecords holds the records computed by the last update of each hosted zone.
+type desiredRecords struct {
+	sync.Mutex
+	byZone map[string][]Record
+}
+
+func (d *desiredRecords) set(zone *hostedZone, records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.SetIdentifier < b.SetIdentifier
+	})
+
+	d.Lock()
+	defer d.Unlock()
+	if d.byZone == nil {
+		d.byZone = make(map[string][]Record)
+	}
+	d.byZone[zone.id] = records
+}
+
+func (d *desiredRecords) all() []Record {
+	d.Lock()
+	defer d.Unlock()
+
+	var zones []string
+	for zone := range d.byZone {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	records := []Record{}
+	for _, zone := range zones {
+		records = append(records, d.byZone[zone]...)
+	}
+	return records
+}
+
+// desiredRecord describes the record for a host, from the change creating it, or the existing record if it's
+// unchanged.
+func desiredRecord(zone *hostedZone, host string, details adapter.DNSDetails, policy adapter.RoutingPolicy,
+	change *route53.Change, existing adapter.ConsolidatedRecord) Record {
+
+	record := Record{
+		Zone:          zone.domain,
+		Host:          host,
+		Target:        details.DNSName,
+		SetIdentifier: policy.SetIdentifier,
+	}
+	if change == nil {
+		record.Type = existing.Type
+		record.TTL = existing.TTL
+		return record
+	}
+	record.Type = aws.StringValue(change.ResourceRecordSet.Type)
+	record.TTL = aws.Int64Value(change.ResourceRecordSet.TTL)
+	return record
+}
+
+// Records returns the desired records of every hosted zone, computed by the last update of each zone.
+func (u *updater) Records() []Record {
+	return u.records.all()
+}
@@ -0,0 +1,293 @@
+/*
+Package digitalocean is the DigitalOcean provider of feed-dns, managing the records of a domain through the
+DigitalOcean v2 API. Each value of a Route53 record set is a DigitalOcean record, named relative to the domain with
+@ for the apex, and records are listed a page at a time.
+*/
+package digitalocean
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/dns/recordset"
+)
+
+const (
+	// DefaultAPIURL is the URL of the DigitalOcean API.
+	DefaultAPIURL = "https://api.digitalocean.com/v2"
+	// pageSize is the number of records listed per request, DigitalOcean's maximum.
+	pageSize       = 200
+	requestTimeout = 30 * time.Second
+	// minTTL is the smallest TTL DigitalOcean accepts. Shorter TTLs are rounded up to it.
+	minTTL = 30
+	// apex is the name of records for the domain itself.
+	apex = "@"
+)
+
+// Capabilities are those of DigitalOcean domain records. TTLs shorter than DigitalOcean's minimum of 30 seconds are
+// rounded up to it rather than rejected.
+var Capabilities = r53.Capabilities{Provider: "digitalocean", IPv6: true, TXT: true, MinTTL: minTTL, MaxTTL: r53.MaxTTL,
+	RoundsUpTTL: true}
+
+// Config describes the DigitalOcean domain to manage and how to reach the API.
+// Token is an API token with write access to the Domain, which is the domain's name, e.g. example.com.
+// APIURL overrides DefaultAPIURL, e.g. for testing.
+type Config struct {
+	Token  string
+	Domain string
+	APIURL string
+}
+
+type client struct {
+	http     *http.Client
+	apiURL   string
+	token    string
+	domain   string
+	names    recordset.Names
+	lookedUp bool
+}
+
+// record is a domain record of the DigitalOcean API. Each value of a record set is a separate record.
+type record struct {
+	ID   int64  `json:"id,omitempty"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Data string `json:"data"`
+	TTL  int64  `json:"ttl"`
+}
+
+type recordResponse struct {
+	DomainRecord record `json:"domain_record"`
+}
+
+type recordsResponse struct {
+	DomainRecords []record `json:"domain_records"`
+	Links         struct {
+		Pages struct {
+			Next string `json:"next"`
+		} `json:"pages"`
+	} `json:"links"`
+}
+
+// NewUpdater creates a dns updater of DigitalOcean domains. The hosted zone ids of the updater config are the
+// domains, overriding the Domain of the config.
+func NewUpdater(lbAdapter adapter.FrontendAdapter, updaterConfig dns.Config, config Config) controller.Updater {
+	updaterConfig.ZoneClient = func(zone string) r53.Route53Client {
+		zoneConfig := config
+		zoneConfig.Domain = zone
+		return New(zoneConfig)
+	}
+	return dns.New(lbAdapter, updaterConfig)
+}
+
+// New creates a client of a DigitalOcean domain, authenticated with the API token of the config.
+func New(config Config) r53.Route53Client {
+	apiURL := config.APIURL
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	domain := strings.TrimSuffix(config.Domain, ".")
+	return &client{
+		http:   &http.Client{Timeout: requestTimeout},
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+		token:  config.Token,
+		domain: domain,
+		names:  recordset.Names{Zone: domain, Apex: apex},
+	}
+}
+
+// Capabilities of the client.
+func (c *client) Capabilities() r53.Capabilities {
+	return Capabilities
+}
+
+// GetHostedZoneDomain looks up the domain, which fails if the token is invalid, and returns it with a trailing
+// period.
+func (c *client) GetHostedZoneDomain() (string, error) {
+	if err := c.do(http.MethodGet, c.domainPath(""), nil, nil); err != nil {
+		return "", fmt.Errorf("unable to look up DigitalOcean domain %s: %v", c.domain, err)
+	}
+	c.lookedUp = true
+	return c.domain + ".", nil
+}
+
+// GetRecords returns the CNAME, A and AAAA record sets of the domain.
+func (c *client) GetRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsAddress)
+}
+
+// GetTXTRecords returns the TXT record sets of the domain.
+func (c *client) GetTXTRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsTXT)
+}
+
+func (c *client) listRecordSets(include func(recordType string) bool) ([]*route53.ResourceRecordSet, error) {
+	records, err := c.listRecords()
+	if err != nil {
+		return nil, err
+	}
+	return recordset.Sets(records, include), nil
+}
+
+// listRecords lists every record of the domain, a page at a time.
+func (c *client) listRecords() ([]recordset.Record, error) {
+	if !c.lookedUp {
+		return nil, fmt.Errorf("digitalocean domain %s hasn't been looked up", c.domain)
+	}
+
+	var records []recordset.Record
+	for page := 1; ; page++ {
+		var resp recordsResponse
+		path := c.domainPath(fmt.Sprintf("/records?page=%d&per_page=%d", page, pageSize))
+		if err := c.do(http.MethodGet, path, nil, &resp); err != nil {
+			return nil, fmt.Errorf("unable to list records of DigitalOcean domain %s: %v", c.domain, err)
+		}
+		for _, rec := range resp.DomainRecords {
+			records = append(records, c.recordOf(rec))
+		}
+		if resp.Links.Pages.Next == "" || len(resp.DomainRecords) == 0 {
+			return records, nil
+		}
+	}
+}
+
+// UpdateRecordSets applies the changes in order, as DigitalOcean records. A change which can't be applied, such as
+// deleting a record set which doesn't exist, fails the update, leaving the changes before it applied.
+func (c *client) UpdateRecordSets(changes []*route53.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	records, err := c.listRecords()
+	if err != nil {
+		return err
+	}
+	_, err = recordset.Apply("DigitalOcean DNS", c, records, changes)
+	return err
+}
+
+// Create creates a DigitalOcean record of the record set with the value.
+func (c *client) Create(rrs *route53.ResourceRecordSet, value string) (recordset.Record, error) {
+	rec := record{
+		Type: aws.StringValue(rrs.Type),
+		Name: c.names.Relative(aws.StringValue(rrs.Name)),
+		Data: dataOf(aws.StringValue(rrs.Type), value),
+		TTL:  c.ttlOf(aws.StringValue(rrs.Name), aws.Int64Value(rrs.TTL)),
+	}
+	var created recordResponse
+	if err := c.do(http.MethodPost, c.domainPath("/records"), rec, &created); err != nil {
+		return recordset.Record{}, err
+	}
+	return c.recordOf(created.DomainRecord), nil
+}
+
+// UpdateTTL changes the TTL of the DigitalOcean record, unless it already has the TTL once rounded up.
+func (c *client) UpdateTTL(rec recordset.Record, ttl int64) (recordset.Record, error) {
+	updated := rec.Native.(record)
+	ttl = c.ttlOf(rec.Name, ttl)
+	if updated.TTL == ttl {
+		return rec, nil
+	}
+	updated.TTL = ttl
+	if err := c.do(http.MethodPut, c.recordPath(updated.ID), updated, nil); err != nil {
+		return recordset.Record{}, err
+	}
+	return c.recordOf(updated), nil
+}
+
+// Delete deletes the DigitalOcean record.
+func (c *client) Delete(rec recordset.Record) error {
+	return c.do(http.MethodDelete, c.recordPath(rec.Native.(record).ID), nil, nil)
+}
+
+// recordOf returns the value of a record set a DigitalOcean record is.
+func (c *client) recordOf(rec record) recordset.Record {
+	return recordset.Record{Name: c.names.FQDN(rec.Name), Type: rec.Type, Value: valueOf(rec), TTL: rec.TTL,
+		Native: rec}
+}
+
+// ttlOf returns the TTL of a record of the name, rounded up to DigitalOcean's minimum.
+func (c *client) ttlOf(name string, ttl int64) int64 {
+	if ttl < minTTL {
+		log.Infof("Rounding up the TTL of %s from %ds to DigitalOcean's minimum of %ds", name, ttl, minTTL)
+		return minTTL
+	}
+	return ttl
+}
+
+func (c *client) domainPath(suffix string) string {
+	return "/domains/" + url.PathEscape(c.domain) + suffix
+}
+
+func (c *client) recordPath(id int64) string {
+	return c.domainPath("/records/" + strconv.FormatInt(id, 10))
+}
+
+// dataOf returns the DigitalOcean data of a record value. CNAME targets need a trailing period, otherwise
+// DigitalOcean treats them as relative to the domain.
+func dataOf(recordType, value string) string {
+	if recordType == route53.RRTypeCname {
+		return recordset.Canonical(value)
+	}
+	return value
+}
+
+// valueOf returns the record value of a DigitalOcean record, without the trailing period of CNAME targets.
+func valueOf(rec record) string {
+	if rec.Type == route53.RRTypeCname {
+		return strings.TrimSuffix(rec.Data, ".")
+	}
+	return rec.Data
+}
+
+// do sends a request to the API, decoding the response into out if it isn't nil.
+func (c *client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, c.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	log.Debugf("DigitalOcean API %s %s", method, path)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("digitalocean API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,307 @@
+package digitalocean
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/dns/dnstest"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+const testToken = "secret"
+
+// fakeAPI is an in-memory DigitalOcean API of a single domain.
+type fakeAPI struct {
+	*dnstest.FakeAPI
+	domain  string
+	records map[int64]record
+	nextID  int64
+}
+
+func newFakeAPI(domain string, records ...record) (*fakeAPI, *httptest.Server) {
+	api := &fakeAPI{domain: domain, records: make(map[int64]record)}
+	for _, rec := range records {
+		api.add(rec)
+	}
+	api.FakeAPI = dnstest.NewFakeAPI(api)
+	return api, api.Server
+}
+
+func (a *fakeAPI) add(rec record) record {
+	a.nextID++
+	rec.ID = a.nextID
+	a.records[rec.ID] = rec
+	return rec
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		http.Error(w, `{"id":"unauthorized","message":"Unable to authenticate you."}`, http.StatusUnauthorized)
+		return
+	}
+	domainPath := "/domains/" + a.domain
+	if !strings.HasPrefix(r.URL.Path, domainPath) {
+		http.Error(w, `{"id":"not_found","message":"The resource you were accessing could not be found."}`,
+			http.StatusNotFound)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, domainPath)
+	id, _ := strconv.ParseInt(strings.TrimPrefix(path, "/records/"), 10, 64)
+	switch {
+	case r.Method == http.MethodGet && path == "":
+		json.NewEncoder(w).Encode(map[string]interface{}{"domain": map[string]string{"name": a.domain}})
+	case r.Method == http.MethodGet && path == "/records":
+		a.listRecords(w, r)
+	case r.Method == http.MethodPost && path == "/records":
+		var rec record
+		json.NewDecoder(r.Body).Decode(&rec)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(recordResponse{a.add(rec)})
+	case r.Method == http.MethodPut && a.records[id].ID != 0:
+		var rec record
+		json.NewDecoder(r.Body).Decode(&rec)
+		rec.ID = id
+		a.records[id] = rec
+		json.NewEncoder(w).Encode(recordResponse{rec})
+	case r.Method == http.MethodDelete && a.records[id].ID != 0:
+		delete(a.records, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *fakeAPI) listRecords(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if page < 1 || perPage < 1 || perPage > pageSize {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	all := a.sorted()
+	var resp recordsResponse
+	for i := (page - 1) * perPage; i < len(all) && i < page*perPage; i++ {
+		resp.DomainRecords = append(resp.DomainRecords, all[i])
+	}
+	if page*perPage < len(all) {
+		resp.Links.Pages.Next = fmt.Sprintf("%s?page=%d&per_page=%d", r.URL.Path, page+1, perPage)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (a *fakeAPI) sorted() []record {
+	var all []record
+	for _, rec := range a.records {
+		all = append(all, rec)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return all[i].Data < all[j].Data
+	})
+	return all
+}
+
+// values describes the records of the fake, as name type data ttl.
+func (a *fakeAPI) values() []string {
+	a.Lock()
+	defer a.Unlock()
+	var values []string
+	for _, rec := range a.sorted() {
+		values = append(values, fmt.Sprintf("%s %s %s %d", rec.Name, rec.Type, rec.Data, rec.TTL))
+	}
+	return values
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) r53.Route53Client {
+	client := New(Config{Token: testToken, Domain: "example.com", APIURL: server.URL})
+	domain, err := client.GetHostedZoneDomain()
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com.", domain)
+	return client
+}
+
+func TestGetHostedZoneDomainFailsIfTheDomainDoesntExist(t *testing.T) {
+	_, server := newFakeAPI("another.com")
+	defer server.Close()
+
+	_, err := New(Config{Token: testToken, Domain: "example.com", APIURL: server.URL}).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unable to look up DigitalOcean domain example.com")
+		assert.Contains(t, err.Error(), "404 Not Found")
+	}
+}
+
+func TestRequestsFailWithTheAPIError(t *testing.T) {
+	_, server := newFakeAPI("example.com")
+	defer server.Close()
+
+	_, err := New(Config{Token: "wrong", Domain: "example.com", APIURL: server.URL}).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "401 Unauthorized")
+		assert.Contains(t, err.Error(), "Unable to authenticate you.")
+	}
+}
+
+func TestGetRecordsConvertsRecordsToRecordSets(t *testing.T) {
+	// given
+	_, server := newFakeAPI("example.com",
+		record{Type: "CNAME", Name: "foo", Data: "lb.example.net.", TTL: 300},
+		record{Type: "A", Name: "@", Data: "10.0.0.1", TTL: 1800},
+		record{Type: "A", Name: "@", Data: "10.0.0.2", TTL: 1800},
+		record{Type: "TXT", Name: "foo", Data: `"hello"`, TTL: 60},
+		record{Type: "MX", Name: "@", Data: "mail.example.com.", TTL: 1800},
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	records, err := client.GetRecords()
+	txtRecords, txtErr := client.GetTXTRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*route53.ResourceRecordSet{
+		{
+			Name: aws.String("example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(1800),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.1")},
+				{Value: aws.String("10.0.0.2")},
+			},
+		},
+		dnstest.CNAME("foo.example.com.", "lb.example.net", 300),
+	}, records)
+	assert.NoError(t, txtErr)
+	assert.Equal(t, []*route53.ResourceRecordSet{{
+		Name:            aws.String("foo.example.com."),
+		Type:            aws.String("TXT"),
+		TTL:             aws.Int64(60),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"hello"`)}},
+	}}, txtRecords)
+}
+
+func TestGetRecordsListsEveryPage(t *testing.T) {
+	// given
+	var records []record
+	for i := 0; i < pageSize*2+1; i++ {
+		records = append(records, record{Type: "CNAME", Name: fmt.Sprintf("host-%03d", i), Data: "lb.example.net.",
+			TTL: 60})
+	}
+	api, server := newFakeAPI("example.com", records...)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	recordSets, err := client.GetRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, recordSets, pageSize*2+1)
+	assert.Equal(t, []string{"GET /domains/example.com", "GET /domains/example.com/records",
+		"GET /domains/example.com/records", "GET /domains/example.com/records"}, api.Requests())
+}
+
+func TestUpdateRecordSetsCreatesUpsertsAndDeletesRecords(t *testing.T) {
+	// given
+	api, server := newFakeAPI("example.com",
+		record{Type: "CNAME", Name: "update", Data: "old.example.net.", TTL: 300},
+		record{Type: "CNAME", Name: "ttl", Data: "lb.example.net.", TTL: 300},
+		record{Type: "CNAME", Name: "delete", Data: "lb.example.net.", TTL: 300},
+		record{Type: "A", Name: "ips", Data: "10.0.0.1", TTL: 60},
+		record{Type: "A", Name: "ips", Data: "10.0.0.2", TTL: 60},
+		record{Type: "MX", Name: "@", Data: "mail.example.com.", TTL: 1800},
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{
+		{Action: aws.String("CREATE"), ResourceRecordSet: dnstest.CNAME("create.example.com.", "lb.example.net", 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("update.example.com.", "new.example.net", 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("ttl.example.com.", "lb.example.net", 60)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name: aws.String("ips.example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.2")},
+				{Value: aws.String("10.0.0.3")},
+			},
+		}},
+		{Action: aws.String("DELETE"), ResourceRecordSet: dnstest.CNAME("delete.example.com.", "lb.example.net", 300)},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"@ MX mail.example.com. 1800",
+		"create CNAME lb.example.net. 300",
+		"ips A 10.0.0.2 60",
+		"ips A 10.0.0.3 60",
+		"ttl CNAME lb.example.net. 60",
+		"update CNAME new.example.net. 300",
+	}, api.values())
+}
+
+func TestShortTTLsAreRoundedUpToTheMinimum(t *testing.T) {
+	// given
+	api, server := newFakeAPI("example.com", record{Type: "CNAME", Name: "foo", Data: "lb.example.net.", TTL: 300})
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{
+		{Action: aws.String("CREATE"), ResourceRecordSet: dnstest.CNAME("bar.example.com.", "lb.example.net", 10)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("foo.example.com.", "lb.example.net", 0)},
+	})
+	requests := len(api.Requests())
+	repeatErr := client.UpdateRecordSets([]*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("foo.example.com.", "lb.example.net", 10)},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.NoError(t, repeatErr)
+	assert.Equal(t, []string{"bar CNAME lb.example.net. 30", "foo CNAME lb.example.net. 30"}, api.values())
+	assert.Equal(t, []string{"GET /domains/example.com/records"}, api.Requests()[requests:],
+		"records which already have the minimum TTL shouldn't be updated")
+}
+
+func TestUpdateRecordSetsFailsForChangesWhichCantBeApplied(t *testing.T) {
+	_, server := newFakeAPI("example.com", record{Type: "CNAME", Name: "foo", Data: "lb.example.net.", TTL: 60})
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	dnstest.RunUnappliedChanges(t, client, "DigitalOcean DNS")
+}
+
+func TestConformance(t *testing.T) {
+	dnstest.RunConformance(t, func() (func(id string) r53.Route53Client, func()) {
+		_, server := newFakeAPI(dnstest.Zone)
+		return func(id string) r53.Route53Client {
+			return New(Config{Token: testToken, Domain: id, APIURL: server.URL})
+		}, server.Close
+	})
+}
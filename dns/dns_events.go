@@ -0,0 +1,99 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns/adapter"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+const (
+	recordCreatedReason = "DNSRecordCreated"
+	recordUpdatedReason = "DNSRecordUpdated"
+	recordDeletedReason = "DNSRecordDeleted"
+	updateFailedReason  = "DNSUpdateFailed"
+	// unsupportedAnnotationReason is recorded once per ingress and annotation, until the annotation is removed.
+	unsupportedAnnotationReason = "DNSAnnotationUnsupported"
+)
+
+var operationReasons = map[string]string{
+	"created": recordCreatedReason,
+	"updated": recordUpdatedReason,
+	"deleted": recordDeletedReason,
+}
+
+// recordChangeEvents records an event for each change on the ingresses of the changed host. There's no event
+// for records deleted after their ingress was removed, as there's no ingress left to record it on.
+func (u *updater) recordChangeEvents(changes []*route53.Change, records []adapter.ConsolidatedRecord,
+	entries controller.IngressEntries) {
+
+	if u.events == nil {
+		return
+	}
+
+	ingresses := ingressesByHost(entries)
+	operations := operationsOf(changes, records)
+	for i, change := range changes {
+		rrs := change.ResourceRecordSet
+		message := fmt.Sprintf("%s %s record %s in %s", strings.Title(operations[i]), aws.StringValue(rrs.Type),
+			aws.StringValue(rrs.Name), u.provider())
+		for _, ingress := range ingresses[aws.StringValue(rrs.Name)] {
+			u.events.Event(ingress, v1.EventTypeNormal, operationReasons[operations[i]], message)
+		}
+	}
+}
+
+// recordFailureEvents records a warning on the ingresses of each host whose records failed to change.
+func (u *updater) recordFailureEvents(changes []*route53.Change, entries controller.IngressEntries, err error) {
+	if u.events == nil {
+		return
+	}
+
+	ingresses := ingressesByHost(entries)
+	warned := make(map[*v1beta1.Ingress]bool)
+	for _, change := range changes {
+		rrs := change.ResourceRecordSet
+		for _, ingress := range ingresses[aws.StringValue(rrs.Name)] {
+			if warned[ingress] {
+				continue
+			}
+			warned[ingress] = true
+			message := fmt.Sprintf("Unable to update %s records for %s in %s: %v", aws.StringValue(rrs.Type),
+				aws.StringValue(rrs.Name), u.provider(), err)
+			u.events.Event(ingress, v1.EventTypeWarning, updateFailedReason, message)
+		}
+	}
+}
+
+// recordUnsupportedAnnotationEvent records a warning on an ingress with an annotation which is ignored, as it isn't
+// supported.
+func (u *updater) recordUnsupportedAnnotationEvent(ingress *v1beta1.Ingress, err error) {
+	if u.events == nil {
+		return
+	}
+	u.events.Event(ingress, v1.EventTypeWarning, unsupportedAnnotationReason, err.Error())
+}
+
+// ingressesByHost maps each host, with a trailing period like Route53 record names, to its ingresses.
+func ingressesByHost(entries controller.IngressEntries) map[string][]*v1beta1.Ingress {
+	type ingressHost struct {
+		ingress *v1beta1.Ingress
+		host    string
+	}
+	ingresses := make(map[string][]*v1beta1.Ingress)
+	seen := make(map[ingressHost]bool)
+	for _, entry := range entries {
+		key := ingressHost{entry.Ingress, entry.Host + "."}
+		if entry.Ingress == nil || seen[key] {
+			continue
+		}
+		seen[key] = true
+		ingresses[key.host] = append(ingresses[key.host], entry.Ingress)
+	}
+	return ingresses
+}
@@ -4,12 +4,16 @@ import (
 	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/controller"
 	"github.com/sky-uk/feed/util/metrics"
 )
 
 var once sync.Once
-var recordsGauge prometheus.Gauge
-var updateCount, failedCount, skippedCount prometheus.Counter
+var recordsGauge, rejectedChangesGauge prometheus.Gauge
+var observedIngressesGauge, contributingHostsGauge, resultingRecordsGauge prometheus.Gauge
+var updateCount, failedCount, skippedCount, excludedCount, skippedDeletesCount, invalidRecordsCount prometheus.Counter
+var ownedRecordsGauge *prometheus.GaugeVec
+var recordChangesCount *prometheus.CounterVec
 
 func initMetrics() {
 	once.Do(func() {
@@ -22,6 +26,44 @@ func initMetrics() {
 				ConstLabels: metrics.ConstLabels(),
 			})).(prometheus.Gauge)
 
+		rejectedChangesGauge = prometheus.MustRegisterOrGet(prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: metrics.PrometheusNamespace,
+				Subsystem: metrics.PrometheusDNSSubsystem,
+				Name:      "route53_rejected_changes",
+				Help: "The number of changes rejected as invalid by Route53 in the last update. feed-dns is" +
+					" degraded while this is non-zero.",
+				ConstLabels: metrics.ConstLabels(),
+			})).(prometheus.Gauge)
+
+		observedIngressesGauge = prometheus.MustRegisterOrGet(prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace:   metrics.PrometheusNamespace,
+				Subsystem:   metrics.PrometheusDNSSubsystem,
+				Name:        "observed_ingresses",
+				Help:        "The number of ingresses with hosts seen by the last update.",
+				ConstLabels: metrics.ConstLabels(),
+			})).(prometheus.Gauge)
+
+		contributingHostsGauge = prometheus.MustRegisterOrGet(prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: metrics.PrometheusNamespace,
+				Subsystem: metrics.PrometheusDNSSubsystem,
+				Name:      "contributing_hosts",
+				Help: "The number of ingress hosts with records computed by the last update, after skipped" +
+					" entries are left out.",
+				ConstLabels: metrics.ConstLabels(),
+			})).(prometheus.Gauge)
+
+		resultingRecordsGauge = prometheus.MustRegisterOrGet(prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace:   metrics.PrometheusNamespace,
+				Subsystem:   metrics.PrometheusDNSSubsystem,
+				Name:        "resulting_records",
+				Help:        "The number of records computed for ingress hosts by the last update.",
+				ConstLabels: metrics.ConstLabels(),
+			})).(prometheus.Gauge)
+
 		updateCount = prometheus.MustRegisterOrGet(prometheus.NewCounter(
 			prometheus.CounterOpts{
 				Namespace:   metrics.PrometheusNamespace,
@@ -50,5 +92,82 @@ func initMetrics() {
 				ConstLabels: metrics.ConstLabels(),
 			})).(prometheus.Counter)
 
+		excludedCount = prometheus.MustRegisterOrGet(prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: metrics.PrometheusNamespace,
+				Subsystem: metrics.PrometheusDNSSubsystem,
+				Name:      "excluded_ingresses",
+				Help: "The number of ingresses excluded by the sky.uk/feed-dns-exclude annotation, counted on" +
+					" every update.",
+				ConstLabels: metrics.ConstLabels(),
+			})).(prometheus.Counter)
+
+		skippedDeletesCount = prometheus.MustRegisterOrGet(prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: metrics.PrometheusNamespace,
+				Subsystem: metrics.PrometheusDNSSubsystem,
+				Name:      "skipped_deletes",
+				Help: "The number of record deletes skipped by -no-delete, counted on every update, so records left" +
+					" in place can be audited.",
+				ConstLabels: metrics.ConstLabels(),
+			})).(prometheus.Counter)
+
+		invalidRecordsCount = prometheus.MustRegisterOrGet(prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: metrics.PrometheusNamespace,
+				Subsystem: metrics.PrometheusDNSSubsystem,
+				Name:      "invalid_records",
+				Help: "The number of computed records skipped as invalid, such as CNAMEs to an empty hostname," +
+					" counted on every update.",
+				ConstLabels: metrics.ConstLabels(),
+			})).(prometheus.Counter)
+
+		ownedRecordsGauge = prometheus.MustRegisterOrGet(prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   metrics.PrometheusNamespace,
+				Subsystem:   metrics.PrometheusDNSSubsystem,
+				Name:        "owned_records",
+				Help:        "The number of records managed by feed-dns after the last reconcile.",
+				ConstLabels: metrics.ConstLabels(),
+			}, []string{"provider"})).(*prometheus.GaugeVec)
+
+		recordChangesCount = prometheus.MustRegisterOrGet(prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metrics.PrometheusNamespace,
+				Subsystem: metrics.PrometheusDNSSubsystem,
+				Name:      "record_changes",
+				Help: "The number of records created, updated or deleted by feed-dns, and the number of ingress" +
+					" entries skipped.",
+				ConstLabels: metrics.ConstLabels(),
+			}, []string{"provider", "operation"})).(*prometheus.CounterVec)
 	})
 }
+
+func (u *updater) skipEntry() {
+	u.skipEntries(1)
+}
+
+// skipEntries counts entries skipped by an update, such as those the ownership registry or TXT records leave out.
+func (u *updater) skipEntries(count int) {
+	skippedCount.Add(float64(count))
+	recordChangesCount.WithLabelValues(u.provider(), "skipped").Add(float64(count))
+}
+
+// countIngresses returns the number of ingresses with entries.
+func countIngresses(entries controller.IngressEntries) int {
+	ingresses := make(map[string]bool)
+	for _, entry := range entries {
+		ingresses[entry.NamespaceName()] = true
+	}
+	return len(ingresses)
+}
+
+// setDesiredRecordGauges sets the number of hosts with records, and the number of records, from the desired records.
+func setDesiredRecordGauges(records []Record) {
+	hosts := make(map[string]bool)
+	for _, record := range records {
+		hosts[record.Host] = true
+	}
+	contributingHostsGauge.Set(float64(len(hosts)))
+	resultingRecordsGauge.Set(float64(len(records)))
+}
@@ -1,38 +1,227 @@
 package dns
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"text/template"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/route53"
 	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/controller"
 	"github.com/sky-uk/feed/dns/adapter"
 	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/k8s"
+	"github.com/sky-uk/feed/util"
+	"github.com/sky-uk/feed/util/tracing"
 )
 
-type hostToIngress map[string]controller.IngressEntry
+// hostToIngress maps a host to the first ingress entry seen for each load balancer scheme.
+type hostToIngress map[string][]controller.IngressEntry
+
+type hostedZone struct {
+	id     string
+	r53    r53.Route53Client
+	domain string
+	// scheme is the load balancer scheme of the ingresses whose records are in the zone, or empty for any scheme.
+	scheme string
+}
+
+// Load balancer schemes of the ingresses managed by InternalHostedZoneID and ExternalHostedZoneID.
+const (
+	internalLBScheme = "internal"
+	externalLBScheme = "internet-facing"
+)
+
+// logicalZoneSchemes maps the logical zones of the zones annotation to the scheme of their hosted zone.
+var logicalZoneSchemes = map[string]string{
+	adapter.InternalZone: internalLBScheme,
+	adapter.ExternalZone: externalLBScheme,
+}
 
 type updater struct {
-	r53                 r53.Route53Client
+	zones               []*hostedZone
 	schemeToFrontendMap map[string]adapter.DNSDetails
-	domain              string
+	distributions       map[string]adapter.DNSDetails
+	namedFrontends      map[string]adapter.DNSDetails
 	lbAdapter           adapter.FrontendAdapter
+	registry            *ownershipRegistry
+	txt                 *txtRecords
+	events              k8s.EventRecorder
+	hostFilter          *regexp.Regexp
+	excludedHosts       map[string]bool
+	setIdentifier       *template.Template
+	recordName          *template.Template
+	clusterName         string
+	orphans             *orphanedRecords
+	statusTargets       map[string]bool
+	managedTypes        map[string]bool
+	webhook             *changeWebhook
+	healthChecks        *healthChecks
+	maxRecords          int
+	noDelete            bool
+	unsupportedWarned   map[string]bool
+	records             desiredRecords
+	health              util.SafeError
+	draining            bool
+	dryRun              bool
 }
 
-// New creates an updater for dns
-func New(hostedZoneID string, lbAdapter adapter.FrontendAdapter, retries int) controller.Updater {
+// Config for creating a dns updater.
+type Config struct {
+	HostedZoneIDs []string
+	Route53       r53.Config
+	// TXTOwnerID enables ownership records if set. Only records with an ownership TXT record containing the owner id
+	// are managed, and ownership records are created for new records.
+	TXTOwnerID string
+	// EventRecorder, if set, records an event on each ingress whose records are changed or fail to change.
+	EventRecorder k8s.EventRecorder
+	// HostFilter, if set, restricts the updater to hosts matching it. Records for other hosts are never created,
+	// updated or deleted.
+	HostFilter *regexp.Regexp
+	// ManageTXTRecords enables TXT records requested by the dns-txt annotation. TXT records are deleted once no
+	// ingress requests them.
+	ManageTXTRecords bool
+	// SetIdentifierTemplate, if set, renders the set identifier of records with a routing policy, from
+	// SetIdentifierData. Otherwise they're identified by the load balancer they point to. See
+	// ParseSetIdentifierTemplate.
+	SetIdentifierTemplate *template.Template
+	// RecordNameTemplate, if set, renders the record name of each ingress host from RecordNameData, e.g. to strip a
+	// cluster-specific subdomain. Hosts whose record name can't be rendered are skipped. The host filter, exclusions
+	// and zones apply to the record names. See ParseRecordNameTemplate.
+	RecordNameTemplate *template.Template
+	// ClusterName is the Cluster of SetIdentifierData.
+	ClusterName string
+	// DeleteGracePeriod, if set, delays deleting records which have lost their ingress until they've had no
+	// ingress for the grace period. Draining deletes them straight away.
+	DeleteGracePeriod time.Duration
+	// ManagedRecordTypes are the types of record the updater may create, update or delete, defaulting to
+	// DefaultManagedRecordTypes. Changes to other types are refused. TXT records created by the updater itself, for
+	// ownership or the dns-txt annotation, are managed regardless.
+	ManagedRecordTypes []string
+	// ChangeWebhookURL, if set, is posted a summary of the records changed by each update which changes any. The
+	// body is signed with ChangeWebhookSecret, in the WebhookSignatureHeader.
+	ChangeWebhookURL    string
+	ChangeWebhookSecret string
+	// InternalHostedZoneID and ExternalHostedZoneID, if set, are the hosted zones of the records of ingresses with
+	// the internal and internet-facing schemes, e.g. for split-horizon DNS with a zone of the same domain for each.
+	// Records are only created and deleted in the zone of their ingress's scheme. Ingresses with a scheme which
+	// doesn't have a zone are managed in HostedZoneIDs.
+	InternalHostedZoneID string
+	ExternalHostedZoneID string
+	// InMemory manages hosted zones held in memory, which start out empty, instead of Route53 zones. Each hosted zone
+	// id is the domain of its zone. No AWS credentials are needed, e.g. to plan the records of ingresses.
+	InMemory bool
+	// ZoneClient, if set, creates the client of each hosted zone instead of Route53, e.g. for another DNS provider,
+	// given the hosted zone id.
+	ZoneClient func(id string) r53.Route53Client
+	// MaxRecords, if positive, is the most records the updater computes for a hosted zone before it refuses to change
+	// the zone, as a circuit breaker against runaway changes, e.g. from a bad apiserver response.
+	MaxRecords int
+	// ManageHealthChecks creates the Route53 health checks requested by the health check annotations, and deletes
+	// them once no record uses them. Health checks are owned by the TXTOwnerID, or the ClusterName if it's not set,
+	// which must be unique among feed-dns instances sharing an AWS account.
+	ManageHealthChecks bool
+	// NoDelete skips deleting records, so records are only created and updated, e.g. while rolling out feed-dns.
+	// Records replaced by a record of the same name, such as a simple record replaced by a weighted record, are
+	// still deleted, as they're part of the update.
+	NoDelete bool
+}
+
+// DefaultManagedRecordTypes are all the types of record the updater creates for ingress hosts.
+var DefaultManagedRecordTypes = []string{route53.RRTypeCname, route53.RRTypeA, route53.RRTypeAaaa}
+
+// New creates an updater for dns. Each ingress host is managed in the hosted zone whose domain is
+// the longest suffix of the host, preferring the zone of the ingress's scheme if it has one.
+func New(lbAdapter adapter.FrontendAdapter, config Config) controller.Updater {
 	initMetrics()
 
+	newClient := func(id string) r53.Route53Client { return r53.New(id, config.Route53) }
+	if config.InMemory {
+		newClient = r53.NewInMemory
+	}
+	if config.ZoneClient != nil {
+		newClient = config.ZoneClient
+	}
+
+	var zones []*hostedZone
+	for _, id := range config.HostedZoneIDs {
+		zones = append(zones, &hostedZone{id: id, r53: newClient(id)})
+	}
+	if config.InternalHostedZoneID != "" {
+		zones = append(zones, &hostedZone{id: config.InternalHostedZoneID,
+			r53: newClient(config.InternalHostedZoneID), scheme: internalLBScheme})
+	}
+	if config.ExternalHostedZoneID != "" {
+		zones = append(zones, &hostedZone{id: config.ExternalHostedZoneID,
+			r53: newClient(config.ExternalHostedZoneID), scheme: externalLBScheme})
+	}
+
+	var registry *ownershipRegistry
+	if config.TXTOwnerID != "" {
+		registry = newOwnershipRegistry(config.TXTOwnerID)
+	}
+
+	var txt *txtRecords
+	if config.ManageTXTRecords {
+		txt = newTXTRecords(registry)
+	}
+
+	managedTypes := make(map[string]bool)
+	if len(config.ManagedRecordTypes) == 0 {
+		config.ManagedRecordTypes = DefaultManagedRecordTypes
+	}
+	for _, recordType := range config.ManagedRecordTypes {
+		managedTypes[strings.ToUpper(recordType)] = true
+	}
+
+	var webhook *changeWebhook
+	if config.ChangeWebhookURL != "" {
+		webhook = newChangeWebhook(config.ChangeWebhookURL, config.ChangeWebhookSecret)
+	}
+
+	var orphans *orphanedRecords
+	if config.DeleteGracePeriod > 0 {
+		orphans = newOrphanedRecords(config.DeleteGracePeriod)
+	}
+
+	var checks *healthChecks
+	if config.ManageHealthChecks {
+		owner := config.TXTOwnerID
+		if owner == "" {
+			owner = config.ClusterName
+		}
+		checks = newHealthChecks(owner)
+	}
+
 	return &updater{
-		r53:                 r53.New(hostedZoneID, retries),
+		zones:               zones,
 		lbAdapter:           lbAdapter,
+		registry:            registry,
+		txt:                 txt,
+		events:              config.EventRecorder,
+		hostFilter:          config.HostFilter,
+		setIdentifier:       config.SetIdentifierTemplate,
+		recordName:          config.RecordNameTemplate,
+		clusterName:         config.ClusterName,
+		orphans:             orphans,
+		managedTypes:        managedTypes,
+		webhook:             webhook,
+		healthChecks:        checks,
+		maxRecords:          config.MaxRecords,
+		noDelete:            config.NoDelete,
 		schemeToFrontendMap: make(map[string]adapter.DNSDetails),
+		statusTargets:       make(map[string]bool),
 	}
 }
 
 func (u *updater) String() string {
-	return "route53 updater"
+	return u.provider() + " dns updater"
 }
 
 func (u *updater) Start() error {
@@ -43,12 +232,23 @@ func (u *updater) Start() error {
 		return err
 	}
 	u.schemeToFrontendMap = schemeToFrontendMap
+	if cloudFront, ok := u.lbAdapter.(adapter.CloudFrontAdapter); ok {
+		u.distributions = cloudFront.CloudFrontDistributions()
+	}
+	if named, ok := u.lbAdapter.(adapter.NamedFrontendAdapter); ok {
+		u.namedFrontends = named.NamedFrontends()
+	}
 
-	domain, err := u.r53.GetHostedZoneDomain()
-	if err != nil {
-		return fmt.Errorf("unable to get domain for hosted zone: %v", err)
+	for _, zone := range u.zones {
+		domain, err := zone.r53.GetHostedZoneDomain()
+		if _, missing := err.(*r53.NoSuchHostedZoneError); missing {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("unable to get domain for hosted zone %s: %v", zone.id, err)
+		}
+		zone.domain = domain
 	}
-	u.domain = domain
 
 	log.Info("Dns updater started")
 	return nil
@@ -58,42 +258,554 @@ func (u *updater) Stop() error {
 	return nil
 }
 
+// Drain deletes all the records managed by the updater. Hosts excluded by the last update are still left alone.
+func (u *updater) Drain() error {
+	log.Info("Deleting all managed records")
+	u.draining = true
+	return u.update(controller.IngressEntries{}, nil)
+}
+
+func (u *updater) EnableDryRun() {
+	u.dryRun = true
+}
+
+// Health is unhealthy if a hosted zone didn't exist during the last update, or had more records than the maximum.
 func (u *updater) Health() error {
-	return nil
+	return u.health.Get()
 }
 
 func (u *updater) Update(entries controller.IngressEntries) error {
-	route53Records, err := u.r53.GetRecords()
+	return u.UpdateTraced(entries, nil)
+}
+
+// UpdateTraced records a span of each hosted zone's update within the span, with a span of each record change.
+func (u *updater) UpdateTraced(entries controller.IngressEntries, span *tracing.Span) error {
+	u.refreshFrontends()
+	u.warnAnnotations(entries)
+	observedIngressesGauge.Set(float64(countIngresses(entries)))
+	entries = u.dropUnhonouredAnnotations(entries)
+	entries = u.renameHosts(entries)
+	entries, u.excludedHosts = u.excludeEntries(entries)
+	span.SetAttribute("provider", u.provider())
+	return u.update(entries, span)
+}
+
+// refreshFrontends updates the load balancers from the adapter, if it discovers them. The previous load balancers are
+// kept if they can't be discovered.
+func (u *updater) refreshFrontends() {
+	discovering, ok := u.lbAdapter.(adapter.DiscoveringAdapter)
+	if !ok {
+		return
+	}
+
+	frontends, err := discovering.Frontends()
 	if err != nil {
-		log.Warn("Unable to get records from Route53. Not updating Route53.", err)
+		log.Warnf("Unable to discover load balancers, using the previous ones: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(frontends, u.schemeToFrontendMap) {
+		log.Infof("Load balancers changed from %v to %v", u.schemeToFrontendMap, frontends)
+	}
+	u.schemeToFrontendMap = frontends
+}
+
+// excludeEntries removes the entries for hosts of ingresses with the exclude annotation, including entries of other
+// ingresses for the same hosts, so their records are left alone. It returns the excluded hosts, with trailing periods.
+func (u *updater) excludeEntries(entries controller.IngressEntries) (controller.IngressEntries, map[string]bool) {
+	excludedHosts := make(map[string]bool)
+	excludedIngresses := make(map[string]bool)
+	for _, entry := range entries {
+		if annotationsOf(entry).Exclude {
+			excludedHosts[entry.Host+"."] = true
+			excludedIngresses[entry.NamespaceName()] = true
+		}
+	}
+	excludedCount.Add(float64(len(excludedIngresses)))
+	if len(excludedHosts) == 0 {
+		return entries, excludedHosts
+	}
+
+	var included controller.IngressEntries
+	var skipped []string
+	for _, entry := range entries {
+		if !excludedHosts[entry.Host+"."] {
+			included = append(included, entry)
+		} else if !excludedIngresses[entry.NamespaceName()] {
+			skipped = append(skipped, entry.NamespaceName()+":excluded-host:"+entry.Host)
+			u.skipEntry()
+		}
+	}
+	log.Infof("Excluded %d ingresses with the %s annotation", len(excludedIngresses),
+		adapter.ExcludeAnnotation)
+	if len(skipped) > 0 {
+		log.Warnf("%d skipped entries for hosts excluded by another ingress: %v", len(skipped), skipped)
+	}
+	return included, excludedHosts
+}
+
+func (u *updater) update(entries controller.IngressEntries, span *tracing.Span) error {
+	u.recordStatusTargets(entries)
+	zoneEntries, skipped := u.entriesByZone(entries)
+	if len(skipped) > 0 {
+		log.Warnf("%d skipped entries not in any hosted zone: %v", len(skipped), skipped)
+	}
+
+	if u.healthChecks != nil {
+		if err := u.healthChecks.refresh(u.zones); err != nil {
+			log.Errorf("Unable to get health checks. Not updating Route53: %v", err)
+			failedCount.Inc()
+			return fmt.Errorf("unable to get health checks: %v", err)
+		}
+	}
+
+	var totalRecords, totalRejected int
+	var failedZones, missingZones, limitedZones []string
+	summary := &changeSummary{}
+	for _, zone := range u.zones {
+		zoneSpan := span.Child("update hosted zone")
+		zoneSpan.SetAttribute("provider", u.provider())
+		zoneSpan.SetAttribute("zone.id", zone.id)
+		zoneSpan.SetAttribute("zone.domain", zone.domain)
+		managed, rejected, err := u.updateZone(zone, zoneEntries[zone], summary, zoneSpan)
+		zoneSpan.SetError(err)
+		zoneSpan.End()
+		if err != nil {
+			log.Errorf("Unable to update hosted zone %s (%s): %v", zone.id, zone.domain, err)
+			failedZones = append(failedZones, zone.id)
+			if _, missing := err.(*r53.NoSuchHostedZoneError); missing {
+				missingZones = append(missingZones, fmt.Sprintf("%s (%s)", zone.id, zone.domain))
+			}
+			if _, limited := err.(*tooManyRecordsError); limited {
+				limitedZones = append(limitedZones, fmt.Sprintf("%s (%s)", zone.id, zone.domain))
+			}
+			continue
+		}
+		totalRecords += managed
+		totalRejected += rejected
+	}
+	recordsGauge.Set(float64(totalRecords))
+	rejectedChangesGauge.Set(float64(totalRejected))
+	ownedRecordsGauge.WithLabelValues(u.provider()).Set(float64(totalRecords))
+	setDesiredRecordGauges(u.records.all())
+	if u.healthChecks != nil && len(failedZones) == 0 {
+		u.healthChecks.deleteUnused(u.dryRun)
+	}
+	if u.webhook != nil {
+		u.webhook.notify(summary)
+	}
+	var problems []string
+	if len(missingZones) > 0 {
+		problems = append(problems, fmt.Sprintf("hosted zones don't exist, they may have been deleted: %v",
+			missingZones))
+	}
+	if len(limitedZones) > 0 {
+		problems = append(problems, fmt.Sprintf("hosted zones have more records than the maximum of %d: %v",
+			u.maxRecords, limitedZones))
+	}
+	if len(problems) > 0 {
+		u.health.Set(errors.New(strings.Join(problems, "; ")))
+	} else {
+		u.health.Set(nil)
+	}
+
+	if len(failedZones) > 0 {
+		return fmt.Errorf("unable to update hosted zones: %v", failedZones)
+	}
+	return nil
+}
+
+// recordStatusTargets remembers the load balancers in the status of the entries' ingresses, so records pointing to
+// them are still managed after the ingress is deleted.
+func (u *updater) recordStatusTargets(entries controller.IngressEntries) {
+	status, ok := u.lbAdapter.(adapter.StatusFrontendAdapter)
+	if !ok {
+		return
+	}
+	for _, entry := range entries {
+		if details, found := statusFrontendOf(status, entry); found {
+			u.statusTargets[details.DNSName] = true
+		}
+	}
+}
+
+// statusFrontendOf returns the load balancer in the status of an entry's ingress, or false if it has none.
+func statusFrontendOf(status adapter.StatusFrontendAdapter, entry controller.IngressEntry) (adapter.DNSDetails, bool) {
+	if entry.Ingress == nil {
+		return adapter.DNSDetails{}, false
+	}
+	return status.StatusFrontend(entry.Ingress.Status.LoadBalancer)
+}
+
+// entriesByZone assigns each entry to the hosted zone with the longest domain matching its host, out of the zones of
+// its scheme and the zones of any scheme. Entries with the zones annotation are assigned to the zone of the scheme of
+// each logical zone instead.
+func (u *updater) entriesByZone(entries controller.IngressEntries) (map[*hostedZone]controller.IngressEntries, []string) {
+	var skipped []string
+	zoneEntries := make(map[*hostedZone]controller.IngressEntries)
+
+	for _, entry := range entries {
+		zones := u.zonesForEntry(entry)
+		if len(zones) == 0 {
+			skipped = append(skipped, entry.NamespaceName()+":host:"+entry.Host)
+			u.skipEntry()
+			continue
+		}
+		for _, zone := range zones {
+			zoneEntries[zone] = append(zoneEntries[zone], entry)
+		}
+	}
+
+	return zoneEntries, skipped
+}
+
+// zonesForEntry returns the zones the records of an entry are published to, without duplicates, which are the same
+// zone if a logical zone has no hosted zone of its own.
+func (u *updater) zonesForEntry(entry controller.IngressEntry) []*hostedZone {
+	schemes := []string{entry.LbScheme}
+	if logicalZones := annotationsOf(entry).Zones; len(logicalZones) > 0 {
+		schemes = nil
+		for _, logicalZone := range logicalZones {
+			schemes = append(schemes, logicalZoneSchemes[logicalZone])
+		}
+	}
+
+	var zones []*hostedZone
+	seen := make(map[*hostedZone]bool)
+	for _, scheme := range schemes {
+		// Ingress entries in k8s aren't allowed to have the . on the end.
+		// AWS adds it regardless of whether you specify it.
+		zone := u.zoneForHost(entry.Host+".", scheme)
+		if zone != nil && !seen[zone] {
+			seen[zone] = true
+			zones = append(zones, zone)
+		}
+	}
+	return zones
+}
+
+// zoneForHost returns the zone for a host, preferring the zone of the scheme over a zone of any scheme with the same
+// domain, or nil if there's none.
+func (u *updater) zoneForHost(hostNameWithPeriod string, scheme string) *hostedZone {
+	var match *hostedZone
+	for _, zone := range u.zones {
+		if zone.scheme != "" && zone.scheme != scheme {
+			continue
+		}
+		if hostNameWithPeriod != zone.domain && !strings.HasSuffix(hostNameWithPeriod, "."+zone.domain) {
+			continue
+		}
+		if match == nil || len(zone.domain) > len(match.domain) ||
+			(len(zone.domain) == len(match.domain) && zone.scheme != "") {
+			match = zone
+		}
+	}
+	return match
+}
+
+// tooManyRecordsError refuses an update of a hosted zone which computed more than the maximum records.
+type tooManyRecordsError struct {
+	records int
+	max     int
+}
+
+func (e *tooManyRecordsError) Error() string {
+	return fmt.Sprintf("refusing to update records, %d records computed, more than the maximum of %d", e.records,
+		e.max)
+}
+
+// updateZone updates the records of a zone, returning the number of managed records and the number of changes
+// Route53 rejected as invalid. Rejected changes don't fail the update, so the other records are kept up to date.
+// The applied changes are added to the summary.
+func (u *updater) updateZone(zone *hostedZone, entries controller.IngressEntries, summary *changeSummary,
+	span *tracing.Span) (int, int, error) {
+	route53Records, err := zone.r53.GetRecords()
+	if err != nil {
+		log.Warnf("Unable to get records from Route53 for %s. Not updating Route53: %v", zone.domain, err)
 		failedCount.Inc()
-		return err
+		return 0, 0, err
+	}
+
+	if u.healthChecks != nil {
+		u.healthChecks.markUsed(route53Records)
 	}
 
 	// Flatten Alias (A) and CNAME records into a common structure
-	records := u.consolidateRecordsFromRoute53(route53Records)
+	records := u.consolidateRecordsFromRoute53(zone, route53Records)
 
 	records = u.determineManagedRecordSets(records)
-	recordsGauge.Set(float64(len(records)))
+	records, entries = u.filterHosts(records, entries)
+
+	var txtRecords []*route53.ResourceRecordSet
+	if u.registry != nil || u.txt != nil {
+		txtRecords, err = zone.r53.GetTXTRecords()
+		if err != nil {
+			log.Warnf("Unable to get TXT records from Route53 for %s. Not updating Route53: %v", zone.domain, err)
+			failedCount.Inc()
+			return 0, 0, err
+		}
+	}
+
+	var owners ownership
+	if u.registry != nil {
+		owners = u.registry.ownership(txtRecords, route53Records)
+		// Leave the ownership records of filtered hosts alone too.
+		for host := range owners.owned {
+			if !u.managesHost(host) {
+				delete(owners.owned, host)
+			}
+		}
+		records = owners.filterOwned(records)
+
+		var skipped []string
+		entries, skipped = owners.filterEntries(entries)
+		u.skipEntries(len(skipped))
+		if len(skipped) > 0 {
+			log.Warnf("%d skipped entries for hosts owned by something else in zone '%s': %v", len(skipped),
+				zone.domain, skipped)
+		}
+	}
+
+	calculated, err := u.calculateChanges(zone, records, entries)
+	if tooMany, ok := err.(*tooManyRecordsError); ok {
+		log.Errorf("Refusing to update %s: %d records computed, more than the maximum of %d", zone.domain,
+			tooMany.records, tooMany.max)
+		failedCount.Inc()
+		return 0, 0, err
+	}
+	changes := u.refuseUnmanagedTypes(calculated)
+	recordChanges := changes
+	if u.registry != nil {
+		changes = append(changes, u.skipDeletes(zone, u.registry.changes(owners, records, recordChanges))...)
+	}
+	if u.txt != nil {
+		desired, skipped := u.txt.desired(zone, entries)
+		txtChanges, skipped2 := u.txt.changes(desired, txtRecords, u.managesHost)
+		skipped = append(skipped, skipped2...)
+		u.skipEntries(len(skipped))
+		if len(skipped) > 0 {
+			log.Warnf("%d skipped TXT records for zone '%s': %v", len(skipped), zone.domain, skipped)
+		}
+		changes = append(changes, u.skipDeletes(zone, txtChanges)...)
+	}
 
-	changes := u.calculateChanges(records, entries)
+	span.SetAttribute("entries", len(entries))
+	span.SetAttribute("records.managed", len(records))
+	span.SetAttribute("records.changes", len(changes))
+	if u.dryRun {
+		for _, change := range changes {
+			log.Infof("[dry-run] Would %s", describeChange(change))
+		}
+		span.SetAttribute("dry_run", true)
+		return len(records), 0, nil
+	}
 
+	if log.GetLevel() >= log.DebugLevel {
+		logChanges(zone, changes, append(route53Records, txtRecords...))
+	}
 	updateCount.Add(float64(len(changes)))
 
-	err = u.r53.UpdateRecordSets(changes)
+	var rejected []r53.RejectedChange
+	err = zone.r53.UpdateRecordSets(changes)
+	if rejectedErr, ok := err.(*r53.RejectedChangesError); ok {
+		log.Warnf("Route53 rejected %d changes for %s, applied the rest", len(rejectedErr.Rejected), zone.domain)
+		rejected = rejectedErr.Rejected
+		err = nil
+	}
 	if err != nil {
 		failedCount.Inc()
-		return fmt.Errorf("unable to update record sets: %v", err)
+		u.recordFailureEvents(recordChanges, entries, err)
+		if _, missing := err.(*r53.NoSuchHostedZoneError); missing {
+			return 0, 0, err
+		}
+		return 0, 0, fmt.Errorf("unable to update record sets: %v", err)
 	}
+	u.traceChanges(span, recordChanges, records, rejected)
 
-	return nil
+	if len(rejected) > 0 {
+		rejectedChanges := make(map[*route53.Change]bool)
+		for _, r := range rejected {
+			rejectedChanges[r.Change] = true
+			u.recordFailureEvents([]*route53.Change{r.Change}, entries, r.Err)
+		}
+		var applied []*route53.Change
+		for _, change := range recordChanges {
+			if !rejectedChanges[change] {
+				applied = append(applied, change)
+			}
+		}
+		recordChanges = applied
+	}
+	u.countChanges(recordChanges, records)
+	summary.add(zone, recordChanges, records)
+	u.recordChangeEvents(recordChanges, records, entries)
+
+	return len(records), len(rejected), nil
+}
+
+// skipDeletes leaves out the deletes with no-delete, counting them.
+func (u *updater) skipDeletes(zone *hostedZone, changes []*route53.Change) []*route53.Change {
+	if !u.noDelete {
+		return changes
+	}
+
+	kept := []*route53.Change{}
+	var skipped []string
+	for _, change := range changes {
+		if aws.StringValue(change.Action) == route53.ChangeActionDelete {
+			skipped = append(skipped, describeChange(change))
+			continue
+		}
+		kept = append(kept, change)
+	}
+	if len(skipped) > 0 {
+		log.Infof("Not deleting %d records in %s, as deletes are disabled: %v", len(skipped), zone.domain, skipped)
+		skippedDeletesCount.Add(float64(len(skipped)))
+	}
+	return kept
+}
+
+// refuseUnmanagedTypes leaves out changes to records whose type isn't managed, with a warning.
+func (u *updater) refuseUnmanagedTypes(changes []*route53.Change) []*route53.Change {
+	allowed := []*route53.Change{}
+	for _, change := range changes {
+		recordType := aws.StringValue(change.ResourceRecordSet.Type)
+		if !u.managedTypes[recordType] {
+			log.Warnf("Refusing to %s, as %s records aren't managed", describeChange(change), recordType)
+			continue
+		}
+		allowed = append(allowed, change)
+	}
+	return allowed
 }
 
-func (u *updater) consolidateRecordsFromRoute53(rrs []*route53.ResourceRecordSet) []adapter.ConsolidatedRecord {
+// traceChanges records a span of each record change, with its operation and whether Route53 applied or rejected it.
+func (u *updater) traceChanges(span *tracing.Span, changes []*route53.Change, records []adapter.ConsolidatedRecord,
+	rejected []r53.RejectedChange) {
+	if span == nil {
+		return
+	}
+
+	rejectedErrs := make(map[*route53.Change]error)
+	for _, r := range rejected {
+		rejectedErrs[r.Change] = r.Err
+	}
+	span.SetAttribute("records.rejected", len(rejected))
+
+	for i, operation := range operationsOf(changes, records) {
+		rrs := changes[i].ResourceRecordSet
+		changeSpan := span.Child("change record")
+		changeSpan.SetAttribute("provider", u.provider())
+		changeSpan.SetAttribute("record.name", aws.StringValue(rrs.Name))
+		changeSpan.SetAttribute("record.type", aws.StringValue(rrs.Type))
+		changeSpan.SetAttribute("record.operation", operation)
+		if err, ok := rejectedErrs[changes[i]]; ok {
+			changeSpan.SetAttribute("record.outcome", "rejected")
+			changeSpan.SetError(err)
+		} else {
+			changeSpan.SetAttribute("record.outcome", "applied")
+		}
+		changeSpan.End()
+	}
+}
+
+func describeChange(change *route53.Change) string {
+	rrs := change.ResourceRecordSet
+	description := fmt.Sprintf("%s %s %s -> %s", aws.StringValue(change.Action), aws.StringValue(rrs.Type),
+		aws.StringValue(rrs.Name), recordValue(rrs))
+	if rrs.SetIdentifier != nil {
+		description += fmt.Sprintf(" (set %s, weight %d)", aws.StringValue(rrs.SetIdentifier),
+			aws.Int64Value(rrs.Weight))
+	}
+	return description
+}
+
+// recordValue describes what a record set points at, its alias target or its values.
+func recordValue(rrs *route53.ResourceRecordSet) string {
+	if rrs.AliasTarget != nil {
+		return aws.StringValue(rrs.AliasTarget.DNSName)
+	}
+	var values []string
+	for _, rr := range rrs.ResourceRecords {
+		values = append(values, aws.StringValue(rr.Value))
+	}
+	return strings.Join(values, ",")
+}
+
+// logChanges logs the existing and intended value of each record changed, at debug level.
+func logChanges(zone *hostedZone, changes []*route53.Change, existing []*route53.ResourceRecordSet) {
+	type recordSet struct{ name, recordType, setIdentifier string }
+	keyOf := func(rrs *route53.ResourceRecordSet) recordSet {
+		return recordSet{aws.StringValue(rrs.Name), aws.StringValue(rrs.Type), aws.StringValue(rrs.SetIdentifier)}
+	}
+	existingByKey := make(map[recordSet]*route53.ResourceRecordSet)
+	for _, rrs := range existing {
+		existingByKey[keyOf(rrs)] = rrs
+	}
+
+	for _, change := range changes {
+		rrs := change.ResourceRecordSet
+		name, recordType := aws.StringValue(rrs.Name), aws.StringValue(rrs.Type)
+		if rrs.SetIdentifier != nil {
+			name += " (set " + aws.StringValue(rrs.SetIdentifier) + ")"
+		}
+		old, exists := existingByKey[keyOf(rrs)]
+		switch {
+		case aws.StringValue(change.Action) == route53.ChangeActionDelete:
+			log.Debugf("Deleting %s %s in %s: %s", recordType, name, zone.domain, recordValue(rrs))
+		case exists:
+			log.Debugf("Updating %s %s in %s: %s -> %s", recordType, name, zone.domain, recordValue(old),
+				recordValue(rrs))
+		default:
+			log.Debugf("Creating %s %s in %s: %s", recordType, name, zone.domain, recordValue(rrs))
+		}
+	}
+}
+
+// countChanges records the number of created, updated and deleted records.
+func (u *updater) countChanges(changes []*route53.Change, records []adapter.ConsolidatedRecord) {
+	for _, operation := range operationsOf(changes, records) {
+		recordChangesCount.WithLabelValues(u.provider(), operation).Inc()
+	}
+}
+
+// operationsOf returns whether each change creates, updates or deletes a record. An UPSERT creates a record unless
+// the record set already exists.
+func operationsOf(changes []*route53.Change, records []adapter.ConsolidatedRecord) []string {
+	type recordSet struct{ name, recordType, setIdentifier string }
+	existing := make(map[recordSet]bool)
+	for _, rec := range records {
+		existing[recordSet{rec.Name, rec.Type, rec.SetIdentifier}] = true
+	}
+
+	var operations []string
+	for _, change := range changes {
+		rrs := change.ResourceRecordSet
+		operation := "created"
+		switch {
+		case aws.StringValue(change.Action) == route53.ChangeActionDelete:
+			operation = "deleted"
+		case existing[recordSet{aws.StringValue(rrs.Name), aws.StringValue(rrs.Type),
+			aws.StringValue(rrs.SetIdentifier)}]:
+			operation = "updated"
+		}
+		operations = append(operations, operation)
+	}
+	return operations
+}
+
+func (u *updater) consolidateRecordsFromRoute53(zone *hostedZone,
+	rrs []*route53.ResourceRecordSet) []adapter.ConsolidatedRecord {
 	var records []adapter.ConsolidatedRecord
+	reporter, _ := zone.r53.(r53.AutomaticTTLReporter)
 
 	for _, recordSet := range rrs {
+		if !u.managedTypes[aws.StringValue(recordSet.Type)] {
+			continue
+		}
 		if record, managed := u.lbAdapter.IsManaged(recordSet); managed {
+			record.Type = aws.StringValue(recordSet.Type)
+			record.RoutingPolicy = adapter.RoutingPolicyOf(recordSet)
+			record.AutomaticTTL = reporter != nil && reporter.HasAutomaticTTL(recordSet)
 			records = append(records, *record)
 		}
 	}
@@ -106,6 +818,15 @@ func (u *updater) determineManagedRecordSets(rrs []adapter.ConsolidatedRecord) [
 	for _, dns := range u.schemeToFrontendMap {
 		managedLBs[dns.DNSName] = true
 	}
+	for _, dns := range u.distributions {
+		managedLBs[dns.DNSName] = true
+	}
+	for _, dns := range u.namedFrontends {
+		managedLBs[dns.DNSName] = true
+	}
+	for target := range u.statusTargets {
+		managedLBs[target] = true
+	}
 	var managed []adapter.ConsolidatedRecord
 	var nonManaged []string
 	for _, rec := range rrs {
@@ -123,31 +844,73 @@ func (u *updater) determineManagedRecordSets(rrs []adapter.ConsolidatedRecord) [
 	return managed
 }
 
-func (u *updater) calculateChanges(originalRecords []adapter.ConsolidatedRecord,
-	entries controller.IngressEntries) []*route53.Change {
+// filterHosts removes the records and entries for hosts which don't match the host filter, or are excluded.
+func (u *updater) filterHosts(records []adapter.ConsolidatedRecord,
+	entries controller.IngressEntries) ([]adapter.ConsolidatedRecord, controller.IngressEntries) {
+
+	if u.hostFilter == nil && len(u.excludedHosts) == 0 {
+		return records, entries
+	}
+
+	var filteredRecords []adapter.ConsolidatedRecord
+	for _, rec := range records {
+		if u.managesHost(rec.Name) {
+			filteredRecords = append(filteredRecords, rec)
+		} else {
+			log.Debugf("Ignoring record for %s, which isn't managed", rec.Name)
+		}
+	}
+
+	var filteredEntries controller.IngressEntries
+	for _, entry := range entries {
+		if u.managesHost(entry.Host) {
+			filteredEntries = append(filteredEntries, entry)
+		} else {
+			log.Debugf("Ignoring %s for %s, which isn't managed", entry.NamespaceName(), entry.Host)
+		}
+	}
+
+	return filteredRecords, filteredEntries
+}
+
+// managesHost returns true if the host, with or without a trailing period, matches the host filter and isn't
+// excluded.
+func (u *updater) managesHost(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	return (u.hostFilter == nil || u.hostFilter.MatchString(host)) && !u.excludedHosts[host+"."]
+}
+
+// calculateChanges fails with a tooManyRecordsError if more than the maximum records are computed, without changing
+// the desired records or orphans of the zone.
+func (u *updater) calculateChanges(zone *hostedZone, originalRecords []adapter.ConsolidatedRecord,
+	entries controller.IngressEntries) ([]*route53.Change, error) {
 
-	log.Infof("Current %s records: %d", u.domain, len(originalRecords))
-	log.Debugf("Current %s record set: %v", u.domain, originalRecords)
+	log.Infof("Current %s records: %d", zone.domain, len(originalRecords))
+	log.Debugf("Current %s record set: %v", zone.domain, originalRecords)
 	log.Debug("Processing ingress update: ", entries)
 
 	hostToIngress, skipped := u.indexByHost(entries)
-	changes, skipped2 := u.createChanges(hostToIngress, originalRecords)
+	changes, skipped2, err := u.createChanges(zone, hostToIngress, originalRecords)
 
 	skipped = append(skipped, skipped2...)
 
 	if len(skipped) > 0 {
 		log.Warnf("%d skipped entries for zone '%s': %v",
-			len(skipped), u.domain, skipped)
+			len(skipped), zone.domain, skipped)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	log.Debug("Host to ingress entry: ", hostToIngress)
 	log.Infof("Calculated changes to dns: %v", changes)
-	return changes
+	return changes, nil
 }
 
 func (u *updater) indexByHost(entries []controller.IngressEntry) (hostToIngress, []string) {
 	var skipped []string
 	mapping := make(hostToIngress)
+	namespaces := make(map[string]map[string]bool)
 
 	for _, entry := range entries {
 		log.Debugf("Processing entry %v", entry)
@@ -155,60 +918,430 @@ func (u *updater) indexByHost(entries []controller.IngressEntry) (hostToIngress,
 		// AWS adds it regardless of whether you specify it.
 		hostNameWithPeriod := entry.Host + "."
 
-		log.Debugf("Checking if ingress entry hostname %s is in domain %s", hostNameWithPeriod, u.domain)
-		if !strings.HasSuffix(hostNameWithPeriod, "."+u.domain) {
-			skipped = append(skipped, entry.NamespaceName()+":host:"+hostNameWithPeriod)
-			skippedCount.Inc()
-			continue
+		if namespaces[hostNameWithPeriod] == nil {
+			namespaces[hostNameWithPeriod] = make(map[string]bool)
+		}
+		namespaces[hostNameWithPeriod][entry.Namespace] = true
+
+		if !containsFrontend(mapping[hostNameWithPeriod], entry) {
+			mapping[hostNameWithPeriod] = append(mapping[hostNameWithPeriod], entry)
 		}
+	}
 
-		if previous, exists := mapping[hostNameWithPeriod]; exists {
-			if previous.LbScheme != entry.LbScheme {
+	// Only hosts with a routing policy can point to more than one load balancer.
+	for host, hostEntries := range mapping {
+		if len(hostEntries) > 1 && routingTypeOf(hostEntries) == simpleRouting {
+			for _, entry := range hostEntries[1:] {
 				skipped = append(skipped, entry.NamespaceName()+":conflicting-scheme:"+entry.LbScheme)
-				skippedCount.Inc()
+				u.skipEntry()
 			}
-		} else {
-			mapping[hostNameWithPeriod] = entry
+			mapping[host] = hostEntries[:1]
 		}
 	}
 
+	logNamespaceCollisions(namespaces)
 	return mapping, skipped
 }
 
-func (u *updater) createChanges(hostToIngress hostToIngress,
-	originalRecords []adapter.ConsolidatedRecord) ([]*route53.Change, []string) {
+// logNamespaceCollisions warns about hosts of ingresses in more than one namespace, as the namespaces may belong to
+// different teams.
+func logNamespaceCollisions(hostNamespaces map[string]map[string]bool) {
+	var hosts []string
+	for host, namespaces := range hostNamespaces {
+		if len(namespaces) > 1 {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
 
-	type recordKey struct{ host, elbDNSName string }
-	changes := []*route53.Change{}
+	for _, host := range hosts {
+		var namespaces []string
+		for namespace := range hostNamespaces[host] {
+			namespaces = append(namespaces, namespace)
+		}
+		sort.Strings(namespaces)
+		log.Warnf("Host %s is used by ingresses in several namespaces: %v", strings.TrimSuffix(host, "."), namespaces)
+	}
+}
+
+// containsFrontend returns true if one of the entries points to the same load balancer as the entry, by scheme and
+// load balancer name, for the same geolocation.
+func containsFrontend(entries []controller.IngressEntry, entry controller.IngressEntry) bool {
+	annotations := annotationsOf(entry)
+	for _, other := range entries {
+		otherAnnotations := annotationsOf(other)
+		if other.LbScheme == entry.LbScheme && otherAnnotations.LBName == annotations.LBName &&
+			otherAnnotations.GeoLocation == annotations.GeoLocation {
+			return true
+		}
+	}
+	return false
+}
+
+type routingType int
+
+const (
+	simpleRouting routingType = iota
+	weightedRouting
+	failoverRouting
+	latencyRouting
+	geoRouting
+)
+
+// routingTypeOf returns the routing policy type for the records of a host. All records for a host must have the same
+// type, so any entry with a routing annotation determines it for the whole host.
+func routingTypeOf(entries []controller.IngressEntry) routingType {
+	for _, entry := range entries {
+		if annotationsOf(entry).Failover {
+			return failoverRouting
+		}
+	}
+	for _, entry := range entries {
+		if annotationsOf(entry).Latency {
+			return latencyRouting
+		}
+	}
+	for _, entry := range entries {
+		if annotationsOf(entry).Geo {
+			return geoRouting
+		}
+	}
+	for _, entry := range entries {
+		if annotationsOf(entry).Weighted {
+			return weightedRouting
+		}
+	}
+	return simpleRouting
+}
+
+// routingPolicyOf returns the routing policy for the record of an entry, or false if the entry has no valid
+// policy. Record sets with a routing policy are identified by the set identifier.
+func routingPolicyOf(routing routingType, entry controller.IngressEntry, dnsDetails adapter.DNSDetails,
+	setIdentifier string) (adapter.RoutingPolicy, bool) {
+
+	switch routing {
+	case weightedRouting:
+		weight := int64(adapter.DefaultWeight)
+		if annotations := annotationsOf(entry); annotations.Weighted {
+			weight = annotations.Weight
+		}
+		return adapter.RoutingPolicy{SetIdentifier: setIdentifier, Weight: aws.Int64(weight)}, true
+	case failoverRouting:
+		role := annotationsOf(entry).FailoverRole
+		if role == "" {
+			log.Warnf("Ingress %s has an invalid or missing %s annotation, must be primary or secondary",
+				entry.NamespaceName(), adapter.FailoverRoleAnnotation)
+			return adapter.RoutingPolicy{}, false
+		}
+		return adapter.RoutingPolicy{
+			SetIdentifier: setIdentifier,
+			Failover:      role,
+			HealthCheckID: dnsDetails.HealthCheckID,
+		}, true
+	case latencyRouting:
+		if dnsDetails.Region == "" {
+			log.Warnf("Ingress %s uses latency routing, but the region of %s is unknown", entry.NamespaceName(),
+				dnsDetails.DNSName)
+			return adapter.RoutingPolicy{}, false
+		}
+		return adapter.RoutingPolicy{SetIdentifier: setIdentifier, Region: dnsDetails.Region}, true
+	case geoRouting:
+		location := annotationsOf(entry).GeoLocation
+		if location == "" {
+			log.Warnf("Ingress %s has an invalid or missing %s annotation, must be a country code, continent: and "+
+				"a continent code, or %s", entry.NamespaceName(), adapter.GeoAnnotation, adapter.DefaultGeoLocation)
+			return adapter.RoutingPolicy{}, false
+		}
+		return adapter.RoutingPolicy{SetIdentifier: setIdentifier, GeoLocation: location}, true
+	}
+	return adapter.RoutingPolicy{}, true
+}
+
+// annotationsOf returns the record annotations of an entry's ingress.
+func annotationsOf(entry controller.IngressEntry) adapter.RecordAnnotations {
+	if entry.Ingress == nil {
+		return adapter.RecordAnnotations{}
+	}
+	annotations, _ := adapter.ParseAnnotations(entry.Ingress.Annotations)
+	return annotations
+}
+
+// warnAnnotations logs the invalid record annotations of each ingress, those the frontend adapter doesn't support and
+// the routing annotations the provider can't honour. An event is recorded on the ingress for each unsupported
+// annotation, the first time it's seen.
+func (u *updater) warnAnnotations(entries controller.IngressEntries) {
+	warned := make(map[string]bool)
+	unsupportedWarned := make(map[string]bool)
+	provider := u.provider()
+	for _, entry := range entries {
+		if entry.Ingress == nil || warned[entry.NamespaceName()] {
+			continue
+		}
+		warned[entry.NamespaceName()] = true
+
+		_, warnings := adapter.ParseAnnotations(entry.Ingress.Annotations)
+		for _, warning := range warnings {
+			log.Warnf("Ingress %s has an %s", entry.NamespaceName(), warning)
+		}
+		errs := adapter.CheckAnnotations(u.lbAdapter, provider, entry.Ingress.Annotations)
+		for _, name := range u.unhonouredAnnotations(entry.Ingress.Annotations) {
+			errs = append(errs, &adapter.UnsupportedAnnotationError{Annotation: name, Provider: provider,
+				Frontend: adapter.FrontendName(u.lbAdapter)})
+		}
+		for _, err := range errs {
+			log.Warnf("Ignoring annotation of ingress %s: %v", entry.NamespaceName(), err)
+			key := entry.NamespaceName() + " " + err.(*adapter.UnsupportedAnnotationError).Annotation
+			unsupportedWarned[key] = true
+			if !u.unsupportedWarned[key] {
+				u.recordUnsupportedAnnotationEvent(entry.Ingress, err)
+			}
+		}
+	}
+	u.unsupportedWarned = unsupportedWarned
+}
+
+func (u *updater) createChanges(zone *hostedZone, hostToIngress hostToIngress,
+	originalRecords []adapter.ConsolidatedRecord) ([]*route53.Change, []string, error) {
+
+	// AAAA records are tracked separately to the A or CNAME record for the same host.
+	type recordKey struct {
+		host, setIdentifier string
+		ipv6                bool
+	}
+	keyOf := func(rec adapter.ConsolidatedRecord) recordKey {
+		return recordKey{rec.Name, rec.SetIdentifier, rec.Type == route53.RRTypeAaaa}
+	}
+
+	var upserts []*route53.Change
+	limits := ttlLimitsOf(zone.r53)
 	indexedRecords := make(map[recordKey]adapter.ConsolidatedRecord)
 	for _, rec := range originalRecords {
-		indexedRecords[recordKey{rec.Name, rec.PointsTo}] = rec
+		indexedRecords[keyOf(rec)] = rec
 	}
 
 	var skipped []string
-	for host, entry := range hostToIngress {
-		dnsDetails, exists := u.schemeToFrontendMap[entry.LbScheme]
-		if !exists {
-			skipped = append(skipped, entry.NamespaceName()+":scheme:"+entry.LbScheme)
-			skippedCount.Inc()
-			continue
-		}
+	var records []Record
+	desired := make(map[recordKey]bool)
+	routedHosts := make(map[string]bool)
+	// Hosts with an invalid record, and those with a valid record, so replaced records are only deleted if they'd
+	// be replaced by a valid record.
+	invalidHosts := make(map[string]bool)
+	hostsWithRecords := make(map[string]bool)
+	// Iterate in host order, so the changes are deterministic.
+	hosts := make([]string, 0, len(hostToIngress))
+	for host := range hostToIngress {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		hostEntries := hostToIngress[host]
+		routing := routingTypeOf(hostEntries)
+		routedHosts[host] = routing != simpleRouting
+
+		for _, entry := range hostEntries {
+			annotations := annotationsOf(entry)
+			dnsDetails, exists := u.schemeToFrontendMap[entry.LbScheme]
+			if status, ok := u.lbAdapter.(adapter.StatusFrontendAdapter); ok {
+				dnsDetails, exists = statusFrontendOf(status, entry)
+				if !exists {
+					skipped = append(skipped, entry.NamespaceName()+":ingress-status:"+entry.Host)
+					u.skipEntry()
+					continue
+				}
+			} else if annotations.LBName != "" {
+				dnsDetails, exists = u.namedFrontends[annotations.LBName]
+				if !exists {
+					skipped = append(skipped, entry.NamespaceName()+":lb-name:"+annotations.LBName)
+					u.skipEntry()
+					continue
+				}
+			} else if !exists {
+				skipped = append(skipped, entry.NamespaceName()+":scheme:"+entry.LbScheme)
+				u.skipEntry()
+				continue
+			}
+
+			if annotations.TTL > 0 {
+				dnsDetails.TTL = annotations.TTL
+			}
+			// The provider would round the TTL up anyway, so the record would never match the desired TTL.
+			requestedTTL := dnsDetails.TTL
+			minTTL := time.Duration(limits.min) * time.Second
+			if limits.roundUp && requestedTTL < minTTL {
+				dnsDetails.TTL = minTTL
+			}
+			dnsDetails.Apex = host == zone.domain
+
+			if id := annotations.CloudFrontDistribution; id != "" {
+				distribution, found := u.distributions[id]
+				if !found {
+					skipped = append(skipped, entry.NamespaceName()+":cloudfront-distribution:"+id)
+					u.skipEntry()
+					continue
+				}
+				dnsDetails.DNSName = distribution.DNSName
+				dnsDetails.HostedZoneID = distribution.HostedZoneID
+				dnsDetails.IPv6 = false
+			}
+
+			var setIdentifier string
+			if routing != simpleRouting {
+				var err error
+				if setIdentifier, err = u.setIdentifierOf(host, entry, dnsDetails, routing); err != nil {
+					log.Warnf("Unable to render the set identifier for %s of ingress %s: %v", host,
+						entry.NamespaceName(), err)
+					skipped = append(skipped, entry.NamespaceName()+":set-identifier:"+entry.Host)
+					u.skipEntry()
+					continue
+				}
+			}
+
+			policy, valid := routingPolicyOf(routing, entry, dnsDetails, setIdentifier)
+			if !valid {
+				skipped = append(skipped, entry.NamespaceName()+":routing-policy:"+entry.Host)
+				u.skipEntry()
+				continue
+			}
+
+			if annotations.HealthCheck && u.healthChecks != nil {
+				if routing == simpleRouting {
+					log.Warnf("Not creating a health check for %s of ingress %s, as only records with a routing "+
+						"policy have health checks", host, entry.NamespaceName())
+				} else {
+					spec := healthCheckSpec{fqdn: strings.TrimSuffix(dnsDetails.DNSName, "."),
+						path: annotations.HealthCheckPath, port: annotations.HealthCheckPort,
+						interval: annotations.HealthCheckInterval}
+					id, err := u.healthChecks.idFor(spec, u.dryRun)
+					if err != nil {
+						// Keep the health check of an existing record, rather than deleting the record.
+						existingRecord, found := indexedRecords[recordKey{host, policy.SetIdentifier, false}]
+						log.Warnf("Unable to create the health check for %s of ingress %s: %v", host,
+							entry.NamespaceName(), err)
+						if !found {
+							skipped = append(skipped, entry.NamespaceName()+":health-check:"+entry.Host)
+							u.skipEntry()
+							continue
+						}
+						id = existingRecord.RoutingPolicy.HealthCheckID
+					}
+					policy.HealthCheckID = id
+				}
+			}
+
+			ipv6Options := []bool{false}
+			if dnsDetails.IPv6 {
+				ipv6Options = append(ipv6Options, true)
+			}
+
+			for _, ipv6 := range ipv6Options {
+				key := recordKey{host, policy.SetIdentifier, ipv6}
+				desired[key] = true
+				existingRecord, found := indexedRecords[key]
+				recordExists := found && existingRecord.PointsTo == dnsDetails.DNSName &&
+					existingRecord.RoutingPolicy.Equal(policy)
 
-		existingRecord, recordExists := indexedRecords[recordKey{host, dnsDetails.DNSName}]
-		change := u.lbAdapter.CreateChange("UPSERT", host, dnsDetails, recordExists, &existingRecord)
-		if change != nil {
-			changes = append(changes, change)
+				change := u.createChange("UPSERT", host, dnsDetails, recordExists, &existingRecord, ipv6)
+				if recordExists && existingRecord.AutomaticTTL {
+					// Only the TTL differs, which the provider sets itself, so changing it would never converge.
+					change = nil
+				}
+				if change != nil && dnsDetails.Apex && aws.StringValue(change.ResourceRecordSet.Type) == route53.RRTypeCname {
+					log.Warnf("Not creating a CNAME for %s, as CNAMEs aren't allowed at the zone apex", host)
+					skipped = append(skipped, entry.NamespaceName()+":apex-cname:"+entry.Host)
+					u.skipEntry()
+					continue
+				}
+				if change != nil {
+					policy.Apply(change.ResourceRecordSet)
+					if err := validateRecord(change.ResourceRecordSet, limits); err != nil {
+						log.Warnf("Not applying the %s record for %s of ingress %s, as it's invalid: %v",
+							aws.StringValue(change.ResourceRecordSet.Type), host, entry.NamespaceName(), err)
+						skipped = append(skipped, entry.NamespaceName()+":invalid-record:"+entry.Host)
+						invalidHosts[host] = true
+						invalidRecordsCount.Inc()
+						u.skipEntry()
+						continue
+					}
+					if requestedTTL != dnsDetails.TTL {
+						log.Infof("Rounding up the TTL of %s from %v to the %s minimum of %v", host, requestedTTL,
+							u.provider(), dnsDetails.TTL)
+					}
+				}
+				if change != nil || recordExists {
+					records = append(records, desiredRecord(zone, host, dnsDetails, policy, change, existingRecord))
+					hostsWithRecords[host] = true
+				}
+				if change != nil {
+					upserts = append(upserts, change)
+				}
+			}
 		}
 	}
 
+	// Records replaced by a different routing policy are deleted first, as Route53 doesn't allow simple
+	// and routed record sets to exist for the same name.
+	var replaced, deletes []*route53.Change
 	for _, rec := range originalRecords {
-		if _, contains := hostToIngress[rec.Name]; !contains {
-			changes = append(changes, u.lbAdapter.CreateChange("DELETE", rec.Name, adapter.DNSDetails{
-				DNSName:      rec.PointsTo,
-				HostedZoneID: rec.AliasHostedZone,
-			}, false, nil))
+		ipv6 := rec.Type == route53.RRTypeAaaa
+		routed, inUse := routedHosts[rec.Name]
+		if rec.IsSimple() && !ipv6 && inUse && !routed || desired[keyOf(rec)] {
+			continue
+		}
+		if inUse && invalidHosts[rec.Name] && !hostsWithRecords[rec.Name] {
+			continue
+		}
+
+		change := u.createChange("DELETE", rec.Name, adapter.DNSDetails{
+			DNSName:      rec.PointsTo,
+			HostedZoneID: rec.AliasHostedZone,
+			// Route53 only deletes records which match exactly.
+			TTL:  time.Duration(rec.TTL) * time.Second,
+			Apex: rec.Name == zone.domain,
+		}, false, nil, ipv6)
+		if change == nil {
+			continue
+		}
+		rec.RoutingPolicy.Apply(change.ResourceRecordSet)
+
+		if inUse {
+			replaced = append(replaced, change)
+		} else {
+			deletes = append(deletes, change)
 		}
 	}
 
-	return changes, skipped
+	// The maximum is checked before tracking orphans and setting the desired records, so a refused update leaves
+	// them as they were.
+	if u.maxRecords > 0 && len(records) > u.maxRecords {
+		return nil, skipped, &tooManyRecordsError{records: len(records), max: u.maxRecords}
+	}
+	if u.orphans != nil && !u.draining {
+		deletes = u.orphans.expired(zone, deletes)
+	}
+	deletes = u.skipDeletes(zone, deletes)
+	u.records.set(zone, records)
+
+	changes := []*route53.Change{}
+	changes = append(changes, replaced...)
+	changes = append(changes, upserts...)
+	changes = append(changes, deletes...)
+	return changes, skipped, nil
+}
+
+// createChange creates a change using the frontend adapter. AAAA changes are only created for ALIAS records, as
+// CNAMEs already apply to both IPv4 and IPv6 lookups.
+func (u *updater) createChange(action string, host string, details adapter.DNSDetails, recordExists bool,
+	existingRecord *adapter.ConsolidatedRecord, ipv6 bool) *route53.Change {
+
+	change := u.lbAdapter.CreateChange(action, host, details, recordExists, existingRecord)
+	if !ipv6 || change == nil {
+		return change
+	}
+
+	if change.ResourceRecordSet.AliasTarget == nil {
+		return nil
+	}
+	change.ResourceRecordSet.Type = aws.String(route53.RRTypeAaaa)
+	return change
 }
@@ -1,22 +1,41 @@
 package dns
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
 	aws_elb "github.com/aws/aws-sdk-go/service/elb"
 	aws_alb "github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/aws/aws-sdk-go/service/route53"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/controller"
 	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/dns/recordset"
 	"github.com/sky-uk/feed/elb"
+	"github.com/sky-uk/feed/util/awspartition"
 	"github.com/sky-uk/feed/util/metrics"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
 )
 
 func init() {
@@ -106,6 +125,12 @@ func (m *mockELB) mockFindFrontEndElbs(labelValue string, lbDetails []lbDetail,
 	m.On("FindFrontEndElbs", mock.Anything, labelValue).Return(lbs, err)
 }
 
+func (m *mockELB) FindFrontEndElbsWithTags(e elb.ELB, tags map[string]string) (map[string]elb.LoadBalancerDetails,
+	error) {
+	args := m.Called(e, tags)
+	return args.Get(0).(map[string]elb.LoadBalancerDetails), args.Error(1)
+}
+
 func (m *mockELB) DescribeLoadBalancers(input *aws_elb.DescribeLoadBalancersInput) (*aws_elb.DescribeLoadBalancersOutput, error) {
 	return nil, nil
 }
@@ -126,6 +151,10 @@ type mockR53Client struct {
 	mock.Mock
 }
 
+func (m *mockR53Client) Capabilities() r53.Capabilities {
+	return r53.Route53Capabilities
+}
+
 func (m *mockR53Client) GetHostedZoneDomain() (string, error) {
 	args := m.Called()
 	return args.String(0), args.Error(1)
@@ -145,6 +174,15 @@ func (m *mockR53Client) GetRecords() ([]*route53.ResourceRecordSet, error) {
 	return args.Get(0).([]*route53.ResourceRecordSet), args.Error(1)
 }
 
+func (m *mockR53Client) GetTXTRecords() ([]*route53.ResourceRecordSet, error) {
+	args := m.Called()
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*route53.ResourceRecordSet), args.Error(1)
+}
+
 func (m *mockR53Client) mockGetRecords(rs []*route53.ResourceRecordSet, err error) {
 	m.On("GetRecords").Return(rs, err)
 }
@@ -153,12 +191,18 @@ func (m *mockR53Client) mockGetHostedZoneDomain() {
 	m.On("GetHostedZoneDomain").Return(domain, nil)
 }
 
+func newTestUpdater(lbAdapter adapter.FrontendAdapter, config Config) *updater {
+	config.HostedZoneIDs = []string{hostedZoneID}
+	config.Route53 = r53.Config{Retries: 1}
+	return New(lbAdapter, config).(*updater)
+}
+
 func setupForELB(albNames []string, elbLabelValue string) (*updater, *mockR53Client, *mockELB, *mockALB) {
 	mockALB := &mockALB{}
 	mockELB := &mockELB{}
 
 	config := adapter.AWSAdapterConfig{
-		HostedZoneID:  hostedZoneID,
+		HostedZoneIDs: []string{hostedZoneID},
 		ELBLabelValue: elbLabelValue,
 		ALBNames:      albNames,
 		ELBClient:     mockELB,
@@ -166,19 +210,19 @@ func setupForELB(albNames []string, elbLabelValue string) (*updater, *mockR53Cli
 		ELBFinder:     mockELB.FindFrontEndElbs,
 	}
 	lbAdapter, _ := adapter.NewAWSAdapter(&config)
-	dnsUpdater := New(hostedZoneID, lbAdapter, 1).(*updater)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{})
 
 	mockR53 := &mockR53Client{}
-	dnsUpdater.r53 = mockR53
+	dnsUpdater.zones[0].r53 = mockR53
 	return dnsUpdater, mockR53, mockELB, mockALB
 }
 
 func setupForExplicitAddresses(definedFrontends map[string]string) (*updater, *mockR53Client) {
-	lbAdapter := adapter.NewStaticHostnameAdapter(definedFrontends, 5*time.Minute)
+	lbAdapter := adapter.NewStaticHostnameAdapter(definedFrontends, 5*time.Minute, nil)
 
-	dnsUpdater := New(hostedZoneID, lbAdapter, 1).(*updater)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{})
 	mockR53 := &mockR53Client{}
-	dnsUpdater.r53 = mockR53
+	dnsUpdater.zones[0].r53 = mockR53
 	return dnsUpdater, mockR53
 }
 
@@ -229,6 +273,95 @@ func TestQueryFrontedElbs(t *testing.T) {
 	mockR53.AssertExpectations(t)
 }
 
+func TestQueryFrontendElbsByTagsInsteadOfLabelValue(t *testing.T) {
+	mockELB := &mockELB{}
+	tags := map[string]string{elb.ElbTag: elbLabelValue, "team": "core"}
+	config := adapter.AWSAdapterConfig{
+		HostedZoneIDs: []string{hostedZoneID},
+		ELBLabelValue: elbLabelValue,
+		ELBTags:       tags,
+		ELBClient:     mockELB,
+		ALBClient:     &mockALB{},
+		ELBFinder:     mockELB.FindFrontEndElbs,
+		ELBTagsFinder: mockELB.FindFrontEndElbsWithTags,
+	}
+	lbAdapter, _ := adapter.NewAWSAdapter(&config)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockELB.On("FindFrontEndElbsWithTags", mock.Anything, tags).Return(map[string]elb.LoadBalancerDetails{
+		internalScheme: {DNSName: internalALBDnsName, HostedZoneID: lbHostedZoneID},
+	}, nil)
+	mockR53.mockGetHostedZoneDomain()
+
+	assert.NoError(t, dnsUpdater.Start())
+	assert.Equal(t, map[string]adapter.DNSDetails{
+		internalScheme: {DNSName: internalALBDnsNameWithPeriod, HostedZoneID: lbHostedZoneID},
+	}, dnsUpdater.schemeToFrontendMap)
+	mockELB.AssertNotCalled(t, "FindFrontEndElbs", mock.Anything, mock.Anything)
+}
+
+func setupForDiscovery(interval time.Duration) (*updater, *mockR53Client, *mockELB) {
+	mockELB := &mockELB{}
+	config := adapter.AWSAdapterConfig{
+		HostedZoneIDs:     []string{hostedZoneID},
+		ELBLabelValue:     elbLabelValue,
+		ELBClient:         mockELB,
+		ALBClient:         &mockALB{},
+		ELBFinder:         mockELB.FindFrontEndElbs,
+		DiscoveryInterval: interval,
+	}
+	lbAdapter, _ := adapter.NewAWSAdapter(&config)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{}, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+	return dnsUpdater, mockR53, mockELB
+}
+
+func TestLoadBalancersAreCachedWithinTheDiscoveryInterval(t *testing.T) {
+	dnsUpdater, _, mockELB := setupForDiscovery(time.Hour)
+	mockELB.mockFindFrontEndElbs(elbLabelValue, lbDetails, nil)
+
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{}))
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{}))
+
+	mockELB.AssertNumberOfCalls(t, "FindFrontEndElbs", 1)
+}
+
+func TestLoadBalancersAreRediscoveredAfterTheDiscoveryInterval(t *testing.T) {
+	dnsUpdater, _, mockELB := setupForDiscovery(time.Nanosecond)
+	mockELB.mockFindFrontEndElbs(elbLabelValue, lbDetails, nil)
+	assert.NoError(t, dnsUpdater.Start())
+
+	recreated := []lbDetail{{scheme: internalScheme, dnsName: unassocALBDnsName}}
+	mockELB.ExpectedCalls = nil
+	mockELB.mockFindFrontEndElbs(elbLabelValue, recreated, nil)
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{}))
+
+	assert.Equal(t, map[string]adapter.DNSDetails{
+		internalScheme: {DNSName: unassocALBDnsNameWithPeriod, HostedZoneID: lbHostedZoneID},
+	}, dnsUpdater.schemeToFrontendMap)
+}
+
+func TestPreviousLoadBalancersAreKeptIfRediscoveryFails(t *testing.T) {
+	dnsUpdater, _, mockELB := setupForDiscovery(time.Nanosecond)
+	mockELB.mockFindFrontEndElbs(elbLabelValue, lbDetails, nil)
+	assert.NoError(t, dnsUpdater.Start())
+
+	mockELB.ExpectedCalls = nil
+	mockELB.mockFindFrontEndElbs(elbLabelValue, nil, errors.New("throttled"))
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{}))
+
+	assert.Equal(t, map[string]adapter.DNSDetails{
+		internalScheme: {DNSName: internalALBDnsNameWithPeriod, HostedZoneID: lbHostedZoneID},
+		externalScheme: {DNSName: externalALBDnsNameWithPeriod, HostedZoneID: lbHostedZoneID},
+	}, dnsUpdater.schemeToFrontendMap)
+}
+
 func TestGetsDomainNameFails(t *testing.T) {
 	dnsUpdater, mockR53, _, mockALB := setupForELB(albNames, "")
 	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
@@ -948,3 +1081,2863 @@ func TestRecordSetUpdatesWithAddressArguments(t *testing.T) {
 		}
 	}
 }
+
+func TestRecordsAreManagedInTheHostedZoneWithTheLongestMatchingDomain(t *testing.T) {
+	// given
+	dnsUpdater, parentR53 := setupForExplicitAddresses(map[string]string{internalScheme: internalAddressArgument})
+	childR53 := &mockR53Client{}
+	dnsUpdater.zones = append(dnsUpdater.zones, &hostedZone{id: "5678", r53: childR53})
+
+	parentR53.mockGetHostedZoneDomain()
+	parentR53.mockGetRecords(nil, nil)
+	childR53.On("GetHostedZoneDomain").Return("sub."+domain, nil)
+	childR53.mockGetRecords(nil, nil)
+
+	cname := func(host string) *route53.Change {
+		return &route53.Change{
+			Action: aws.String("UPSERT"),
+			ResourceRecordSet: &route53.ResourceRecordSet{
+				Name:            aws.String(host),
+				Type:            aws.String("CNAME"),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(internalAddressArgument)}},
+				TTL:             aws.Int64(300),
+			},
+		}
+	}
+	parentR53.On("UpdateRecordSets", []*route53.Change{cname("foo.james.com.")}).Return(nil)
+	childR53.On("UpdateRecordSets", []*route53.Change{cname("bar.sub.james.com.")}).Return(nil)
+
+	entries := controller.IngressEntries{
+		{Name: "parent", Host: "foo.james.com", LbScheme: internalScheme},
+		{Name: "child", Host: "bar.sub.james.com", LbScheme: internalScheme},
+		{Name: "no-zone", Host: "baz.other.com", LbScheme: internalScheme},
+	}
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(entries))
+
+	// then
+	parentR53.AssertExpectations(t)
+	childR53.AssertExpectations(t)
+}
+
+func TestRecordsAreManagedInTheHostedZoneOfTheirScheme(t *testing.T) {
+	// given
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{
+		internalLBScheme: internalAddressArgument,
+		externalLBScheme: externalAddressArgument,
+	}, 5*time.Minute, nil)
+	dnsUpdater := New(lbAdapter, Config{
+		InternalHostedZoneID: "internal-zone",
+		ExternalHostedZoneID: "external-zone",
+		Route53:              r53.Config{Retries: 1},
+	}).(*updater)
+	internalR53 := &mockR53Client{}
+	externalR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = internalR53
+	dnsUpdater.zones[1].r53 = externalR53
+
+	internalR53.mockGetHostedZoneDomain()
+	internalR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("moved.james.com.", externalAddressArgument, 300),
+	}, nil)
+	externalR53.mockGetHostedZoneDomain()
+	externalR53.mockGetRecords(nil, nil)
+
+	internalR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("internal.james.com.", internalAddressArgument, 300)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: cnameRecordSet("moved.james.com.", externalAddressArgument, 300)},
+	}).Return(nil)
+	externalR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("external.james.com.", externalAddressArgument, 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("moved.james.com.", externalAddressArgument, 300)},
+	}).Return(nil)
+
+	entries := controller.IngressEntries{
+		{Name: "internal", Host: "internal.james.com", LbScheme: internalLBScheme},
+		{Name: "external", Host: "external.james.com", LbScheme: externalLBScheme},
+		{Name: "moved", Host: "moved.james.com", LbScheme: externalLBScheme},
+	}
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(entries))
+
+	// then
+	internalR53.AssertExpectations(t)
+	externalR53.AssertExpectations(t)
+}
+
+func TestZonesAnnotationPublishesRecordsToEachLogicalZone(t *testing.T) {
+	// given
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{
+		internalLBScheme: internalAddressArgument,
+		externalLBScheme: externalAddressArgument,
+	}, 5*time.Minute, nil)
+	dnsUpdater := New(lbAdapter, Config{
+		InternalHostedZoneID: "internal-zone",
+		ExternalHostedZoneID: "external-zone",
+		Route53:              r53.Config{Retries: 1},
+	}).(*updater)
+	internalR53 := &mockR53Client{}
+	externalR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = internalR53
+	dnsUpdater.zones[1].r53 = externalR53
+
+	internalR53.mockGetHostedZoneDomain()
+	internalR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("unpublished.james.com.", externalAddressArgument, 300),
+	}, nil)
+	externalR53.mockGetHostedZoneDomain()
+	externalR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("unpublished.james.com.", externalAddressArgument, 300),
+	}, nil)
+
+	internalR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("both.james.com.", internalAddressArgument, 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("published.james.com.", externalAddressArgument, 300)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: cnameRecordSet("unpublished.james.com.", externalAddressArgument, 300)},
+	}).Return(nil)
+	externalR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("both.james.com.", internalAddressArgument, 300)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: cnameRecordSet("unpublished.james.com.", externalAddressArgument, 300)},
+	}).Return(nil)
+
+	entries := controller.IngressEntries{
+		{Name: "both", Host: "both.james.com", LbScheme: internalLBScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.ZonesAnnotation: "internal, External"})},
+		{Name: "published", Host: "published.james.com", LbScheme: externalLBScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.ZonesAnnotation: "internal"})},
+	}
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(entries))
+
+	// then
+	internalR53.AssertExpectations(t)
+	externalR53.AssertExpectations(t)
+}
+
+func TestUnhealthyWhileAHostedZoneIsMissing(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	dnsUpdater, mockR53 := setupForExplicitAddresses(map[string]string{internalScheme: internalAddressArgument})
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.On("GetRecords").Return(nil, &r53.NoSuchHostedZoneError{HostedZone: hostedZoneID}).Once()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{}, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+	assert.NoError(dnsUpdater.Start())
+
+	// when
+	updateErr := dnsUpdater.Update(controller.IngressEntries{})
+	unhealthy := dnsUpdater.Health()
+	dnsUpdater.Update(controller.IngressEntries{})
+
+	// then
+	assert.Error(updateErr)
+	if assert.Error(unhealthy) {
+		assert.Equal("hosted zones don't exist, they may have been deleted: [1234 (james.com.)]", unhealthy.Error())
+	}
+	assert.NoError(dnsUpdater.Health(), "should be healthy once the zone exists")
+}
+
+func TestRefusesToUpdateZonesWithMoreThanTheMaximumRecords(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		5*time.Minute, nil)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{MaxRecords: 2})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("old.james.com.", internalAddressArgument, 300),
+	}, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+	assert.NoError(dnsUpdater.Start())
+
+	entries := controller.IngressEntries{
+		{Name: "a", Host: "a.james.com", LbScheme: internalScheme},
+		{Name: "b", Host: "b.james.com", LbScheme: internalScheme},
+		{Name: "c", Host: "c.james.com", LbScheme: internalScheme},
+	}
+
+	// when
+	updateErr := dnsUpdater.Update(entries)
+	unhealthy := dnsUpdater.Health()
+	dnsUpdater.Update(entries[:2])
+
+	// then
+	assert.Error(updateErr)
+	if assert.Error(unhealthy) {
+		assert.Equal("hosted zones have more records than the maximum of 2: [1234 (james.com.)]", unhealthy.Error())
+	}
+	mockR53.AssertNumberOfCalls(t, "UpdateRecordSets", 1)
+	assert.NoError(dnsUpdater.Health(), "should be healthy once the records are within the maximum")
+}
+
+func TestRefusedUpdatesLeaveTheDesiredRecordsAndOrphansAlone(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		5*time.Minute, nil)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{MaxRecords: 2, DeleteGracePeriod: time.Hour})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("old.james.com.", internalAddressArgument, 300),
+	}, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+	assert.NoError(dnsUpdater.Start())
+	now := time.Now()
+	dnsUpdater.orphans.now = func() time.Time { return now }
+
+	assert.NoError(dnsUpdater.Update(controller.IngressEntries{
+		{Name: "a", Host: "a.james.com", LbScheme: internalScheme},
+		{Name: "b", Host: "b.james.com", LbScheme: internalScheme},
+	}))
+	records := dnsUpdater.Records()
+	orphans := make(map[orphanKey]time.Time)
+	for key, since := range dnsUpdater.orphans.since {
+		orphans[key] = since
+	}
+	now = now.Add(time.Minute)
+
+	// when
+	err := dnsUpdater.Update(controller.IngressEntries{
+		{Name: "a", Host: "a.james.com", LbScheme: internalScheme},
+		{Name: "c", Host: "c.james.com", LbScheme: internalScheme},
+		{Name: "d", Host: "d.james.com", LbScheme: internalScheme},
+	})
+
+	// then
+	assert.Error(err)
+	assert.Len(records, 2)
+	assert.Equal(records, dnsUpdater.Records(), "the refused records shouldn't be desired")
+	assert.Len(orphans, 1)
+	assert.Equal(orphans, dnsUpdater.orphans.since, "b.james.com shouldn't be orphaned by a refused update")
+}
+
+func TestStartFailsIfAHostedZoneIsMissing(t *testing.T) {
+	dnsUpdater, mockR53 := setupForExplicitAddresses(map[string]string{internalScheme: internalAddressArgument})
+	mockR53.On("GetHostedZoneDomain").Return("", &r53.NoSuchHostedZoneError{HostedZone: hostedZoneID})
+
+	assert.EqualError(t, dnsUpdater.Start(), "hosted zone 1234 doesn't exist, it may have been deleted")
+}
+
+func TestUpdateContinuesWithOtherZonesWhenOneFails(t *testing.T) {
+	// given
+	dnsUpdater, failingR53 := setupForExplicitAddresses(map[string]string{internalScheme: internalAddressArgument})
+	workingR53 := &mockR53Client{}
+	dnsUpdater.zones = append(dnsUpdater.zones, &hostedZone{id: "5678", r53: workingR53})
+
+	failingR53.mockGetHostedZoneDomain()
+	failingR53.mockGetRecords(nil, errors.New("zone unavailable"))
+	workingR53.On("GetHostedZoneDomain").Return("other.com.", nil)
+	workingR53.mockGetRecords(nil, nil)
+	workingR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+
+	entries := controller.IngressEntries{{Name: "other", Host: "foo.other.com", LbScheme: internalScheme}}
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	err := dnsUpdater.Update(entries)
+
+	// then
+	assert.EqualError(t, err, "unable to update hosted zones: [1234]")
+	workingR53.AssertExpectations(t)
+}
+
+func ingressWithAnnotations(annotations map[string]string) *v1beta1.Ingress {
+	return &v1beta1.Ingress{ObjectMeta: v1.ObjectMeta{Annotations: annotations}}
+}
+
+func aliasRecordSet(host, lbDNSName string) *route53.ResourceRecordSet {
+	return &route53.ResourceRecordSet{
+		Name: aws.String(host),
+		Type: aws.String(route53.RRTypeA),
+		AliasTarget: &route53.AliasTarget{
+			DNSName:              aws.String(lbDNSName),
+			HostedZoneId:         aws.String(lbHostedZoneID),
+			EvaluateTargetHealth: aws.Bool(false),
+		},
+	}
+}
+
+func weightedAliasRecordSet(host, lbDNSName string, weight int64) *route53.ResourceRecordSet {
+	rrs := aliasRecordSet(host, lbDNSName)
+	rrs.SetIdentifier = aws.String(strings.TrimSuffix(lbDNSName, "."))
+	rrs.Weight = aws.Int64(weight)
+	return rrs
+}
+
+func TestWeightedRecordSetUpdates(t *testing.T) {
+	weighted := ingressWithAnnotations(map[string]string{adapter.WeightAnnotation: "20"})
+
+	var tests = []struct {
+		name            string
+		update          controller.IngressEntries
+		records         []*route53.ResourceRecordSet
+		expectedChanges []*route53.Change
+	}{
+		{
+			"Creates a weighted record per load balancer, defaulting the weight",
+			controller.IngressEntries{
+				{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme, Ingress: weighted},
+				{Name: "green", Host: "foo.james.com", LbScheme: externalScheme},
+			},
+			nil,
+			[]*route53.Change{
+				{
+					Action:            aws.String("UPSERT"),
+					ResourceRecordSet: weightedAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, 20),
+				},
+				{
+					Action:            aws.String("UPSERT"),
+					ResourceRecordSet: weightedAliasRecordSet("foo.james.com.", externalALBDnsNameWithPeriod, adapter.DefaultWeight),
+				},
+			},
+		},
+		{
+			"Does not update weighted records which are unchanged",
+			controller.IngressEntries{
+				{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme, Ingress: weighted},
+			},
+			[]*route53.ResourceRecordSet{
+				weightedAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, 20),
+			},
+			[]*route53.Change{},
+		},
+		{
+			"Updates the weight of an existing record",
+			controller.IngressEntries{
+				{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme, Ingress: weighted},
+			},
+			[]*route53.ResourceRecordSet{
+				weightedAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, 80),
+			},
+			[]*route53.Change{{
+				Action:            aws.String("UPSERT"),
+				ResourceRecordSet: weightedAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, 20),
+			}},
+		},
+		{
+			"Deleting one ingress only removes its weighted record",
+			controller.IngressEntries{
+				{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme, Ingress: weighted},
+			},
+			[]*route53.ResourceRecordSet{
+				weightedAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, 20),
+				weightedAliasRecordSet("foo.james.com.", externalALBDnsNameWithPeriod, 80),
+			},
+			[]*route53.Change{{
+				Action:            aws.String("DELETE"),
+				ResourceRecordSet: weightedAliasRecordSet("foo.james.com.", externalALBDnsNameWithPeriod, 80),
+			}},
+		},
+		{
+			"Replaces a simple record with a weighted record",
+			controller.IngressEntries{
+				{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme, Ingress: weighted},
+			},
+			[]*route53.ResourceRecordSet{
+				aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod),
+			},
+			[]*route53.Change{
+				{
+					Action:            aws.String("DELETE"),
+					ResourceRecordSet: aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod),
+				},
+				{
+					Action:            aws.String("UPSERT"),
+					ResourceRecordSet: weightedAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, 20),
+				},
+			},
+		},
+		{
+			"Invalid weights use the default weight",
+			controller.IngressEntries{
+				{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme,
+					Ingress: ingressWithAnnotations(map[string]string{adapter.WeightAnnotation: "heavy"})},
+			},
+			nil,
+			[]*route53.Change{{
+				Action:            aws.String("UPSERT"),
+				ResourceRecordSet: weightedAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, adapter.DefaultWeight),
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Printf("=== test: TestWeightedRecordSetUpdates: %s\n", test.name)
+
+		dnsUpdater, mockR53, _, mockALB := setupForELB(albNames, "")
+		mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+		mockR53.mockGetHostedZoneDomain()
+		mockR53.mockGetRecords(test.records, nil)
+		mockR53.On("UpdateRecordSets", test.expectedChanges).Return(nil)
+
+		assert.NoError(t, dnsUpdater.Start())
+		assert.NoError(t, dnsUpdater.Update(test.update))
+
+		mockR53.AssertExpectations(t)
+
+		if t.Failed() {
+			t.FailNow()
+		}
+	}
+}
+
+const healthCheckID = "abcdef-1234"
+
+func failoverAliasRecordSet(host, lbDNSName, role string) *route53.ResourceRecordSet {
+	rrs := aliasRecordSet(host, lbDNSName)
+	rrs.SetIdentifier = aws.String(strings.TrimSuffix(lbDNSName, "."))
+	rrs.Failover = aws.String(role)
+	rrs.HealthCheckId = aws.String(healthCheckID)
+	return rrs
+}
+
+func TestFailoverRecordSetUpdates(t *testing.T) {
+	primary := ingressWithAnnotations(map[string]string{adapter.FailoverRoleAnnotation: "primary"})
+	secondary := ingressWithAnnotations(map[string]string{adapter.FailoverRoleAnnotation: "SECONDARY"})
+
+	var tests = []struct {
+		name            string
+		update          controller.IngressEntries
+		records         []*route53.ResourceRecordSet
+		expectedChanges []*route53.Change
+	}{
+		{
+			"Creates a failover record per load balancer with the health check",
+			controller.IngressEntries{
+				{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme, Ingress: primary},
+				{Name: "green", Host: "foo.james.com", LbScheme: externalScheme, Ingress: secondary},
+			},
+			nil,
+			[]*route53.Change{
+				{
+					Action: aws.String("UPSERT"),
+					ResourceRecordSet: failoverAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod,
+						route53.ResourceRecordSetFailoverPrimary),
+				},
+				{
+					Action: aws.String("UPSERT"),
+					ResourceRecordSet: failoverAliasRecordSet("foo.james.com.", externalALBDnsNameWithPeriod,
+						route53.ResourceRecordSetFailoverSecondary),
+				},
+			},
+		},
+		{
+			"Does not update failover records which are unchanged",
+			controller.IngressEntries{
+				{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme, Ingress: primary},
+			},
+			[]*route53.ResourceRecordSet{
+				failoverAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod,
+					route53.ResourceRecordSetFailoverPrimary),
+			},
+			[]*route53.Change{},
+		},
+		{
+			"Replaces a simple record with a failover record",
+			controller.IngressEntries{
+				{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme, Ingress: primary},
+			},
+			[]*route53.ResourceRecordSet{
+				aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod),
+			},
+			[]*route53.Change{
+				{
+					Action:            aws.String("DELETE"),
+					ResourceRecordSet: aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod),
+				},
+				{
+					Action: aws.String("UPSERT"),
+					ResourceRecordSet: failoverAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod,
+						route53.ResourceRecordSetFailoverPrimary),
+				},
+			},
+		},
+		{
+			"Skips entries on a failover host without a valid role",
+			controller.IngressEntries{
+				{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme, Ingress: primary},
+				{Name: "green", Host: "foo.james.com", LbScheme: externalScheme,
+					Ingress: ingressWithAnnotations(map[string]string{adapter.FailoverRoleAnnotation: "tertiary"})},
+			},
+			nil,
+			[]*route53.Change{{
+				Action: aws.String("UPSERT"),
+				ResourceRecordSet: failoverAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod,
+					route53.ResourceRecordSetFailoverPrimary),
+			}},
+		},
+		{
+			"Creates simple records without the annotation",
+			controller.IngressEntries{
+				{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme},
+			},
+			nil,
+			[]*route53.Change{{
+				Action:            aws.String("UPSERT"),
+				ResourceRecordSet: aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod),
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Printf("=== test: TestFailoverRecordSetUpdates: %s\n", test.name)
+
+		mockALB := &mockALB{}
+		mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+		lbAdapter, err := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{
+			HostedZoneIDs: []string{hostedZoneID},
+			ALBNames:      albNames,
+			ALBClient:     mockALB,
+			ELBClient:     &mockELB{},
+			HealthCheckID: healthCheckID,
+		})
+		assert.NoError(t, err)
+		dnsUpdater := newTestUpdater(lbAdapter, Config{})
+		mockR53 := &mockR53Client{}
+		dnsUpdater.zones[0].r53 = mockR53
+		mockR53.mockGetHostedZoneDomain()
+		mockR53.mockGetRecords(test.records, nil)
+		mockR53.On("UpdateRecordSets", test.expectedChanges).Return(nil)
+
+		assert.NoError(t, dnsUpdater.Start())
+		assert.NoError(t, dnsUpdater.Update(test.update))
+
+		mockR53.AssertExpectations(t)
+
+		if t.Failed() {
+			t.FailNow()
+		}
+	}
+}
+
+type mockHealthCheckR53Client struct {
+	mockR53Client
+}
+
+func (m *mockHealthCheckR53Client) GetHealthChecks() ([]*route53.HealthCheck, error) {
+	args := m.Called()
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*route53.HealthCheck), args.Error(1)
+}
+
+func (m *mockHealthCheckR53Client) CreateHealthCheck(callerReference string,
+	config *route53.HealthCheckConfig) (string, error) {
+	args := m.Called(callerReference, config)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockHealthCheckR53Client) DeleteHealthCheck(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func setupForHealthChecks(t *testing.T) (*updater, *mockHealthCheckR53Client) {
+	mockALB := &mockALB{}
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	lbAdapter, err := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{
+		HostedZoneIDs: []string{hostedZoneID},
+		ALBNames:      albNames,
+		ALBClient:     mockALB,
+		ELBClient:     &mockELB{},
+	})
+	assert.NoError(t, err)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{ManageHealthChecks: true, ClusterName: "blue"})
+	mockR53 := &mockHealthCheckR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	return dnsUpdater, mockR53
+}
+
+func ownedHealthCheck(id, owner, path string) *route53.HealthCheck {
+	return &route53.HealthCheck{
+		Id:              aws.String(id),
+		CallerReference: aws.String("feed-dns:" + owner + ":1234"),
+		HealthCheckConfig: healthCheckSpec{fqdn: internalALBDnsName, path: path, port: 8080,
+			interval: 10}.config(),
+	}
+}
+
+func healthCheckedRecordSet(host, lbDNSName, id string) *route53.ResourceRecordSet {
+	rrs := failoverAliasRecordSet(host, lbDNSName, route53.ResourceRecordSetFailoverPrimary)
+	rrs.HealthCheckId = aws.String(id)
+	return rrs
+}
+
+var healthCheckedIngress = ingressWithAnnotations(map[string]string{
+	adapter.FailoverRoleAnnotation:        "primary",
+	adapter.HealthCheckPathAnnotation:     "/health",
+	adapter.HealthCheckPortAnnotation:     "8080",
+	adapter.HealthCheckIntervalAnnotation: "10",
+})
+
+func TestHealthChecksAreCreatedForAnnotatedRecordsAndDeletedOnceUnused(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForHealthChecks(t)
+	mockR53.On("GetHealthChecks").Return([]*route53.HealthCheck{
+		ownedHealthCheck("hc-other", "green", "/health"),
+		ownedHealthCheck("hc-old", "blue", "/old"),
+	}, nil)
+	mockR53.mockGetRecords(nil, nil)
+	expectedConfig := &route53.HealthCheckConfig{
+		Type:                     aws.String(route53.HealthCheckTypeHttp),
+		FullyQualifiedDomainName: aws.String(internalALBDnsName),
+		Port:                     aws.Int64(8080),
+		ResourcePath:             aws.String("/health"),
+		RequestInterval:          aws.Int64(10),
+	}
+	mockR53.On("CreateHealthCheck", mock.MatchedBy(func(ref string) bool {
+		return strings.HasPrefix(ref, "feed-dns:blue:")
+	}), expectedConfig).Return("hc-new", nil).Once()
+	mockR53.On("UpdateRecordSets", []*route53.Change{{
+		Action:            aws.String("UPSERT"),
+		ResourceRecordSet: healthCheckedRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, "hc-new"),
+	}}).Return(nil)
+	mockR53.On("DeleteHealthCheck", "hc-old").Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	err := dnsUpdater.Update(controller.IngressEntries{
+		{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme, Ingress: healthCheckedIngress},
+	})
+
+	// then
+	assert.NoError(t, err)
+	mockR53.AssertExpectations(t)
+	mockR53.AssertNotCalled(t, "DeleteHealthCheck", "hc-other")
+}
+
+func TestHealthChecksAreReusedAndKeptWhileARecordUsesThem(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForHealthChecks(t)
+	mockR53.On("GetHealthChecks").Return([]*route53.HealthCheck{
+		ownedHealthCheck("hc-1", "blue", "/health"),
+		ownedHealthCheck("hc-2", "blue", "/old"),
+	}, nil)
+	deleted := healthCheckedRecordSet("bar.james.com.", internalALBDnsNameWithPeriod, "hc-2")
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{deleted}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{
+			Action:            aws.String("UPSERT"),
+			ResourceRecordSet: healthCheckedRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, "hc-1"),
+		},
+		{Action: aws.String("DELETE"), ResourceRecordSet: deleted},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	err := dnsUpdater.Update(controller.IngressEntries{
+		{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme, Ingress: healthCheckedIngress},
+	})
+
+	// then
+	assert.NoError(t, err)
+	mockR53.AssertExpectations(t)
+	mockR53.AssertNotCalled(t, "CreateHealthCheck", mock.Anything, mock.Anything)
+	mockR53.AssertNotCalled(t, "DeleteHealthCheck", mock.Anything)
+}
+
+func TestUpdatesFailIfHealthChecksCantBeListed(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForHealthChecks(t)
+	mockR53.On("GetHealthChecks").Return(nil, errors.New("throttled"))
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	err := dnsUpdater.Update(controller.IngressEntries{
+		{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme, Ingress: healthCheckedIngress},
+	})
+
+	// then
+	assert.EqualError(t, err, "unable to get health checks: throttled")
+	mockR53.AssertNotCalled(t, "UpdateRecordSets", mock.Anything)
+}
+
+func latencyAliasRecordSet(host, lbDNSName, region string) *route53.ResourceRecordSet {
+	rrs := aliasRecordSet(host, lbDNSName)
+	rrs.SetIdentifier = aws.String(strings.TrimSuffix(lbDNSName, "."))
+	rrs.Region = aws.String(region)
+	return rrs
+}
+
+func TestSetIdentifiersAreRenderedFromTheTemplate(t *testing.T) {
+	// given
+	tmpl, err := ParseSetIdentifierTemplate("{{.Region}}-{{.Cluster}}")
+	assert.NoError(t, err)
+	mockALB := &mockALB{}
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	lbAdapter, _ := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{
+		Region:        "eu-west-1",
+		HostedZoneIDs: []string{hostedZoneID},
+		ALBNames:      albNames,
+		ALBClient:     mockALB,
+		ELBClient:     &mockELB{},
+	})
+	dnsUpdater := newTestUpdater(lbAdapter, Config{SetIdentifierTemplate: tmpl, ClusterName: "blue"})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords(nil, nil)
+	expected := latencyAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, "eu-west-1")
+	expected.SetIdentifier = aws.String("eu-west-1-blue")
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: expected},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.RoutingPolicyAnnotation: "latency"})},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestInvalidSetIdentifierTemplatesAreRejected(t *testing.T) {
+	for _, text := range []string{"{{.Region", "{{.Zone}}", "", "{{.Region}}" + strings.Repeat("x", 128)} {
+		_, err := ParseSetIdentifierTemplate(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestRecordNamesAreRenderedFromTheTemplate(t *testing.T) {
+	// given
+	tmpl, err := ParseRecordNameTemplate(`{{if ne .Namespace "broken"}}{{.Host | replace ".blue." "."}}{{end}}`)
+	assert.NoError(t, err)
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		time.Minute, nil)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{RecordNameTemplate: tmpl})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("old.james.com.", internalAddressArgument, 60),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("bar.james.com.", internalAddressArgument, 60)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("foo.james.com.", internalAddressArgument, 60)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: cnameRecordSet("old.james.com.", internalAddressArgument, 60)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Namespace: "blue", Name: "foo", Host: "foo.blue.james.com", LbScheme: internalScheme},
+		{Namespace: "blue", Name: "bar", Host: "bar.james.com", LbScheme: internalScheme},
+		{Namespace: "broken", Name: "old", Host: "old.james.com", LbScheme: internalScheme},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestInvalidRecordNameTemplatesAreRejected(t *testing.T) {
+	for _, text := range []string{"{{.Host", "{{.Zone}}", "", "{{.Host | upper}}", "{{.Host}}..com"} {
+		_, err := ParseRecordNameTemplate(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestLatencyRecordSetUpdates(t *testing.T) {
+	latency := ingressWithAnnotations(map[string]string{adapter.RoutingPolicyAnnotation: "latency"})
+	otherRegionLB := "other-region-lb.us-east-1.elb.amazonaws.com."
+
+	var tests = []struct {
+		name            string
+		update          controller.IngressEntries
+		records         []*route53.ResourceRecordSet
+		expectedChanges []*route53.Change
+	}{
+		{
+			"Creates a latency record in the load balancer's region",
+			controller.IngressEntries{
+				{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme, Ingress: latency},
+			},
+			[]*route53.ResourceRecordSet{
+				latencyAliasRecordSet("foo.james.com.", otherRegionLB, "us-east-1"),
+			},
+			[]*route53.Change{{
+				Action:            aws.String("UPSERT"),
+				ResourceRecordSet: latencyAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, "eu-west-1"),
+			}},
+		},
+		{
+			"Does not update latency records which are unchanged",
+			controller.IngressEntries{
+				{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme, Ingress: latency},
+			},
+			[]*route53.ResourceRecordSet{
+				latencyAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, "eu-west-1"),
+			},
+			[]*route53.Change{},
+		},
+		{
+			"Removing the ingress only removes this region's record",
+			controller.IngressEntries{},
+			[]*route53.ResourceRecordSet{
+				latencyAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, "eu-west-1"),
+				latencyAliasRecordSet("foo.james.com.", otherRegionLB, "us-east-1"),
+			},
+			[]*route53.Change{{
+				Action:            aws.String("DELETE"),
+				ResourceRecordSet: latencyAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, "eu-west-1"),
+			}},
+		},
+		{
+			"Ignores unsupported routing policies",
+			controller.IngressEntries{
+				{Name: "blue", Host: "foo.james.com", LbScheme: internalScheme,
+					Ingress: ingressWithAnnotations(map[string]string{adapter.RoutingPolicyAnnotation: "geolocation"})},
+			},
+			nil,
+			[]*route53.Change{{
+				Action:            aws.String("UPSERT"),
+				ResourceRecordSet: aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod),
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Printf("=== test: TestLatencyRecordSetUpdates: %s\n", test.name)
+
+		mockALB := &mockALB{}
+		mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+		lbAdapter, err := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{
+			Region:        "eu-west-1",
+			HostedZoneIDs: []string{hostedZoneID},
+			ALBNames:      albNames,
+			ALBClient:     mockALB,
+			ELBClient:     &mockELB{},
+		})
+		assert.NoError(t, err)
+		dnsUpdater := newTestUpdater(lbAdapter, Config{})
+		mockR53 := &mockR53Client{}
+		dnsUpdater.zones[0].r53 = mockR53
+		mockR53.mockGetHostedZoneDomain()
+		mockR53.mockGetRecords(test.records, nil)
+		mockR53.On("UpdateRecordSets", test.expectedChanges).Return(nil)
+
+		assert.NoError(t, dnsUpdater.Start())
+		assert.NoError(t, dnsUpdater.Update(test.update))
+
+		mockR53.AssertExpectations(t)
+
+		if t.Failed() {
+			t.FailNow()
+		}
+	}
+}
+
+func geoAliasRecordSet(host, lbDNSName, location string, geo *route53.GeoLocation) *route53.ResourceRecordSet {
+	rrs := aliasRecordSet(host, lbDNSName)
+	rrs.SetIdentifier = aws.String(strings.TrimSuffix(lbDNSName, ".") + "/" + location)
+	rrs.GeoLocation = geo
+	return rrs
+}
+
+func TestGeolocationRecordSetUpdates(t *testing.T) {
+	geo := func(location string) *v1beta1.Ingress {
+		return ingressWithAnnotations(map[string]string{adapter.GeoAnnotation: location})
+	}
+	europe := &route53.GeoLocation{ContinentCode: aws.String("EU")}
+	unitedKingdom := &route53.GeoLocation{CountryCode: aws.String("GB")}
+	everywhere := &route53.GeoLocation{CountryCode: aws.String("*")}
+
+	var tests = []struct {
+		name            string
+		update          controller.IngressEntries
+		records         []*route53.ResourceRecordSet
+		expectedChanges []*route53.Change
+	}{
+		{
+			"Creates a geolocation record for a continent",
+			controller.IngressEntries{
+				{Name: "eu", Host: "foo.james.com", LbScheme: internalScheme, Ingress: geo("continent:eu")},
+			},
+			nil,
+			[]*route53.Change{{
+				Action: aws.String("UPSERT"),
+				ResourceRecordSet: geoAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, "continent:EU",
+					europe),
+			}},
+		},
+		{
+			"Creates a record for each location of the same load balancer",
+			controller.IngressEntries{
+				{Name: "default", Host: "foo.james.com", LbScheme: internalScheme, Ingress: geo("*")},
+				{Name: "uk", Host: "foo.james.com", LbScheme: internalScheme, Ingress: geo("gb")},
+			},
+			nil,
+			[]*route53.Change{
+				{
+					Action: aws.String("UPSERT"),
+					ResourceRecordSet: geoAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, "*",
+						everywhere),
+				},
+				{
+					Action: aws.String("UPSERT"),
+					ResourceRecordSet: geoAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, "GB",
+						unitedKingdom),
+				},
+			},
+		},
+		{
+			"Does not update geolocation records which are unchanged",
+			controller.IngressEntries{
+				{Name: "uk", Host: "foo.james.com", LbScheme: internalScheme, Ingress: geo("GB")},
+			},
+			[]*route53.ResourceRecordSet{
+				geoAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, "GB", unitedKingdom),
+			},
+			[]*route53.Change{},
+		},
+		{
+			"Removing an ingress only removes its geolocation record",
+			controller.IngressEntries{
+				{Name: "uk", Host: "foo.james.com", LbScheme: internalScheme, Ingress: geo("GB")},
+			},
+			[]*route53.ResourceRecordSet{
+				geoAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, "GB", unitedKingdom),
+				geoAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, "*", everywhere),
+			},
+			[]*route53.Change{{
+				Action:            aws.String("DELETE"),
+				ResourceRecordSet: geoAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, "*", everywhere),
+			}},
+		},
+		{
+			"Skips ingresses with an invalid location",
+			controller.IngressEntries{
+				{Name: "eu", Host: "foo.james.com", LbScheme: internalScheme, Ingress: geo("europe")},
+			},
+			nil,
+			[]*route53.Change{},
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Printf("=== test: TestGeolocationRecordSetUpdates: %s\n", test.name)
+
+		mockALB := &mockALB{}
+		mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+		lbAdapter, err := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{
+			HostedZoneIDs: []string{hostedZoneID},
+			ALBNames:      albNames,
+			ALBClient:     mockALB,
+			ELBClient:     &mockELB{},
+		})
+		assert.NoError(t, err)
+		dnsUpdater := newTestUpdater(lbAdapter, Config{})
+		mockR53 := &mockR53Client{}
+		dnsUpdater.zones[0].r53 = mockR53
+		mockR53.mockGetHostedZoneDomain()
+		mockR53.mockGetRecords(test.records, nil)
+		mockR53.On("UpdateRecordSets", test.expectedChanges).Return(nil)
+
+		assert.NoError(t, dnsUpdater.Start())
+		assert.NoError(t, dnsUpdater.Update(test.update))
+
+		mockR53.AssertExpectations(t)
+
+		if t.Failed() {
+			t.FailNow()
+		}
+	}
+}
+
+func TestCreatesCNAMERecordsForLoadBalancersWhenConfigured(t *testing.T) {
+	// given
+	mockALB := &mockALB{}
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	lbAdapter, err := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{
+		HostedZoneIDs: []string{hostedZoneID},
+		ALBNames:      albNames,
+		ALBClient:     mockALB,
+		ELBClient:     &mockELB{},
+		RecordType:    adapter.CNAMERecordType,
+		CNAMETTL:      time.Minute,
+	})
+	assert.NoError(t, err)
+
+	dnsUpdater := newTestUpdater(lbAdapter, Config{})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{{
+		Name:            aws.String("old.james.com."),
+		Type:            aws.String(route53.RRTypeCname),
+		TTL:             aws.Int64(60),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(internalALBDnsNameWithPeriod)}},
+	}}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{
+			Action: aws.String("UPSERT"),
+			ResourceRecordSet: &route53.ResourceRecordSet{
+				Name:            aws.String("foo.james.com."),
+				Type:            aws.String("CNAME"),
+				TTL:             aws.Int64(60),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(externalALBDnsNameWithPeriod)}},
+			},
+		},
+		{
+			Action: aws.String("DELETE"),
+			ResourceRecordSet: &route53.ResourceRecordSet{
+				Name:            aws.String("old.james.com."),
+				Type:            aws.String("CNAME"),
+				TTL:             aws.Int64(60),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(internalALBDnsNameWithPeriod)}},
+			},
+		},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "test-entry", Host: "foo.james.com", LbScheme: externalScheme},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestApexHostsAreAliasedWhenCreatingCNAMERecords(t *testing.T) {
+	// given
+	mockALB := &mockALB{}
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	lbAdapter, err := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{
+		HostedZoneIDs: []string{hostedZoneID},
+		ALBNames:      albNames,
+		ALBClient:     mockALB,
+		ELBClient:     &mockELB{},
+		RecordType:    adapter.CNAMERecordType,
+		CNAMETTL:      time.Minute,
+	})
+	assert.NoError(t, err)
+
+	dnsUpdater := newTestUpdater(lbAdapter, Config{})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("foo.james.com.", externalALBDnsNameWithPeriod, 60)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: aliasRecordSet("james.com.", externalALBDnsNameWithPeriod)},
+	}).Return(nil).Once()
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	entries := controller.IngressEntries{
+		{Name: "apex", Host: "james.com", LbScheme: externalScheme},
+		{Name: "foo", Host: "foo.james.com", LbScheme: externalScheme},
+	}
+	assert.NoError(t, dnsUpdater.Update(entries))
+
+	// then the apex alias is managed, and deleted with its ingress
+	mockR53.ExpectedCalls = nil
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("foo.james.com.", externalALBDnsNameWithPeriod, 60),
+		aliasRecordSet("james.com.", externalALBDnsNameWithPeriod),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("DELETE"), ResourceRecordSet: aliasRecordSet("james.com.", externalALBDnsNameWithPeriod)},
+	}).Return(nil)
+	assert.NoError(t, dnsUpdater.Update(entries[1:]))
+	mockR53.AssertExpectations(t)
+}
+
+func TestApexHostsAreSkippedWhenTheyCannotBeAliased(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForExplicitAddresses(map[string]string{internalScheme: internalAddressArgument})
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("foo.james.com.", internalAddressArgument, 300)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "apex", Host: "james.com", LbScheme: internalScheme},
+		{Name: "foo", Host: "foo.james.com", LbScheme: internalScheme},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestNamedLoadBalancersAreSelectedByAnnotation(t *testing.T) {
+	// given
+	lbAdapter := adapter.NewNamedStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		map[string]string{"team-a": "team-a-lb"}, 5*time.Minute, nil)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("old.james.com.", "team-a-lb", 300),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("default.james.com.", internalAddressArgument, 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("team-a.james.com.", "team-a-lb", 300)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: cnameRecordSet("old.james.com.", "team-a-lb", 300)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "default", Host: "default.james.com", LbScheme: internalScheme},
+		{Name: "team-a", Host: "team-a.james.com", LbScheme: internalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.LBNameAnnotation: "team-a"})},
+		{Name: "unknown", Host: "unknown.james.com", LbScheme: internalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.LBNameAnnotation: "team-b"})},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestRejectsUnknownRecordType(t *testing.T) {
+	_, err := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{
+		ALBClient:  &mockALB{},
+		ELBClient:  &mockELB{},
+		RecordType: "mx",
+	})
+
+	assert.EqualError(t, err, `unknown record type "mx", must be alias or cname`)
+}
+
+type mockNLB struct {
+	mockALB
+}
+
+func (m *mockNLB) DescribeTags(input *aws_alb.DescribeTagsInput) (*aws_alb.DescribeTagsOutput, error) {
+	args := m.Called(input)
+	return args.Get(0).(*aws_alb.DescribeTagsOutput), args.Error(1)
+}
+
+func setupForNLB(nlbNames []string, nlbLabelValue string) (*updater, *mockR53Client, *mockNLB) {
+	mockNLB := &mockNLB{}
+	lbAdapter, _ := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{
+		HostedZoneIDs: []string{hostedZoneID},
+		NLBNames:      nlbNames,
+		NLBLabelValue: nlbLabelValue,
+		NLBClient:     mockNLB,
+	})
+	dnsUpdater := newTestUpdater(lbAdapter, Config{})
+
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	return dnsUpdater, mockR53, mockNLB
+}
+
+func nlb(name, lbType, scheme, dnsName string) *aws_alb.LoadBalancer {
+	return &aws_alb.LoadBalancer{
+		LoadBalancerName:      aws.String(name),
+		LoadBalancerArn:       aws.String("arn:" + name),
+		Type:                  aws.String(lbType),
+		Scheme:                aws.String(scheme),
+		DNSName:               aws.String(dnsName),
+		CanonicalHostedZoneId: aws.String(lbHostedZoneID),
+	}
+}
+
+func TestQueryFrontendNLBsByName(t *testing.T) {
+	dnsUpdater, mockR53, mockNLB := setupForNLB([]string{"internal-nlb", "external-nlb"}, "")
+	mockR53.mockGetHostedZoneDomain()
+	mockNLB.On("DescribeLoadBalancers", &aws_alb.DescribeLoadBalancersInput{
+		Names: aws.StringSlice([]string{"internal-nlb", "external-nlb"}),
+	}).Return(&aws_alb.DescribeLoadBalancersOutput{LoadBalancers: []*aws_alb.LoadBalancer{
+		nlb("internal-nlb", "network", internalScheme, internalALBDnsName),
+		nlb("external-nlb", "network", externalScheme, externalALBDnsName),
+	}}, nil)
+
+	assert.NoError(t, dnsUpdater.Start())
+	assert.Equal(t, map[string]adapter.DNSDetails{
+		internalScheme: {DNSName: internalALBDnsNameWithPeriod, HostedZoneID: lbHostedZoneID},
+		externalScheme: {DNSName: externalALBDnsNameWithPeriod, HostedZoneID: lbHostedZoneID},
+	}, dnsUpdater.schemeToFrontendMap)
+}
+
+func TestQueryFrontendNLBsByLabel(t *testing.T) {
+	dnsUpdater, mockR53, mockNLB := setupForNLB(nil, "my-cluster")
+	mockR53.mockGetHostedZoneDomain()
+	mockNLB.On("DescribeLoadBalancers", &aws_alb.DescribeLoadBalancersInput{}).Return(
+		&aws_alb.DescribeLoadBalancersOutput{LoadBalancers: []*aws_alb.LoadBalancer{
+			nlb("internal-nlb", "network", internalScheme, internalALBDnsName),
+			nlb("other-cluster-nlb", "network", externalScheme, unassocALBDnsName),
+			nlb("some-alb", "application", externalScheme, "some-alb-dns-name"),
+		}}, nil)
+	mockNLB.On("DescribeTags", &aws_alb.DescribeTagsInput{
+		ResourceArns: aws.StringSlice([]string{"arn:internal-nlb", "arn:other-cluster-nlb"}),
+	}).Return(&aws_alb.DescribeTagsOutput{TagDescriptions: []*aws_alb.TagDescription{
+		{
+			ResourceArn: aws.String("arn:internal-nlb"),
+			Tags:        []*aws_alb.Tag{{Key: aws.String(elb.ElbTag), Value: aws.String("my-cluster")}},
+		},
+		{
+			ResourceArn: aws.String("arn:other-cluster-nlb"),
+			Tags:        []*aws_alb.Tag{{Key: aws.String(elb.ElbTag), Value: aws.String("other-cluster")}},
+		},
+	}}, nil)
+
+	assert.NoError(t, dnsUpdater.Start())
+	assert.Equal(t, map[string]adapter.DNSDetails{
+		internalScheme: {DNSName: internalALBDnsNameWithPeriod, HostedZoneID: lbHostedZoneID},
+	}, dnsUpdater.schemeToFrontendMap)
+	mockNLB.AssertExpectations(t)
+}
+
+func TestNLBsCannotBeCombinedWithALBs(t *testing.T) {
+	lbAdapter, _ := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{
+		ALBNames:  albNames,
+		NLBNames:  []string{"nlb"},
+		NLBClient: &mockNLB{},
+	})
+
+	_, err := lbAdapter.Initialise()
+
+	assert.Error(t, err)
+}
+
+func setupForIPv6(lookupIP adapter.LookupIPFunc) (*updater, *mockR53Client) {
+	mockALB := &mockALB{}
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	lbAdapter, _ := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{
+		HostedZoneIDs: []string{hostedZoneID},
+		ALBNames:      albNames,
+		ALBClient:     mockALB,
+		ELBClient:     &mockELB{},
+		EnableIPv6:    true,
+		LookupIP:      lookupIP,
+	})
+	dnsUpdater := newTestUpdater(lbAdapter, Config{})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	return dnsUpdater, mockR53
+}
+
+func internalIsDualStack(host string) ([]net.IP, error) {
+	if host == internalALBDnsName {
+		return []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")}, nil
+	}
+	return []net.IP{net.ParseIP("10.0.0.2")}, nil
+}
+
+func aaaaAliasRecordSet(host, lbDNSName string) *route53.ResourceRecordSet {
+	rrs := aliasRecordSet(host, lbDNSName)
+	rrs.Type = aws.String(route53.RRTypeAaaa)
+	return rrs
+}
+
+func TestCreatesAAAARecordsForDualStackLoadBalancers(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForIPv6(internalIsDualStack)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: aaaaAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "test-entry", Host: "foo.james.com", LbScheme: internalScheme},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestDoesNotCreateAAAARecordsForIPv4OnlyLoadBalancers(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForIPv6(internalIsDualStack)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		aaaaAliasRecordSet("foo.james.com.", externalALBDnsNameWithPeriod),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("DELETE"), ResourceRecordSet: aaaaAliasRecordSet("foo.james.com.", externalALBDnsNameWithPeriod)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: aliasRecordSet("foo.james.com.", externalALBDnsNameWithPeriod)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "test-entry", Host: "foo.james.com", LbScheme: externalScheme},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestDeletesAAAARecordsForRemovedHosts(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForIPv6(internalIsDualStack)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		aliasRecordSet("old.james.com.", internalALBDnsNameWithPeriod),
+		aaaaAliasRecordSet("old.james.com.", internalALBDnsNameWithPeriod),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("DELETE"), ResourceRecordSet: aliasRecordSet("old.james.com.", internalALBDnsNameWithPeriod)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: aaaaAliasRecordSet("old.james.com.", internalALBDnsNameWithPeriod)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func metricValue(c prometheus.Collector) float64 {
+	metricCh := make(chan prometheus.Metric, 1)
+	c.Collect(metricCh)
+	metric := <-metricCh
+	var metricVal dto.Metric
+	metric.Write(&metricVal)
+	if metricVal.Gauge != nil {
+		return *metricVal.Gauge.Value
+	}
+	if metricVal.Counter != nil {
+		return *metricVal.Counter.Value
+	}
+	return -1.0
+}
+
+func TestRecordChangeMetrics(t *testing.T) {
+	// given
+	dnsUpdater, mockR53, _, mockALB := setupForELB(albNames, "")
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod),
+		aliasRecordSet("old.james.com.", internalALBDnsNameWithPeriod),
+	}, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+
+	operations := []string{"created", "updated", "deleted", "skipped"}
+	before := make(map[string]float64)
+	for _, operation := range operations {
+		before[operation] = metricValue(recordChangesCount.WithLabelValues("route53", operation))
+	}
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "foo", Host: "foo.james.com", LbScheme: externalScheme},
+		{Name: "bar", Host: "bar.james.com", LbScheme: internalScheme},
+		{Name: "baz", Host: "baz.james.com", LbScheme: "unknown"},
+	}))
+
+	// then
+	for _, operation := range operations {
+		assert.Equal(t, 1.0, metricValue(recordChangesCount.WithLabelValues("route53", operation))-before[operation],
+			operation)
+	}
+	assert.Equal(t, 2.0, metricValue(ownedRecordsGauge.WithLabelValues("route53")))
+}
+
+func TestMetricsEventsAndNameAreLabelledWithTheProviderOfTheZoneClient(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		5*time.Minute, nil)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{ZoneClient: func(id string) r53.Route53Client {
+		return r53.NewInMemory("james.com")
+	}})
+	recorder := &fakeEventRecorder{}
+	dnsUpdater.events = recorder
+	foo := &v1beta1.Ingress{ObjectMeta: v1.ObjectMeta{Name: "foo"}}
+	before := metricValue(recordChangesCount.WithLabelValues("in-memory", "created"))
+
+	entries := controller.IngressEntries{{Name: "foo", Host: "foo.james.com", LbScheme: internalScheme, Ingress: foo}}
+
+	// when
+	assert.NoError(dnsUpdater.Start())
+	assert.NoError(dnsUpdater.Update(entries))
+	assert.NoError(dnsUpdater.Update(entries))
+
+	// then
+	assert.Equal("in-memory dns updater", dnsUpdater.String())
+	assert.Equal(1.0, metricValue(recordChangesCount.WithLabelValues("in-memory", "created"))-before)
+	assert.Equal(1.0, metricValue(ownedRecordsGauge.WithLabelValues("in-memory")))
+	assert.Equal([]recordedEvent{
+		{foo, "Normal", "DNSRecordCreated", "Created CNAME record foo.james.com. in in-memory"},
+	}, recorder.events)
+}
+func TestIngressAndRecordGauges(t *testing.T) {
+	// given
+	dnsUpdater, mockR53, _, mockALB := setupForELB(albNames, "")
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{}, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Namespace: "a", Name: "foo", Host: "foo.james.com", LbScheme: externalScheme},
+		{Namespace: "a", Name: "foo", Host: "foo2.james.com", LbScheme: externalScheme},
+		{Namespace: "b", Name: "bar", Host: "bar.james.com", LbScheme: internalScheme},
+		{Namespace: "b", Name: "baz", Host: "baz.james.com", LbScheme: "unknown"},
+		{Namespace: "c", Name: "other", Host: "foo.another.com", LbScheme: internalScheme},
+	}))
+
+	// then
+	assert.Equal(t, 4.0, metricValue(observedIngressesGauge))
+	assert.Equal(t, 3.0, metricValue(contributingHostsGauge))
+	assert.Equal(t, 3.0, metricValue(resultingRecordsGauge))
+}
+
+func TestDryRunDoesNotUpdateRecordSets(t *testing.T) {
+	// given
+	dnsUpdater, mockR53, _, mockALB := setupForELB(albNames, "")
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		aliasRecordSet("old.james.com.", internalALBDnsNameWithPeriod),
+	}, nil)
+	dnsUpdater.EnableDryRun()
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "foo", Host: "foo.james.com", LbScheme: externalScheme},
+	}))
+
+	// then
+	mockR53.AssertNotCalled(t, "UpdateRecordSets", mock.Anything)
+	assert.NoError(t, dnsUpdater.Health())
+}
+
+func TestWildcardHostsAreCreatedKeptAndDeleted(t *testing.T) {
+	// given
+	dnsUpdater, mockR53, _, mockALB := setupForELB(albNames, "")
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	mockR53.mockGetHostedZoneDomain()
+	entries := controller.IngressEntries{{Name: "team", Host: "*.team.james.com", LbScheme: externalScheme}}
+	wildcard := aliasRecordSet("*.team.james.com.", externalALBDnsNameWithPeriod)
+	assert.NoError(t, dnsUpdater.Start())
+
+	// when created
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: wildcard},
+	}).Return(nil)
+	assert.NoError(t, dnsUpdater.Update(entries))
+	mockR53.AssertExpectations(t)
+
+	// when unchanged, as the r53 client unescapes the \052 Route53 returns
+	mockR53.ExpectedCalls = nil
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{wildcard}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{}).Return(nil)
+	assert.NoError(t, dnsUpdater.Update(entries))
+	mockR53.AssertExpectations(t)
+
+	// when deleted
+	mockR53.ExpectedCalls = nil
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{wildcard}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("DELETE"), ResourceRecordSet: wildcard},
+	}).Return(nil)
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{}))
+	mockR53.AssertExpectations(t)
+}
+
+func TestChangesAreLoggedAtDebugLevel(t *testing.T) {
+	// given
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	log.SetLevel(log.DebugLevel)
+	defer log.SetLevel(log.InfoLevel)
+	defer log.SetOutput(os.Stderr)
+
+	dnsUpdater, mockR53, _, mockALB := setupForELB(albNames, "")
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		aliasRecordSet("moved.james.com.", internalALBDnsNameWithPeriod),
+		aliasRecordSet("old.james.com.", internalALBDnsNameWithPeriod),
+	}, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "foo", Host: "foo.james.com", LbScheme: externalScheme},
+		{Name: "moved", Host: "moved.james.com", LbScheme: externalScheme},
+	}))
+
+	// then
+	logged := out.String()
+	assert.Contains(t, logged, "Creating A foo.james.com. in james.com.: "+externalALBDnsNameWithPeriod)
+	assert.Contains(t, logged, "Updating A moved.james.com. in james.com.: "+internalALBDnsNameWithPeriod+" -> "+
+		externalALBDnsNameWithPeriod)
+	assert.Contains(t, logged, "Deleting A old.james.com. in james.com.: "+internalALBDnsNameWithPeriod)
+}
+
+func TestDrainDeletesAllManagedRecords(t *testing.T) {
+	// given
+	dnsUpdater, mockR53, _, mockALB := setupForELB(albNames, "")
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod),
+		aliasRecordSet("unmanaged.james.com.", unassocALBDnsNameWithPeriod),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("DELETE"), ResourceRecordSet: aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Drain())
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+const txtOwnerID = "cluster-a"
+
+func setupForOwnership(txtRecords []*route53.ResourceRecordSet) (*updater, *mockR53Client) {
+	mockALB := &mockALB{}
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	lbAdapter, _ := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{
+		HostedZoneIDs: []string{hostedZoneID},
+		ALBNames:      albNames,
+		ALBClient:     mockALB,
+		ELBClient:     &mockELB{},
+	})
+	dnsUpdater := newTestUpdater(lbAdapter, Config{TXTOwnerID: txtOwnerID})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.On("GetTXTRecords").Return(txtRecords, nil)
+	return dnsUpdater, mockR53
+}
+
+func ownershipRecordSet(host, owner string) *route53.ResourceRecordSet {
+	return &route53.ResourceRecordSet{
+		Name:            aws.String("_feed-owner." + host),
+		Type:            aws.String(route53.RRTypeTxt),
+		TTL:             aws.Int64(300),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("\"heritage=feed,feed/owner=" + owner + "\"")}},
+	}
+}
+
+func TestOnlyOwnedRecordsAreUpdated(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForOwnership([]*route53.ResourceRecordSet{
+		ownershipRecordSet("foo.james.com.", txtOwnerID),
+		ownershipRecordSet("bar.james.com.", "cluster-b"),
+	})
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod),
+		aliasRecordSet("bar.james.com.", internalALBDnsNameWithPeriod),
+		aliasRecordSet("manual.james.com.", internalALBDnsNameWithPeriod),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: aliasRecordSet("foo.james.com.", externalALBDnsNameWithPeriod)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: aliasRecordSet("new.james.com.", externalALBDnsNameWithPeriod)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: ownershipRecordSet("new.james.com.", txtOwnerID)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "foo", Host: "foo.james.com", LbScheme: externalScheme},
+		{Name: "bar", Host: "bar.james.com", LbScheme: externalScheme},
+		{Name: "manual", Host: "manual.james.com", LbScheme: externalScheme},
+		{Name: "new", Host: "new.james.com", LbScheme: externalScheme},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestOnlyOwnedRecordsAreDeleted(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForOwnership([]*route53.ResourceRecordSet{
+		ownershipRecordSet("old.james.com.", txtOwnerID),
+	})
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		aliasRecordSet("old.james.com.", internalALBDnsNameWithPeriod),
+		aliasRecordSet("manual.james.com.", internalALBDnsNameWithPeriod),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("DELETE"), ResourceRecordSet: aliasRecordSet("old.james.com.", internalALBDnsNameWithPeriod)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: ownershipRecordSet("old.james.com.", txtOwnerID)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func cnameRecordSet(host, target string, ttl int64) *route53.ResourceRecordSet {
+	return &route53.ResourceRecordSet{
+		Name:            aws.String(host),
+		Type:            aws.String(route53.RRTypeCname),
+		TTL:             aws.Int64(ttl),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(target)}},
+	}
+}
+
+func TestTTLAnnotationOverridesDefaultTTL(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForExplicitAddresses(map[string]string{internalScheme: internalAddressArgument})
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("unchanged.james.com.", internalAddressArgument, 30),
+		cnameRecordSet("old.james.com.", internalAddressArgument, 10),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("short.james.com.", internalAddressArgument, 30)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: cnameRecordSet("old.james.com.", internalAddressArgument, 10)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "short", Host: "short.james.com", LbScheme: internalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.TTLAnnotation: "30"})},
+		{Name: "unchanged", Host: "unchanged.james.com", LbScheme: internalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.TTLAnnotation: "30"})},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestInvalidTTLAnnotationUsesDefaultTTL(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForExplicitAddresses(map[string]string{internalScheme: internalAddressArgument})
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("invalid.james.com.", internalAddressArgument, 300)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "invalid", Host: "invalid.james.com", LbScheme: internalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.TTLAnnotation: "soon"})},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+// automaticTTLR53Client reports the TTL of the record sets of some hosts as set by the provider, as Cloudflare does
+// for proxied records.
+type automaticTTLR53Client struct {
+	*mockR53Client
+	automaticHosts map[string]bool
+}
+
+func (m *automaticTTLR53Client) HasAutomaticTTL(rrs *route53.ResourceRecordSet) bool {
+	return m.automaticHosts[aws.StringValue(rrs.Name)]
+}
+
+func TestRecordsWithAnAutomaticTTLAreOnlyUpdatedForTheirTarget(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForExplicitAddresses(map[string]string{internalScheme: internalAddressArgument})
+	dnsUpdater.zones[0].r53 = &automaticTTLR53Client{
+		mockR53Client:  mockR53,
+		automaticHosts: map[string]bool{"automatic.james.com.": true, "moved.james.com.": true},
+	}
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("automatic.james.com.", internalAddressArgument, 0),
+		cnameRecordSet("moved.james.com.", "old.james.com", 0),
+		cnameRecordSet("manual.james.com.", internalAddressArgument, 0),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("manual.james.com.", internalAddressArgument, 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("moved.james.com.", internalAddressArgument, 300)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "automatic", Host: "automatic.james.com", LbScheme: internalScheme},
+		{Name: "moved", Host: "moved.james.com", LbScheme: internalScheme},
+		{Name: "manual", Host: "manual.james.com", LbScheme: internalScheme},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+type recordedEvent struct {
+	ingress                    *v1beta1.Ingress
+	eventType, reason, message string
+}
+
+type fakeEventRecorder struct {
+	events []recordedEvent
+}
+
+func (r *fakeEventRecorder) Event(ingress *v1beta1.Ingress, eventType, reason, message string) {
+	r.events = append(r.events, recordedEvent{ingress, eventType, reason, message})
+}
+
+func setupForEvents() (*updater, *mockR53Client, *fakeEventRecorder) {
+	dnsUpdater, mockR53, _, mockALB := setupForELB(albNames, "")
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	mockR53.mockGetHostedZoneDomain()
+	recorder := &fakeEventRecorder{}
+	dnsUpdater.events = recorder
+	return dnsUpdater, mockR53, recorder
+}
+
+func TestEventsAreRecordedOnIngressesWithUnsupportedAnnotations(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	dnsUpdater, mockR53, recorder := setupForEvents()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{}, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+	foo := ingressWithAnnotations(map[string]string{adapter.TTLAnnotation: "30"})
+	entries := controller.IngressEntries{{Name: "foo", Host: "foo.james.com", LbScheme: internalScheme, Ingress: foo}}
+
+	// when
+	assert.NoError(dnsUpdater.Start())
+	assert.NoError(dnsUpdater.Update(entries))
+	assert.NoError(dnsUpdater.Update(entries))
+
+	// then
+	var unsupported []recordedEvent
+	for _, event := range recorder.events {
+		if event.reason == "DNSAnnotationUnsupported" {
+			unsupported = append(unsupported, event)
+		}
+	}
+	assert.Equal([]recordedEvent{{foo, "Warning", "DNSAnnotationUnsupported",
+		"sky.uk/dns-ttl annotation isn't supported by the route53 provider with the AWS load balancer frontend"}},
+		unsupported, "should only record the event the first time")
+}
+
+func TestCheckAnnotationsReturnsUnsupportedAnnotationErrors(t *testing.T) {
+	errs := adapter.CheckAnnotations(adapter.NewStaticIPAdapter(nil, time.Minute), "route53", map[string]string{
+		adapter.CloudFrontDistributionAnnotation: "E1",
+		adapter.TTLAnnotation:                    "30",
+	})
+
+	assert.Equal(t, []error{&adapter.UnsupportedAnnotationError{
+		Annotation: adapter.CloudFrontDistributionAnnotation,
+		Provider:   "route53",
+		Frontend:   "static IP",
+	}}, errs)
+}
+
+func TestEventsAreRecordedOnIngressesForRecordChanges(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	dnsUpdater, mockR53, recorder := setupForEvents()
+	foo := &v1beta1.Ingress{ObjectMeta: v1.ObjectMeta{Name: "foo"}}
+	bar := &v1beta1.Ingress{ObjectMeta: v1.ObjectMeta{Name: "bar"}}
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		aliasRecordSet("bar.james.com.", externalALBDnsNameWithPeriod),
+		aliasRecordSet("old.james.com.", internalALBDnsNameWithPeriod),
+	}, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+
+	// when
+	assert.NoError(dnsUpdater.Start())
+	assert.NoError(dnsUpdater.Update(controller.IngressEntries{
+		{Name: "foo", Host: "foo.james.com", Path: "/a", LbScheme: internalScheme, Ingress: foo},
+		{Name: "foo", Host: "foo.james.com", Path: "/b", LbScheme: internalScheme, Ingress: foo},
+		{Name: "bar", Host: "bar.james.com", LbScheme: internalScheme, Ingress: bar},
+	}))
+
+	// then
+	assert.Equal([]recordedEvent{
+		{bar, "Normal", "DNSRecordUpdated", "Updated A record bar.james.com. in route53"},
+		{foo, "Normal", "DNSRecordCreated", "Created A record foo.james.com. in route53"},
+	}, recorder.events, "should record one event per ingress, and none for the removed old.james.com")
+}
+
+func TestEventsAreRecordedOnIngressesWhenRecordChangesFail(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	dnsUpdater, mockR53, recorder := setupForEvents()
+	foo := &v1beta1.Ingress{ObjectMeta: v1.ObjectMeta{Name: "foo"}}
+	mockR53.mockGetRecords(nil, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(errors.New("throttled"))
+
+	// when
+	assert.NoError(dnsUpdater.Start())
+	assert.Error(dnsUpdater.Update(controller.IngressEntries{
+		{Name: "foo", Host: "foo.james.com", LbScheme: internalScheme, Ingress: foo},
+	}))
+
+	// then
+	assert.Equal([]recordedEvent{
+		{foo, "Warning", "DNSUpdateFailed", "Unable to update A records for foo.james.com. in route53: throttled"},
+	}, recorder.events)
+}
+
+// rejectingR53Client rejects changes to a host, as Route53 does for invalid changes.
+type rejectingR53Client struct {
+	*mockR53Client
+	rejectedHost string
+	applied      []*route53.Change
+}
+
+func (m *rejectingR53Client) UpdateRecordSets(changes []*route53.Change) error {
+	var rejected []r53.RejectedChange
+	for _, change := range changes {
+		if aws.StringValue(change.ResourceRecordSet.Name) == m.rejectedHost {
+			rejected = append(rejected, r53.RejectedChange{Change: change, Err: errors.New("invalid name")})
+		} else {
+			m.applied = append(m.applied, change)
+		}
+	}
+	if len(rejected) > 0 {
+		return &r53.RejectedChangesError{Rejected: rejected}
+	}
+	return nil
+}
+
+func TestRejectedChangesDoNotFailTheUpdate(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	dnsUpdater, mockR53, recorder := setupForEvents()
+	r53Client := &rejectingR53Client{mockR53Client: mockR53, rejectedHost: "bad.james.com."}
+	dnsUpdater.zones[0].r53 = r53Client
+	bad := &v1beta1.Ingress{ObjectMeta: v1.ObjectMeta{Name: "bad"}}
+	good := &v1beta1.Ingress{ObjectMeta: v1.ObjectMeta{Name: "good"}}
+	mockR53.mockGetRecords(nil, nil)
+
+	// when
+	assert.NoError(dnsUpdater.Start())
+	err := dnsUpdater.Update(controller.IngressEntries{
+		{Name: "bad", Host: "bad.james.com", LbScheme: internalScheme, Ingress: bad},
+		{Name: "good", Host: "good.james.com", LbScheme: internalScheme, Ingress: good},
+	})
+
+	// then
+	assert.NoError(err)
+	assert.Equal([]*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: aliasRecordSet("good.james.com.", internalALBDnsNameWithPeriod)},
+	}, r53Client.applied)
+	assert.Equal(1.0, metricValue(rejectedChangesGauge), "should be degraded")
+	assert.Equal([]recordedEvent{
+		{bad, "Warning", "DNSUpdateFailed", "Unable to update A records for bad.james.com. in route53: invalid name"},
+		{good, "Normal", "DNSRecordCreated", "Created A record good.james.com. in route53"},
+	}, recorder.events)
+
+	// when
+	r53Client.rejectedHost = ""
+	assert.NoError(dnsUpdater.Update(controller.IngressEntries{
+		{Name: "good", Host: "good.james.com", LbScheme: internalScheme, Ingress: good},
+	}))
+
+	// then
+	assert.Equal(0.0, metricValue(rejectedChangesGauge), "should no longer be degraded")
+}
+
+func TestCNAMERecordsHaveTheTTLOfTheirScheme(t *testing.T) {
+	// given
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{
+		internalScheme: internalAddressArgument,
+		externalScheme: externalAddressArgument,
+	}, 5*time.Minute, map[string]time.Duration{internalScheme: time.Hour})
+	dnsUpdater := newTestUpdater(lbAdapter, Config{})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("internal.james.com.", internalAddressArgument, 300),
+		cnameRecordSet("external.james.com.", externalAddressArgument, 300),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("internal.james.com.", internalAddressArgument, 3600)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "internal", Host: "internal.james.com", LbScheme: internalScheme},
+		{Name: "external", Host: "external.james.com", LbScheme: externalScheme},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func ipRecordSet(host string, ttl int64, ips ...string) *route53.ResourceRecordSet {
+	rrs := &route53.ResourceRecordSet{
+		Name: aws.String(host),
+		Type: aws.String(route53.RRTypeA),
+		TTL:  aws.Int64(ttl),
+	}
+	for _, ip := range ips {
+		rrs.ResourceRecords = append(rrs.ResourceRecords, &route53.ResourceRecord{Value: aws.String(ip)})
+	}
+	return rrs
+}
+
+func TestARecordsAreCreatedForStaticIPs(t *testing.T) {
+	// given
+	lbAdapter := adapter.NewStaticIPAdapter(map[string][]string{
+		internalScheme: {"10.0.0.2", "10.0.0.1"},
+		externalScheme: {"192.0.2.1"},
+	}, 5*time.Minute)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		ipRecordSet("unchanged.james.com.", 300, "10.0.0.2", "10.0.0.1"),
+		ipRecordSet("old.james.com.", 300, "192.0.2.1"),
+		ipRecordSet("unmanaged.james.com.", 300, "203.0.113.1"),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: ipRecordSet("new.james.com.", 300, "192.0.2.1")},
+		{Action: aws.String("DELETE"), ResourceRecordSet: ipRecordSet("old.james.com.", 300, "192.0.2.1")},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "unchanged", Host: "unchanged.james.com", LbScheme: internalScheme},
+		{Name: "new", Host: "new.james.com", LbScheme: externalScheme},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestHostsNotMatchingTheHostFilterAreIgnored(t *testing.T) {
+	// given
+	dnsUpdater, mockR53, _, mockALB := setupForELB(albNames, "")
+	dnsUpdater.hostFilter = regexp.MustCompile(`\.dev\.james\.com$`)
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		aliasRecordSet("old.dev.james.com.", internalALBDnsNameWithPeriod),
+		aliasRecordSet("old.james.com.", internalALBDnsNameWithPeriod),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: aliasRecordSet("foo.dev.james.com.", internalALBDnsNameWithPeriod)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: aliasRecordSet("old.dev.james.com.", internalALBDnsNameWithPeriod)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "foo", Host: "foo.dev.james.com", LbScheme: internalScheme},
+		{Name: "bar", Host: "bar.james.com", LbScheme: internalScheme},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestOwnershipRecordsOfFilteredHostsAreNotDeleted(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForOwnership([]*route53.ResourceRecordSet{
+		ownershipRecordSet("foo.dev.james.com.", txtOwnerID),
+		ownershipRecordSet("bar.james.com.", txtOwnerID),
+	})
+	dnsUpdater.hostFilter = regexp.MustCompile(`\.dev\.james\.com$`)
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		aliasRecordSet("foo.dev.james.com.", internalALBDnsNameWithPeriod),
+		aliasRecordSet("bar.james.com.", internalALBDnsNameWithPeriod),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "foo", Host: "foo.dev.james.com", LbScheme: internalScheme},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+type mockCloudFront struct {
+	mock.Mock
+}
+
+func (m *mockCloudFront) ListDistributions(input *cloudfront.ListDistributionsInput) (*cloudfront.ListDistributionsOutput, error) {
+	args := m.Called(input)
+	return args.Get(0).(*cloudfront.ListDistributionsOutput), args.Error(1)
+}
+
+func (m *mockCloudFront) mockListDistributions(marker, nextMarker *string, distributions map[string]string) {
+	var items []*cloudfront.DistributionSummary
+	for id, domain := range distributions {
+		items = append(items, &cloudfront.DistributionSummary{Id: aws.String(id), DomainName: aws.String(domain)})
+	}
+
+	m.On("ListDistributions", &cloudfront.ListDistributionsInput{Marker: marker}).Return(
+		&cloudfront.ListDistributionsOutput{DistributionList: &cloudfront.DistributionList{
+			Items:       items,
+			IsTruncated: aws.Bool(nextMarker != nil),
+			NextMarker:  nextMarker,
+		}}, nil)
+}
+
+func setupForCloudFront(recordType string) (*updater, *mockR53Client) {
+	mockALB := &mockALB{}
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	mockCloudFront := &mockCloudFront{}
+	mockCloudFront.mockListDistributions(nil, aws.String("page-2"), map[string]string{"E1": "d1.cloudfront.net"})
+	mockCloudFront.mockListDistributions(aws.String("page-2"), nil, map[string]string{"E2": "d2.cloudfront.net"})
+
+	lbAdapter, _ := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{
+		HostedZoneIDs:    []string{hostedZoneID},
+		ALBNames:         albNames,
+		ALBClient:        mockALB,
+		ELBClient:        &mockELB{},
+		RecordType:       recordType,
+		CNAMETTL:         time.Minute,
+		EnableCloudFront: true,
+		CloudFrontClient: mockCloudFront,
+	})
+	dnsUpdater := newTestUpdater(lbAdapter, Config{})
+
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	return dnsUpdater, mockR53
+}
+
+func cloudFrontAliasRecordSet(host, distributionDNSName string) *route53.ResourceRecordSet {
+	rrs := aliasRecordSet(host, distributionDNSName)
+	rrs.AliasTarget.HostedZoneId = aws.String("Z2FDTNDATAQYW2")
+	return rrs
+}
+
+func TestHostsAreAliasedToCloudFrontDistributions(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForCloudFront(adapter.AliasRecordType)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		aliasRecordSet("moved.james.com.", externalALBDnsNameWithPeriod),
+		cloudFrontAliasRecordSet("old.james.com.", "d1.cloudfront.net."),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cloudFrontAliasRecordSet("cdn.james.com.", "d2.cloudfront.net.")},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: aliasRecordSet("foo.james.com.", externalALBDnsNameWithPeriod)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cloudFrontAliasRecordSet("moved.james.com.", "d1.cloudfront.net.")},
+		{Action: aws.String("DELETE"), ResourceRecordSet: cloudFrontAliasRecordSet("old.james.com.", "d1.cloudfront.net.")},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "cdn", Host: "cdn.james.com", LbScheme: externalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.CloudFrontDistributionAnnotation: "E2"})},
+		{Name: "foo", Host: "foo.james.com", LbScheme: externalScheme},
+		{Name: "moved", Host: "moved.james.com", LbScheme: externalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.CloudFrontDistributionAnnotation: "E1"})},
+		{Name: "unknown", Host: "unknown.james.com", LbScheme: externalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.CloudFrontDistributionAnnotation: "E3"})},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestCloudFrontAliasesCoexistWithCNAMERecords(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForCloudFront(adapter.CNAMERecordType)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cloudFrontAliasRecordSet("cdn.james.com.", "d1.cloudfront.net."),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("foo.james.com.", externalALBDnsNameWithPeriod, 60)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "cdn", Host: "cdn.james.com", LbScheme: externalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.CloudFrontDistributionAnnotation: "E1"})},
+		{Name: "foo", Host: "foo.james.com", LbScheme: externalScheme},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestCloudFrontAliasesUseTheHostedZoneOfThePartition(t *testing.T) {
+	// given
+	mockALB := &mockALB{}
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	mockCloudFront := &mockCloudFront{}
+	mockCloudFront.mockListDistributions(nil, nil, map[string]string{"E1": "d1.cloudfront.cn"})
+	config := &adapter.AWSAdapterConfig{
+		Region:           "cn-north-1",
+		Partition:        awspartition.China,
+		HostedZoneIDs:    []string{hostedZoneID},
+		ALBNames:         albNames,
+		ALBClient:        mockALB,
+		ELBClient:        &mockELB{},
+		EnableCloudFront: true,
+		CloudFrontClient: mockCloudFront,
+	}
+	lbAdapter, err := adapter.NewAWSAdapter(config)
+	assert.NoError(t, err)
+
+	// when
+	_, initErr := lbAdapter.Initialise()
+	config.Partition = awspartition.GovCloud
+	_, govCloudErr := adapter.NewAWSAdapter(config)
+
+	// then
+	assert.NoError(t, initErr)
+	assert.Equal(t, map[string]adapter.DNSDetails{
+		"E1": {DNSName: "d1.cloudfront.cn.", HostedZoneID: "Z3RFFRIM2A3IF5"},
+	}, lbAdapter.(adapter.CloudFrontAdapter).CloudFrontDistributions())
+	assert.EqualError(t, govCloudErr, "the aws-us-gov partition has no CloudFront")
+}
+
+func txtRecordSet(name string, values ...string) *route53.ResourceRecordSet {
+	rrs := &route53.ResourceRecordSet{
+		Name: aws.String(name),
+		Type: aws.String(route53.RRTypeTxt),
+		TTL:  aws.Int64(60),
+	}
+	for _, value := range values {
+		rrs.ResourceRecords = append(rrs.ResourceRecords, &route53.ResourceRecord{Value: aws.String(value)})
+	}
+	return rrs
+}
+
+func setupForTXTRecords(config Config, txtRecords []*route53.ResourceRecordSet) (*updater, *mockR53Client) {
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		5*time.Minute, nil)
+	config.ManageTXTRecords = true
+	dnsUpdater := newTestUpdater(lbAdapter, config)
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("foo.james.com.", internalAddressArgument, 300),
+	}, nil)
+	mockR53.On("GetTXTRecords").Return(txtRecords, nil)
+	return dnsUpdater, mockR53
+}
+
+func TestTXTRecordsAreManagedFromAnnotations(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForTXTRecords(Config{}, []*route53.ResourceRecordSet{
+		txtRecordSet("_acme-challenge.foo.james.com.", `"old-token"`, `"heritage=feed"`),
+		txtRecordSet("_acme-challenge.removed.james.com.", `"token"`, `"heritage=feed"`),
+		txtRecordSet("_acme-challenge.unchanged.james.com.", `"token"`, `"heritage=feed"`),
+		txtRecordSet("_acme-challenge.manual.james.com.", `"manual-token"`),
+		txtRecordSet("james.com.", `"v=spf1 -all"`),
+	})
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: txtRecordSet("_acme-challenge.foo.james.com.",
+			`"heritage=feed"`, `"new-token"`, `"wildcard-token"`)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: txtRecordSet("_acme-challenge.removed.james.com.",
+			`"token"`, `"heritage=feed"`)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "foo", Host: "foo.james.com", LbScheme: internalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.TXTAnnotation: "_acme-challenge.foo.james.com=new-token," +
+				"_acme-challenge.foo.james.com=wildcard-token,_acme-challenge.unchanged.james.com=token," +
+				"_acme-challenge.manual.james.com=token,_acme-challenge.foo.other.com=token,invalid"})},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestTXTRecordsAreMarkedWithTheOwnerID(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForTXTRecords(Config{TXTOwnerID: "cluster-a"}, []*route53.ResourceRecordSet{
+		txtRecordSet("_feed-owner.foo.james.com.", `"heritage=feed,feed/owner=cluster-a"`),
+		txtRecordSet("_acme-challenge.other.james.com.", `"token"`, `"heritage=feed,feed/owner=cluster-b"`),
+	})
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: txtRecordSet("_acme-challenge.foo.james.com.",
+			`"heritage=feed,feed/owner=cluster-a"`, `"token"`)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "foo", Host: "foo.james.com", LbScheme: internalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.TXTAnnotation: "_acme-challenge.foo.james.com=token"})},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestExcludedIngressesAreIgnored(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	dnsUpdater, mockR53, _, mockALB := setupForELB(albNames, "")
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		aliasRecordSet("excluded.james.com.", internalALBDnsNameWithPeriod),
+		aliasRecordSet("old.james.com.", internalALBDnsNameWithPeriod),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: aliasRecordSet("old.james.com.", internalALBDnsNameWithPeriod)},
+	}).Return(nil).Once()
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("DELETE"), ResourceRecordSet: aliasRecordSet("old.james.com.", internalALBDnsNameWithPeriod)},
+	}).Return(nil).Once()
+	excluded := ingressWithAnnotations(map[string]string{adapter.ExcludeAnnotation: "true"})
+	excluded.Name = "excluded"
+	before := metricValue(excludedCount)
+
+	// when
+	assert.NoError(dnsUpdater.Start())
+	assert.NoError(dnsUpdater.Update(controller.IngressEntries{
+		{Name: "excluded", Host: "excluded.james.com", LbScheme: externalScheme, Ingress: excluded},
+		{Name: "excluded", Host: "excluded.james.com", Path: "/other", LbScheme: externalScheme, Ingress: excluded},
+		{Name: "shared", Host: "excluded.james.com", LbScheme: externalScheme},
+		{Name: "foo", Host: "foo.james.com", LbScheme: internalScheme},
+	}))
+	assert.NoError(dnsUpdater.Drain())
+
+	// then
+	mockR53.AssertExpectations(t)
+	assert.Equal(1.0, metricValue(excludedCount)-before)
+}
+
+func TestAnnotationsAreParsedTheSameForEveryAdapter(t *testing.T) {
+	assert := assert.New(t)
+
+	annotations, warnings := adapter.ParseAnnotations(map[string]string{
+		adapter.TTLAnnotation:           "30",
+		adapter.WeightAnnotation:        "300",
+		adapter.FailoverRoleAnnotation:  "Primary",
+		adapter.RoutingPolicyAnnotation: "geo",
+		adapter.ExcludeAnnotation:       "true",
+	})
+
+	assert.Equal(adapter.RecordAnnotations{
+		TTL:          30 * time.Second,
+		Weighted:     true,
+		Weight:       adapter.DefaultWeight,
+		Failover:     true,
+		FailoverRole: "PRIMARY",
+		Exclude:      true,
+	}, annotations)
+	assert.Equal([]string{
+		"invalid sky.uk/dns-weight annotation: 300. Using default of 100",
+		`unsupported sky.uk/dns-routing-policy annotation: "geo", ignoring`,
+	}, warnings)
+}
+
+func TestZonesAnnotationIgnoresInvalidZones(t *testing.T) {
+	annotations, warnings := adapter.ParseAnnotations(map[string]string{
+		adapter.ZonesAnnotation: "external,private,External",
+	})
+
+	assert.Equal(t, []string{adapter.ExternalZone}, annotations.Zones)
+	assert.Equal(t, []string{`invalid zone in sky.uk/dns-zones annotation: "private", must be internal or external`},
+		warnings)
+}
+
+func TestHealthCheckAnnotationsDefaultMissingAndInvalidValues(t *testing.T) {
+	annotations, warnings := adapter.ParseAnnotations(map[string]string{
+		adapter.HealthCheckPortAnnotation:     "443",
+		adapter.HealthCheckIntervalAnnotation: "60",
+	})
+
+	assert.Equal(t, adapter.RecordAnnotations{
+		HealthCheck:         true,
+		HealthCheckPath:     adapter.DefaultHealthCheckPath,
+		HealthCheckPort:     443,
+		HealthCheckInterval: adapter.DefaultHealthCheckInterval,
+	}, annotations)
+	assert.Equal(t, []string{"invalid sky.uk/dns-healthcheck-interval annotation: 60, must be 10 or 30. Using " +
+		"default of 30"}, warnings)
+}
+
+func TestAdaptersDeclareTheAnnotationsTheySupport(t *testing.T) {
+	assert := assert.New(t)
+	annotations := map[string]string{
+		adapter.CloudFrontDistributionAnnotation: "E1",
+		adapter.RoutingPolicyAnnotation:          "latency",
+		adapter.TTLAnnotation:                    "30",
+		adapter.WeightAnnotation:                 "10",
+	}
+	aliases, _ := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{ALBClient: &mockALB{}, ELBClient: &mockELB{}})
+	cnames, _ := adapter.NewAWSAdapter(&adapter.AWSAdapterConfig{ALBClient: &mockALB{}, ELBClient: &mockELB{},
+		RecordType: adapter.CNAMERecordType, EnableCloudFront: true, CloudFrontClient: &mockCloudFront{}})
+
+	assert.Equal([]string{adapter.CloudFrontDistributionAnnotation, adapter.TTLAnnotation},
+		adapter.UnsupportedAnnotations(aliases, annotations))
+	assert.Empty(adapter.UnsupportedAnnotations(cnames, annotations))
+	assert.Equal([]string{adapter.CloudFrontDistributionAnnotation, adapter.RoutingPolicyAnnotation},
+		adapter.UnsupportedAnnotations(adapter.NewStaticHostnameAdapter(nil, time.Minute, nil), annotations))
+}
+
+func TestNoDeleteSkipsDeletesButStillReplacesRecords(t *testing.T) {
+	// given
+	dnsUpdater, mockR53, _, mockALB := setupForELB(albNames, "")
+	dnsUpdater.noDelete = true
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod),
+		aliasRecordSet("bar.james.com.", internalALBDnsNameWithPeriod),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{
+			Action:            aws.String("DELETE"),
+			ResourceRecordSet: aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod),
+		},
+		{
+			Action:            aws.String("UPSERT"),
+			ResourceRecordSet: weightedAliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod, 20),
+		},
+	}).Return(nil)
+	before := metricValue(skippedDeletesCount)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	err := dnsUpdater.Update(controller.IngressEntries{{Name: "blue", Host: "foo.james.com",
+		LbScheme: internalScheme, Ingress: ingressWithAnnotations(map[string]string{adapter.WeightAnnotation: "20"})}})
+
+	// then
+	assert.NoError(t, err)
+	mockR53.AssertExpectations(t)
+	assert.Equal(t, 1.0, metricValue(skippedDeletesCount)-before)
+}
+
+func TestRecordsAreOnlyDeletedAfterTheGracePeriod(t *testing.T) {
+	// given
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		5*time.Minute, nil)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{DeleteGracePeriod: time.Minute})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	now := time.Now()
+	dnsUpdater.orphans.now = func() time.Time { return now }
+	record := cnameRecordSet("foo.james.com.", internalAddressArgument, 300)
+	entries := controller.IngressEntries{{Name: "foo", Host: "foo.james.com", LbScheme: internalScheme}}
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{record}, nil)
+	assert.NoError(t, dnsUpdater.Start())
+
+	update := func(entries controller.IngressEntries, expected []*route53.Change) {
+		mockR53.On("UpdateRecordSets", expected).Return(nil).Once()
+		assert.NoError(t, dnsUpdater.Update(entries))
+		mockR53.AssertExpectations(t)
+	}
+
+	// when the ingress is removed, then the record is kept within the grace period
+	update(controller.IngressEntries{}, []*route53.Change{})
+	now = now.Add(50 * time.Second)
+	update(controller.IngressEntries{}, []*route53.Change{})
+
+	// when the ingress comes back, the grace period starts again when it's next removed
+	update(entries, []*route53.Change{})
+	now = now.Add(50 * time.Second)
+	update(controller.IngressEntries{}, []*route53.Change{})
+	now = now.Add(50 * time.Second)
+	update(controller.IngressEntries{}, []*route53.Change{})
+
+	// when the record has had no ingress for the grace period, it's deleted
+	now = now.Add(10 * time.Second)
+	update(controller.IngressEntries{}, []*route53.Change{{Action: aws.String("DELETE"), ResourceRecordSet: record}})
+}
+
+func TestDrainingDeletesRecordsWithinTheGracePeriod(t *testing.T) {
+	// given
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		5*time.Minute, nil)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{DeleteGracePeriod: time.Hour})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	record := cnameRecordSet("foo.james.com.", internalAddressArgument, 300)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{record}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{{Action: aws.String("DELETE"), ResourceRecordSet: record}}).
+		Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Drain())
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func ingressWithStatus(hostnames []string, ips []string) *v1beta1.Ingress {
+	ingress := &v1beta1.Ingress{}
+	for _, hostname := range hostnames {
+		ingress.Status.LoadBalancer.Ingress = append(ingress.Status.LoadBalancer.Ingress,
+			v1.LoadBalancerIngress{Hostname: hostname})
+	}
+	for _, ip := range ips {
+		ingress.Status.LoadBalancer.Ingress = append(ingress.Status.LoadBalancer.Ingress,
+			v1.LoadBalancerIngress{IP: ip})
+	}
+	return ingress
+}
+
+func TestHostsPointAtTheLoadBalancerInTheIngressStatus(t *testing.T) {
+	// given
+	dnsUpdater := newTestUpdater(adapter.NewIngressStatusAdapter(5*time.Minute), Config{})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("unchanged.james.com.", "lb.example.com", 300),
+		cnameRecordSet("moved.james.com.", "old-lb.example.com", 300),
+		cnameRecordSet("not-managed.james.com.", "other.example.com", 300),
+	}, nil)
+	entries := controller.IngressEntries{
+		{Name: "unchanged", Host: "unchanged.james.com", Ingress: ingressWithStatus([]string{"lb.example.com"}, nil)},
+		{Name: "moved", Host: "moved.james.com", Ingress: ingressWithStatus([]string{"new-lb.example.com"}, nil)},
+		{Name: "ips", Host: "ips.james.com", Ingress: ingressWithStatus(nil, []string{"10.0.0.2", "10.0.0.1"})},
+		{Name: "hostname-first", Host: "both.james.com",
+			Ingress: ingressWithStatus([]string{"lb.example.com"}, []string{"10.0.0.1"})},
+		{Name: "no-status", Host: "no-status.james.com", Ingress: ingressWithStatus(nil, nil)},
+	}
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("both.james.com.", "lb.example.com", 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name: aws.String("ips.james.com."),
+			Type: aws.String(route53.RRTypeA),
+			TTL:  aws.Int64(300),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.1")},
+				{Value: aws.String("10.0.0.2")},
+			},
+		}},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: cnameRecordSet("moved.james.com.", "new-lb.example.com", 300)},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	err := dnsUpdater.Update(entries)
+
+	// then
+	assert.NoError(t, err)
+	mockR53.AssertExpectations(t)
+}
+
+func TestRecordsForLoadBalancersSeenInIngressStatusesAreDeleted(t *testing.T) {
+	// given
+	dnsUpdater := newTestUpdater(adapter.NewIngressStatusAdapter(5*time.Minute), Config{})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	record := cnameRecordSet("foo.james.com.", "lb.example.com", 300)
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{record}, nil)
+	assert.NoError(t, dnsUpdater.Start())
+	mockR53.On("UpdateRecordSets", []*route53.Change{}).Return(nil).Once()
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "foo", Host: "foo.james.com", Ingress: ingressWithStatus([]string{"lb.example.com"}, nil)},
+	}))
+
+	// when
+	mockR53.On("UpdateRecordSets", []*route53.Change{{Action: aws.String("DELETE"), ResourceRecordSet: record}}).
+		Return(nil).Once()
+	err := dnsUpdater.Update(controller.IngressEntries{})
+
+	// then
+	assert.NoError(t, err)
+	mockR53.AssertExpectations(t)
+}
+
+func TestRecordsAreTheDesiredRecordsOfTheLastUpdate(t *testing.T) {
+	// given
+	dnsUpdater, mockR53 := setupForExplicitAddresses(map[string]string{
+		internalScheme: internalAddressArgument,
+		externalScheme: externalAddressArgument,
+	})
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("unchanged.james.com.", internalAddressArgument, 300),
+		cnameRecordSet("deleted.james.com.", internalAddressArgument, 300),
+	}, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+	assert.NoError(t, dnsUpdater.Start())
+	assert.Empty(t, dnsUpdater.Records())
+
+	// when
+	err := dnsUpdater.Update(controller.IngressEntries{
+		{Name: "unchanged", Host: "unchanged.james.com", LbScheme: internalScheme},
+		{Name: "new", Host: "new.james.com", LbScheme: externalScheme},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []Record{
+		{Zone: "james.com.", Host: "new.james.com.", Type: route53.RRTypeCname, Target: externalAddressArgument,
+			TTL: 300},
+		{Zone: "james.com.", Host: "unchanged.james.com.", Type: route53.RRTypeCname, Target: internalAddressArgument,
+			TTL: 300},
+	}, dnsUpdater.Records())
+}
+
+func TestRecordsOfUnmanagedTypesAreNeverChanged(t *testing.T) {
+	// given
+	lbAdapter := adapter.NewStaticIPAdapter(map[string][]string{internalScheme: {"10.0.0.1"}}, 5*time.Minute)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{ManagedRecordTypes: []string{"cname"}})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		ipRecordSet("old.james.com.", 300, "10.0.0.1"),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(controller.IngressEntries{
+		{Name: "new", Host: "new.james.com", LbScheme: internalScheme},
+	}))
+
+	// then
+	mockR53.AssertExpectations(t)
+}
+
+func TestChangesAreSentToTheWebhook(t *testing.T) {
+	// given
+	var bodies [][]byte
+	var signatures []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, body)
+		signatures = append(signatures, r.Header.Get(WebhookSignatureHeader))
+	}))
+	defer server.Close()
+
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		5*time.Minute, nil)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{ChangeWebhookURL: server.URL, ChangeWebhookSecret: "secret"})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("old.james.com.", internalAddressArgument, 300),
+	}, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+	entries := controller.IngressEntries{{Name: "new", Host: "new.james.com", LbScheme: internalScheme}}
+	assert.NoError(t, dnsUpdater.Start())
+
+	// when
+	assert.NoError(t, dnsUpdater.Update(entries))
+	mockR53.ExpectedCalls = nil
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("new.james.com.", internalAddressArgument, 300),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{}).Return(nil)
+	assert.NoError(t, dnsUpdater.Update(entries))
+
+	// then
+	assert.Len(t, bodies, 1, "only updates with changes are notified")
+	assert.JSONEq(t, `{
+		"created": 1,
+		"updated": 0,
+		"deleted": 1,
+		"records": [
+			{"zone": "james.com.", "operation": "created", "name": "new.james.com.", "type": "CNAME",
+				"value": "ha-ingress-internal"},
+			{"zone": "james.com.", "operation": "deleted", "name": "old.james.com.", "type": "CNAME",
+				"value": "ha-ingress-internal"}
+		]
+	}`, string(bodies[0]))
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(bodies[0])
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), signatures[0])
+}
+
+func TestWebhookFailuresDontFailTheUpdate(t *testing.T) {
+	// given
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		5*time.Minute, nil)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{ChangeWebhookURL: server.URL})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{}, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+	assert.NoError(t, dnsUpdater.Start())
+
+	// when
+	err := dnsUpdater.Update(controller.IngressEntries{{Name: "new", Host: "new.james.com", LbScheme: internalScheme}})
+
+	// then
+	assert.NoError(t, err)
+}
+
+// hetznerDNSCapabilities are those of Hetzner DNS, which has no routing policies and a minimum TTL of a minute.
+var hetznerDNSCapabilities = r53.Capabilities{Provider: "hetzner", IPv6: true, TXT: true, MinTTL: 60,
+	MaxTTL: r53.MaxTTL}
+
+// declaringR53Client declares the capabilities of another DNS provider.
+type declaringR53Client struct {
+	r53.Route53Client
+	capabilities r53.Capabilities
+}
+
+func (c *declaringR53Client) Capabilities() r53.Capabilities {
+	return c.capabilities
+}
+
+func TestCapabilitiesAreDeclaredByTheProviderAndLimitTheHonouredAnnotations(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		5*time.Minute, nil)
+	route53Updater := newTestUpdater(lbAdapter, Config{ManageTXTRecords: true})
+	hetznerUpdater := newTestUpdater(lbAdapter, Config{ManageTXTRecords: true, ZoneClient: func(id string) r53.Route53Client {
+		return &declaringR53Client{Route53Client: r53.NewInMemory(id), capabilities: hetznerDNSCapabilities}
+	}})
+	unknownUpdater := newTestUpdater(lbAdapter, Config{})
+	unknownUpdater.zones[0].r53 = struct{ r53.Route53Client }{&mockR53Client{}}
+
+	// when
+	route53Capabilities := route53Updater.Capabilities()
+	hetznerCapabilities := hetznerUpdater.Capabilities()
+	unknownCapabilities := unknownUpdater.Capabilities()
+
+	// then
+	assert.Equal(Capabilities{
+		Capabilities: r53.Route53Capabilities,
+		Frontend:     "static hostname",
+		Annotations: []string{adapter.FailoverRoleAnnotation, adapter.GeoAnnotation, adapter.TTLAnnotation,
+			adapter.TXTAnnotation, adapter.WeightAnnotation, adapter.ZonesAnnotation, adapter.ExcludeAnnotation,
+			adapter.LBNameAnnotation},
+	}, route53Capabilities, "health checks aren't managed")
+	assert.Equal(Capabilities{
+		Capabilities: hetznerDNSCapabilities,
+		Frontend:     "static hostname",
+		Annotations: []string{adapter.TTLAnnotation, adapter.TXTAnnotation, adapter.ZonesAnnotation,
+			adapter.ExcludeAnnotation, adapter.LBNameAnnotation},
+	}, hetznerCapabilities)
+	assert.Equal("unknown", unknownCapabilities.Provider)
+	assert.False(unknownCapabilities.Weighted)
+	assert.Equal([]string{adapter.TTLAnnotation, adapter.ZonesAnnotation, adapter.ExcludeAnnotation,
+		adapter.LBNameAnnotation}, unknownCapabilities.Annotations)
+}
+
+// checkingR53Client rejects the changes its provider can't manage, as the clients of providers without routing
+// policies do.
+type checkingR53Client struct {
+	declaringR53Client
+}
+
+func (c *checkingR53Client) UpdateRecordSets(changes []*route53.Change) error {
+	for _, change := range changes {
+		if err := recordset.Check(c.capabilities.Provider, change.ResourceRecordSet); err != nil {
+			return err
+		}
+	}
+	return c.Route53Client.UpdateRecordSets(changes)
+}
+
+func TestRoutingAnnotationsTheProviderCantHonourAreDroppedWithAnEvent(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		5*time.Minute, nil)
+	hetzner := &checkingR53Client{declaringR53Client{Route53Client: r53.NewInMemory("james.com"),
+		capabilities: hetznerDNSCapabilities}}
+	recorder := &fakeEventRecorder{}
+	dnsUpdater := New(lbAdapter, Config{HostedZoneIDs: []string{hostedZoneID}, EventRecorder: recorder,
+		ZoneClient: func(id string) r53.Route53Client { return hetzner }})
+	weighted := ingressWithAnnotations(map[string]string{adapter.WeightAnnotation: "20",
+		adapter.TTLAnnotation: "300"})
+	assert.NoError(dnsUpdater.Start())
+
+	// when
+	err := dnsUpdater.Update(controller.IngressEntries{
+		{Name: "weighted", Host: "weighted.james.com", LbScheme: internalScheme, Ingress: weighted},
+		{Name: "plain", Host: "plain.james.com", LbScheme: internalScheme},
+	})
+
+	// then
+	assert.NoError(err)
+	records, err := hetzner.GetRecords()
+	assert.NoError(err)
+	assert.Equal([]*route53.ResourceRecordSet{
+		cnameRecordSet("plain.james.com.", internalAddressArgument, 300),
+		cnameRecordSet("weighted.james.com.", internalAddressArgument, 300),
+	}, records, "the weighted host should get a simple record, without blocking the other")
+	var unsupported []recordedEvent
+	for _, event := range recorder.events {
+		if event.reason == "DNSAnnotationUnsupported" {
+			unsupported = append(unsupported, event)
+		}
+	}
+	assert.Equal([]recordedEvent{{weighted, "Warning", "DNSAnnotationUnsupported",
+		"sky.uk/dns-weight annotation isn't supported by the hetzner provider with the static hostname frontend"}},
+		unsupported)
+	assert.Equal("20", weighted.Annotations[adapter.WeightAnnotation], "the ingress shouldn't be changed")
+}
+
+func TestInvalidRecordsAreSkippedAndReplacedRecordsKept(t *testing.T) {
+	// given
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: "", externalScheme: "bad host"},
+		5*time.Minute, nil)
+	dnsUpdater := newTestUpdater(lbAdapter, Config{})
+	mockR53 := &mockR53Client{}
+	dnsUpdater.zones[0].r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("foo.james.com.", internalAddressArgument, 300),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{}).Return(nil)
+	assert.NoError(t, dnsUpdater.Start())
+	before := metricValue(invalidRecordsCount)
+
+	// when
+	err := dnsUpdater.Update(controller.IngressEntries{
+		{Name: "foo", Host: "foo.james.com", LbScheme: internalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.WeightAnnotation: "20"})},
+		{Name: "bar", Host: "bar.james.com", LbScheme: externalScheme},
+	})
+
+	// then
+	assert.NoError(t, err)
+	mockR53.AssertExpectations(t)
+	assert.Equal(t, 2.0, metricValue(invalidRecordsCount)-before)
+	assert.Empty(t, dnsUpdater.Records())
+}
+
+func TestTTLsOutsideTheProvidersLimitsAreInvalid(t *testing.T) {
+	// given
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		5*time.Minute, nil)
+	hetzner := &declaringR53Client{Route53Client: r53.NewInMemory("james.com"), capabilities: hetznerDNSCapabilities}
+	dnsUpdater := newTestUpdater(lbAdapter, Config{ZoneClient: func(id string) r53.Route53Client {
+		return hetzner
+	}})
+	assert.NoError(t, dnsUpdater.Start())
+	before := metricValue(invalidRecordsCount)
+
+	// when
+	err := dnsUpdater.Update(controller.IngressEntries{
+		{Name: "short", Host: "short.james.com", LbScheme: internalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.TTLAnnotation: "30"})},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, metricValue(invalidRecordsCount)-before, "Hetzner doesn't accept TTLs under a minute")
+	assert.Empty(t, dnsUpdater.Records())
+	assert.Equal(t, `TTL 30 isn't between 60 and 2147483647`,
+		validateRecord(cnameRecordSet("foo.james.com.", "lb.example.net", 30),
+			ttlLimitsOf(hetzner)).Error())
+	assert.NoError(t, validateRecord(cnameRecordSet("foo.james.com.", "lb.example.net", 30),
+		ttlLimitsOf(r53.NewInMemory("james.com"))), "Route53 accepts any TTL of RFC 2181")
+}
+
+func TestTTLsUnderTheMinimumOfProvidersWhichRoundThemUpAreRoundedUpSoTheyConverge(t *testing.T) {
+	// given
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		5*time.Minute, nil)
+	digitalOcean := r53.Capabilities{Provider: "digitalocean", IPv6: true, TXT: true, MinTTL: 30,
+		MaxTTL: r53.MaxTTL, RoundsUpTTL: true}
+	mockR53 := &mockR53Client{}
+	dnsUpdater := newTestUpdater(lbAdapter, Config{})
+	dnsUpdater.zones[0].r53 = &declaringR53Client{Route53Client: mockR53, capabilities: digitalOcean}
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		cnameRecordSet("short.james.com.", internalAddressArgument, 30),
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{Action: aws.String("UPSERT"),
+			ResourceRecordSet: cnameRecordSet("new.james.com.", internalAddressArgument, 30)},
+	}).Return(nil)
+	assert.NoError(t, dnsUpdater.Start())
+	before := metricValue(invalidRecordsCount)
+
+	// when
+	err := dnsUpdater.Update(controller.IngressEntries{
+		{Name: "short", Host: "short.james.com", LbScheme: internalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.TTLAnnotation: "10"})},
+		{Name: "new", Host: "new.james.com", LbScheme: internalScheme,
+			Ingress: ingressWithAnnotations(map[string]string{adapter.TTLAnnotation: "10"})},
+	})
+
+	// then
+	assert.NoError(t, err)
+	mockR53.AssertExpectations(t)
+	assert.Equal(t, 0.0, metricValue(invalidRecordsCount)-before)
+}
+
+func TestValidateRecord(t *testing.T) {
+	a := func(ip string) *route53.ResourceRecordSet {
+		return &route53.ResourceRecordSet{Name: aws.String("foo.james.com."), Type: aws.String("A"),
+			TTL: aws.Int64(60), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(ip)}}}
+	}
+	alias := aliasRecordSet("foo.james.com.", internalALBDnsNameWithPeriod)
+
+	var tests = []struct {
+		name     string
+		rrs      *route53.ResourceRecordSet
+		expected string
+	}{
+		{"CNAME", cnameRecordSet("foo.james.com.", "lb.example.net", 300), ""},
+		{"Wildcard", cnameRecordSet("*.james.com.", "lb.example.net.", 0), ""},
+		{"Underscore", cnameRecordSet("_acme-challenge.james.com.", "lb.example.net", 60), ""},
+		{"Empty target", cnameRecordSet("foo.james.com.", "", 300), "invalid target: empty hostname"},
+		{"Invalid target", cnameRecordSet("foo.james.com.", "lb..example.net", 300),
+			`invalid target: "lb..example.net" isn't a valid hostname`},
+		{"Invalid name", cnameRecordSet("foo bar.james.com.", "lb.example.net", 300),
+			`invalid name: "foo bar.james.com." isn't a valid hostname`},
+		{"Long label", cnameRecordSet(strings.Repeat("a", 64)+".james.com.", "lb.example.net", 300),
+			`invalid name: "` + strings.Repeat("a", 64) + `.james.com." isn't a valid hostname`},
+		{"Negative TTL", cnameRecordSet("foo.james.com.", "lb.example.net", -1), "TTL -1 isn't between 0 and 2147483647"},
+		{"TTL too long", cnameRecordSet("foo.james.com.", "lb.example.net", 1<<31),
+			"TTL 2147483648 isn't between 0 and 2147483647"},
+		{"IPv4", a("10.0.0.1"), ""},
+		{"Not an IP", a("lb.example.net"), `"lb.example.net" isn't an IPv4 address`},
+		{"No values", &route53.ResourceRecordSet{Name: aws.String("foo.james.com."), Type: aws.String("A"),
+			TTL: aws.Int64(60)}, "no values"},
+		{"Alias", alias, ""},
+		{"Alias without a target", aliasRecordSet("foo.james.com.", ""), "invalid alias target: empty hostname"},
+	}
+
+	for _, test := range tests {
+		fmt.Printf("=== test: %s\n", test.name)
+		err := validateRecord(test.rrs, ttlLimitsOf(&mockR53Client{}))
+		if test.expected == "" {
+			assert.NoError(t, err, test.name)
+		} else {
+			assert.EqualError(t, err, test.expected, test.name)
+		}
+	}
+}
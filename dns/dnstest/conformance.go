@@ -0,0 +1,246 @@
+/*
+Package dnstest is a conformance suite for DNS providers, so every provider manages the lifecycle of ingress records
+the same way. A provider runs it in its tests against a fake backend, such as an httptest server of its API.
+*/
+package dnstest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/stretchr/testify/assert"
+)
+
+// Zone is the zone of the backends the suite runs against.
+const Zone = "example.com"
+
+// automaticTTL describes the TTL of records whose TTL the provider sets itself.
+const automaticTTL = "auto"
+
+// NewBackend creates a new, empty fake backend of the provider containing Zone. It returns the client of each hosted
+// zone, as the ZoneClient of the dns updater, and closes the backend with closeBackend.
+type NewBackend func() (zoneClient func(id string) r53.Route53Client, closeBackend func())
+
+// step updates the records of ingress hosts of the internal scheme to CNAMEs to target, with the TTL. Changes is the
+// number of changes the update is expected to apply to the zone.
+type step struct {
+	target  string
+	ttl     time.Duration
+	hosts   []string
+	changes int
+}
+
+var scenarios = []struct {
+	name     string
+	steps    []step
+	expected []string
+}{
+	{
+		"create",
+		[]step{{"lb.example.net", time.Minute, []string{"foo.example.com", "bar.example.com"}, 2}},
+		[]string{"bar.example.com CNAME 60 lb.example.net", "foo.example.com CNAME 60 lb.example.net"},
+	},
+	{
+		"no-op",
+		[]step{
+			{"lb.example.net", time.Minute, []string{"foo.example.com"}, 1},
+			{"lb.example.net", time.Minute, []string{"foo.example.com"}, 0},
+		},
+		[]string{"foo.example.com CNAME 60 lb.example.net"},
+	},
+	{
+		"update-target",
+		[]step{
+			{"lb.example.net", time.Minute, []string{"foo.example.com"}, 1},
+			{"new-lb.example.net", time.Minute, []string{"foo.example.com"}, 1},
+		},
+		[]string{"foo.example.com CNAME 60 new-lb.example.net"},
+	},
+	{
+		"update-ttl",
+		[]step{
+			{"lb.example.net", time.Minute, []string{"foo.example.com"}, 1},
+			{"lb.example.net", 5 * time.Minute, []string{"foo.example.com"}, 1},
+		},
+		[]string{"foo.example.com CNAME 300 lb.example.net"},
+	},
+	{
+		"delete",
+		[]step{
+			{"lb.example.net", time.Minute, []string{"foo.example.com", "bar.example.com"}, 2},
+			{"lb.example.net", time.Minute, []string{"foo.example.com"}, 1},
+		},
+		[]string{"foo.example.com CNAME 60 lb.example.net"},
+	},
+	{
+		"wildcard",
+		[]step{{"lb.example.net", time.Minute, []string{"*.apps.example.com"}, 1}},
+		[]string{"*.apps.example.com CNAME 60 lb.example.net"},
+	},
+	{
+		// CNAMEs aren't allowed at the apex, so it's skipped and the other hosts are still created.
+		"apex",
+		[]step{{"lb.example.net", time.Minute, []string{"example.com", "foo.example.com"}, 1}},
+		[]string{"foo.example.com CNAME 60 lb.example.net"},
+	},
+}
+
+// RunConformance runs every scenario as a subtest against a new backend, updating its records with the dns updater
+// and checking the records in the zone after each scenario.
+func RunConformance(t *testing.T, newBackend NewBackend) {
+	runConformance(t, newBackend, false)
+}
+
+// RunAutomaticTTLConformance runs the scenarios against a backend whose provider sets the TTL of the records the dns
+// updater creates itself, such as Cloudflare's proxied records. Their TTLs are never changed, so a step which only
+// changes the TTL has no changes, and the records in the zone are expected to report an automatic TTL.
+func RunAutomaticTTLConformance(t *testing.T, newBackend NewBackend) {
+	runConformance(t, newBackend, true)
+}
+
+func runConformance(t *testing.T, newBackend NewBackend, automaticTTL bool) {
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.name, func(t *testing.T) {
+			zoneClient, closeBackend := newBackend()
+			defer closeBackend()
+			counter := &changeCounter{}
+
+			for i, step := range scenario.steps {
+				updater := dns.New(adapter.NewStaticHostnameAdapter(map[string]string{"internal": step.target},
+					step.ttl, nil), dns.Config{
+					HostedZoneIDs: []string{Zone},
+					ZoneClient:    counter.wrap(zoneClient),
+				})
+				var entries controller.IngressEntries
+				for _, host := range step.hosts {
+					entries = append(entries, controller.IngressEntry{Namespace: "conformance", Name: scenario.name,
+						Host: host, LbScheme: "internal"})
+				}
+
+				changes := step.changes
+				if automaticTTL && i > 0 && onlyTheTTLDiffers(scenario.steps[i-1], step) {
+					changes = 0
+				}
+				counter.reset()
+				description := fmt.Sprintf("step %d", i+1)
+				if assert.NoError(t, updater.Start(), description) {
+					assert.NoError(t, updater.Update(entries), description)
+					assert.NoError(t, updater.Stop(), description)
+				}
+				assert.Equal(t, changes, counter.count(), "changes of "+description)
+			}
+
+			expected := scenario.expected
+			if automaticTTL {
+				expected = withAutomaticTTLs(expected)
+			}
+			records, err := recordsOf(zoneClient(Zone))
+			assert.NoError(t, err)
+			assert.Equal(t, expected, records)
+		})
+	}
+}
+
+// onlyTheTTLDiffers is whether a step updates the same hosts to the same target as the step before it.
+func onlyTheTTLDiffers(previous, current step) bool {
+	return previous.target == current.target &&
+		strings.Join(previous.hosts, ",") == strings.Join(current.hosts, ",")
+}
+
+// withAutomaticTTLs describes the records with an automatic TTL instead of the TTL they were created with.
+func withAutomaticTTLs(records []string) []string {
+	var automatic []string
+	for _, record := range records {
+		fields := strings.Fields(record)
+		fields[2] = automaticTTL
+		automatic = append(automatic, strings.Join(fields, " "))
+	}
+	return automatic
+}
+
+// recordsOf describes the records in the zone, as sorted name type ttl values, without trailing periods. The ttl of
+// record sets whose TTL the provider sets itself is automaticTTL.
+func recordsOf(client r53.Route53Client) ([]string, error) {
+	if _, err := client.GetHostedZoneDomain(); err != nil {
+		return nil, err
+	}
+	recordSets, err := client.GetRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	reporter, _ := client.(r53.AutomaticTTLReporter)
+	var records []string
+	for _, rrs := range recordSets {
+		ttl := strconv.FormatInt(aws.Int64Value(rrs.TTL), 10)
+		if reporter != nil && reporter.HasAutomaticTTL(rrs) {
+			ttl = automaticTTL
+		}
+		var values []string
+		for _, rr := range rrs.ResourceRecords {
+			values = append(values, strings.TrimSuffix(aws.StringValue(rr.Value), "."))
+		}
+		sort.Strings(values)
+		records = append(records, fmt.Sprintf("%s %s %s %s", strings.TrimSuffix(aws.StringValue(rrs.Name), "."),
+			aws.StringValue(rrs.Type), ttl, strings.Join(values, ",")))
+	}
+	sort.Strings(records)
+	return records, nil
+}
+
+// changeCounter counts the changes applied through the zone clients it wraps.
+type changeCounter struct {
+	sync.Mutex
+	changes int
+}
+
+func (c *changeCounter) wrap(zoneClient func(id string) r53.Route53Client) func(id string) r53.Route53Client {
+	return func(id string) r53.Route53Client {
+		return &countingClient{Route53Client: zoneClient(id), counter: c}
+	}
+}
+
+func (c *changeCounter) reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.changes = 0
+}
+
+func (c *changeCounter) count() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.changes
+}
+
+type countingClient struct {
+	r53.Route53Client
+	counter *changeCounter
+}
+
+func (c *countingClient) UpdateRecordSets(changes []*route53.Change) error {
+	err := c.Route53Client.UpdateRecordSets(changes)
+	if err == nil {
+		c.counter.Lock()
+		c.counter.changes += len(changes)
+		c.counter.Unlock()
+	}
+	return err
+}
+
+// HasAutomaticTTL keeps the TTLs the wrapped client reports as automatic visible to the dns updater.
+func (c *countingClient) HasAutomaticTTL(rrs *route53.ResourceRecordSet) bool {
+	reporter, ok := c.Route53Client.(r53.AutomaticTTLReporter)
+	return ok && reporter.HasAutomaticTTL(rrs)
+}
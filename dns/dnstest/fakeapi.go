@@ -0,0 +1,97 @@
+package dnstest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/stretchr/testify/assert"
+)
+
+// FakeAPI is an httptest server of a provider's fake API. It serves one request at a time, holding its lock, and logs
+// the method and path of each request, so a test can check the requests a client makes. The fake's state is guarded
+// by the same lock.
+type FakeAPI struct {
+	sync.Mutex
+	*httptest.Server
+	requests []string
+}
+
+// NewFakeAPI starts serving the handler, which is called with the lock held.
+func NewFakeAPI(handler http.Handler) *FakeAPI {
+	api := &FakeAPI{}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.Lock()
+		defer api.Unlock()
+		api.requests = append(api.requests, r.Method+" "+r.URL.Path)
+		handler.ServeHTTP(w, r)
+	}))
+	return api
+}
+
+// Requests are the method and path of each request served so far, in order.
+func (a *FakeAPI) Requests() []string {
+	a.Lock()
+	defer a.Unlock()
+	return append([]string(nil), a.requests...)
+}
+
+// CNAME is a record set of a CNAME with the name, target and TTL.
+func CNAME(name, target string, ttl int64) *route53.ResourceRecordSet {
+	return &route53.ResourceRecordSet{
+		Name:            aws.String(name),
+		Type:            aws.String(route53.RRTypeCname),
+		TTL:             aws.Int64(ttl),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(target)}},
+	}
+}
+
+// RunUnappliedChanges checks that the client fails to apply changes the provider named by provider can't make, being
+// creating foo.example.com. when it exists, deleting bar.example.com. which doesn't, and records it has no support
+// for. The client's zone must have a CNAME for foo.example.com. and no records for bar.example.com.
+func RunUnappliedChanges(t *testing.T, client r53.Route53Client, provider string) {
+	weighted := CNAME("bar.example.com.", "lb.example.net", 60)
+	weighted.SetIdentifier = aws.String("blue")
+	weighted.Weight = aws.Int64(1)
+
+	var tests = []struct {
+		name     string
+		change   *route53.Change
+		expected string
+	}{
+		{
+			"Creating an existing record",
+			&route53.Change{Action: aws.String("CREATE"), ResourceRecordSet: CNAME("foo.example.com.", "x", 60)},
+			"can't create foo.example.com. CNAME, it already exists",
+		},
+		{
+			"Deleting a missing record",
+			&route53.Change{Action: aws.String("DELETE"), ResourceRecordSet: CNAME("bar.example.com.", "x", 60)},
+			"can't delete bar.example.com. CNAME, it doesn't exist",
+		},
+		{
+			"Alias records",
+			&route53.Change{Action: aws.String("UPSERT"), ResourceRecordSet: &route53.ResourceRecordSet{
+				Name:        aws.String("bar.example.com."),
+				Type:        aws.String("A"),
+				AliasTarget: &route53.AliasTarget{DNSName: aws.String("lb.example.net")},
+			}},
+			"can't change bar.example.com., alias records aren't supported by " + provider,
+		},
+		{
+			"Routing policies",
+			&route53.Change{Action: aws.String("UPSERT"), ResourceRecordSet: weighted},
+			"can't change bar.example.com., routing policies aren't supported by " + provider,
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Printf("=== test: %s\n", test.name)
+		assert.EqualError(t, client.UpdateRecordSets([]*route53.Change{test.change}), test.expected, test.name)
+	}
+}
@@ -0,0 +1,172 @@
+package dns
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/dns/r53"
+)
+
+const (
+	// healthCheckReferencePrefix starts the caller reference of the health checks the updater creates, followed by
+	// the owner, so they're told apart from health checks created by anything else.
+	healthCheckReferencePrefix = "feed-dns:"
+	// maxHealthCheckOwnerLength keeps caller references within the 64 characters Route53 allows.
+	maxHealthCheckOwnerLength = 32
+	httpsPort                 = 443
+)
+
+// healthCheckSpec is the part of a health check's config requested by the health check annotations.
+type healthCheckSpec struct {
+	fqdn, path     string
+	port, interval int64
+}
+
+func healthCheckSpecOf(config *route53.HealthCheckConfig) healthCheckSpec {
+	return healthCheckSpec{
+		fqdn:     aws.StringValue(config.FullyQualifiedDomainName),
+		path:     aws.StringValue(config.ResourcePath),
+		port:     aws.Int64Value(config.Port),
+		interval: aws.Int64Value(config.RequestInterval),
+	}
+}
+
+// config returns the config of a health check of the spec, over HTTPS on port 443 and HTTP otherwise.
+func (s healthCheckSpec) config() *route53.HealthCheckConfig {
+	checkType := route53.HealthCheckTypeHttp
+	if s.port == httpsPort {
+		checkType = route53.HealthCheckTypeHttps
+	}
+	return &route53.HealthCheckConfig{
+		Type:                     aws.String(checkType),
+		FullyQualifiedDomainName: aws.String(s.fqdn),
+		Port:                     aws.Int64(s.port),
+		ResourcePath:             aws.String(s.path),
+		RequestInterval:          aws.Int64(s.interval),
+	}
+}
+
+func (s healthCheckSpec) String() string {
+	return s.fqdn + ":" + strconv.FormatInt(s.port, 10) + s.path + " every " + strconv.FormatInt(s.interval, 10) + "s"
+}
+
+// healthChecks manages the health checks requested by the health check annotations. The health checks it owns are
+// identified by their caller reference, and matched to records by their config, so one health check is shared by
+// all the records with the same spec. Health checks are never changed, as Route53 can't change the interval of a
+// health check. Instead a health check with the new spec is created, and the old one deleted once no record uses it.
+type healthChecks struct {
+	reference string
+	now       func() time.Time
+	lastNano  int64
+	client    r53.HealthCheckClient
+	owned     map[healthCheckSpec]string
+	used      map[string]bool
+}
+
+func newHealthChecks(owner string) *healthChecks {
+	if len(owner) > maxHealthCheckOwnerLength {
+		owner = owner[:maxHealthCheckOwnerLength]
+	}
+	return &healthChecks{reference: healthCheckReferencePrefix + owner + ":", now: time.Now}
+}
+
+// refresh lists the owned health checks at the start of an update, through the first client which manages health
+// checks, and forgets which were used by the previous update.
+func (h *healthChecks) refresh(zones []*hostedZone) error {
+	h.client = nil
+	for _, zone := range zones {
+		if client, ok := zone.r53.(r53.HealthCheckClient); ok {
+			h.client = client
+			break
+		}
+	}
+	if h.client == nil {
+		return errors.New("the DNS provider doesn't support health checks")
+	}
+
+	all, err := h.client.GetHealthChecks()
+	if err != nil {
+		return err
+	}
+	h.owned = make(map[healthCheckSpec]string)
+	h.used = make(map[string]bool)
+	for _, healthCheck := range all {
+		if strings.HasPrefix(aws.StringValue(healthCheck.CallerReference), h.reference) &&
+			healthCheck.HealthCheckConfig != nil {
+			h.owned[healthCheckSpecOf(healthCheck.HealthCheckConfig)] = aws.StringValue(healthCheck.Id)
+		}
+	}
+	return nil
+}
+
+// markUsed keeps the health checks of existing records, so a health check is only deleted by the update after the
+// last record using it is changed or deleted.
+func (h *healthChecks) markUsed(records []*route53.ResourceRecordSet) {
+	for _, rrs := range records {
+		if rrs.HealthCheckId != nil {
+			h.used[aws.StringValue(rrs.HealthCheckId)] = true
+		}
+	}
+}
+
+// idFor returns the id of the owned health check of the spec, creating it if there isn't one. In dry run, health
+// checks aren't created, and the id is empty.
+func (h *healthChecks) idFor(spec healthCheckSpec, dryRun bool) (string, error) {
+	if id, ok := h.owned[spec]; ok {
+		h.used[id] = true
+		return id, nil
+	}
+	if dryRun {
+		log.Infof("[dry-run] Would create health check of %v", spec)
+		h.owned[spec] = ""
+		return "", nil
+	}
+
+	id, err := h.client.CreateHealthCheck(h.nextReference(), spec.config())
+	if err != nil {
+		return "", err
+	}
+	log.Infof("Created health check %s of %v", id, spec)
+	h.owned[spec] = id
+	h.used[id] = true
+	return id, nil
+}
+
+// nextReference returns a unique caller reference, from the current time.
+func (h *healthChecks) nextReference() string {
+	nano := h.now().UnixNano()
+	if nano <= h.lastNano {
+		nano = h.lastNano + 1
+	}
+	h.lastNano = nano
+	return h.reference + strconv.FormatInt(nano, 10)
+}
+
+// deleteUnused deletes the owned health checks which no record used during the update, once every hosted zone has
+// been updated. Health checks which fail to delete are deleted by a later update.
+func (h *healthChecks) deleteUnused(dryRun bool) {
+	var unused []string
+	for spec, id := range h.owned {
+		if id != "" && !h.used[id] {
+			unused = append(unused, id)
+			log.Infof("Health check %s of %v is no longer used", id, spec)
+		}
+	}
+	sort.Strings(unused)
+
+	for _, id := range unused {
+		if dryRun {
+			log.Infof("[dry-run] Would delete health check %s", id)
+			continue
+		}
+		if err := h.client.DeleteHealthCheck(id); err != nil {
+			log.Warnf("Unable to delete unused health check, will retry next update: %v", err)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+/*
+Package hetzner is the Hetzner DNS provider of feed-dns, managing the records of a zone through the Hetzner DNS
+API. Each value of a Route53 record set is a Hetzner record with an id, and records without a TTL of their own
+have Hetzner's default of a day.
+*/
+package hetzner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/dns/recordset"
+)
+
+const (
+	// DefaultAPIURL is the URL of the Hetzner DNS API.
+	DefaultAPIURL = "https://dns.hetzner.com/api/v1"
+	// tokenHeader authenticates requests with the API token.
+	tokenHeader = "Auth-API-Token"
+	// pageSize is the number of records listed per request.
+	pageSize       = 100
+	requestTimeout = 30 * time.Second
+	// defaultTTL is the TTL of records without their own, which use the TTL of the zone, Hetzner's default.
+	defaultTTL = 86400
+	// minTTL is the smallest TTL Hetzner DNS accepts.
+	minTTL = 60
+	// apex is the name of records for the zone's domain itself.
+	apex = "@"
+)
+
+// Capabilities are those of Hetzner DNS records, whose TTLs are at least a minute.
+var Capabilities = r53.Capabilities{Provider: "hetzner", IPv6: true, TXT: true, MinTTL: minTTL, MaxTTL: r53.MaxTTL}
+
+// Config describes the Hetzner DNS zone to manage and how to reach the API.
+// Token is an API token with access to the Zone, which is the zone's domain, e.g. example.com.
+// APIURL overrides DefaultAPIURL, e.g. for testing.
+type Config struct {
+	Token  string
+	Zone   string
+	APIURL string
+}
+
+type client struct {
+	http   *http.Client
+	apiURL string
+	token  string
+	zone   string
+	names  recordset.Names
+	zoneID string
+}
+
+// record is a record of the Hetzner DNS API. Each value of a record set is a separate record.
+type record struct {
+	ID     string `json:"id,omitempty"`
+	ZoneID string `json:"zone_id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	TTL    *int64 `json:"ttl,omitempty"`
+}
+
+type pagination struct {
+	Page     int `json:"page"`
+	LastPage int `json:"last_page"`
+}
+
+type meta struct {
+	Pagination pagination `json:"pagination"`
+}
+
+type zonesResponse struct {
+	Zones []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"zones"`
+}
+
+type recordsResponse struct {
+	Records []record `json:"records"`
+	Meta    meta     `json:"meta"`
+}
+
+// NewUpdater creates a dns updater of Hetzner DNS zones, which are named by the hosted zone ids of the updater
+// config. A client is created for each of them, with its name as the Zone of the config.
+func NewUpdater(lbAdapter adapter.FrontendAdapter, updaterConfig dns.Config, config Config) controller.Updater {
+	updaterConfig.ZoneClient = func(zone string) r53.Route53Client {
+		zoneConfig := config
+		zoneConfig.Zone = zone
+		return New(zoneConfig)
+	}
+	return dns.New(lbAdapter, updaterConfig)
+}
+
+// New creates a client of a Hetzner DNS zone, authenticated with the API token of the config. The zone's id is
+// looked up by its name, and its records are listed a page at a time.
+func New(config Config) r53.Route53Client {
+	apiURL := config.APIURL
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	zone := strings.TrimSuffix(config.Zone, ".")
+	return &client{
+		http:   &http.Client{Timeout: requestTimeout},
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+		token:  config.Token,
+		zone:   zone,
+		names:  recordset.Names{Zone: zone, Apex: apex},
+	}
+}
+
+// Capabilities of the client.
+func (c *client) Capabilities() r53.Capabilities {
+	return Capabilities
+}
+
+// GetHostedZoneDomain looks up the zone, and returns its domain with a trailing period.
+func (c *client) GetHostedZoneDomain() (string, error) {
+	var zones zonesResponse
+	if err := c.do(http.MethodGet, "/zones?name="+url.QueryEscape(c.zone), nil, &zones); err != nil {
+		return "", fmt.Errorf("unable to look up Hetzner zone %s: %v", c.zone, err)
+	}
+	for _, zone := range zones.Zones {
+		if zone.Name == c.zone {
+			c.zoneID = zone.ID
+			return c.zone + ".", nil
+		}
+	}
+	return "", fmt.Errorf("hetzner zone %s doesn't exist", c.zone)
+}
+
+// GetRecords returns the CNAME, A and AAAA record sets of the zone.
+func (c *client) GetRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsAddress)
+}
+
+// GetTXTRecords returns the TXT record sets of the zone.
+func (c *client) GetTXTRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsTXT)
+}
+
+func (c *client) listRecordSets(include func(recordType string) bool) ([]*route53.ResourceRecordSet, error) {
+	records, err := c.listRecords()
+	if err != nil {
+		return nil, err
+	}
+	return recordset.Sets(records, include), nil
+}
+
+// listRecords lists every record of the zone, a page at a time.
+func (c *client) listRecords() ([]recordset.Record, error) {
+	if c.zoneID == "" {
+		return nil, fmt.Errorf("hetzner zone %s hasn't been looked up", c.zone)
+	}
+
+	var records []recordset.Record
+	for page := 1; ; page++ {
+		var resp recordsResponse
+		path := fmt.Sprintf("/records?zone_id=%s&page=%d&per_page=%d", url.QueryEscape(c.zoneID), page, pageSize)
+		if err := c.do(http.MethodGet, path, nil, &resp); err != nil {
+			return nil, fmt.Errorf("unable to list records of Hetzner zone %s: %v", c.zone, err)
+		}
+		for _, rec := range resp.Records {
+			records = append(records, c.recordOf(rec))
+		}
+		if resp.Meta.Pagination.LastPage <= page || len(resp.Records) == 0 {
+			return records, nil
+		}
+	}
+}
+
+// UpdateRecordSets applies the changes in order, as Hetzner records. A change which can't be applied, such as
+// deleting a record set which doesn't exist, fails the update, leaving the changes before it applied.
+func (c *client) UpdateRecordSets(changes []*route53.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	records, err := c.listRecords()
+	if err != nil {
+		return err
+	}
+	_, err = recordset.Apply("Hetzner DNS", c, records, changes)
+	return err
+}
+
+// Create creates a Hetzner record of the record set with the value.
+func (c *client) Create(rrs *route53.ResourceRecordSet, value string) (recordset.Record, error) {
+	rec := record{
+		ZoneID: c.zoneID,
+		Type:   aws.StringValue(rrs.Type),
+		Name:   c.names.Relative(aws.StringValue(rrs.Name)),
+		Value:  value,
+		TTL:    rrs.TTL,
+	}
+	var created struct {
+		Record record `json:"record"`
+	}
+	if err := c.do(http.MethodPost, "/records", rec, &created); err != nil {
+		return recordset.Record{}, err
+	}
+	return c.recordOf(created.Record), nil
+}
+
+// UpdateTTL replaces the Hetzner record with one with the TTL.
+func (c *client) UpdateTTL(rec recordset.Record, ttl int64) (recordset.Record, error) {
+	updated := rec.Native.(record)
+	updated.TTL = aws.Int64(ttl)
+	if err := c.do(http.MethodPut, "/records/"+url.PathEscape(updated.ID), updated, nil); err != nil {
+		return recordset.Record{}, err
+	}
+	return c.recordOf(updated), nil
+}
+
+// Delete deletes the Hetzner record.
+func (c *client) Delete(rec recordset.Record) error {
+	return c.do(http.MethodDelete, "/records/"+url.PathEscape(rec.Native.(record).ID), nil, nil)
+}
+
+// recordOf returns the value of a record set a Hetzner record is.
+func (c *client) recordOf(rec record) recordset.Record {
+	return recordset.Record{Name: c.names.FQDN(rec.Name), Type: rec.Type, Value: rec.Value, TTL: ttlOf(rec),
+		Native: rec}
+}
+
+func ttlOf(rec record) int64 {
+	if rec.TTL == nil {
+		return defaultTTL
+	}
+	return *rec.TTL
+}
+
+// do sends a request to the API, decoding the response into out if it isn't nil.
+func (c *client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, c.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(tokenHeader, c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	log.Debugf("Hetzner DNS %s %s", method, path)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("hetzner DNS API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
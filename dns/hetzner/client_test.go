@@ -0,0 +1,284 @@
+package hetzner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/dns/dnstest"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+const (
+	testToken  = "secret"
+	testZoneID = "zone-1"
+)
+
+// fakeAPI is an in-memory Hetzner DNS API of a single zone.
+type fakeAPI struct {
+	*dnstest.FakeAPI
+	zone    string
+	records map[string]record
+	nextID  int
+}
+
+func newFakeAPI(zone string, records ...record) (*fakeAPI, *httptest.Server) {
+	api := &fakeAPI{zone: zone, records: make(map[string]record)}
+	for _, rec := range records {
+		api.add(rec)
+	}
+	api.FakeAPI = dnstest.NewFakeAPI(api)
+	return api, api.Server
+}
+
+func (a *fakeAPI) add(rec record) record {
+	a.nextID++
+	rec.ID = strconv.Itoa(a.nextID)
+	rec.ZoneID = testZoneID
+	a.records[rec.ID] = rec
+	return rec
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(tokenHeader) != testToken {
+		http.Error(w, `{"message":"Invalid authentication credentials"}`, http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/zones":
+		var zones zonesResponse
+		if r.URL.Query().Get("name") == a.zone {
+			zones.Zones = append(zones.Zones, struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			}{testZoneID, a.zone})
+		}
+		json.NewEncoder(w).Encode(zones)
+	case r.Method == http.MethodGet && r.URL.Path == "/records":
+		a.listRecords(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/records":
+		var rec record
+		json.NewDecoder(r.Body).Decode(&rec)
+		json.NewEncoder(w).Encode(map[string]record{"record": a.add(rec)})
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/records/"):
+		var rec record
+		json.NewDecoder(r.Body).Decode(&rec)
+		rec.ID = strings.TrimPrefix(r.URL.Path, "/records/")
+		a.records[rec.ID] = rec
+		json.NewEncoder(w).Encode(map[string]record{"record": rec})
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/records/"):
+		id := strings.TrimPrefix(r.URL.Path, "/records/")
+		if _, ok := a.records[id]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(a.records, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *fakeAPI) listRecords(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if r.URL.Query().Get("zone_id") != testZoneID || page < 1 || perPage < 1 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	all := a.sorted()
+	var resp recordsResponse
+	resp.Meta.Pagination = pagination{Page: page, LastPage: (len(all) + perPage - 1) / perPage}
+	for i := (page - 1) * perPage; i < len(all) && i < page*perPage; i++ {
+		resp.Records = append(resp.Records, all[i])
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (a *fakeAPI) sorted() []record {
+	var all []record
+	for _, rec := range a.records {
+		all = append(all, rec)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return all[i].Value < all[j].Value
+	})
+	return all
+}
+
+// values describes the records of the fake, as name type value ttl.
+func (a *fakeAPI) values() []string {
+	a.Lock()
+	defer a.Unlock()
+	var values []string
+	for _, rec := range a.sorted() {
+		values = append(values, fmt.Sprintf("%s %s %s %d", rec.Name, rec.Type, rec.Value, ttlOf(rec)))
+	}
+	return values
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) r53.Route53Client {
+	client := New(Config{Token: testToken, Zone: "example.com", APIURL: server.URL})
+	domain, err := client.GetHostedZoneDomain()
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com.", domain)
+	return client
+}
+
+func TestGetHostedZoneDomainFailsIfTheZoneDoesntExist(t *testing.T) {
+	_, server := newFakeAPI("another.com")
+	defer server.Close()
+
+	_, err := New(Config{Token: testToken, Zone: "example.com", APIURL: server.URL}).GetHostedZoneDomain()
+
+	assert.EqualError(t, err, "hetzner zone example.com doesn't exist")
+}
+
+func TestRequestsFailWithTheAPIError(t *testing.T) {
+	_, server := newFakeAPI("example.com")
+	defer server.Close()
+
+	_, err := New(Config{Token: "wrong", Zone: "example.com", APIURL: server.URL}).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "401 Unauthorized")
+		assert.Contains(t, err.Error(), "Invalid authentication credentials")
+	}
+}
+
+func TestGetRecordsConvertsRecordsToRecordSets(t *testing.T) {
+	// given
+	_, server := newFakeAPI("example.com",
+		record{Type: "CNAME", Name: "foo", Value: "lb.example.net", TTL: aws.Int64(300)},
+		record{Type: "A", Name: "@", Value: "10.0.0.1"},
+		record{Type: "A", Name: "@", Value: "10.0.0.2"},
+		record{Type: "TXT", Name: "foo", Value: `"hello"`, TTL: aws.Int64(60)},
+		record{Type: "MX", Name: "@", Value: "10 mail.example.com."},
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	records, err := client.GetRecords()
+	txtRecords, txtErr := client.GetTXTRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*route53.ResourceRecordSet{
+		{
+			Name: aws.String("example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(defaultTTL),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.1")},
+				{Value: aws.String("10.0.0.2")},
+			},
+		},
+		dnstest.CNAME("foo.example.com.", "lb.example.net", 300),
+	}, records)
+	assert.NoError(t, txtErr)
+	assert.Equal(t, []*route53.ResourceRecordSet{{
+		Name:            aws.String("foo.example.com."),
+		Type:            aws.String("TXT"),
+		TTL:             aws.Int64(60),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"hello"`)}},
+	}}, txtRecords)
+}
+
+func TestGetRecordsListsEveryPage(t *testing.T) {
+	// given
+	var records []record
+	for i := 0; i < pageSize*2+1; i++ {
+		records = append(records, record{Type: "CNAME", Name: fmt.Sprintf("host-%03d", i), Value: "lb.example.net"})
+	}
+	api, server := newFakeAPI("example.com", records...)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	recordSets, err := client.GetRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, recordSets, pageSize*2+1)
+	assert.Equal(t, []string{"GET /zones", "GET /records", "GET /records", "GET /records"}, api.Requests())
+}
+
+func TestUpdateRecordSetsCreatesUpsertsAndDeletesRecords(t *testing.T) {
+	// given
+	api, server := newFakeAPI("example.com",
+		record{Type: "CNAME", Name: "update", Value: "old.example.net", TTL: aws.Int64(300)},
+		record{Type: "CNAME", Name: "ttl", Value: "lb.example.net", TTL: aws.Int64(300)},
+		record{Type: "CNAME", Name: "delete", Value: "lb.example.net", TTL: aws.Int64(300)},
+		record{Type: "A", Name: "ips", Value: "10.0.0.1", TTL: aws.Int64(60)},
+		record{Type: "A", Name: "ips", Value: "10.0.0.2", TTL: aws.Int64(60)},
+		record{Type: "MX", Name: "@", Value: "10 mail.example.com."},
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{
+		{Action: aws.String("CREATE"), ResourceRecordSet: dnstest.CNAME("create.example.com.", "lb.example.net", 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("update.example.com.", "new.example.net", 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("ttl.example.com.", "lb.example.net", 60)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name: aws.String("ips.example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.2")},
+				{Value: aws.String("10.0.0.3")},
+			},
+		}},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("example.com.", "apex.example.net", 300)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: dnstest.CNAME("delete.example.com.", "lb.example.net", 300)},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"@ MX 10 mail.example.com. 86400",
+		"@ CNAME apex.example.net 300",
+		"create CNAME lb.example.net 300",
+		"ips A 10.0.0.2 60",
+		"ips A 10.0.0.3 60",
+		"ttl CNAME lb.example.net 60",
+		"update CNAME new.example.net 300",
+	}, api.values())
+}
+
+func TestUpdateRecordSetsFailsForChangesWhichCantBeApplied(t *testing.T) {
+	_, server := newFakeAPI("example.com", record{Type: "CNAME", Name: "foo", Value: "lb.example.net"})
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	dnstest.RunUnappliedChanges(t, client, "Hetzner DNS")
+}
+
+func TestConformance(t *testing.T) {
+	dnstest.RunConformance(t, func() (func(id string) r53.Route53Client, func()) {
+		_, server := newFakeAPI(dnstest.Zone)
+		return func(id string) r53.Route53Client {
+			return New(Config{Token: testToken, Zone: id, APIURL: server.URL})
+		}, server.Close
+	})
+}
@@ -0,0 +1,275 @@
+/*
+Package ns1 is the NS1 provider of feed-dns. An NS1 record is a whole record set, with an answer for each value,
+so each change creates, replaces or deletes a single record. Only CNAME, A, AAAA and TXT records are managed, and
+NS1's filter chains aren't used.
+*/
+package ns1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/dns/recordset"
+)
+
+const (
+	// DefaultAPIURL is the URL of the NS1 API.
+	DefaultAPIURL = "https://api.nsone.net/v1"
+	// apiKeyHeader authenticates requests with the API key.
+	apiKeyHeader   = "X-NSONE-Key"
+	requestTimeout = 30 * time.Second
+)
+
+// Capabilities are those of NS1 records without filter chains, which would be needed for routing.
+var Capabilities = r53.Capabilities{Provider: "ns1", IPv6: true, TXT: true, MaxTTL: r53.MaxTTL}
+
+// Config describes the NS1 zone to manage and how to reach the API.
+// APIKey is an API key with access to the records of the Zone, which is the zone's domain, e.g. example.com.
+// APIURL overrides DefaultAPIURL, e.g. for a private NS1 deployment or testing.
+type Config struct {
+	APIKey string
+	Zone   string
+	APIURL string
+}
+
+type client struct {
+	http     *http.Client
+	apiURL   string
+	apiKey   string
+	zone     string
+	lookedUp bool
+}
+
+// record is a record of the NS1 API, which is a record set with an answer for each value. Its domain has no
+// trailing period.
+type record struct {
+	Zone    string   `json:"zone"`
+	Domain  string   `json:"domain"`
+	Type    string   `json:"type"`
+	TTL     int64    `json:"ttl"`
+	Answers []answer `json:"answers"`
+}
+
+type answer struct {
+	Answer []string `json:"answer"`
+}
+
+// zoneResponse is an NS1 zone, with a summary of each of its records.
+type zoneResponse struct {
+	Zone    string `json:"zone"`
+	Records []struct {
+		Domain       string   `json:"domain"`
+		Type         string   `json:"type"`
+		TTL          int64    `json:"ttl"`
+		ShortAnswers []string `json:"short_answers"`
+	} `json:"records"`
+}
+
+// NewUpdater creates a dns updater of the NS1 zones named by the hosted zone ids of the updater config, each with
+// its own client of the API.
+func NewUpdater(lbAdapter adapter.FrontendAdapter, updaterConfig dns.Config, config Config) controller.Updater {
+	updaterConfig.ZoneClient = func(zone string) r53.Route53Client {
+		zoneConfig := config
+		zoneConfig.Zone = zone
+		return New(zoneConfig)
+	}
+	return dns.New(lbAdapter, updaterConfig)
+}
+
+// New creates a client of an NS1 zone, authenticated with the API key of the config. The zone's records are listed
+// with the zone, and a record's answers are the values of its record set.
+func New(config Config) r53.Route53Client {
+	apiURL := config.APIURL
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &client{
+		http:   &http.Client{Timeout: requestTimeout},
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+		apiKey: config.APIKey,
+		zone:   strings.TrimSuffix(config.Zone, "."),
+	}
+}
+
+// Capabilities of the client.
+func (c *client) Capabilities() r53.Capabilities {
+	return Capabilities
+}
+
+// GetHostedZoneDomain looks up the zone, which fails if the API key is invalid, and returns its domain with a
+// trailing period.
+func (c *client) GetHostedZoneDomain() (string, error) {
+	if _, err := c.getZone(); err != nil {
+		return "", fmt.Errorf("unable to look up NS1 zone %s: %v", c.zone, err)
+	}
+	c.lookedUp = true
+	return c.zone + ".", nil
+}
+
+// GetRecords returns the CNAME, A and AAAA record sets of the zone.
+func (c *client) GetRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsAddress)
+}
+
+// GetTXTRecords returns the TXT record sets of the zone.
+func (c *client) GetTXTRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsTXT)
+}
+
+func (c *client) listRecordSets(include func(recordType string) bool) ([]*route53.ResourceRecordSet, error) {
+	sets, err := c.listSets()
+	if err != nil {
+		return nil, err
+	}
+	return recordset.RecordSets(sets, include), nil
+}
+
+// listSets returns the record sets of the zone, from the short answers of its records, which are the first field of
+// each answer, the whole value for CNAME, A, AAAA and TXT records.
+func (c *client) listSets() ([]recordset.Set, error) {
+	if !c.lookedUp {
+		return nil, fmt.Errorf("ns1 zone %s hasn't been looked up", c.zone)
+	}
+	zone, err := c.getZone()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list records of NS1 zone %s: %v", c.zone, err)
+	}
+
+	var sets []recordset.Set
+	for _, rec := range zone.Records {
+		rrs := &route53.ResourceRecordSet{
+			Name: aws.String(recordset.Canonical(rec.Domain)),
+			Type: aws.String(rec.Type),
+			TTL:  aws.Int64(rec.TTL),
+		}
+		for _, value := range rec.ShortAnswers {
+			rrs.ResourceRecords = append(rrs.ResourceRecords,
+				&route53.ResourceRecord{Value: aws.String(valueOf(rec.Type, value))})
+		}
+		sets = append(sets, recordset.Set{RecordSet: rrs})
+	}
+	return sets, nil
+}
+
+func (c *client) getZone() (*zoneResponse, error) {
+	var zone zoneResponse
+	if err := c.do(http.MethodGet, "/zones/"+url.PathEscape(c.zone), nil, &zone); err != nil {
+		return nil, err
+	}
+	return &zone, nil
+}
+
+// UpdateRecordSets applies the changes in order, as NS1 records. A change which can't be applied, such as deleting a
+// record set which doesn't exist, fails the update, leaving the changes before it applied.
+func (c *client) UpdateRecordSets(changes []*route53.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	sets, err := c.listSets()
+	if err != nil {
+		return err
+	}
+	_, err = recordset.ApplySets("NS1", c, sets, changes)
+	return err
+}
+
+// CreateSet creates the NS1 record of the record set, which NS1 does with a PUT.
+func (c *client) CreateSet(rrs *route53.ResourceRecordSet) (recordset.Set, error) {
+	if err := c.do(http.MethodPut, c.recordPath(rrs), c.recordOf(rrs), nil); err != nil {
+		return recordset.Set{}, err
+	}
+	return recordset.Set{RecordSet: rrs}, nil
+}
+
+// ReplaceSet replaces the answers and TTL of the NS1 record of the record set, which NS1 does with a POST.
+func (c *client) ReplaceSet(_ recordset.Set, rrs *route53.ResourceRecordSet) (recordset.Set, error) {
+	if err := c.do(http.MethodPost, c.recordPath(rrs), c.recordOf(rrs), nil); err != nil {
+		return recordset.Set{}, err
+	}
+	return recordset.Set{RecordSet: rrs}, nil
+}
+
+// DeleteSet deletes the NS1 record of the record set.
+func (c *client) DeleteSet(current recordset.Set) error {
+	return c.do(http.MethodDelete, c.recordPath(current.RecordSet), nil, nil)
+}
+
+// recordOf returns the NS1 record of a record set.
+func (c *client) recordOf(rrs *route53.ResourceRecordSet) record {
+	rec := record{
+		Zone:    c.zone,
+		Domain:  strings.TrimSuffix(aws.StringValue(rrs.Name), "."),
+		Type:    aws.StringValue(rrs.Type),
+		TTL:     aws.Int64Value(rrs.TTL),
+		Answers: []answer{},
+	}
+	for _, rr := range rrs.ResourceRecords {
+		rec.Answers = append(rec.Answers, answer{Answer: []string{aws.StringValue(rr.Value)}})
+	}
+	return rec
+}
+
+func (c *client) recordPath(rrs *route53.ResourceRecordSet) string {
+	return "/zones/" + url.PathEscape(c.zone) + "/" + url.PathEscape(strings.TrimSuffix(aws.StringValue(rrs.Name),
+		".")) + "/" + url.PathEscape(aws.StringValue(rrs.Type))
+}
+
+// valueOf returns the record value of an NS1 answer, without the trailing period CNAME targets may have.
+func valueOf(recordType, value string) string {
+	if recordType == route53.RRTypeCname {
+		return strings.TrimSuffix(value, ".")
+	}
+	return value
+}
+
+// do sends a request to the API, decoding the response into out if it isn't nil.
+func (c *client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, c.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(apiKeyHeader, c.apiKey)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	log.Debugf("NS1 API %s %s", method, path)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("ns1 API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
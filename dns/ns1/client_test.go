@@ -0,0 +1,261 @@
+package ns1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/dns/dnstest"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+const testAPIKey = "secret"
+
+// fakeAPI is an in-memory NS1 API of a single zone.
+type fakeAPI struct {
+	*dnstest.FakeAPI
+	zone    string
+	records map[string]record
+}
+
+func newFakeAPI(zone string, records ...record) (*fakeAPI, *httptest.Server) {
+	api := &fakeAPI{zone: zone, records: make(map[string]record)}
+	for _, rec := range records {
+		rec.Zone = zone
+		api.records[rec.Domain+"/"+rec.Type] = rec
+	}
+	api.FakeAPI = dnstest.NewFakeAPI(api)
+	return api, api.Server
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(apiKeyHeader) != testAPIKey {
+		http.Error(w, `{"message":"Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	zonePath := "/zones/" + a.zone
+	if r.URL.Path != zonePath && !strings.HasPrefix(r.URL.Path, zonePath+"/") {
+		http.Error(w, `{"message":"zone not found"}`, http.StatusNotFound)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, zonePath+"/")
+	_, exists := a.records[key]
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == zonePath:
+		a.getZone(w)
+	case r.Method == http.MethodPut && !exists:
+		a.putRecord(w, r, key)
+	case r.Method == http.MethodPut:
+		http.Error(w, `{"message":"record already exists"}`, http.StatusBadRequest)
+	case r.Method == http.MethodPost && exists:
+		a.putRecord(w, r, key)
+	case r.Method == http.MethodDelete && exists:
+		delete(a.records, key)
+		w.Write([]byte("{}"))
+	default:
+		http.Error(w, `{"message":"record not found"}`, http.StatusNotFound)
+	}
+}
+
+func (a *fakeAPI) getZone(w http.ResponseWriter) {
+	zone := zoneResponse{Zone: a.zone}
+	for _, rec := range a.sorted() {
+		summary := struct {
+			Domain       string   `json:"domain"`
+			Type         string   `json:"type"`
+			TTL          int64    `json:"ttl"`
+			ShortAnswers []string `json:"short_answers"`
+		}{Domain: rec.Domain, Type: rec.Type, TTL: rec.TTL}
+		for _, ans := range rec.Answers {
+			summary.ShortAnswers = append(summary.ShortAnswers, strings.Join(ans.Answer, " "))
+		}
+		zone.Records = append(zone.Records, summary)
+	}
+	json.NewEncoder(w).Encode(zone)
+}
+
+func (a *fakeAPI) putRecord(w http.ResponseWriter, r *http.Request, key string) {
+	var rec record
+	json.NewDecoder(r.Body).Decode(&rec)
+	if rec.Zone != a.zone || rec.Domain+"/"+rec.Type != key || len(rec.Answers) == 0 {
+		http.Error(w, `{"message":"invalid record"}`, http.StatusBadRequest)
+		return
+	}
+	a.records[key] = rec
+	json.NewEncoder(w).Encode(rec)
+}
+
+func (a *fakeAPI) sorted() []record {
+	var all []record
+	for _, rec := range a.records {
+		all = append(all, rec)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Domain+" "+all[i].Type < all[j].Domain+" "+all[j].Type
+	})
+	return all
+}
+
+// values describes the records of the fake, as domain type ttl answers.
+func (a *fakeAPI) values() []string {
+	a.Lock()
+	defer a.Unlock()
+	var values []string
+	for _, rec := range a.sorted() {
+		var answers []string
+		for _, ans := range rec.Answers {
+			answers = append(answers, strings.Join(ans.Answer, " "))
+		}
+		values = append(values, fmt.Sprintf("%s %s %d %s", rec.Domain, rec.Type, rec.TTL,
+			strings.Join(answers, ",")))
+	}
+	return values
+}
+
+func answers(values ...string) []answer {
+	var answers []answer
+	for _, value := range values {
+		answers = append(answers, answer{Answer: strings.Fields(value)})
+	}
+	return answers
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) r53.Route53Client {
+	client := New(Config{APIKey: testAPIKey, Zone: "example.com", APIURL: server.URL})
+	domain, err := client.GetHostedZoneDomain()
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com.", domain)
+	return client
+}
+
+func TestGetHostedZoneDomainFailsIfTheZoneDoesntExist(t *testing.T) {
+	_, server := newFakeAPI("another.com")
+	defer server.Close()
+
+	_, err := New(Config{APIKey: testAPIKey, Zone: "example.com", APIURL: server.URL}).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unable to look up NS1 zone example.com")
+		assert.Contains(t, err.Error(), "zone not found")
+	}
+}
+
+func TestRequestsFailWithTheAPIError(t *testing.T) {
+	_, server := newFakeAPI("example.com")
+	defer server.Close()
+
+	_, err := New(Config{APIKey: "wrong", Zone: "example.com", APIURL: server.URL}).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "401 Unauthorized")
+	}
+}
+
+func TestGetRecordsConvertsRecordsToRecordSets(t *testing.T) {
+	// given
+	_, server := newFakeAPI("example.com",
+		record{Domain: "foo.example.com", Type: "CNAME", TTL: 300, Answers: answers("lb.example.net.")},
+		record{Domain: "example.com", Type: "A", TTL: 3600, Answers: answers("10.0.0.1", "10.0.0.2")},
+		record{Domain: "foo.example.com", Type: "TXT", TTL: 60, Answers: answers(`"hello"`)},
+		record{Domain: "example.com", Type: "MX", TTL: 3600, Answers: answers("10 mail.example.com")},
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	records, err := client.GetRecords()
+	txtRecords, txtErr := client.GetTXTRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*route53.ResourceRecordSet{
+		{
+			Name: aws.String("example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(3600),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.1")},
+				{Value: aws.String("10.0.0.2")},
+			},
+		},
+		dnstest.CNAME("foo.example.com.", "lb.example.net", 300),
+	}, records)
+	assert.NoError(t, txtErr)
+	assert.Equal(t, []*route53.ResourceRecordSet{{
+		Name:            aws.String("foo.example.com."),
+		Type:            aws.String("TXT"),
+		TTL:             aws.Int64(60),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"hello"`)}},
+	}}, txtRecords)
+}
+
+func TestUpdateRecordSetsCreatesReplacesAndDeletesRecords(t *testing.T) {
+	// given
+	api, server := newFakeAPI("example.com",
+		record{Domain: "update.example.com", Type: "CNAME", TTL: 300, Answers: answers("old.example.net")},
+		record{Domain: "delete.example.com", Type: "CNAME", TTL: 300, Answers: answers("lb.example.net")},
+		record{Domain: "ips.example.com", Type: "A", TTL: 60, Answers: answers("10.0.0.1", "10.0.0.2")},
+		record{Domain: "example.com", Type: "MX", TTL: 3600, Answers: answers("10 mail.example.com")},
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{
+		{Action: aws.String("CREATE"), ResourceRecordSet: dnstest.CNAME("create.example.com.", "lb.example.net", 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("update.example.com.", "new.example.net", 60)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name: aws.String("ips.example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.2")},
+				{Value: aws.String("10.0.0.3")},
+			},
+		}},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("*.apps.example.com.", "lb.example.net", 60)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: dnstest.CNAME("delete.example.com.", "lb.example.net", 300)},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"*.apps.example.com CNAME 60 lb.example.net",
+		"create.example.com CNAME 300 lb.example.net",
+		"example.com MX 3600 10 mail.example.com",
+		"ips.example.com A 60 10.0.0.2,10.0.0.3",
+		"update.example.com CNAME 60 new.example.net",
+	}, api.values())
+}
+
+func TestUpdateRecordSetsFailsForChangesWhichCantBeApplied(t *testing.T) {
+	_, server := newFakeAPI("example.com",
+		record{Domain: "foo.example.com", Type: "CNAME", TTL: 60, Answers: answers("lb.example.net")})
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	dnstest.RunUnappliedChanges(t, client, "NS1")
+}
+
+func TestConformance(t *testing.T) {
+	dnstest.RunConformance(t, func() (func(id string) r53.Route53Client, func()) {
+		_, server := newFakeAPI(dnstest.Zone)
+		return func(id string) r53.Route53Client {
+			return New(Config{APIKey: testAPIKey, Zone: id, APIURL: server.URL})
+		}, server.Close
+	})
+}
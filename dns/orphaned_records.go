@@ -0,0 +1,68 @@
+package dns
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+)
+
+// orphanedRecords delays deleting records which have lost their ingress until they've been orphaned for the grace
+// period, across consecutive updates, so records survive an ingress being recreated. Orphans are only tracked in
+// memory, so the grace period starts again after a restart.
+type orphanedRecords struct {
+	sync.Mutex
+	gracePeriod time.Duration
+	now         func() time.Time
+	since       map[orphanKey]time.Time
+}
+
+type orphanKey struct {
+	zone, name, recordType, setIdentifier string
+}
+
+func newOrphanedRecords(gracePeriod time.Duration) *orphanedRecords {
+	return &orphanedRecords{
+		gracePeriod: gracePeriod,
+		now:         time.Now,
+		since:       make(map[orphanKey]time.Time),
+	}
+}
+
+// expired returns the deletes of records which have been orphaned for at least the grace period. Records of the
+// zone which are no longer orphaned, as their ingress came back, stop being tracked.
+func (o *orphanedRecords) expired(zone *hostedZone, deletes []*route53.Change) []*route53.Change {
+	o.Lock()
+	defer o.Unlock()
+
+	now := o.now()
+	orphaned := make(map[orphanKey]bool)
+	var expired []*route53.Change
+	for _, change := range deletes {
+		rrs := change.ResourceRecordSet
+		key := orphanKey{zone.id, aws.StringValue(rrs.Name), aws.StringValue(rrs.Type), aws.StringValue(rrs.SetIdentifier)}
+		orphaned[key] = true
+
+		since, tracked := o.since[key]
+		if !tracked {
+			since = now
+			o.since[key] = now
+			log.Infof("%s %s lost its ingress, deleting it in %v unless the ingress comes back", key.recordType,
+				key.name, o.gracePeriod)
+		}
+		if now.Sub(since) >= o.gracePeriod {
+			expired = append(expired, change)
+		}
+	}
+
+	for key := range o.since {
+		if key.zone == zone.id && !orphaned[key] {
+			log.Infof("%s %s is no longer orphaned, keeping it", key.recordType, key.name)
+			delete(o.since, key)
+		}
+	}
+
+	return expired
+}
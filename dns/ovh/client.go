@@ -0,0 +1,321 @@
+/*
+Package ovh is the OVH provider of feed-dns, managing the records of an OVH DNS zone through the OVH API. Requests
+are signed with the application secret and consumer key against OVH's clock, and the zone is refreshed after it's
+changed, as OVH only publishes changes to a zone when it's refreshed.
+*/
+package ovh
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/dns/recordset"
+)
+
+const (
+	// DefaultEndpoint is the URL of the OVH Europe API.
+	DefaultEndpoint = "https://eu.api.ovh.com/1.0"
+	requestTimeout  = 30 * time.Second
+	// defaultTTL is the TTL of records without their own, which use the TTL of the zone, OVH's default.
+	defaultTTL = 3600
+	// minTTL is the smallest TTL OVH accepts.
+	minTTL = 60
+	// signaturePrefix is the version of OVH's request signatures.
+	signaturePrefix = "$1$"
+)
+
+// Capabilities are those of OVH zone records, whose TTLs are at least a minute.
+var Capabilities = r53.Capabilities{Provider: "ovh", IPv6: true, TXT: true, MinTTL: minTTL, MaxTTL: r53.MaxTTL}
+
+// Config describes the OVH DNS zone to manage and how to reach the API.
+// ApplicationKey and ApplicationSecret identify the OVH application, and ConsumerKey is a consumer key with access
+// to the records and refresh of the Zone, which is the zone's domain, e.g. example.com.
+// Endpoint overrides DefaultEndpoint, e.g. for OVH's other regions or testing.
+type Config struct {
+	ApplicationKey    string
+	ApplicationSecret string
+	ConsumerKey       string
+	Zone              string
+	Endpoint          string
+}
+
+type client struct {
+	http      *http.Client
+	endpoint  string
+	config    Config
+	zone      string
+	names     recordset.Names
+	now       func() time.Time
+	timeDelta time.Duration
+	lookedUp  bool
+}
+
+// record is a record of the OVH API. Each value of a record set is a separate record.
+type record struct {
+	ID        int64  `json:"id,omitempty"`
+	FieldType string `json:"fieldType"`
+	SubDomain string `json:"subDomain"`
+	Target    string `json:"target"`
+	TTL       int64  `json:"ttl"`
+}
+
+// recordUpdate is the body of a request to change a record, which can't change its type.
+type recordUpdate struct {
+	SubDomain string `json:"subDomain"`
+	Target    string `json:"target"`
+	TTL       int64  `json:"ttl"`
+}
+
+// NewUpdater creates a dns updater of the OVH zones named by the hosted zone ids of the updater config. They share
+// the application and consumer keys of the config, with a client per zone.
+func NewUpdater(lbAdapter adapter.FrontendAdapter, updaterConfig dns.Config, config Config) controller.Updater {
+	updaterConfig.ZoneClient = func(zone string) r53.Route53Client {
+		zoneConfig := config
+		zoneConfig.Zone = zone
+		return New(zoneConfig)
+	}
+	return dns.New(lbAdapter, updaterConfig)
+}
+
+// New creates a client of an OVH DNS zone. Requests are signed with OVH's time, which GetHostedZoneDomain gets, and the
+// zone is refreshed after each update which changes it.
+func New(config Config) r53.Route53Client {
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	zone := strings.TrimSuffix(config.Zone, ".")
+	return &client{
+		http:     &http.Client{Timeout: requestTimeout},
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		config:   config,
+		zone:     zone,
+		names:    recordset.Names{Zone: zone},
+		now:      time.Now,
+	}
+}
+
+// Capabilities of the client.
+func (c *client) Capabilities() r53.Capabilities {
+	return Capabilities
+}
+
+// GetHostedZoneDomain syncs the time requests are signed with to OVH's, and looks up the zone, which fails if the
+// credentials are invalid. It returns the zone's domain with a trailing period.
+func (c *client) GetHostedZoneDomain() (string, error) {
+	var serverTime int64
+	if err := c.do(http.MethodGet, "/auth/time", false, nil, &serverTime); err != nil {
+		return "", fmt.Errorf("unable to get the time of the OVH API: %v", err)
+	}
+	c.timeDelta = time.Unix(serverTime, 0).Sub(c.now())
+
+	var zone struct {
+		Name string `json:"name"`
+	}
+	if err := c.do(http.MethodGet, c.zonePath(""), true, nil, &zone); err != nil {
+		return "", fmt.Errorf("unable to look up OVH zone %s: %v", c.zone, err)
+	}
+	c.lookedUp = true
+	return c.zone + ".", nil
+}
+
+// GetRecords returns the CNAME, A and AAAA record sets of the zone.
+func (c *client) GetRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsAddress)
+}
+
+// GetTXTRecords returns the TXT record sets of the zone.
+func (c *client) GetTXTRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(recordset.IsTXT)
+}
+
+func (c *client) listRecordSets(include func(recordType string) bool) ([]*route53.ResourceRecordSet, error) {
+	records, err := c.listRecords()
+	if err != nil {
+		return nil, err
+	}
+	return recordset.Sets(records, include), nil
+}
+
+// listRecords lists the ids of the records of the zone, then gets each record, as the API only lists ids.
+func (c *client) listRecords() ([]recordset.Record, error) {
+	if !c.lookedUp {
+		return nil, fmt.Errorf("ovh zone %s hasn't been looked up", c.zone)
+	}
+
+	var ids []int64
+	if err := c.do(http.MethodGet, c.zonePath("/record"), true, nil, &ids); err != nil {
+		return nil, fmt.Errorf("unable to list records of OVH zone %s: %v", c.zone, err)
+	}
+
+	var records []recordset.Record
+	for _, id := range ids {
+		var rec record
+		if err := c.do(http.MethodGet, c.recordPath(id), true, nil, &rec); err != nil {
+			return nil, fmt.Errorf("unable to get record %d of OVH zone %s: %v", id, c.zone, err)
+		}
+		records = append(records, c.recordOf(rec))
+	}
+	return records, nil
+}
+
+// UpdateRecordSets applies the changes in order, as OVH records, then refreshes the zone if any were applied. A
+// change which can't be applied, such as deleting a record set which doesn't exist, fails the update, leaving the
+// changes before it applied.
+func (c *client) UpdateRecordSets(changes []*route53.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	records, err := c.listRecords()
+	if err != nil {
+		return err
+	}
+
+	applied, err := recordset.Apply("OVH DNS", c, records, changes)
+	if applied {
+		if refreshErr := c.do(http.MethodPost, c.zonePath("/refresh"), true, nil, nil); refreshErr != nil && err == nil {
+			err = fmt.Errorf("unable to refresh OVH zone %s: %v", c.zone, refreshErr)
+		}
+	}
+	return err
+}
+
+// Create creates an OVH record of the record set with the value.
+func (c *client) Create(rrs *route53.ResourceRecordSet, value string) (recordset.Record, error) {
+	rec := record{
+		FieldType: aws.StringValue(rrs.Type),
+		SubDomain: c.names.Relative(aws.StringValue(rrs.Name)),
+		Target:    targetOf(aws.StringValue(rrs.Type), value),
+		TTL:       aws.Int64Value(rrs.TTL),
+	}
+	var created record
+	if err := c.do(http.MethodPost, c.zonePath("/record"), true, rec, &created); err != nil {
+		return recordset.Record{}, err
+	}
+	return c.recordOf(created), nil
+}
+
+// UpdateTTL changes the TTL of the OVH record.
+func (c *client) UpdateTTL(rec recordset.Record, ttl int64) (recordset.Record, error) {
+	updated := rec.Native.(record)
+	updated.TTL = ttl
+	update := recordUpdate{SubDomain: updated.SubDomain, Target: updated.Target, TTL: ttl}
+	if err := c.do(http.MethodPut, c.recordPath(updated.ID), true, update, nil); err != nil {
+		return recordset.Record{}, err
+	}
+	return c.recordOf(updated), nil
+}
+
+// Delete deletes the OVH record.
+func (c *client) Delete(rec recordset.Record) error {
+	return c.do(http.MethodDelete, c.recordPath(rec.Native.(record).ID), true, nil, nil)
+}
+
+// recordOf returns the value of a record set an OVH record is.
+func (c *client) recordOf(rec record) recordset.Record {
+	return recordset.Record{Name: c.names.FQDN(rec.SubDomain), Type: rec.FieldType, Value: valueOf(rec),
+		TTL: ttlOf(rec), Native: rec}
+}
+
+func (c *client) zonePath(suffix string) string {
+	return "/domain/zone/" + url.PathEscape(c.zone) + suffix
+}
+
+func (c *client) recordPath(id int64) string {
+	return c.zonePath("/record/" + strconv.FormatInt(id, 10))
+}
+
+func ttlOf(rec record) int64 {
+	if rec.TTL == 0 {
+		return defaultTTL
+	}
+	return rec.TTL
+}
+
+// targetOf returns the OVH target of a record value. CNAME targets need a trailing period, otherwise OVH treats them
+// as relative to the zone.
+func targetOf(recordType, value string) string {
+	if recordType == route53.RRTypeCname && !strings.HasSuffix(value, ".") {
+		return value + "."
+	}
+	return value
+}
+
+// valueOf returns the record value of an OVH record, without the trailing period of CNAME targets.
+func valueOf(rec record) string {
+	if rec.FieldType == route53.RRTypeCname {
+		return strings.TrimSuffix(rec.Target, ".")
+	}
+	return rec.Target
+}
+
+// do sends a request to the API, signed with the credentials if authenticated, decoding the response into out if
+// it isn't nil.
+func (c *client) do(method, path string, authenticated bool, in, out interface{}) error {
+	var encoded []byte
+	if in != nil {
+		var err error
+		if encoded, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	fullURL := c.endpoint + path
+	req, err := http.NewRequest(method, fullURL, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authenticated {
+		timestamp := strconv.FormatInt(c.now().Add(c.timeDelta).Unix(), 10)
+		req.Header.Set("X-Ovh-Application", c.config.ApplicationKey)
+		req.Header.Set("X-Ovh-Consumer", c.config.ConsumerKey)
+		req.Header.Set("X-Ovh-Timestamp", timestamp)
+		req.Header.Set("X-Ovh-Signature", signature(c.config.ApplicationSecret, c.config.ConsumerKey, method, fullURL,
+			string(encoded), timestamp))
+	}
+
+	log.Debugf("OVH API %s %s", method, path)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("ovh API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// signature signs a request as OVH requires, with a SHA1 of the secret, consumer key, method, URL, body and
+// timestamp.
+func signature(secret, consumerKey, method, fullURL, body, timestamp string) string {
+	sum := sha1.Sum([]byte(strings.Join([]string{secret, consumerKey, method, fullURL, body, timestamp}, "+")))
+	return signaturePrefix + hex.EncodeToString(sum[:])
+}
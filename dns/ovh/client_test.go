@@ -0,0 +1,292 @@
+package ovh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/dns/dnstest"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+const (
+	testAppKey      = "app-key"
+	testAppSecret   = "app-secret"
+	testConsumerKey = "consumer-key"
+	testServerTime  = 1500000000
+)
+
+// fakeAPI is an in-memory OVH API of a single zone, which checks the signature of authenticated requests.
+type fakeAPI struct {
+	*dnstest.FakeAPI
+	zone      string
+	records   map[int64]record
+	nextID    int64
+	refreshes int
+}
+
+func newFakeAPI(zone string, records ...record) (*fakeAPI, *httptest.Server) {
+	api := &fakeAPI{zone: zone, records: make(map[int64]record)}
+	for _, rec := range records {
+		api.add(rec)
+	}
+	api.FakeAPI = dnstest.NewFakeAPI(api)
+	return api, api.Server
+}
+
+func (a *fakeAPI) add(rec record) record {
+	a.nextID++
+	rec.ID = a.nextID
+	a.records[rec.ID] = rec
+	return rec
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/auth/time" {
+		json.NewEncoder(w).Encode(testServerTime)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	timestamp := r.Header.Get("X-Ovh-Timestamp")
+	expected := signature(testAppSecret, testConsumerKey, r.Method, "http://"+r.Host+r.URL.RequestURI(), string(body),
+		timestamp)
+	if r.Header.Get("X-Ovh-Application") != testAppKey || r.Header.Get("X-Ovh-Signature") != expected {
+		http.Error(w, `{"message":"Invalid signature"}`, http.StatusBadRequest)
+		return
+	}
+	if timestamp != strconv.Itoa(testServerTime) {
+		http.Error(w, `{"message":"Query out of time"}`, http.StatusBadRequest)
+		return
+	}
+
+	zonePath := "/domain/zone/" + a.zone
+	recordPrefix := zonePath + "/record/"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == zonePath:
+		json.NewEncoder(w).Encode(map[string]string{"name": a.zone})
+	case r.Method == http.MethodGet && r.URL.Path == zonePath+"/record":
+		ids := []int64{}
+		for _, rec := range a.sorted() {
+			ids = append(ids, rec.ID)
+		}
+		json.NewEncoder(w).Encode(ids)
+	case r.Method == http.MethodPost && r.URL.Path == zonePath+"/record":
+		var rec record
+		json.Unmarshal(body, &rec)
+		json.NewEncoder(w).Encode(a.add(rec))
+	case r.Method == http.MethodPost && r.URL.Path == zonePath+"/refresh":
+		a.refreshes++
+	case strings.HasPrefix(r.URL.Path, recordPrefix):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, recordPrefix), 10, 64)
+		rec, ok := a.records[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(rec)
+		case http.MethodPut:
+			var update recordUpdate
+			json.Unmarshal(body, &update)
+			rec.SubDomain, rec.Target, rec.TTL = update.SubDomain, update.Target, update.TTL
+			a.records[id] = rec
+		case http.MethodDelete:
+			delete(a.records, id)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *fakeAPI) sorted() []record {
+	var all []record
+	for _, rec := range a.records {
+		all = append(all, rec)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].SubDomain != all[j].SubDomain {
+			return all[i].SubDomain < all[j].SubDomain
+		}
+		return all[i].Target < all[j].Target
+	})
+	return all
+}
+
+// values describes the records of the fake, as sub-domain type target ttl.
+func (a *fakeAPI) values() []string {
+	a.Lock()
+	defer a.Unlock()
+	var values []string
+	for _, rec := range a.sorted() {
+		values = append(values, fmt.Sprintf("%s %s %s %d", rec.SubDomain, rec.FieldType, rec.Target, rec.TTL))
+	}
+	return values
+}
+
+func testConfig(server *httptest.Server) Config {
+	return Config{ApplicationKey: testAppKey, ApplicationSecret: testAppSecret, ConsumerKey: testConsumerKey,
+		Zone: "example.com", Endpoint: server.URL}
+}
+
+// newWithClock creates a client whose clock is ahead of OVH's, so requests are only accepted if they're signed with
+// OVH's time.
+func newWithClock(config Config) r53.Route53Client {
+	ovh := New(config)
+	ovh.(*client).now = func() time.Time { return time.Unix(testServerTime+3600, 0) }
+	return ovh
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) r53.Route53Client {
+	client := newWithClock(testConfig(server))
+	domain, err := client.GetHostedZoneDomain()
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com.", domain)
+	return client
+}
+
+func TestGetHostedZoneDomainFailsWithInvalidCredentials(t *testing.T) {
+	_, server := newFakeAPI("example.com")
+	defer server.Close()
+	config := testConfig(server)
+	config.ApplicationSecret = "wrong"
+
+	_, err := newWithClock(config).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unable to look up OVH zone example.com")
+		assert.Contains(t, err.Error(), "Invalid signature")
+	}
+}
+
+func TestGetHostedZoneDomainFailsIfTheZoneDoesntExist(t *testing.T) {
+	_, server := newFakeAPI("another.com")
+	defer server.Close()
+
+	_, err := newWithClock(testConfig(server)).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "404 Not Found")
+	}
+}
+
+func TestGetRecordsConvertsRecordsToRecordSets(t *testing.T) {
+	// given
+	_, server := newFakeAPI("example.com",
+		record{FieldType: "CNAME", SubDomain: "foo", Target: "lb.example.net.", TTL: 300},
+		record{FieldType: "A", SubDomain: "", Target: "10.0.0.1"},
+		record{FieldType: "A", SubDomain: "", Target: "10.0.0.2"},
+		record{FieldType: "TXT", SubDomain: "foo", Target: `"hello"`, TTL: 60},
+		record{FieldType: "MX", SubDomain: "", Target: "10 mail.example.com."},
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	records, err := client.GetRecords()
+	txtRecords, txtErr := client.GetTXTRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*route53.ResourceRecordSet{
+		{
+			Name: aws.String("example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(defaultTTL),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.1")},
+				{Value: aws.String("10.0.0.2")},
+			},
+		},
+		dnstest.CNAME("foo.example.com.", "lb.example.net", 300),
+	}, records)
+	assert.NoError(t, txtErr)
+	assert.Equal(t, []*route53.ResourceRecordSet{{
+		Name:            aws.String("foo.example.com."),
+		Type:            aws.String("TXT"),
+		TTL:             aws.Int64(60),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"hello"`)}},
+	}}, txtRecords)
+}
+
+func TestUpdateRecordSetsCreatesUpsertsAndDeletesRecordsThenRefreshesTheZone(t *testing.T) {
+	// given
+	api, server := newFakeAPI("example.com",
+		record{FieldType: "CNAME", SubDomain: "update", Target: "old.example.net.", TTL: 300},
+		record{FieldType: "CNAME", SubDomain: "ttl", Target: "lb.example.net.", TTL: 300},
+		record{FieldType: "CNAME", SubDomain: "delete", Target: "lb.example.net.", TTL: 300},
+		record{FieldType: "A", SubDomain: "ips", Target: "10.0.0.1", TTL: 60},
+		record{FieldType: "A", SubDomain: "ips", Target: "10.0.0.2", TTL: 60},
+		record{FieldType: "MX", SubDomain: "", Target: "10 mail.example.com."},
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{
+		{Action: aws.String("CREATE"), ResourceRecordSet: dnstest.CNAME("create.example.com.", "lb.example.net", 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("update.example.com.", "new.example.net", 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("ttl.example.com.", "lb.example.net", 60)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name: aws.String("ips.example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.2")},
+				{Value: aws.String("10.0.0.3")},
+			},
+		}},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("example.com.", "apex.example.net", 300)},
+		{Action: aws.String("DELETE"), ResourceRecordSet: dnstest.CNAME("delete.example.com.", "lb.example.net", 300)},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		" MX 10 mail.example.com. 0",
+		" CNAME apex.example.net. 300",
+		"create CNAME lb.example.net. 300",
+		"ips A 10.0.0.2 60",
+		"ips A 10.0.0.3 60",
+		"ttl CNAME lb.example.net. 60",
+		"update CNAME new.example.net. 300",
+	}, api.values())
+	assert.Equal(t, 1, api.refreshes)
+}
+
+func TestUpdateRecordSetsFailsForChangesWhichCantBeApplied(t *testing.T) {
+	api, server := newFakeAPI("example.com", record{FieldType: "CNAME", SubDomain: "foo", Target: "lb.example.net."})
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	dnstest.RunUnappliedChanges(t, client, "OVH DNS")
+	assert.Equal(t, 0, api.refreshes, "nothing was changed")
+}
+
+func TestConformance(t *testing.T) {
+	dnstest.RunConformance(t, func() (func(id string) r53.Route53Client, func()) {
+		_, server := newFakeAPI(dnstest.Zone)
+		return func(id string) r53.Route53Client {
+			config := testConfig(server)
+			config.Zone = id
+			return newWithClock(config)
+		}, server.Close
+	})
+}
@@ -0,0 +1,155 @@
+package dns
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns/adapter"
+)
+
+const (
+	// ownershipPrefix is prepended to a host to name its ownership TXT record. A separate name is needed as
+	// a TXT record can't share a name with a CNAME.
+	ownershipPrefix = "_feed-owner."
+	ownershipTTL    = 300
+)
+
+// ownershipRegistry tracks which hosts are owned by a feed-dns instance, using a TXT record for each host
+// containing the owner id. Only records for owned hosts are managed. Hosts with records which aren't owned are
+// left alone.
+type ownershipRegistry struct {
+	ownerID string
+}
+
+// ownership of the hosts in a hosted zone.
+type ownership struct {
+	// owned maps each owned host to its TXT record.
+	owned map[string]*route53.ResourceRecordSet
+	// foreign hosts have records, but aren't owned.
+	foreign map[string]bool
+}
+
+func newOwnershipRegistry(ownerID string) *ownershipRegistry {
+	return &ownershipRegistry{ownerID: ownerID}
+}
+
+func (r *ownershipRegistry) value() string {
+	return fmt.Sprintf("\"heritage=feed,feed/owner=%s\"", r.ownerID)
+}
+
+// ownership determines the owned and foreign hosts, from the TXT records and the A/AAAA/CNAME records of a zone.
+func (r *ownershipRegistry) ownership(txtRecords, records []*route53.ResourceRecordSet) ownership {
+	o := ownership{
+		owned:   make(map[string]*route53.ResourceRecordSet),
+		foreign: make(map[string]bool),
+	}
+
+	for _, txt := range txtRecords {
+		name := aws.StringValue(txt.Name)
+		if !strings.HasPrefix(name, ownershipPrefix) {
+			continue
+		}
+		for _, rr := range txt.ResourceRecords {
+			if aws.StringValue(rr.Value) == r.value() {
+				o.owned[strings.TrimPrefix(name, ownershipPrefix)] = txt
+			}
+		}
+	}
+
+	for _, rec := range records {
+		name := aws.StringValue(rec.Name)
+		if _, owned := o.owned[name]; !owned {
+			o.foreign[name] = true
+		}
+	}
+
+	return o
+}
+
+// filterOwned returns the records of owned hosts.
+func (o ownership) filterOwned(records []adapter.ConsolidatedRecord) []adapter.ConsolidatedRecord {
+	var owned []adapter.ConsolidatedRecord
+	var notOwned []string
+	for _, rec := range records {
+		if _, ok := o.owned[rec.Name]; ok {
+			owned = append(owned, rec)
+		} else {
+			notOwned = append(notOwned, rec.Name)
+		}
+	}
+
+	if len(notOwned) > 0 {
+		log.Infof("Filtered %d resource record sets without an ownership record: %v", len(notOwned), notOwned)
+	}
+	return owned
+}
+
+// filterEntries removes entries for foreign hosts, so their records aren't replaced.
+func (o ownership) filterEntries(entries controller.IngressEntries) (controller.IngressEntries, []string) {
+	var filtered controller.IngressEntries
+	var skipped []string
+	for _, entry := range entries {
+		if o.foreign[entry.Host+"."] {
+			skipped = append(skipped, entry.NamespaceName()+":not-owned:"+entry.Host)
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	return filtered, skipped
+}
+
+// changes creates ownership records for hosts which will have records after the record changes are applied,
+// and deletes the ownership records of hosts which won't.
+func (r *ownershipRegistry) changes(o ownership, records []adapter.ConsolidatedRecord,
+	recordChanges []*route53.Change) []*route53.Change {
+
+	type recordSet struct{ name, recordType, setIdentifier string }
+	remaining := make(map[recordSet]bool)
+	for _, rec := range records {
+		remaining[recordSet{rec.Name, rec.Type, rec.SetIdentifier}] = true
+	}
+	for _, change := range recordChanges {
+		rrs := change.ResourceRecordSet
+		key := recordSet{aws.StringValue(rrs.Name), aws.StringValue(rrs.Type), aws.StringValue(rrs.SetIdentifier)}
+		remaining[key] = aws.StringValue(change.Action) != route53.ChangeActionDelete
+	}
+
+	hosts := make(map[string]bool)
+	for key, exists := range remaining {
+		if exists {
+			hosts[key.name] = true
+		}
+	}
+
+	var changes []*route53.Change
+	for host := range hosts {
+		if _, owned := o.owned[host]; !owned {
+			changes = append(changes, &route53.Change{
+				Action: aws.String(route53.ChangeActionUpsert),
+				ResourceRecordSet: &route53.ResourceRecordSet{
+					Name:            aws.String(ownershipPrefix + host),
+					Type:            aws.String(route53.RRTypeTxt),
+					TTL:             aws.Int64(ownershipTTL),
+					ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(r.value())}},
+				},
+			})
+		}
+	}
+	for host, txt := range o.owned {
+		if !hosts[host] {
+			changes = append(changes, &route53.Change{
+				Action:            aws.String(route53.ChangeActionDelete),
+				ResourceRecordSet: txt,
+			})
+		}
+	}
+	name := func(i int) string { return aws.StringValue(changes[i].ResourceRecordSet.Name) }
+	sort.Slice(changes, func(i, j int) bool { return name(i) < name(j) })
+
+	return changes
+}
@@ -0,0 +1,315 @@
+/*
+Package powerdns is the PowerDNS provider of feed-dns, e.g. for on-prem clusters, managing the RRSets of a zone on
+an authoritative server through its HTTP API. Names and CNAME targets are canonical, with a trailing period, and
+every update is a single PATCH of the zone.
+*/
+package powerdns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+)
+
+const (
+	// DefaultServerID is the id of the server of the PowerDNS API, which is always localhost for the
+	// authoritative server.
+	DefaultServerID = "localhost"
+	// apiKeyHeader authenticates requests with the API key.
+	apiKeyHeader   = "X-API-Key"
+	requestTimeout = 30 * time.Second
+	// PowerDNS change types of an RRSet in a PATCH of a zone.
+	changeTypeReplace = "REPLACE"
+	changeTypeDelete  = "DELETE"
+)
+
+// Capabilities are those of PowerDNS RRSets. PowerDNS's LUA records could route, but aren't managed.
+var Capabilities = r53.Capabilities{Provider: "powerdns", IPv6: true, TXT: true, MaxTTL: r53.MaxTTL}
+
+// Config describes the PowerDNS zone to manage and how to reach the API.
+// APIURL is the URL of the webserver of PowerDNS, e.g. http://pdns:8081, and APIKey its api-key. ServerID defaults
+// to DefaultServerID. Zone is the zone's domain, e.g. example.com.
+type Config struct {
+	APIURL   string
+	APIKey   string
+	ServerID string
+	Zone     string
+}
+
+type client struct {
+	http     *http.Client
+	zoneURL  string
+	apiKey   string
+	zone     string
+	lookedUp bool
+}
+
+// rrset is an RRSet of the PowerDNS API, with the canonical name of its records, which has a trailing period.
+type rrset struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	TTL        int64    `json:"ttl,omitempty"`
+	ChangeType string   `json:"changetype,omitempty"`
+	Records    []record `json:"records"`
+}
+
+type record struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+type zoneResponse struct {
+	Name   string  `json:"name"`
+	RRSets []rrset `json:"rrsets"`
+}
+
+// NewUpdater creates a dns updater of zones of the PowerDNS server, named by the hosted zone ids of the updater
+// config, with or without a trailing period.
+func NewUpdater(lbAdapter adapter.FrontendAdapter, updaterConfig dns.Config, config Config) controller.Updater {
+	updaterConfig.ZoneClient = func(zone string) r53.Route53Client {
+		zoneConfig := config
+		zoneConfig.Zone = zone
+		return New(zoneConfig)
+	}
+	return dns.New(lbAdapter, updaterConfig)
+}
+
+// New creates a client of a zone of the PowerDNS server, authenticated with the API key of the config. The changes
+// of an update are sent in one PATCH, so they're applied together or not at all.
+func New(config Config) r53.Route53Client {
+	serverID := config.ServerID
+	if serverID == "" {
+		serverID = DefaultServerID
+	}
+	zone := strings.TrimSuffix(config.Zone, ".")
+	return &client{
+		http: &http.Client{Timeout: requestTimeout},
+		zoneURL: strings.TrimSuffix(config.APIURL, "/") + "/api/v1/servers/" + url.PathEscape(serverID) +
+			"/zones/" + url.PathEscape(zone+"."),
+		apiKey: config.APIKey,
+		zone:   zone,
+	}
+}
+
+// Capabilities of the client.
+func (c *client) Capabilities() r53.Capabilities {
+	return Capabilities
+}
+
+// GetHostedZoneDomain looks up the zone, which fails if the API key is invalid, and returns its domain with a
+// trailing period.
+func (c *client) GetHostedZoneDomain() (string, error) {
+	if _, err := c.getZone(); err != nil {
+		return "", fmt.Errorf("unable to look up PowerDNS zone %s: %v", c.zone, err)
+	}
+	c.lookedUp = true
+	return c.zone + ".", nil
+}
+
+// GetRecords returns the CNAME, A and AAAA record sets of the zone.
+func (c *client) GetRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(func(recordType string) bool {
+		return recordType == route53.RRTypeA || recordType == route53.RRTypeAaaa || recordType == route53.RRTypeCname
+	})
+}
+
+// GetTXTRecords returns the TXT record sets of the zone.
+func (c *client) GetTXTRecords() ([]*route53.ResourceRecordSet, error) {
+	return c.listRecordSets(func(recordType string) bool {
+		return recordType == route53.RRTypeTxt
+	})
+}
+
+// listRecordSets returns the record sets of the zone's RRSets, leaving out disabled records.
+func (c *client) listRecordSets(include func(recordType string) bool) ([]*route53.ResourceRecordSet, error) {
+	rrsets, err := c.listRRSets()
+	if err != nil {
+		return nil, err
+	}
+
+	var recordSets []*route53.ResourceRecordSet
+	for _, set := range rrsets {
+		if !include(set.Type) {
+			continue
+		}
+		rrs := &route53.ResourceRecordSet{
+			Name: aws.String(set.Name),
+			Type: aws.String(set.Type),
+			TTL:  aws.Int64(set.TTL),
+		}
+		for _, rec := range set.Records {
+			if !rec.Disabled {
+				rrs.ResourceRecords = append(rrs.ResourceRecords,
+					&route53.ResourceRecord{Value: aws.String(valueOf(set.Type, rec.Content))})
+			}
+		}
+		if len(rrs.ResourceRecords) > 0 {
+			recordSets = append(recordSets, rrs)
+		}
+	}
+	return recordSets, nil
+}
+
+func (c *client) listRRSets() ([]rrset, error) {
+	if !c.lookedUp {
+		return nil, fmt.Errorf("powerdns zone %s hasn't been looked up", c.zone)
+	}
+	zone, err := c.getZone()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list records of PowerDNS zone %s: %v", c.zone, err)
+	}
+	return zone.RRSets, nil
+}
+
+func (c *client) getZone() (*zoneResponse, error) {
+	var zone zoneResponse
+	if err := c.do(http.MethodGet, nil, &zone); err != nil {
+		return nil, err
+	}
+	return &zone, nil
+}
+
+// UpdateRecordSets applies the changes in a single PATCH of the zone's RRSets, so either all of them are applied or
+// none are. The last change of each record set replaces earlier ones, as PowerDNS changes each RRSet once. A change
+// which can't be applied, such as deleting a record set which doesn't exist, fails the update.
+func (c *client) UpdateRecordSets(changes []*route53.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	rrsets, err := c.listRRSets()
+	if err != nil {
+		return err
+	}
+	exists := make(map[string]bool)
+	for _, set := range rrsets {
+		exists[set.Name+" "+set.Type] = true
+	}
+
+	var patch []rrset
+	indexes := make(map[string]int)
+	for _, change := range changes {
+		rrs := change.ResourceRecordSet
+		if rrs.AliasTarget != nil {
+			return fmt.Errorf("can't change %s, alias records aren't supported by PowerDNS",
+				aws.StringValue(rrs.Name))
+		}
+		if rrs.SetIdentifier != nil {
+			return fmt.Errorf("can't change %s, routing policies aren't supported by PowerDNS",
+				aws.StringValue(rrs.Name))
+		}
+
+		name := canonical(aws.StringValue(rrs.Name))
+		key := name + " " + aws.StringValue(rrs.Type)
+		set := rrset{Name: name, Type: aws.StringValue(rrs.Type), Records: []record{}}
+		switch aws.StringValue(change.Action) {
+		case route53.ChangeActionCreate:
+			if exists[key] {
+				return fmt.Errorf("can't create %s, it already exists", key)
+			}
+			fallthrough
+		case route53.ChangeActionUpsert:
+			set.ChangeType = changeTypeReplace
+			set.TTL = aws.Int64Value(rrs.TTL)
+			for _, rr := range rrs.ResourceRecords {
+				set.Records = append(set.Records, record{Content: contentOf(set.Type, aws.StringValue(rr.Value))})
+			}
+			exists[key] = true
+		case route53.ChangeActionDelete:
+			if !exists[key] {
+				return fmt.Errorf("can't delete %s, it doesn't exist", key)
+			}
+			set.ChangeType = changeTypeDelete
+			exists[key] = false
+		default:
+			return fmt.Errorf("unknown action %s", aws.StringValue(change.Action))
+		}
+
+		if i, ok := indexes[key]; ok {
+			patch[i] = set
+			continue
+		}
+		indexes[key] = len(patch)
+		patch = append(patch, set)
+	}
+
+	if err := c.do(http.MethodPatch, map[string][]rrset{"rrsets": patch}, nil); err != nil {
+		return fmt.Errorf("unable to change records of PowerDNS zone %s: %v", c.zone, err)
+	}
+	return nil
+}
+
+// canonical returns the canonical form of a name, with the trailing period PowerDNS requires.
+func canonical(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// contentOf returns the PowerDNS content of a record value. CNAME targets are canonical, as PowerDNS requires.
+func contentOf(recordType, value string) string {
+	if recordType == route53.RRTypeCname {
+		return canonical(value)
+	}
+	return value
+}
+
+// valueOf returns the record value of PowerDNS content, without the trailing period of CNAME targets.
+func valueOf(recordType, content string) string {
+	if recordType == route53.RRTypeCname {
+		return strings.TrimSuffix(content, ".")
+	}
+	return content
+}
+
+// do sends a request to the zone, decoding the response into out if it isn't nil.
+func (c *client) do(method string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, c.zoneURL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(apiKeyHeader, c.apiKey)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	log.Debugf("PowerDNS %s %s", method, c.zoneURL)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("powerdns API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,268 @@
+package powerdns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/dns/dnstest"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+const testAPIKey = "api-key"
+
+// fakeAPI is an in-memory PowerDNS API of a single zone, which checks the API key of requests.
+type fakeAPI struct {
+	*dnstest.FakeAPI
+	zone    string
+	rrsets  map[string]rrset
+	patches int
+}
+
+func newFakeAPI(zone string, rrsets ...rrset) (*fakeAPI, *httptest.Server) {
+	api := &fakeAPI{zone: zone, rrsets: make(map[string]rrset)}
+	for _, set := range rrsets {
+		api.rrsets[set.Name+" "+set.Type] = set
+	}
+	api.FakeAPI = dnstest.NewFakeAPI(api)
+	return api, api.Server
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(apiKeyHeader) != testAPIKey {
+		http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Path != "/api/v1/servers/localhost/zones/"+a.zone {
+		http.Error(w, `{"error":"Could not find domain"}`, http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(zoneResponse{Name: a.zone, RRSets: a.sorted()})
+	case http.MethodPatch:
+		var patch struct {
+			RRSets []rrset `json:"rrsets"`
+		}
+		json.NewDecoder(r.Body).Decode(&patch)
+		for _, set := range patch.RRSets {
+			key := set.Name + " " + set.Type
+			if !strings.HasSuffix(set.Name, ".") {
+				http.Error(w, `{"error":"Name is not canonical"}`, http.StatusUnprocessableEntity)
+				return
+			}
+			switch set.ChangeType {
+			case changeTypeReplace:
+				set.ChangeType = ""
+				a.rrsets[key] = set
+			case changeTypeDelete:
+				delete(a.rrsets, key)
+			}
+		}
+		a.patches++
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *fakeAPI) sorted() []rrset {
+	var all []rrset
+	for _, set := range a.rrsets {
+		all = append(all, set)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return all[i].Type < all[j].Type
+	})
+	return all
+}
+
+// values describes the records of the fake, as name type ttl contents.
+func (a *fakeAPI) values() []string {
+	a.Lock()
+	defer a.Unlock()
+	var values []string
+	for _, set := range a.sorted() {
+		var contents []string
+		for _, rec := range set.Records {
+			contents = append(contents, rec.Content)
+		}
+		values = append(values, fmt.Sprintf("%s %s %d %s", set.Name, set.Type, set.TTL, strings.Join(contents, ",")))
+	}
+	return values
+}
+
+func testConfig(server *httptest.Server) Config {
+	return Config{APIURL: server.URL + "/", APIKey: testAPIKey, Zone: "example.com"}
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) r53.Route53Client {
+	client := New(testConfig(server))
+	domain, err := client.GetHostedZoneDomain()
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com.", domain)
+	return client
+}
+
+func set(name, recordType string, ttl int64, contents ...string) rrset {
+	s := rrset{Name: name, Type: recordType, TTL: ttl}
+	for _, content := range contents {
+		s.Records = append(s.Records, record{Content: content})
+	}
+	return s
+}
+
+func TestGetHostedZoneDomainFailsWithAnInvalidAPIKey(t *testing.T) {
+	_, server := newFakeAPI("example.com.")
+	defer server.Close()
+	config := testConfig(server)
+	config.APIKey = "wrong"
+
+	_, err := New(config).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unable to look up PowerDNS zone example.com")
+		assert.Contains(t, err.Error(), "401 Unauthorized")
+	}
+}
+
+func TestGetHostedZoneDomainFailsIfTheZoneDoesntExist(t *testing.T) {
+	_, server := newFakeAPI("another.com.")
+	defer server.Close()
+
+	_, err := New(testConfig(server)).GetHostedZoneDomain()
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "404 Not Found")
+	}
+}
+
+func TestGetRecordsConvertsRRSetsToRecordSets(t *testing.T) {
+	// given
+	disabled := set("disabled.example.com.", "A", 60, "10.0.0.9")
+	disabled.Records[0].Disabled = true
+	_, server := newFakeAPI("example.com.",
+		set("foo.example.com.", "CNAME", 300, "lb.example.net."),
+		set("example.com.", "A", 60, "10.0.0.1", "10.0.0.2"),
+		set("foo.example.com.", "TXT", 60, `"hello"`),
+		set("example.com.", "SOA", 3600, "ns1.example.com. admin.example.com. 1 10800 3600 604800 3600"),
+		disabled,
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	records, err := client.GetRecords()
+	txtRecords, txtErr := client.GetTXTRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*route53.ResourceRecordSet{
+		{
+			Name: aws.String("example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.1")},
+				{Value: aws.String("10.0.0.2")},
+			},
+		},
+		dnstest.CNAME("foo.example.com.", "lb.example.net", 300),
+	}, records)
+	assert.NoError(t, txtErr)
+	assert.Equal(t, []*route53.ResourceRecordSet{{
+		Name:            aws.String("foo.example.com."),
+		Type:            aws.String("TXT"),
+		TTL:             aws.Int64(60),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"hello"`)}},
+	}}, txtRecords)
+}
+
+func TestUpdateRecordSetsPatchesTheZoneOnce(t *testing.T) {
+	// given
+	api, server := newFakeAPI("example.com.",
+		set("update.example.com.", "CNAME", 300, "old.example.net."),
+		set("delete.example.com.", "CNAME", 300, "lb.example.net."),
+		set("ips.example.com.", "A", 60, "10.0.0.1", "10.0.0.2"),
+		set("example.com.", "SOA", 3600, "ns1.example.com. admin.example.com. 1 10800 3600 604800 3600"),
+	)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{
+		{Action: aws.String("CREATE"), ResourceRecordSet: dnstest.CNAME("create.example.com", "lb.example.net", 300)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: dnstest.CNAME("update.example.com.", "new.example.net", 60)},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name: aws.String("ips.example.com."),
+			Type: aws.String("A"),
+			TTL:  aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.2")},
+				{Value: aws.String("10.0.0.3")},
+			},
+		}},
+		{Action: aws.String("DELETE"), ResourceRecordSet: dnstest.CNAME("delete.example.com.", "lb.example.net", 300)},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"create.example.com. CNAME 300 lb.example.net.",
+		"example.com. SOA 3600 ns1.example.com. admin.example.com. 1 10800 3600 604800 3600",
+		"ips.example.com. A 60 10.0.0.2,10.0.0.3",
+		"update.example.com. CNAME 60 new.example.net.",
+	}, api.values())
+	assert.Equal(t, 1, api.patches)
+}
+
+func TestUpdateRecordSetsKeepsTheLastChangeOfARecordSet(t *testing.T) {
+	api, server := newFakeAPI("example.com.", set("foo.example.com.", "CNAME", 300, "old.example.net."))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	err := client.UpdateRecordSets([]*route53.Change{
+		{Action: aws.String("DELETE"), ResourceRecordSet: dnstest.CNAME("foo.example.com.", "old.example.net", 300)},
+		{Action: aws.String("CREATE"), ResourceRecordSet: dnstest.CNAME("foo.example.com.", "new.example.net", 300)},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo.example.com. CNAME 300 new.example.net."}, api.values())
+}
+
+func TestUpdateRecordSetsFailsForChangesWhichCantBeApplied(t *testing.T) {
+	api, server := newFakeAPI("example.com.", set("foo.example.com.", "CNAME", 300, "lb.example.net."))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	dnstest.RunUnappliedChanges(t, client, "PowerDNS")
+	assert.Equal(t, 0, api.patches, "nothing was changed")
+}
+
+func TestConformance(t *testing.T) {
+	dnstest.RunConformance(t, func() (func(id string) r53.Route53Client, func()) {
+		_, server := newFakeAPI(dnstest.Zone + ".")
+		return func(id string) r53.Route53Client {
+			config := testConfig(server)
+			config.Zone = id
+			return New(config)
+		}, server.Close
+	})
+}
@@ -2,27 +2,141 @@ package r53
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/util"
+	"github.com/sky-uk/feed/util/awscreds"
+	"github.com/sky-uk/feed/util/awspartition"
+	"github.com/sky-uk/feed/util/awsretry"
+	"github.com/sky-uk/feed/util/useragent"
 )
 
-const maxRecordChanges = 100
+const (
+	// MaxBatchSize is the maximum number of changes Route53 accepts in a single request.
+	MaxBatchSize = 100
+	// MaxTTL is the largest TTL of RFC 2181, which is also the largest Route53 accepts.
+	MaxTTL = 1<<31 - 1
+	// DefaultRegion is the region of the Route53 session, for the global endpoint of the aws partition. Route53 is a
+	// global service, but requests are still signed for a region.
+	DefaultRegion = "us-east-1"
+	// credentialsExpiryWindow refreshes assumed role credentials before they expire, so in flight requests
+	// aren't signed with expired credentials.
+	credentialsExpiryWindow = time.Minute
+	// DefaultSyncTimeout is how long UpdateRecordSets waits for changes to be in sync, if WaitForSync is set.
+	DefaultSyncTimeout = 5 * time.Minute
+	// syncPollInterval is how often the status of changes is checked while waiting for them to be in sync.
+	syncPollInterval = 5 * time.Second
+)
+
+// noSuchHostedZoneCode is the error code of requests to a hosted zone which doesn't exist.
+const noSuchHostedZoneCode = "NoSuchHostedZone"
+
+// Route53 rejects a whole batch with one of these error codes if any of its changes are invalid.
+var invalidChangeCodes = map[string]bool{
+	"InvalidChangeBatch": true,
+	"InvalidInput":       true,
+}
+
+// RejectedChangesError is returned by UpdateRecordSets if Route53 rejected some of the changes as invalid.
+// The rest of the changes were applied.
+type RejectedChangesError struct {
+	Rejected []RejectedChange
+}
+
+// RejectedChange is a change which Route53 rejected, with the reason it was rejected.
+type RejectedChange struct {
+	Change *route53.Change
+	Err    error
+}
+
+func (e *RejectedChangesError) Error() string {
+	var rejected []string
+	for _, r := range e.Rejected {
+		rejected = append(rejected, fmt.Sprintf("%s %s %s (%v)", aws.StringValue(r.Change.Action),
+			recordName(r.Change), recordType(r.Change), r.Err))
+	}
+	return fmt.Sprintf("%d changes rejected: %s", len(e.Rejected), strings.Join(rejected, ", "))
+}
+
+// NoSuchHostedZoneError is returned if the hosted zone doesn't exist, e.g. as it's been deleted.
+type NoSuchHostedZoneError struct {
+	HostedZone string
+}
+
+func (e *NoSuchHostedZoneError) Error() string {
+	return fmt.Sprintf("hosted zone %s doesn't exist, it may have been deleted", e.HostedZone)
+}
 
 // Route53Client is the public interface
 type Route53Client interface {
 	GetHostedZoneDomain() (string, error)
 	UpdateRecordSets(changes []*route53.Change) error
 	GetRecords() ([]*route53.ResourceRecordSet, error)
+	GetTXTRecords() ([]*route53.ResourceRecordSet, error)
+}
+
+// HealthCheckClient manages Route53 health checks. Health checks belong to the account, rather than a hosted zone,
+// so every client of the same account sees the same health checks.
+type HealthCheckClient interface {
+	GetHealthChecks() ([]*route53.HealthCheck, error)
+	// CreateHealthCheck creates a health check, returning its id. The caller reference must be unique.
+	CreateHealthCheck(callerReference string, config *route53.HealthCheckConfig) (string, error)
+	DeleteHealthCheck(id string) error
+}
+
+// Capabilities are the features of the DNS provider of a client, so tooling can tell which records it can manage.
+// MinTTL and MaxTTL are the smallest and largest TTLs of records the provider accepts, where a MaxTTL of 0 is the
+// limits of RFC 2181. RoundsUpTTL is whether the provider rounds TTLs under MinTTL up to it, rather than rejecting
+// them.
+type Capabilities struct {
+	Provider     string `json:"provider"`
+	Alias        bool   `json:"alias"`
+	Weighted     bool   `json:"weighted"`
+	Failover     bool   `json:"failover"`
+	Latency      bool   `json:"latency"`
+	Geolocation  bool   `json:"geolocation"`
+	IPv6         bool   `json:"ipv6"`
+	TXT          bool   `json:"txt"`
+	HealthChecks bool   `json:"healthChecks"`
+	MinTTL       int64  `json:"minTTL"`
+	MaxTTL       int64  `json:"maxTTL"`
+	RoundsUpTTL  bool   `json:"roundsUpTTL"`
+}
+
+// AutomaticTTLReporter is implemented by clients of providers which set the TTL of some records themselves, such as
+// Cloudflare's proxied records. The TTLs of those records are left alone, as any other TTL would never be kept.
+type AutomaticTTLReporter interface {
+	// HasAutomaticTTL is whether the provider sets the TTL of a record set the client last listed.
+	HasAutomaticTTL(rrs *route53.ResourceRecordSet) bool
 }
 
+// CapabilityDeclarer is implemented by clients which declare the capabilities of their DNS provider.
+type CapabilityDeclarer interface {
+	Capabilities() Capabilities
+}
+
+// Route53Capabilities are the capabilities of Route53, which supports every record feed-dns manages.
+var Route53Capabilities = Capabilities{Provider: "route53", Alias: true, Weighted: true, Failover: true,
+	Latency: true, Geolocation: true, IPv6: true, TXT: true, HealthChecks: true, MaxTTL: MaxTTL}
+
 // r53 interface exposes the subset of methods we use of the aws sdk
 type r53 interface {
 	GetHostedZone(input *route53.GetHostedZoneInput) (*route53.GetHostedZoneOutput, error)
 	ChangeResourceRecordSets(input *route53.ChangeResourceRecordSetsInput) (*route53.ChangeResourceRecordSetsOutput, error)
 	ListResourceRecordSets(input *route53.ListResourceRecordSetsInput) (*route53.ListResourceRecordSetsOutput, error)
+	GetChange(input *route53.GetChangeInput) (*route53.GetChangeOutput, error)
+	ListHealthChecks(input *route53.ListHealthChecksInput) (*route53.ListHealthChecksOutput, error)
+	CreateHealthCheck(input *route53.CreateHealthCheckInput) (*route53.CreateHealthCheckOutput, error)
+	DeleteHealthCheck(input *route53.DeleteHealthCheckInput) (*route53.DeleteHealthCheckOutput, error)
 }
 
 // Route53Client enables interaction with aws route53
@@ -30,15 +144,83 @@ type client struct {
 	r53              r53
 	hostedZone       string
 	maxRecordChanges int
+	waitForSync      bool
+	syncTimeout      time.Duration
+	syncPollInterval time.Duration
+}
+
+// Config describes how the route53 client makes requests.
+// Retries is the number of times a failed request is retried, which includes throttled change batches. The delay
+// before each retry doubles from RetryBaseDelay up to RetryMaxDelay, which default to the awsretry defaults.
+// BatchSize is the maximum number of changes per request, between 1 and MaxBatchSize. It defaults to MaxBatchSize.
+// If AssumeRoleARN is set, the role is assumed for all requests, which allows managing hosted zones in another
+// account.
+// Partition is the id of the AWS partition of the hosted zones, which resolves the Route53 endpoint, e.g.
+// awspartition.GovCloud. Empty is the standard partition.
+// Region is the region of the Route53 session, which is independent of the region of the load balancers. It
+// defaults to DefaultRegion in the standard partition, and the region of the global Route53 endpoint in others.
+// EndpointURL overrides the Route53 endpoint, e.g. to test against LocalStack. Empty uses the default endpoint.
+// If WaitForSync is set, UpdateRecordSets waits until the changes are in sync on all Route53 name servers, for up to
+// SyncTimeout, which defaults to DefaultSyncTimeout.
+// UserAgent is appended to the User-Agent of all requests. Empty leaves it unchanged.
+type Config struct {
+	Retries        int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	BatchSize      int
+	AssumeRoleARN  string
+	Partition      string
+	Region         string
+	EndpointURL    string
+	WaitForSync    bool
+	SyncTimeout    time.Duration
+	UserAgent      string
 }
 
 // New creates a route53 client used to interact with aws
-func New(hostedZone string, retries int) Route53Client {
-	config := aws.Config{MaxRetries: aws.Int(retries)}
+func New(hostedZone string, config Config) Route53Client {
+	initMetrics()
+	partition, err := awspartition.Lookup(config.Partition)
+	if err != nil {
+		log.Warnf("%v, using the %s partition", err, partition.ID)
+	}
+	region := config.Region
+	if region == "" {
+		region = partition.Route53Region
+	}
+	sessionConfig := aws.Config{Region: aws.String(region), EndpointResolver: partition}
+	if config.EndpointURL != "" {
+		// Also used for assuming roles, so the endpoint can provide STS too.
+		sessionConfig.Endpoint = aws.String(config.EndpointURL)
+	}
+	sess := session.New(&sessionConfig)
+	useragent.Add(sess, config.UserAgent)
+	awscreds.UseWebIdentity(sess)
+	awsConfig := request.WithRetryer(aws.NewConfig(),
+		awsretry.New(config.Retries, config.RetryBaseDelay, config.RetryMaxDelay))
+	if config.AssumeRoleARN != "" {
+		awsConfig.Credentials = stscreds.NewCredentials(sess, config.AssumeRoleARN, func(p *stscreds.AssumeRoleProvider) {
+			p.ExpiryWindow = credentialsExpiryWindow
+		})
+	}
+
+	batchSize := config.BatchSize
+	if batchSize <= 0 || batchSize > MaxBatchSize {
+		batchSize = MaxBatchSize
+	}
+
+	syncTimeout := config.SyncTimeout
+	if syncTimeout <= 0 {
+		syncTimeout = DefaultSyncTimeout
+	}
+
 	return &client{
-		r53:              route53.New(session.New(), &config),
+		r53:              route53.New(sess, awsConfig),
 		hostedZone:       hostedZone,
-		maxRecordChanges: maxRecordChanges,
+		maxRecordChanges: batchSize,
+		waitForSync:      config.WaitForSync,
+		syncTimeout:      syncTimeout,
+		syncPollInterval: syncPollInterval,
 	}
 }
 
@@ -47,35 +229,182 @@ func (dns *client) GetHostedZoneDomain() (string, error) {
 	input := &route53.GetHostedZoneInput{Id: aws.String(dns.hostedZone)}
 	hostedZone, err := dns.r53.GetHostedZone(input)
 	if err != nil {
+		if isMissingZone(err) {
+			return "", &NoSuchHostedZoneError{HostedZone: dns.hostedZone}
+		}
 		return "", fmt.Errorf("unable to get Hosted Zone Info: %v", err)
 	}
-	return *hostedZone.HostedZone.Name, nil
+	return unescapeName(*hostedZone.HostedZone.Name), nil
+}
+
+// unescapeName decodes the octal escapes Route53 uses for special characters in the names it returns, e.g. \052 for
+// the * of a wildcard record, so they match the names of ingress hosts. Route53 accepts the unescaped names in
+// changes.
+func unescapeName(name string) string {
+	if !strings.Contains(name, `\`) {
+		return name
+	}
+
+	var unescaped []byte
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+3 < len(name) {
+			if value, err := strconv.ParseUint(name[i+1:i+4], 8, 8); err == nil {
+				unescaped = append(unescaped, byte(value))
+				i += 3
+				continue
+			}
+		}
+		unescaped = append(unescaped, name[i])
+	}
+	return string(unescaped)
 }
 
-// UpdateRecordSets updates records in aws based on the change list.
+// UpdateRecordSets updates records in aws based on the change list. If Route53 rejects a batch as invalid, its
+// changes are applied one at a time so only the invalid changes are left out, and a RejectedChangesError is
+// returned once the rest are applied. With WaitForSync, it then waits for the applied changes to be in sync.
 func (dns *client) UpdateRecordSets(changes []*route53.Change) error {
+	var rejected []RejectedChange
+	var changeIDs []string
 	partitions := util.Partition(len(changes), dns.maxRecordChanges)
 	for _, partition := range partitions {
 		batch := changes[partition.Low:partition.High]
-		recordSetsInput := &route53.ChangeResourceRecordSetsInput{
-			HostedZoneId: aws.String(dns.hostedZone),
-			ChangeBatch: &route53.ChangeBatch{
-				Changes: batch,
-			},
+		changeID, err := dns.applyBatch(batch)
+		if err == nil {
+			changeIDs = append(changeIDs, changeID)
+			continue
 		}
 
-		_, err := dns.r53.ChangeResourceRecordSets(recordSetsInput)
+		if isMissingZone(err) {
+			return &NoSuchHostedZoneError{HostedZone: dns.hostedZone}
+		}
+		if !isInvalidChange(err) {
+			for _, change := range batch {
+				log.Errorf("Change rejected in failed batch: %s %s %s", aws.StringValue(change.Action),
+					recordName(change), recordType(change))
+			}
+			return fmt.Errorf("failed to apply batch of %d changes: %v", len(batch), err)
+		}
 
-		if err != nil {
-			return fmt.Errorf("failed to create A record: %v", err)
+		// Apply the changes one at a time, to find out which of them are invalid.
+		for _, change := range batch {
+			changeErr := err
+			if len(batch) > 1 {
+				changeID, changeErr = dns.applyBatch([]*route53.Change{change})
+			}
+			if changeErr == nil {
+				changeIDs = append(changeIDs, changeID)
+				continue
+			}
+			if !isInvalidChange(changeErr) {
+				return fmt.Errorf("failed to apply change to %s: %v", recordName(change), changeErr)
+			}
+			log.Errorf("Change rejected by Route53: %s %s %s: %v", aws.StringValue(change.Action),
+				recordName(change), recordType(change), changeErr)
+			rejected = append(rejected, RejectedChange{Change: change, Err: changeErr})
 		}
 	}
 
+	if dns.waitForSync {
+		if err := dns.waitForChanges(changeIDs); err != nil {
+			return err
+		}
+	}
+
+	if len(rejected) > 0 {
+		return &RejectedChangesError{Rejected: rejected}
+	}
+	return nil
+}
+
+// applyBatch applies the changes, returning the id of the Route53 change.
+func (dns *client) applyBatch(batch []*route53.Change) (string, error) {
+	start := time.Now()
+	defer func() { observeChange(batch, time.Since(start)) }()
+
+	out, err := dns.r53.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(dns.hostedZone),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: batch,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.ChangeInfo == nil {
+		return "", nil
+	}
+	return aws.StringValue(out.ChangeInfo.Id), nil
+}
+
+// waitForChanges polls the status of each change until they're all in sync, or the sync timeout passes.
+func (dns *client) waitForChanges(changeIDs []string) error {
+	start := time.Now()
+	defer func() { syncDuration.Observe(time.Since(start).Seconds()) }()
+
+	deadline := start.Add(dns.syncTimeout)
+	for _, id := range changeIDs {
+		if id == "" {
+			continue
+		}
+		for {
+			out, err := dns.r53.GetChange(&route53.GetChangeInput{Id: aws.String(id)})
+			if err != nil {
+				return fmt.Errorf("unable to get the status of change %s: %v", id, err)
+			}
+			if aws.StringValue(out.ChangeInfo.Status) == route53.ChangeStatusInsync {
+				break
+			}
+			if time.Now().Add(dns.syncPollInterval).After(deadline) {
+				syncTimeoutCount.Inc()
+				return fmt.Errorf("change %s wasn't in sync within %v", id, dns.syncTimeout)
+			}
+			time.Sleep(dns.syncPollInterval)
+		}
+	}
+
+	log.Debugf("Changes %v in sync after %v", changeIDs, time.Since(start))
 	return nil
 }
 
+func isInvalidChange(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && invalidChangeCodes[awsErr.Code()]
+}
+
+func isMissingZone(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == noSuchHostedZoneCode
+}
+
+func recordName(change *route53.Change) string {
+	if change.ResourceRecordSet == nil {
+		return ""
+	}
+	return aws.StringValue(change.ResourceRecordSet.Name)
+}
+
+func recordType(change *route53.Change) string {
+	if change.ResourceRecordSet == nil {
+		return ""
+	}
+	return aws.StringValue(change.ResourceRecordSet.Type)
+}
+
 // GetRecords gets a list of DNS records from aws.
 func (dns *client) GetRecords() ([]*route53.ResourceRecordSet, error) {
+	return dns.listRecords(func(recordType string) bool {
+		return recordType == route53.RRTypeA || recordType == route53.RRTypeAaaa || recordType == route53.RRTypeCname
+	})
+}
+
+// GetTXTRecords gets a list of TXT records from aws.
+func (dns *client) GetTXTRecords() ([]*route53.ResourceRecordSet, error) {
+	return dns.listRecords(func(recordType string) bool {
+		return recordType == route53.RRTypeTxt
+	})
+}
+
+func (dns *client) listRecords(include func(recordType string) bool) ([]*route53.ResourceRecordSet, error) {
 	records := []*route53.ResourceRecordSet{}
 	request := &route53.ListResourceRecordSetsInput{
 		HostedZoneId: aws.String(dns.hostedZone),
@@ -83,14 +412,18 @@ func (dns *client) GetRecords() ([]*route53.ResourceRecordSet, error) {
 	for {
 		recordSetsOutput, err := dns.r53.ListResourceRecordSets(request)
 
+		if isMissingZone(err) {
+			return nil, &NoSuchHostedZoneError{HostedZone: dns.hostedZone}
+		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch A records: %v", err)
+			return nil, fmt.Errorf("failed to fetch records: %v", err)
 		}
 
 		recordSets := recordSetsOutput.ResourceRecordSets
 
 		for _, recordSet := range recordSets {
-			if *recordSet.Type == route53.RRTypeA || *recordSet.Type == route53.RRTypeCname {
+			recordSet.Name = aws.String(unescapeName(aws.StringValue(recordSet.Name)))
+			if include(*recordSet.Type) {
 				records = append(records, recordSet)
 			}
 		}
@@ -108,3 +441,45 @@ func (dns *client) GetRecords() ([]*route53.ResourceRecordSet, error) {
 
 	return records, nil
 }
+
+// Capabilities are the Route53Capabilities.
+func (dns *client) Capabilities() Capabilities {
+	return Route53Capabilities
+}
+
+// GetHealthChecks lists all the health checks of the account.
+func (dns *client) GetHealthChecks() ([]*route53.HealthCheck, error) {
+	var healthChecks []*route53.HealthCheck
+	input := &route53.ListHealthChecksInput{}
+	for {
+		out, err := dns.r53.ListHealthChecks(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch health checks: %v", err)
+		}
+		healthChecks = append(healthChecks, out.HealthChecks...)
+		if !aws.BoolValue(out.IsTruncated) {
+			return healthChecks, nil
+		}
+		input = &route53.ListHealthChecksInput{Marker: out.NextMarker}
+	}
+}
+
+// CreateHealthCheck creates a health check with the config.
+func (dns *client) CreateHealthCheck(callerReference string, config *route53.HealthCheckConfig) (string, error) {
+	out, err := dns.r53.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference:   aws.String(callerReference),
+		HealthCheckConfig: config,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to create health check: %v", err)
+	}
+	return aws.StringValue(out.HealthCheck.Id), nil
+}
+
+// DeleteHealthCheck deletes a health check. Route53 stops checking it, even if records are still associated with it.
+func (dns *client) DeleteHealthCheck(id string) error {
+	if _, err := dns.r53.DeleteHealthCheck(&route53.DeleteHealthCheckInput{HealthCheckId: aws.String(id)}); err != nil {
+		return fmt.Errorf("unable to delete health check %s: %v", id, err)
+	}
+	return nil
+}
@@ -3,13 +3,23 @@ package r53
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sky-uk/feed/util/awspartition"
+	"github.com/sky-uk/feed/util/metrics"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
 type fake53 struct {
 	mock.Mock
 }
@@ -43,6 +53,42 @@ func (m *fake53) ListResourceRecordSets(input *route53.ListResourceRecordSetsInp
 	return args.Get(0).(*route53.ListResourceRecordSetsOutput), err
 }
 
+func (m *fake53) GetChange(input *route53.GetChangeInput) (*route53.GetChangeOutput, error) {
+	args := m.Called(input)
+	err := args.Error(1)
+	if err != nil {
+		return nil, err
+	}
+	return args.Get(0).(*route53.GetChangeOutput), err
+}
+
+func (m *fake53) ListHealthChecks(input *route53.ListHealthChecksInput) (*route53.ListHealthChecksOutput, error) {
+	args := m.Called(input)
+	err := args.Error(1)
+	if err != nil {
+		return nil, err
+	}
+	return args.Get(0).(*route53.ListHealthChecksOutput), err
+}
+
+func (m *fake53) CreateHealthCheck(input *route53.CreateHealthCheckInput) (*route53.CreateHealthCheckOutput, error) {
+	args := m.Called(input)
+	err := args.Error(1)
+	if err != nil {
+		return nil, err
+	}
+	return args.Get(0).(*route53.CreateHealthCheckOutput), err
+}
+
+func (m *fake53) DeleteHealthCheck(input *route53.DeleteHealthCheckInput) (*route53.DeleteHealthCheckOutput, error) {
+	args := m.Called(input)
+	err := args.Error(1)
+	if err != nil {
+		return nil, err
+	}
+	return args.Get(0).(*route53.DeleteHealthCheckOutput), err
+}
+
 func TestGetHostedZoneDomain(t *testing.T) {
 	zoneDomain := "james.com"
 	client, fake53 := createClient()
@@ -67,6 +113,29 @@ func TestGetHostedZoneDomainError(t *testing.T) {
 	assert.EqualError(t, err, "unable to get Hosted Zone Info: james says no")
 }
 
+func TestMissingHostedZoneErrorsIncludeTheZone(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	client, fake53 := createClient()
+	missingErr := awserr.New("NoSuchHostedZone", "No hosted zone found with ID: "+hostedZone, nil)
+	fake53.On("GetHostedZone", mock.Anything).Return(nil, missingErr)
+	fake53.On("ListResourceRecordSets", mock.Anything).Return(nil, missingErr)
+	fake53.On("ChangeResourceRecordSets", mock.Anything).Return(nil, missingErr)
+	expected := &NoSuchHostedZoneError{HostedZone: hostedZone}
+
+	// when
+	_, domainErr := client.GetHostedZoneDomain()
+	_, recordsErr := client.GetRecords()
+	updateErr := client.UpdateRecordSets([]*route53.Change{{Action: aws.String("UPSERT"),
+		ResourceRecordSet: &route53.ResourceRecordSet{Name: aws.String("foo.james.com.")}}})
+
+	// then
+	assert.Equal(expected, domainErr)
+	assert.Equal(expected, recordsErr)
+	assert.Equal(expected, updateErr)
+	assert.EqualError(domainErr, "hosted zone "+hostedZone+" doesn't exist, it may have been deleted")
+}
+
 func TestGetRecords(t *testing.T) {
 	// given
 	client, fake53 := createClient()
@@ -92,6 +161,25 @@ func TestGetRecords(t *testing.T) {
 	assert.Equal(t, expectedRecords, records)
 }
 
+func TestGetRecordsUnescapesWildcardNames(t *testing.T) {
+	// given
+	client, fake53 := createClient()
+	fake53.On("ListResourceRecordSets", &route53.ListResourceRecordSetsInput{
+		HostedZoneId: aws.String(hostedZone),
+	}).Return(&route53.ListResourceRecordSetsOutput{ResourceRecordSets: []*route53.ResourceRecordSet{
+		{Name: aws.String(`\052.team.james.com.`), Type: aws.String("A")},
+		{Name: aws.String(`\052\100odd\\.james.com.`), Type: aws.String("CNAME")},
+	}}, nil)
+
+	// when
+	records, err := client.GetRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "*.team.james.com.", aws.StringValue(records[0].Name))
+	assert.Equal(t, `*@odd\\.james.com.`, aws.StringValue(records[1].Name))
+}
+
 func TestGetRecordsFiltersOutNonARecordsAndCNAMERecords(t *testing.T) {
 	// given
 	client, fake53 := createClient()
@@ -206,8 +294,284 @@ func TestUpdateRecordSetsPartial(t *testing.T) {
 }
 
 func createClient() (*client, *fake53) {
-	client := New(hostedZone, 1).(*client)
+	client := New(hostedZone, Config{Retries: 1}).(*client)
 	fake53 := new(fake53)
 	client.r53 = fake53
 	return client, fake53
 }
+
+func TestBatchSizeDefaultsToRoute53Limit(t *testing.T) {
+	assert.Equal(t, MaxBatchSize, New(hostedZone, Config{}).(*client).maxRecordChanges)
+	assert.Equal(t, MaxBatchSize, New(hostedZone, Config{BatchSize: 500}).(*client).maxRecordChanges)
+	assert.Equal(t, 10, New(hostedZone, Config{BatchSize: 10}).(*client).maxRecordChanges)
+}
+
+func TestEndpointURLOverridesTheRoute53Endpoint(t *testing.T) {
+	r53 := New(hostedZone, Config{EndpointURL: "http://localstack:4566"}).(*client).r53.(*route53.Route53)
+	assert.Equal(t, "http://localstack:4566", r53.Endpoint)
+	assert.Equal(t, "us-east-1", r53.SigningRegion)
+}
+
+func TestRegionIsTheRegionOfTheRoute53Session(t *testing.T) {
+	defaultRegion := New(hostedZone, Config{}).(*client).r53.(*route53.Route53)
+	assert.Equal(t, "us-east-1", aws.StringValue(defaultRegion.Config.Region))
+	assert.Equal(t, "https://route53.amazonaws.com", defaultRegion.Endpoint)
+
+	otherRegion := New(hostedZone, Config{Region: "eu-west-1"}).(*client).r53.(*route53.Route53)
+	assert.Equal(t, "eu-west-1", aws.StringValue(otherRegion.Config.Region))
+	assert.Equal(t, "https://route53.amazonaws.com", otherRegion.Endpoint, "Route53 is global")
+	assert.Equal(t, "us-east-1", otherRegion.SigningRegion)
+}
+
+func TestPartitionResolvesTheRoute53Endpoint(t *testing.T) {
+	govCloud := New(hostedZone, Config{Partition: awspartition.GovCloud}).(*client).r53.(*route53.Route53)
+	assert.Equal(t, "https://route53.us-gov.amazonaws.com", govCloud.Endpoint)
+	assert.Equal(t, "us-gov-west-1", govCloud.SigningRegion)
+
+	china := New(hostedZone, Config{Partition: awspartition.China}).(*client).r53.(*route53.Route53)
+	assert.Equal(t, "https://route53.amazonaws.com.cn", china.Endpoint)
+	assert.Equal(t, "cn-northwest-1", china.SigningRegion)
+}
+
+func TestUpdateRecordSetsStopsAtFailedBatch(t *testing.T) {
+	// given
+	client, fake53 := createClient()
+	client.maxRecordChanges = 1
+	firstChange := &route53.Change{Action: aws.String("UPSERT"),
+		ResourceRecordSet: &route53.ResourceRecordSet{Name: aws.String("first.james.com.")}}
+	secondChange := &route53.Change{Action: aws.String("UPSERT"),
+		ResourceRecordSet: &route53.ResourceRecordSet{Name: aws.String("second.james.com.")}}
+	fake53.On("ChangeResourceRecordSets", mock.Anything).Return(nil, errors.New("invalid change batch"))
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{firstChange, secondChange})
+
+	// then
+	assert.EqualError(t, err, "failed to apply batch of 1 changes: invalid change batch")
+	fake53.AssertNumberOfCalls(t, "ChangeResourceRecordSets", 1)
+}
+
+func TestInvalidChangesAreRejectedAndTheRestApplied(t *testing.T) {
+	// given
+	client, fake53 := createClient()
+	client.maxRecordChanges = 2
+	change := func(name string) *route53.Change {
+		return &route53.Change{Action: aws.String("UPSERT"),
+			ResourceRecordSet: &route53.ResourceRecordSet{Name: aws.String(name), Type: aws.String("A")}}
+	}
+	invalid := change("invalid_.james.com.")
+	valid := change("valid.james.com.")
+	other := change("other.james.com.")
+	invalidErr := awserr.New("InvalidChangeBatch", "invalid_.james.com. is not permitted", nil)
+
+	batch := func(changes ...*route53.Change) *route53.ChangeResourceRecordSetsInput {
+		return &route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(hostedZone),
+			ChangeBatch:  &route53.ChangeBatch{Changes: changes},
+		}
+	}
+	fake53.On("ChangeResourceRecordSets", batch(invalid, valid)).Return(nil, invalidErr)
+	fake53.On("ChangeResourceRecordSets", batch(invalid)).Return(nil, invalidErr)
+	fake53.On("ChangeResourceRecordSets", batch(valid)).Return(&route53.ChangeResourceRecordSetsOutput{}, nil)
+	fake53.On("ChangeResourceRecordSets", batch(other)).Return(&route53.ChangeResourceRecordSetsOutput{}, nil)
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{invalid, valid, other})
+
+	// then
+	if assert.IsType(t, &RejectedChangesError{}, err) {
+		assert.Equal(t, []RejectedChange{{Change: invalid, Err: invalidErr}}, err.(*RejectedChangesError).Rejected)
+	}
+	fake53.AssertExpectations(t)
+}
+
+func TestOtherErrorsWhileIsolatingInvalidChangesStopTheUpdate(t *testing.T) {
+	// given
+	client, fake53 := createClient()
+	first := &route53.Change{Action: aws.String("UPSERT"),
+		ResourceRecordSet: &route53.ResourceRecordSet{Name: aws.String("first.james.com.")}}
+	second := &route53.Change{Action: aws.String("UPSERT"),
+		ResourceRecordSet: &route53.ResourceRecordSet{Name: aws.String("second.james.com.")}}
+	fake53.On("ChangeResourceRecordSets", &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(hostedZone),
+		ChangeBatch:  &route53.ChangeBatch{Changes: []*route53.Change{first, second}},
+	}).Return(nil, awserr.New("InvalidChangeBatch", "invalid", nil))
+	fake53.On("ChangeResourceRecordSets", mock.Anything).Return(nil, errors.New("connection refused"))
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{first, second})
+
+	// then
+	assert.EqualError(t, err, "failed to apply change to first.james.com.: connection refused")
+	fake53.AssertNumberOfCalls(t, "ChangeResourceRecordSets", 2)
+}
+
+func TestGetTXTRecords(t *testing.T) {
+	// given
+	client, fake53 := createClient()
+	aRecord := &route53.ResourceRecordSet{
+		Name: aws.String("james.com"),
+		Type: aws.String("A"),
+	}
+	txtRecord := &route53.ResourceRecordSet{
+		Name: aws.String("_feed-owner.james.com"),
+		Type: aws.String("TXT"),
+	}
+	fake53.On("ListResourceRecordSets", &route53.ListResourceRecordSetsInput{
+		HostedZoneId: aws.String(hostedZone),
+	}).Return(&route53.ListResourceRecordSetsOutput{
+		ResourceRecordSets: []*route53.ResourceRecordSet{aRecord, txtRecord},
+	}, nil)
+
+	// when
+	records, err := client.GetTXTRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*route53.ResourceRecordSet{txtRecord}, records)
+}
+
+func TestChangeDurationsAreRecordedByOperation(t *testing.T) {
+	// given
+	client, fake53 := createClient()
+	fake53.On("ChangeResourceRecordSets", mock.Anything).Return(&route53.ChangeResourceRecordSetsOutput{}, nil)
+	count := func(operation string) uint64 {
+		var metric dto.Metric
+		changeDuration.WithLabelValues(operation).(prometheus.Histogram).Write(&metric)
+		return metric.Histogram.GetSampleCount()
+	}
+	updates, deletes, creates := count("update"), count("delete"), count("create")
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{
+		{Action: aws.String(route53.ChangeActionUpsert)},
+		{Action: aws.String(route53.ChangeActionUpsert)},
+		{Action: aws.String(route53.ChangeActionDelete)},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, updates+1, count("update"))
+	assert.Equal(t, deletes+1, count("delete"))
+	assert.Equal(t, creates, count("create"))
+}
+
+func changeOutput(id, status string) *route53.ChangeResourceRecordSetsOutput {
+	return &route53.ChangeResourceRecordSetsOutput{
+		ChangeInfo: &route53.ChangeInfo{Id: aws.String(id), Status: aws.String(status)},
+	}
+}
+
+func getChangeOutput(id, status string) *route53.GetChangeOutput {
+	return &route53.GetChangeOutput{ChangeInfo: &route53.ChangeInfo{Id: aws.String(id), Status: aws.String(status)}}
+}
+
+func TestUpdateRecordSetsWaitsForChangesToBeInSync(t *testing.T) {
+	// given
+	client, fake53 := createClient()
+	client.waitForSync = true
+	client.syncPollInterval = time.Millisecond
+	client.maxRecordChanges = 1
+	first := &route53.Change{Action: aws.String(route53.ChangeActionUpsert)}
+	second := &route53.Change{Action: aws.String(route53.ChangeActionDelete)}
+	fake53.On("ChangeResourceRecordSets", &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(hostedZone),
+		ChangeBatch:  &route53.ChangeBatch{Changes: []*route53.Change{first}},
+	}).Return(changeOutput("first", route53.ChangeStatusPending), nil)
+	fake53.On("ChangeResourceRecordSets", &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(hostedZone),
+		ChangeBatch:  &route53.ChangeBatch{Changes: []*route53.Change{second}},
+	}).Return(changeOutput("second", route53.ChangeStatusPending), nil)
+	fake53.On("GetChange", &route53.GetChangeInput{Id: aws.String("first")}).
+		Return(getChangeOutput("first", route53.ChangeStatusPending), nil).Twice()
+	fake53.On("GetChange", &route53.GetChangeInput{Id: aws.String("first")}).
+		Return(getChangeOutput("first", route53.ChangeStatusInsync), nil).Once()
+	fake53.On("GetChange", &route53.GetChangeInput{Id: aws.String("second")}).
+		Return(getChangeOutput("second", route53.ChangeStatusInsync), nil).Once()
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{first, second})
+
+	// then
+	assert.NoError(t, err)
+	fake53.AssertExpectations(t)
+}
+
+func TestUpdateRecordSetsFailsIfChangesArentInSyncWithinTheTimeout(t *testing.T) {
+	// given
+	client, fake53 := createClient()
+	client.waitForSync = true
+	client.syncPollInterval = time.Millisecond
+	client.syncTimeout = 10 * time.Millisecond
+	fake53.On("ChangeResourceRecordSets", mock.Anything).Return(changeOutput("slow", route53.ChangeStatusPending), nil)
+	fake53.On("GetChange", mock.Anything).Return(getChangeOutput("slow", route53.ChangeStatusPending), nil)
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{{Action: aws.String(route53.ChangeActionUpsert)}})
+
+	// then
+	assert.EqualError(t, err, "change slow wasn't in sync within 10ms")
+}
+
+func TestUpdateRecordSetsDoesntWaitForSyncByDefault(t *testing.T) {
+	// given
+	client, fake53 := createClient()
+	fake53.On("ChangeResourceRecordSets", mock.Anything).Return(changeOutput("id", route53.ChangeStatusPending), nil)
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{{Action: aws.String(route53.ChangeActionUpsert)}})
+
+	// then
+	assert.NoError(t, err)
+	fake53.AssertNotCalled(t, "GetChange", mock.Anything)
+}
+
+func TestGetHealthChecksListsEveryPage(t *testing.T) {
+	// given
+	client, fake53 := createClient()
+	first := &route53.HealthCheck{Id: aws.String("hc-1")}
+	second := &route53.HealthCheck{Id: aws.String("hc-2")}
+	fake53.On("ListHealthChecks", &route53.ListHealthChecksInput{}).Return(&route53.ListHealthChecksOutput{
+		HealthChecks: []*route53.HealthCheck{first},
+		IsTruncated:  aws.Bool(true),
+		NextMarker:   aws.String("hc-2"),
+	}, nil)
+	fake53.On("ListHealthChecks", &route53.ListHealthChecksInput{Marker: aws.String("hc-2")}).Return(
+		&route53.ListHealthChecksOutput{HealthChecks: []*route53.HealthCheck{second}}, nil)
+
+	// when
+	healthChecks, err := client.GetHealthChecks()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*route53.HealthCheck{first, second}, healthChecks)
+}
+
+func TestCreateAndDeleteHealthChecks(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	client, fake53 := createClient()
+	config := &route53.HealthCheckConfig{
+		Type:                     aws.String(route53.HealthCheckTypeHttp),
+		FullyQualifiedDomainName: aws.String("lb.example.com"),
+	}
+	fake53.On("CreateHealthCheck", &route53.CreateHealthCheckInput{
+		CallerReference:   aws.String("ref"),
+		HealthCheckConfig: config,
+	}).Return(&route53.CreateHealthCheckOutput{HealthCheck: &route53.HealthCheck{Id: aws.String("hc-1")}}, nil)
+	fake53.On("DeleteHealthCheck", &route53.DeleteHealthCheckInput{HealthCheckId: aws.String("hc-1")}).Return(
+		&route53.DeleteHealthCheckOutput{}, nil)
+	fake53.On("DeleteHealthCheck", &route53.DeleteHealthCheckInput{HealthCheckId: aws.String("hc-2")}).Return(
+		nil, errors.New("no such health check"))
+
+	// when
+	id, createErr := client.CreateHealthCheck("ref", config)
+	deleteErr := client.DeleteHealthCheck(id)
+	missingErr := client.DeleteHealthCheck("hc-2")
+
+	// then
+	assert.NoError(createErr)
+	assert.Equal("hc-1", id)
+	assert.NoError(deleteErr)
+	assert.EqualError(missingErr, "unable to delete health check hc-2: no such health check")
+}
@@ -0,0 +1,15 @@
+package r53_test
+
+import (
+	"testing"
+
+	"github.com/sky-uk/feed/dns/dnstest"
+	"github.com/sky-uk/feed/dns/r53"
+)
+
+func TestInMemoryConformance(t *testing.T) {
+	dnstest.RunConformance(t, func() (func(id string) r53.Route53Client, func()) {
+		client := r53.NewInMemory(dnstest.Zone)
+		return func(id string) r53.Route53Client { return client }, func() {}
+	})
+}
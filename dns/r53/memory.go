@@ -0,0 +1,104 @@
+package r53
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+type memoryClient struct {
+	sync.Mutex
+	domain  string
+	records map[string]*route53.ResourceRecordSet
+}
+
+// InMemoryCapabilities are those of Route53, except health checks, as an in-memory zone holds any record Route53
+// would accept.
+var InMemoryCapabilities = Capabilities{Provider: "in-memory", Alias: true, Weighted: true, Failover: true,
+	Latency: true, Geolocation: true, IPv6: true, TXT: true, MaxTTL: MaxTTL}
+
+// NewInMemory creates a client of a hosted zone of the domain held in memory, which starts out empty, instead of
+// Route53. It needs no AWS credentials, e.g. to see the changes feed-dns would make to an empty zone.
+func NewInMemory(domain string) Route53Client {
+	if !strings.HasSuffix(domain, ".") {
+		domain += "."
+	}
+	return &memoryClient{domain: domain, records: make(map[string]*route53.ResourceRecordSet)}
+}
+
+// Capabilities of the client.
+func (m *memoryClient) Capabilities() Capabilities {
+	return InMemoryCapabilities
+}
+
+func (m *memoryClient) GetHostedZoneDomain() (string, error) {
+	return m.domain, nil
+}
+
+// UpdateRecordSets applies the changes in order. A change which can't be applied, such as deleting a record which
+// doesn't exist, fails the update, leaving the changes before it applied.
+func (m *memoryClient) UpdateRecordSets(changes []*route53.Change) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, change := range changes {
+		key := recordKey(change.ResourceRecordSet)
+		_, exists := m.records[key]
+		switch aws.StringValue(change.Action) {
+		case route53.ChangeActionCreate:
+			if exists {
+				return fmt.Errorf("can't create %s %s, it already exists", recordName(change), recordType(change))
+			}
+			m.records[key] = change.ResourceRecordSet
+		case route53.ChangeActionUpsert:
+			m.records[key] = change.ResourceRecordSet
+		case route53.ChangeActionDelete:
+			if !exists {
+				return fmt.Errorf("can't delete %s %s, it doesn't exist", recordName(change), recordType(change))
+			}
+			delete(m.records, key)
+		default:
+			return fmt.Errorf("unknown action %s", aws.StringValue(change.Action))
+		}
+	}
+	return nil
+}
+
+func recordKey(rrs *route53.ResourceRecordSet) string {
+	return aws.StringValue(rrs.Name) + " " + aws.StringValue(rrs.Type) + " " + aws.StringValue(rrs.SetIdentifier)
+}
+
+func (m *memoryClient) GetRecords() ([]*route53.ResourceRecordSet, error) {
+	return m.listRecords(func(recordType string) bool {
+		return recordType == route53.RRTypeA || recordType == route53.RRTypeAaaa || recordType == route53.RRTypeCname
+	}), nil
+}
+
+func (m *memoryClient) GetTXTRecords() ([]*route53.ResourceRecordSet, error) {
+	return m.listRecords(func(recordType string) bool {
+		return recordType == route53.RRTypeTxt
+	}), nil
+}
+
+func (m *memoryClient) listRecords(include func(recordType string) bool) []*route53.ResourceRecordSet {
+	m.Lock()
+	defer m.Unlock()
+
+	var keys []string
+	for key := range m.records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	records := []*route53.ResourceRecordSet{}
+	for _, key := range keys {
+		if rrs := m.records[key]; include(aws.StringValue(rrs.Type)) {
+			records = append(records, rrs)
+		}
+	}
+	return records
+}
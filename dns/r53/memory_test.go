@@ -0,0 +1,55 @@
+package r53
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+)
+
+func memoryChange(action, name, recordType string) *route53.Change {
+	return &route53.Change{
+		Action: aws.String(action),
+		ResourceRecordSet: &route53.ResourceRecordSet{
+			Name:            aws.String(name),
+			Type:            aws.String(recordType),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("lb.example.com")}},
+		},
+	}
+}
+
+func TestInMemoryClientAppliesChanges(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	client := NewInMemory("example.com")
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{
+		memoryChange(route53.ChangeActionCreate, "foo.example.com.", route53.RRTypeCname),
+		memoryChange(route53.ChangeActionUpsert, "bar.example.com.", route53.RRTypeCname),
+		memoryChange(route53.ChangeActionUpsert, "bar.example.com.", route53.RRTypeTxt),
+		memoryChange(route53.ChangeActionDelete, "foo.example.com.", route53.RRTypeCname),
+	})
+
+	// then
+	assert.NoError(err)
+	domain, _ := client.GetHostedZoneDomain()
+	assert.Equal("example.com.", domain)
+	records, _ := client.GetRecords()
+	if assert.Len(records, 1) {
+		assert.Equal("bar.example.com.", aws.StringValue(records[0].Name))
+	}
+	txtRecords, _ := client.GetTXTRecords()
+	assert.Len(txtRecords, 1)
+}
+
+func TestInMemoryClientFailsToDeleteMissingRecords(t *testing.T) {
+	client := NewInMemory("example.com.")
+
+	err := client.UpdateRecordSets([]*route53.Change{
+		memoryChange(route53.ChangeActionDelete, "foo.example.com.", route53.RRTypeCname),
+	})
+
+	assert.EqualError(t, err, "can't delete foo.example.com. CNAME, it doesn't exist")
+}
@@ -0,0 +1,81 @@
+package r53
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/util/metrics"
+)
+
+// changeBuckets cover change requests from tens of milliseconds to retried, throttled requests taking a minute.
+var changeBuckets = []float64{0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// syncBuckets cover changes reaching every Route53 name server, which usually takes under a minute.
+var syncBuckets = []float64{1, 5, 10, 20, 30, 45, 60, 90, 120, 300, 600}
+
+var once sync.Once
+var changeDuration *prometheus.HistogramVec
+var syncDuration prometheus.Histogram
+var syncTimeoutCount prometheus.Counter
+
+func initMetrics() {
+	once.Do(func() {
+		changeDuration = prometheus.MustRegisterOrGet(prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: metrics.PrometheusNamespace,
+				Subsystem: metrics.PrometheusDNSSubsystem,
+				Name:      "route53_change_duration_seconds",
+				Help: "How long Route53 took to accept each batch of changes, including retries, by operation. " +
+					"A batch with several operations is recorded once for each of them.",
+				Buckets:     changeBuckets,
+				ConstLabels: metrics.ConstLabels(),
+			}, []string{"operation"})).(*prometheus.HistogramVec)
+
+		syncDuration = prometheus.MustRegisterOrGet(prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: metrics.PrometheusNamespace,
+				Subsystem: metrics.PrometheusDNSSubsystem,
+				Name:      "route53_sync_duration_seconds",
+				Help: "How long feed-dns waited for the changes of each update to be in sync, with " +
+					"-r53-wait-for-sync.",
+				Buckets:     syncBuckets,
+				ConstLabels: metrics.ConstLabels(),
+			})).(prometheus.Histogram)
+
+		syncTimeoutCount = prometheus.MustRegisterOrGet(prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace:   metrics.PrometheusNamespace,
+				Subsystem:   metrics.PrometheusDNSSubsystem,
+				Name:        "route53_sync_timeouts",
+				Help:        "The number of updates whose changes weren't in sync within -r53-sync-timeout.",
+				ConstLabels: metrics.ConstLabels(),
+			})).(prometheus.Counter)
+	})
+}
+
+// observeChange records how long a batch took, once for each operation in the batch.
+func observeChange(batch []*route53.Change, duration time.Duration) {
+	observed := make(map[string]bool)
+	for _, change := range batch {
+		operation := operationOf(change)
+		if !observed[operation] {
+			observed[operation] = true
+			changeDuration.WithLabelValues(operation).Observe(duration.Seconds())
+		}
+	}
+}
+
+// operationOf returns create, update or delete for a change. Upserts are updates, as Route53 doesn't say if the
+// record already existed.
+func operationOf(change *route53.Change) string {
+	switch aws.StringValue(change.Action) {
+	case route53.ChangeActionUpsert:
+		return "update"
+	default:
+		return strings.ToLower(aws.StringValue(change.Action))
+	}
+}
@@ -0,0 +1,97 @@
+package dns
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+)
+
+// RecordNameData is what a record name template is rendered with, for each ingress host.
+type RecordNameData struct {
+	// Host is the host of the ingress, without a trailing period.
+	Host string
+	// Cluster is the ClusterName of the updater.
+	Cluster string
+	// Scheme is the load balancer scheme of the ingress, e.g. internal.
+	Scheme string
+	// Namespace and Ingress identify the ingress of the host.
+	Namespace string
+	Ingress   string
+}
+
+// recordNameFuncs transform hosts in record name templates, with the value being transformed last so they can be
+// piped, e.g. {{.Host | trimSuffix ".cluster.example.com"}}.
+var recordNameFuncs = template.FuncMap{
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"lower":      strings.ToLower,
+}
+
+// ParseRecordNameTemplate parses a record name template, e.g. {{.Host | trimSuffix ".cluster"}}.example.com. It
+// fails if the template can't be rendered, such as if it refers to a field RecordNameData doesn't have. Besides the
+// text/template functions, trimPrefix, trimSuffix, replace and lower transform strings.
+func ParseRecordNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("record-name").Funcs(recordNameFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record name template: %v", err)
+	}
+	example := RecordNameData{Host: "foo.example.com", Cluster: "cluster", Scheme: "internal",
+		Namespace: "namespace", Ingress: "ingress"}
+	if _, err := renderRecordName(tmpl, example); err != nil {
+		return nil, fmt.Errorf("invalid record name template: %v", err)
+	}
+	return tmpl, nil
+}
+
+func renderRecordName(tmpl *template.Template, data RecordNameData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	name := strings.TrimSuffix(strings.TrimSpace(buf.String()), ".")
+	if err := validateHostname(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// renameHosts replaces the host of each entry with its record name, rendered from the record name template, so the
+// rest of the update only sees record names. Entries whose record name can't be rendered are skipped.
+func (u *updater) renameHosts(entries controller.IngressEntries) controller.IngressEntries {
+	if u.recordName == nil {
+		return entries
+	}
+
+	var renamed controller.IngressEntries
+	var skipped []string
+	for _, entry := range entries {
+		name, err := renderRecordName(u.recordName, RecordNameData{
+			Host:      entry.Host,
+			Cluster:   u.clusterName,
+			Scheme:    entry.LbScheme,
+			Namespace: entry.Namespace,
+			Ingress:   entry.Name,
+		})
+		if err != nil {
+			log.Warnf("Unable to render the record name for %s of ingress %s: %v", entry.Host, entry.NamespaceName(),
+				err)
+			skipped = append(skipped, entry.NamespaceName()+":record-name:"+entry.Host)
+			u.skipEntry()
+			continue
+		}
+		if name != entry.Host {
+			log.Debugf("Host %s of ingress %s has the record name %s", entry.Host, entry.NamespaceName(), name)
+		}
+		entry.Host = name
+		renamed = append(renamed, entry)
+	}
+	if len(skipped) > 0 {
+		log.Warnf("%d skipped entries without a record name: %v", len(skipped), skipped)
+	}
+	return renamed
+}
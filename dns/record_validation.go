@@ -0,0 +1,107 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/sky-uk/feed/dns/r53"
+)
+
+const (
+	// maxHostnameLength and maxLabelLength are the longest hostname and label of RFC 1035, without the trailing
+	// period.
+	maxHostnameLength = 253
+	maxLabelLength    = 63
+)
+
+// hostnameLabel matches a label of a hostname. Underscores are allowed, e.g. for _acme-challenge, and so are
+// wildcards.
+var hostnameLabel = regexp.MustCompile(`^(\*|[A-Za-z0-9_]([A-Za-z0-9_-]*[A-Za-z0-9_])?)$`)
+
+// ttlLimits are the smallest and largest TTLs the provider of a client accepts, which are those of RFC 2181 unless
+// the provider declares its own. If roundUp is set, the provider rounds TTLs under min up to it.
+type ttlLimits struct {
+	min, max int64
+	roundUp  bool
+}
+
+func ttlLimitsOf(client r53.Route53Client) ttlLimits {
+	if declarer, ok := client.(r53.CapabilityDeclarer); ok {
+		if capabilities := declarer.Capabilities(); capabilities.MaxTTL > 0 {
+			return ttlLimits{capabilities.MinTTL, capabilities.MaxTTL, capabilities.RoundsUpTTL}
+		}
+	}
+	return ttlLimits{0, r53.MaxTTL, false}
+}
+
+// validateRecord checks a computed record before it's applied, so a bad annotation or a load balancer discovered
+// without a hostname can't send garbage to the provider, e.g. a CNAME to an empty hostname or a TTL the provider
+// doesn't accept.
+func validateRecord(rrs *route53.ResourceRecordSet, limits ttlLimits) error {
+	if err := validateHostname(aws.StringValue(rrs.Name)); err != nil {
+		return fmt.Errorf("invalid name: %v", err)
+	}
+
+	if alias := rrs.AliasTarget; alias != nil {
+		if err := validateHostname(aws.StringValue(alias.DNSName)); err != nil {
+			return fmt.Errorf("invalid alias target: %v", err)
+		}
+		if aws.StringValue(alias.HostedZoneId) == "" {
+			return errors.New("alias target has no hosted zone")
+		}
+		return nil
+	}
+
+	if ttl := aws.Int64Value(rrs.TTL); rrs.TTL == nil || ttl < limits.min || ttl > limits.max {
+		return fmt.Errorf("TTL %d isn't between %d and %d", ttl, limits.min, limits.max)
+	}
+	if len(rrs.ResourceRecords) == 0 {
+		return errors.New("no values")
+	}
+	for _, rr := range rrs.ResourceRecords {
+		if err := validateValue(aws.StringValue(rrs.Type), aws.StringValue(rr.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateValue(recordType, value string) error {
+	switch recordType {
+	case route53.RRTypeCname:
+		if err := validateHostname(value); err != nil {
+			return fmt.Errorf("invalid target: %v", err)
+		}
+	case route53.RRTypeA:
+		if ip := net.ParseIP(value); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("%q isn't an IPv4 address", value)
+		}
+	case route53.RRTypeAaaa:
+		if ip := net.ParseIP(value); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("%q isn't an IPv6 address", value)
+		}
+	}
+	return nil
+}
+
+// validateHostname checks the hostname looks resolvable, with non-empty labels of valid characters.
+func validateHostname(hostname string) error {
+	name := strings.TrimSuffix(hostname, ".")
+	if name == "" {
+		return errors.New("empty hostname")
+	}
+	if len(name) > maxHostnameLength {
+		return fmt.Errorf("%q is longer than %d characters", hostname, maxHostnameLength)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) > maxLabelLength || !hostnameLabel.MatchString(label) {
+			return fmt.Errorf("%q isn't a valid hostname", hostname)
+		}
+	}
+	return nil
+}
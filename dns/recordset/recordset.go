@@ -0,0 +1,299 @@
+/*
+Package recordset manages Route53 record sets in the zones of DNS providers, so each provider only has to convert its
+own records to and from Records, for APIs with a record for each value such as Hetzner and OVH, or Sets, for APIs
+with record sets such as NS1.
+*/
+package recordset
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// Record is a single value of a record set, as a provider's API has it.
+// Name is the domain name of the record, with a trailing period like Route53 record names, and Value is the value of
+// the record as Route53 has it, e.g. without the trailing period of CNAME targets. Native is the provider's own
+// record, e.g. with its id, which the provider needs to update or delete it.
+type Record struct {
+	Name   string
+	Type   string
+	Value  string
+	TTL    int64
+	Native interface{}
+}
+
+// Zone changes the records of a provider's zone, a record at a time.
+type Zone interface {
+	// Create creates a record of the record set with the value, returning the created record.
+	Create(rrs *route53.ResourceRecordSet, value string) (Record, error)
+	// UpdateTTL changes the TTL of a record, returning the updated record.
+	UpdateTTL(rec Record, ttl int64) (Record, error)
+	// Delete deletes a record.
+	Delete(rec Record) error
+}
+
+// Key identifies the record set of a name and type, e.g. foo.example.com. CNAME.
+func Key(name, recordType string) string {
+	return Canonical(name) + " " + recordType
+}
+
+// Canonical returns the domain name with a trailing period.
+func Canonical(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// IsAddress is whether records of the type are returned by GetRecords, being CNAME, A or AAAA records.
+func IsAddress(recordType string) bool {
+	return recordType == route53.RRTypeA || recordType == route53.RRTypeAaaa || recordType == route53.RRTypeCname
+}
+
+// IsTXT is whether records of the type are returned by GetTXTRecords.
+func IsTXT(recordType string) bool {
+	return recordType == route53.RRTypeTxt
+}
+
+// Names converts between domain names and the names of records relative to a zone.
+// Zone is the zone's domain, without a trailing period, and Apex the name of records for the zone's domain itself,
+// e.g. @.
+type Names struct {
+	Zone string
+	Apex string
+}
+
+// FQDN returns the domain name of a relative record name, with a trailing period.
+func (n Names) FQDN(name string) string {
+	if name == n.Apex || name == "" {
+		return n.Zone + "."
+	}
+	return name + "." + n.Zone + "."
+}
+
+// Relative returns the relative record name of a domain name in the zone.
+func (n Names) Relative(fqdn string) string {
+	name := strings.TrimSuffix(fqdn, ".")
+	if name == n.Zone {
+		return n.Apex
+	}
+	return strings.TrimSuffix(name, "."+n.Zone)
+}
+
+// Check fails for record sets the provider can't manage, being alias records and those with routing policies.
+func Check(provider string, rrs *route53.ResourceRecordSet) error {
+	if rrs.AliasTarget != nil {
+		return fmt.Errorf("can't change %s, alias records aren't supported by %s", aws.StringValue(rrs.Name),
+			provider)
+	}
+	if rrs.SetIdentifier != nil {
+		return fmt.Errorf("can't change %s, routing policies aren't supported by %s", aws.StringValue(rrs.Name),
+			provider)
+	}
+	return nil
+}
+
+// Sets groups the records of the types include accepts into record sets, in the order of their first record. The
+// TTL of a record set is that of its first record.
+func Sets(records []Record, include func(recordType string) bool) []*route53.ResourceRecordSet {
+	var recordSets []*route53.ResourceRecordSet
+	byKey := make(map[string]*route53.ResourceRecordSet)
+	for _, rec := range records {
+		if !include(rec.Type) {
+			continue
+		}
+		key := Key(rec.Name, rec.Type)
+		rrs, ok := byKey[key]
+		if !ok {
+			rrs = &route53.ResourceRecordSet{
+				Name: aws.String(Canonical(rec.Name)),
+				Type: aws.String(rec.Type),
+				TTL:  aws.Int64(rec.TTL),
+			}
+			byKey[key] = rrs
+			recordSets = append(recordSets, rrs)
+		}
+		rrs.ResourceRecords = append(rrs.ResourceRecords, &route53.ResourceRecord{Value: aws.String(rec.Value)})
+	}
+	return recordSets
+}
+
+// Apply applies the changes in order to the zone, whose records are existing, making as few changes to records as
+// it can. It returns whether any records may have been changed. A change which can't be applied, such as deleting a
+// record set which doesn't exist, fails the update, leaving the changes before it applied.
+func Apply(provider string, zone Zone, existing []Record, changes []*route53.Change) (bool, error) {
+	byKey := make(map[string][]Record)
+	for _, rec := range existing {
+		key := Key(rec.Name, rec.Type)
+		byKey[key] = append(byKey[key], rec)
+	}
+
+	applied := false
+	for _, change := range changes {
+		rrs := change.ResourceRecordSet
+		if err := Check(provider, rrs); err != nil {
+			return applied, err
+		}
+
+		var err error
+		key := Key(aws.StringValue(rrs.Name), aws.StringValue(rrs.Type))
+		current := byKey[key]
+		switch aws.StringValue(change.Action) {
+		case route53.ChangeActionCreate:
+			if len(current) > 0 {
+				return applied, fmt.Errorf("can't create %s, it already exists", key)
+			}
+			byKey[key], err = upsert(zone, rrs, nil)
+		case route53.ChangeActionUpsert:
+			byKey[key], err = upsert(zone, rrs, current)
+		case route53.ChangeActionDelete:
+			if len(current) == 0 {
+				return applied, fmt.Errorf("can't delete %s, it doesn't exist", key)
+			}
+			err = deleteRecords(zone, current)
+			delete(byKey, key)
+		default:
+			return applied, fmt.Errorf("unknown action %s", aws.StringValue(change.Action))
+		}
+		// A failed change may have changed some of the records of its record set.
+		applied = true
+		if err != nil {
+			return applied, fmt.Errorf("unable to %s %s: %v", strings.ToLower(aws.StringValue(change.Action)), key, err)
+		}
+	}
+	return applied, nil
+}
+
+// upsert makes the records of a record set match it, updating the TTL of records whose value is kept, deleting
+// those whose value isn't, and creating the rest. It returns the records of the record set.
+func upsert(zone Zone, rrs *route53.ResourceRecordSet, current []Record) ([]Record, error) {
+	ttl := aws.Int64Value(rrs.TTL)
+	wanted := make(map[string]bool)
+	for _, rr := range rrs.ResourceRecords {
+		wanted[aws.StringValue(rr.Value)] = true
+	}
+
+	var kept, removed []Record
+	for _, rec := range current {
+		if !wanted[rec.Value] {
+			removed = append(removed, rec)
+			continue
+		}
+		delete(wanted, rec.Value)
+		if rec.TTL != ttl {
+			updated, err := zone.UpdateTTL(rec, ttl)
+			if err != nil {
+				return nil, err
+			}
+			rec = updated
+		}
+		kept = append(kept, rec)
+	}
+	if err := deleteRecords(zone, removed); err != nil {
+		return nil, err
+	}
+
+	for _, rr := range rrs.ResourceRecords {
+		value := aws.StringValue(rr.Value)
+		if !wanted[value] {
+			continue
+		}
+		delete(wanted, value)
+		created, err := zone.Create(rrs, value)
+		if err != nil {
+			return nil, err
+		}
+		kept = append(kept, created)
+	}
+	return kept, nil
+}
+
+func deleteRecords(zone Zone, records []Record) error {
+	for _, rec := range records {
+		if err := zone.Delete(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set is a record set, as a provider's API has it. RecordSet is the Route53 record set it is, with a trailing period
+// in its name and without the trailing period of CNAME targets. Native is the provider's own record set, e.g. with
+// its id, which the provider needs to replace or delete it.
+type Set struct {
+	RecordSet *route53.ResourceRecordSet
+	Native    interface{}
+}
+
+// SetZone changes the record sets of a provider's zone, a record set at a time.
+type SetZone interface {
+	// CreateSet creates a record set, returning the created record set.
+	CreateSet(rrs *route53.ResourceRecordSet) (Set, error)
+	// ReplaceSet replaces the values and TTL of a record set, returning the replaced record set.
+	ReplaceSet(current Set, rrs *route53.ResourceRecordSet) (Set, error)
+	// DeleteSet deletes a record set.
+	DeleteSet(current Set) error
+}
+
+// RecordSets returns the record sets of the types include accepts, in order.
+func RecordSets(sets []Set, include func(recordType string) bool) []*route53.ResourceRecordSet {
+	var recordSets []*route53.ResourceRecordSet
+	for _, set := range sets {
+		if include(aws.StringValue(set.RecordSet.Type)) {
+			recordSets = append(recordSets, set.RecordSet)
+		}
+	}
+	return recordSets
+}
+
+// ApplySets applies the changes in order to the zone, whose record sets are existing, replacing the record sets
+// which are upserted rather than diffing their values. It returns whether any record sets may have been changed. A
+// change which can't be applied, such as deleting a record set which doesn't exist, fails the update, leaving the
+// changes before it applied.
+func ApplySets(provider string, zone SetZone, existing []Set, changes []*route53.Change) (bool, error) {
+	byKey := make(map[string]Set)
+	for _, set := range existing {
+		byKey[Key(aws.StringValue(set.RecordSet.Name), aws.StringValue(set.RecordSet.Type))] = set
+	}
+
+	applied := false
+	for _, change := range changes {
+		rrs := change.ResourceRecordSet
+		if err := Check(provider, rrs); err != nil {
+			return applied, err
+		}
+
+		var err error
+		key := Key(aws.StringValue(rrs.Name), aws.StringValue(rrs.Type))
+		current, exists := byKey[key]
+		switch aws.StringValue(change.Action) {
+		case route53.ChangeActionCreate:
+			if exists {
+				return applied, fmt.Errorf("can't create %s, it already exists", key)
+			}
+			byKey[key], err = zone.CreateSet(rrs)
+		case route53.ChangeActionUpsert:
+			if exists {
+				byKey[key], err = zone.ReplaceSet(current, rrs)
+			} else {
+				byKey[key], err = zone.CreateSet(rrs)
+			}
+		case route53.ChangeActionDelete:
+			if !exists {
+				return applied, fmt.Errorf("can't delete %s, it doesn't exist", key)
+			}
+			err = zone.DeleteSet(current)
+			delete(byKey, key)
+		default:
+			return applied, fmt.Errorf("unknown action %s", aws.StringValue(change.Action))
+		}
+		applied = true
+		if err != nil {
+			return applied, fmt.Errorf("unable to %s %s: %v", strings.ToLower(aws.StringValue(change.Action)), key, err)
+		}
+	}
+	return applied, nil
+}
@@ -0,0 +1,210 @@
+package recordset
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeZone records the changes made to its records.
+type fakeZone struct {
+	changes []string
+	failOn  string
+}
+
+func (z *fakeZone) Create(rrs *route53.ResourceRecordSet, value string) (Record, error) {
+	return z.change("create", Record{Name: aws.StringValue(rrs.Name), Type: aws.StringValue(rrs.Type), Value: value,
+		TTL: aws.Int64Value(rrs.TTL)})
+}
+
+func (z *fakeZone) UpdateTTL(rec Record, ttl int64) (Record, error) {
+	rec.TTL = ttl
+	return z.change("update", rec)
+}
+
+func (z *fakeZone) Delete(rec Record) error {
+	_, err := z.change("delete", rec)
+	return err
+}
+
+func (z *fakeZone) change(action string, rec Record) (Record, error) {
+	change := fmt.Sprintf("%s %s %s %s %d", action, rec.Name, rec.Type, rec.Value, rec.TTL)
+	if change == z.failOn {
+		return Record{}, fmt.Errorf("failed")
+	}
+	z.changes = append(z.changes, change)
+	return rec, nil
+}
+
+func a(name string, ttl int64, values ...string) *route53.ResourceRecordSet {
+	rrs := &route53.ResourceRecordSet{Name: aws.String(name), Type: aws.String(route53.RRTypeA), TTL: aws.Int64(ttl)}
+	for _, value := range values {
+		rrs.ResourceRecords = append(rrs.ResourceRecords, &route53.ResourceRecord{Value: aws.String(value)})
+	}
+	return rrs
+}
+
+func TestNamesConvertRelativeNames(t *testing.T) {
+	names := Names{Zone: "example.com", Apex: "@"}
+
+	assert.Equal(t, "foo.example.com.", names.FQDN("foo"))
+	assert.Equal(t, "example.com.", names.FQDN("@"))
+	assert.Equal(t, "example.com.", names.FQDN(""))
+	assert.Equal(t, "foo", names.Relative("foo.example.com."))
+	assert.Equal(t, "foo", names.Relative("foo.example.com"))
+	assert.Equal(t, "@", names.Relative("example.com."))
+}
+
+func TestSetsGroupsRecordsByNameAndType(t *testing.T) {
+	records := []Record{
+		{Name: "foo.example.com.", Type: "A", Value: "10.0.0.1", TTL: 60},
+		{Name: "foo.example.com.", Type: "TXT", Value: `"hello"`, TTL: 60},
+		{Name: "foo.example.com", Type: "A", Value: "10.0.0.2", TTL: 60},
+	}
+
+	assert.Equal(t, []*route53.ResourceRecordSet{a("foo.example.com.", 60, "10.0.0.1", "10.0.0.2")},
+		Sets(records, IsAddress))
+}
+
+func TestApplyChangesOnlyTheRecordsWhichDiffer(t *testing.T) {
+	// given
+	zone := &fakeZone{}
+	existing := []Record{
+		{Name: "foo.example.com.", Type: "A", Value: "10.0.0.1", TTL: 60},
+		{Name: "foo.example.com.", Type: "A", Value: "10.0.0.2", TTL: 60},
+		{Name: "bar.example.com.", Type: "A", Value: "10.0.0.3", TTL: 60},
+	}
+
+	// when
+	applied, err := Apply("Fake DNS", zone, existing, []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: a("foo.example.com.", 300, "10.0.0.2", "10.0.0.4")},
+		{Action: aws.String("DELETE"), ResourceRecordSet: a("bar.example.com.", 60, "10.0.0.3")},
+		{Action: aws.String("CREATE"), ResourceRecordSet: a("baz.example.com", 60, "10.0.0.5")},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.True(t, applied)
+	assert.Equal(t, []string{
+		"update foo.example.com. A 10.0.0.2 300",
+		"delete foo.example.com. A 10.0.0.1 60",
+		"create foo.example.com. A 10.0.0.4 300",
+		"delete bar.example.com. A 10.0.0.3 60",
+		"create baz.example.com A 10.0.0.5 60",
+	}, zone.changes)
+}
+
+func TestApplyStopsAtTheFirstChangeWhichFails(t *testing.T) {
+	zone := &fakeZone{failOn: "create foo.example.com. A 10.0.0.1 60"}
+
+	applied, err := Apply("Fake DNS", zone, nil, []*route53.Change{
+		{Action: aws.String("CREATE"), ResourceRecordSet: a("foo.example.com.", 60, "10.0.0.1")},
+		{Action: aws.String("CREATE"), ResourceRecordSet: a("bar.example.com.", 60, "10.0.0.2")},
+	})
+
+	assert.EqualError(t, err, "unable to create foo.example.com. A: failed")
+	assert.True(t, applied, "a failed change may have changed records")
+	assert.Empty(t, zone.changes)
+}
+
+func TestApplyRejectsRecordSetsTheProviderCantManage(t *testing.T) {
+	zone := &fakeZone{}
+	alias := &route53.ResourceRecordSet{Name: aws.String("foo.example.com."), Type: aws.String("A"),
+		AliasTarget: &route53.AliasTarget{DNSName: aws.String("lb.example.net")}}
+
+	applied, err := Apply("Fake DNS", zone, nil, []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: alias},
+	})
+
+	assert.EqualError(t, err, "can't change foo.example.com., alias records aren't supported by Fake DNS")
+	assert.False(t, applied)
+}
+
+// fakeSetZone records the changes made to its record sets.
+type fakeSetZone struct {
+	changes []string
+}
+
+func (z *fakeSetZone) CreateSet(rrs *route53.ResourceRecordSet) (Set, error) {
+	z.change("create", rrs, nil)
+	return Set{RecordSet: rrs, Native: "created"}, nil
+}
+
+func (z *fakeSetZone) ReplaceSet(current Set, rrs *route53.ResourceRecordSet) (Set, error) {
+	z.change("replace", rrs, current.Native)
+	return Set{RecordSet: rrs, Native: "replaced"}, nil
+}
+
+func (z *fakeSetZone) DeleteSet(current Set) error {
+	z.change("delete", current.RecordSet, current.Native)
+	return nil
+}
+
+func (z *fakeSetZone) change(action string, rrs *route53.ResourceRecordSet, native interface{}) {
+	var values []string
+	for _, rr := range rrs.ResourceRecords {
+		values = append(values, aws.StringValue(rr.Value))
+	}
+	z.changes = append(z.changes, fmt.Sprintf("%s %s %v %d %v", action, aws.StringValue(rrs.Name), values,
+		aws.Int64Value(rrs.TTL), native))
+}
+
+func TestApplySetsCreatesReplacesAndDeletesRecordSets(t *testing.T) {
+	// given
+	zone := &fakeSetZone{}
+	existing := []Set{
+		{RecordSet: a("foo.example.com.", 60, "10.0.0.1"), Native: "foo"},
+		{RecordSet: a("bar.example.com.", 60, "10.0.0.2"), Native: "bar"},
+	}
+
+	// when
+	applied, err := ApplySets("Fake DNS", zone, existing, []*route53.Change{
+		{Action: aws.String("UPSERT"), ResourceRecordSet: a("foo.example.com", 300, "10.0.0.3")},
+		{Action: aws.String("UPSERT"), ResourceRecordSet: a("baz.example.com.", 60, "10.0.0.4")},
+		{Action: aws.String("DELETE"), ResourceRecordSet: a("baz.example.com.", 60, "10.0.0.4")},
+		{Action: aws.String("DELETE"), ResourceRecordSet: a("bar.example.com.", 60, "10.0.0.2")},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.True(t, applied)
+	assert.Equal(t, []string{
+		"replace foo.example.com [10.0.0.3] 300 foo",
+		"create baz.example.com. [10.0.0.4] 60 <nil>",
+		"delete baz.example.com. [10.0.0.4] 60 created",
+		"delete bar.example.com. [10.0.0.2] 60 bar",
+	}, zone.changes)
+}
+
+func TestApplySetsFailsForChangesWhichCantBeApplied(t *testing.T) {
+	zone := &fakeSetZone{}
+	existing := []Set{{RecordSet: a("foo.example.com.", 60, "10.0.0.1")}}
+
+	var tests = []struct {
+		name     string
+		change   *route53.Change
+		expected string
+	}{
+		{
+			"Creating an existing record set",
+			&route53.Change{Action: aws.String("CREATE"), ResourceRecordSet: a("foo.example.com.", 60, "10.0.0.1")},
+			"can't create foo.example.com. A, it already exists",
+		},
+		{
+			"Deleting a missing record set",
+			&route53.Change{Action: aws.String("DELETE"), ResourceRecordSet: a("bar.example.com.", 60, "10.0.0.1")},
+			"can't delete bar.example.com. A, it doesn't exist",
+		},
+	}
+
+	for _, test := range tests {
+		fmt.Printf("=== test: %s\n", test.name)
+		applied, err := ApplySets("Fake DNS", zone, existing, []*route53.Change{test.change})
+		assert.EqualError(t, err, test.expected, test.name)
+		assert.False(t, applied, test.name)
+	}
+	assert.Empty(t, zone.changes)
+}
@@ -0,0 +1,90 @@
+package dns
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns/adapter"
+)
+
+// maxSetIdentifierLength is the longest set identifier Route53 accepts.
+const maxSetIdentifierLength = 128
+
+// SetIdentifierData is what a set identifier template is rendered with, for each record with a routing policy.
+type SetIdentifierData struct {
+	// Region is the AWS region of the load balancer, if known.
+	Region string
+	// Cluster is the ClusterName of the updater.
+	Cluster string
+	// Host is the host of the record, without a trailing period.
+	Host string
+	// Scheme is the load balancer scheme of the ingress, e.g. internal.
+	Scheme string
+	// LoadBalancer is the DNS name the record points to, without a trailing period.
+	LoadBalancer string
+	// Namespace and Ingress identify the ingress the record is for.
+	Namespace string
+	Ingress   string
+	// Location is the geolocation of geolocation records, e.g. GB, continent:EU or *, empty otherwise.
+	Location string
+}
+
+// ParseSetIdentifierTemplate parses a set identifier template, e.g. {{.Region}}-{{.Cluster}}. It fails if the
+// template can't be rendered, such as if it refers to a field SetIdentifierData doesn't have.
+func ParseSetIdentifierTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("set-identifier").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid set identifier template: %v", err)
+	}
+	example := SetIdentifierData{Region: "eu-west-1", Cluster: "cluster", Host: "foo.example.com",
+		Scheme: "internal", LoadBalancer: "lb.example.com", Namespace: "namespace", Ingress: "ingress", Location: "GB"}
+	if _, err := renderSetIdentifier(tmpl, example); err != nil {
+		return nil, fmt.Errorf("invalid set identifier template: %v", err)
+	}
+	return tmpl, nil
+}
+
+func renderSetIdentifier(tmpl *template.Template, data SetIdentifierData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	setIdentifier := buf.String()
+	if setIdentifier == "" || len(setIdentifier) > maxSetIdentifierLength {
+		return "", fmt.Errorf("set identifier %q must be between 1 and %d characters", setIdentifier,
+			maxSetIdentifierLength)
+	}
+	return setIdentifier, nil
+}
+
+// setIdentifierOf returns the set identifier of an entry's record, rendered from the set identifier template. Without
+// a template, records are identified by the load balancer they point to, and geolocation records also by their
+// location, e.g. lb.example.com/GB, as a load balancer can have a record for several locations.
+func (u *updater) setIdentifierOf(host string, entry controller.IngressEntry, dnsDetails adapter.DNSDetails,
+	routing routingType) (string, error) {
+
+	loadBalancer := strings.TrimSuffix(dnsDetails.DNSName, ".")
+	var location string
+	if routing == geoRouting {
+		location = annotationsOf(entry).GeoLocation
+	}
+	if u.setIdentifier == nil {
+		if location != "" {
+			return loadBalancer + "/" + location, nil
+		}
+		return loadBalancer, nil
+	}
+	return renderSetIdentifier(u.setIdentifier, SetIdentifierData{
+		Region:       dnsDetails.Region,
+		Cluster:      u.clusterName,
+		Host:         strings.TrimSuffix(host, "."),
+		Scheme:       entry.LbScheme,
+		LoadBalancer: loadBalancer,
+		Namespace:    entry.Namespace,
+		Ingress:      entry.Name,
+		Location:     location,
+	})
+}
@@ -0,0 +1,166 @@
+package dns
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/sky-uk/feed/controller"
+)
+
+const (
+	txtRecordTTL = 60
+	// maxTXTValueLength is the longest string Route53 accepts in a TXT record.
+	maxTXTValueLength = 255
+)
+
+// txtRecords manages the TXT records requested by the dns-txt annotation, such as ACME dns-01 challenges.
+// Managed TXT records contain a heritage value alongside the requested values, so they can be deleted once no
+// ingress requests them. TXT lookups return every value, so the heritage value doesn't affect challenges.
+type txtRecords struct {
+	heritage string
+}
+
+func newTXTRecords(registry *ownershipRegistry) *txtRecords {
+	if registry != nil {
+		return &txtRecords{heritage: registry.value()}
+	}
+	return &txtRecords{heritage: quoteTXT("heritage=feed")}
+}
+
+// desired returns the values of each TXT record requested by the entries, keyed by record name. Records outside of
+// the zone, or with invalid values, are skipped.
+func (t *txtRecords) desired(zone *hostedZone, entries controller.IngressEntries) (map[string][]string, []string) {
+	desired := make(map[string][]string)
+	seen := make(map[string]map[string]bool)
+	var skipped []string
+	for _, entry := range entries {
+		value := annotationsOf(entry).TXT
+		if value == "" {
+			continue
+		}
+
+		for _, pair := range strings.Split(value, ",") {
+			parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			name := strings.TrimSuffix(parts[0], ".") + "."
+			if len(parts) != 2 || parts[1] == "" || len(parts[1]) > maxTXTValueLength ||
+				!strings.HasSuffix(name, "."+zone.domain) || strings.HasPrefix(name, ownershipPrefix) {
+				skipped = append(skipped, entry.NamespaceName()+":txt:"+parts[0])
+				continue
+			}
+
+			txtValue := quoteTXT(parts[1])
+			if seen[name] == nil {
+				seen[name] = make(map[string]bool)
+			}
+			if !seen[name][txtValue] {
+				seen[name][txtValue] = true
+				desired[name] = append(desired[name], txtValue)
+			}
+		}
+	}
+
+	return desired, skipped
+}
+
+// changes creates, updates and deletes the managed TXT records, so they match the desired values. Existing TXT
+// records which aren't managed are left alone, even if an ingress requests them, as are records whose name manages
+// returns false for.
+func (t *txtRecords) changes(desired map[string][]string, existing []*route53.ResourceRecordSet,
+	manages func(name string) bool) ([]*route53.Change, []string) {
+
+	existingByName := make(map[string]*route53.ResourceRecordSet)
+	for _, rrs := range existing {
+		existingByName[aws.StringValue(rrs.Name)] = rrs
+	}
+
+	var changes []*route53.Change
+	var skipped []string
+	for name, values := range desired {
+		rrs, exists := existingByName[name]
+		if !manages(name) {
+			skipped = append(skipped, name+":txt-filtered")
+			continue
+		}
+		if exists && !t.isManaged(rrs) {
+			skipped = append(skipped, name+":txt-not-managed")
+			continue
+		}
+
+		values = append(values, t.heritage)
+		sort.Strings(values)
+		if exists && aws.Int64Value(rrs.TTL) == txtRecordTTL && equalStrings(valuesOf(rrs), values) {
+			continue
+		}
+
+		set := &route53.ResourceRecordSet{
+			Name: aws.String(name),
+			Type: aws.String(route53.RRTypeTxt),
+			TTL:  aws.Int64(txtRecordTTL),
+		}
+		for _, value := range values {
+			set.ResourceRecords = append(set.ResourceRecords, &route53.ResourceRecord{Value: aws.String(value)})
+		}
+		changes = append(changes, &route53.Change{
+			Action:            aws.String(route53.ChangeActionUpsert),
+			ResourceRecordSet: set,
+		})
+	}
+
+	for name, rrs := range existingByName {
+		if _, ok := desired[name]; !ok && t.isManaged(rrs) && manages(name) {
+			changes = append(changes, &route53.Change{
+				Action:            aws.String(route53.ChangeActionDelete),
+				ResourceRecordSet: rrs,
+			})
+		}
+	}
+
+	name := func(i int) string { return aws.StringValue(changes[i].ResourceRecordSet.Name) }
+	sort.Slice(changes, func(i, j int) bool { return name(i) < name(j) })
+
+	return changes, skipped
+}
+
+// isManaged returns true if the record set contains the heritage value. Ownership records are never managed, as
+// they're only changed by the ownership registry.
+func (t *txtRecords) isManaged(rrs *route53.ResourceRecordSet) bool {
+	if strings.HasPrefix(aws.StringValue(rrs.Name), ownershipPrefix) {
+		return false
+	}
+	for _, value := range valuesOf(rrs) {
+		if value == t.heritage {
+			return true
+		}
+	}
+	return false
+}
+
+func valuesOf(rrs *route53.ResourceRecordSet) []string {
+	var values []string
+	for _, rr := range rrs.ResourceRecords {
+		values = append(values, aws.StringValue(rr.Value))
+	}
+	sort.Strings(values)
+	return values
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteTXT quotes a TXT value the way Route53 expects.
+func quoteTXT(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return `"` + value + `"`
+}
@@ -16,6 +16,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/controller"
 	"github.com/sky-uk/feed/util"
+	"github.com/sky-uk/feed/util/awscreds"
 )
 
 // ElbTag is the tag key used for identifying ELBs to attach to.
@@ -33,6 +34,7 @@ func New(region string, labelValue string, expectedNumber int, drainDelay time.D
 	if err != nil {
 		return nil, fmt.Errorf("unable to create ELB updater: %v", err)
 	}
+	awscreds.UseWebIdentity(session)
 
 	return &elb{
 		metadata:       ec2metadata.New(session),
@@ -143,6 +145,11 @@ func (e *elb) attachToFrontEnds() error {
 
 // FindFrontEndElbs finds all elbs tagged with 'sky.uk/KubernetesClusterFrontend=<labelValue>'
 func FindFrontEndElbs(awsElb ELB, labelValue string) (map[string]LoadBalancerDetails, error) {
+	return FindFrontEndElbsWithTags(awsElb, map[string]string{ElbTag: labelValue})
+}
+
+// FindFrontEndElbsWithTags finds all elbs with every one of the tags, by scheme.
+func FindFrontEndElbsWithTags(awsElb ELB, tags map[string]string) (map[string]LoadBalancerDetails, error) {
 	maxTagQuery := 20
 	// Find the load balancers that are tagged with this cluster name
 	request := &aws_elb.DescribeLoadBalancersInput{}
@@ -176,7 +183,7 @@ func FindFrontEndElbs(awsElb ELB, labelValue string) (map[string]LoadBalancerDet
 		}
 	}
 
-	log.Debugf("Found %d loadbalancers. Checking for %s tag set to %s", len(lbNames), ElbTag, labelValue)
+	log.Debugf("Found %d loadbalancers. Checking for tags %v", len(lbNames), tags)
 	clusterFrontEnds := make(map[string]LoadBalancerDetails)
 	partitions := util.Partition(len(lbNames), maxTagQuery)
 	for _, partition := range partitions {
@@ -191,13 +198,17 @@ func FindFrontEndElbs(awsElb ELB, labelValue string) (map[string]LoadBalancerDet
 
 		// todo cb error out if we already have an internal or public facing elb
 		for _, description := range output.TagDescriptions {
+			matched := 0
 			for _, tag := range description.Tags {
-				if *tag.Key == ElbTag && *tag.Value == labelValue {
-					log.Infof("Found frontend elb %s", *description.LoadBalancerName)
-					lb := allLbs[*description.LoadBalancerName]
-					clusterFrontEnds[lb.Scheme] = lb
+				if value, ok := tags[*tag.Key]; ok && *tag.Value == value {
+					matched++
 				}
 			}
+			if matched == len(tags) {
+				log.Infof("Found frontend elb %s", *description.LoadBalancerName)
+				lb := allLbs[*description.LoadBalancerName]
+				clusterFrontEnds[lb.Scheme] = lb
+			}
 		}
 	}
 	return clusterFrontEnds, nil
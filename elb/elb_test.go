@@ -221,6 +221,32 @@ func TestNameAndDNSNameAndHostedZoneIDLoadBalancerDetailsAreExtracted(t *testing
 	assert.Equal(t, elbInternalScheme, frontends[elbInternalScheme].Scheme)
 }
 
+func TestFrontendElbsMustHaveAllTheTags(t *testing.T) {
+	//given
+	mockElb := &fakeElb{}
+	mockLoadBalancers(mockElb,
+		lb{name: "team-frontend", scheme: elbInternalScheme},
+		lb{name: "other-team-frontend", scheme: elbInternetFacingScheme})
+	mockClusterTags(mockElb,
+		lbTags{name: "team-frontend", tags: []*aws_elb.Tag{
+			{Key: aws.String(frontendTag), Value: aws.String(clusterName)},
+			{Key: aws.String("team"), Value: aws.String("core")},
+		}},
+		lbTags{name: "other-team-frontend", tags: []*aws_elb.Tag{
+			{Key: aws.String(frontendTag), Value: aws.String(clusterName)},
+			{Key: aws.String("team"), Value: aws.String("other")},
+		}},
+	)
+
+	//when
+	frontends, err := FindFrontEndElbsWithTags(mockElb, map[string]string{frontendTag: clusterName, "team": "core"})
+
+	//then
+	assert.NoError(t, err)
+	assert.Len(t, frontends, 1)
+	assert.Equal(t, "team-frontend", frontends[elbInternalScheme].Name)
+}
+
 func TestAttachWithInternalAndInternetFacing(t *testing.T) {
 	// given
 	e, mockElb, mockMetadata := setup()
@@ -13,6 +13,7 @@ import (
 	"github.com/sky-uk/feed/elb"
 	"github.com/sky-uk/feed/k8s"
 	k8s_status "github.com/sky-uk/feed/k8s/status"
+	"github.com/sky-uk/feed/util/awscreds"
 	"k8s.io/client-go/pkg/api/v1"
 )
 
@@ -29,6 +30,7 @@ func New(conf Config) (controller.Updater, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to create ELB status updater: %v", err)
 	}
+	awscreds.UseWebIdentity(session)
 
 	return &status{
 		awsElb:           aws_elb.New(session),
@@ -66,6 +68,10 @@ func (s *status) Health() error {
 	return nil
 }
 
+func (s *status) String() string {
+	return "elb status updater"
+}
+
 func (s *status) Update(ingresses controller.IngressEntries) error {
 	return k8s_status.Update(ingresses, s.loadBalancers, s.kubernetesClient)
 }
@@ -0,0 +1,146 @@
+package k8s
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/util/metrics"
+	"k8s.io/client-go/pkg/api/meta"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// cacheSyncTimeout is how long GetIngresses and GetServices wait for their caches to sync before failing.
+var cacheSyncTimeout = 30 * time.Second
+
+var metricsOnce sync.Once
+var cacheResyncsCount *prometheus.CounterVec
+
+func initMetrics() {
+	metricsOnce.Do(func() {
+		cacheResyncsCount = prometheus.MustRegisterOrGet(prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metrics.PrometheusNamespace,
+				Subsystem: metrics.PrometheusKubernetesSubsystem,
+				Name:      "cache_resyncs",
+				Help: "The number of times a cache was listed again from the apiserver after its watch " +
+					"disconnected. A high rate means the connection to the apiserver is flapping.",
+				ConstLabels: metrics.ConstLabels(),
+			}, []string{"resource"})).(*prometheus.CounterVec)
+	})
+}
+
+// syncTracker tracks whether the cache of an informer is fresh. The informer lists every object again whenever its
+// watch of the apiserver disconnects, and while the relisted objects are processed the cache can be missing
+// changes made while it was disconnected. The cache is only synced once every listed object has been processed, so
+// updates wait for it instead of acting on a stale cache, e.g. by deleting the records of ingresses which exist.
+type syncTracker struct {
+	sync.Mutex
+	resource  string
+	handler   cache.ResourceEventHandler
+	hasListed bool
+	listing   bool
+	pending   map[string]bool
+}
+
+func newSyncTracker(resource string, handler cache.ResourceEventHandler) *syncTracker {
+	initMetrics()
+	return &syncTracker{resource: resource, handler: handler}
+}
+
+// listWatch wraps the list watch of the informer, to track when it lists.
+func (t *syncTracker) listWatch(lw *cache.ListWatch) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+			t.listStarted()
+			list, err := lw.List(options)
+			if err == nil {
+				t.listed(list)
+			}
+			return list, err
+		},
+		WatchFunc: lw.Watch,
+	}
+}
+
+func (t *syncTracker) listStarted() {
+	t.Lock()
+	defer t.Unlock()
+	if t.hasListed {
+		log.Warnf("Watch of %s disconnected, waiting for them to be listed again before updating", t.resource)
+		cacheResyncsCount.WithLabelValues(t.resource).Inc()
+	}
+	t.listing = true
+	t.pending = nil
+}
+
+// listed expects every object listed to be processed by the informer before the cache is synced. An object which
+// can't be keyed isn't waited for, as the informer can't process it either.
+func (t *syncTracker) listed(list runtime.Object) {
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		items = nil
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	t.hasListed = true
+	t.listing = false
+	t.pending = make(map[string]bool)
+	for _, item := range items {
+		if key, err := cache.MetaNamespaceKeyFunc(item); err == nil {
+			t.pending[key] = true
+		}
+	}
+}
+
+func (t *syncTracker) processed(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	delete(t.pending, key)
+}
+
+// synced is true once the last list has succeeded and every object it listed has been processed.
+func (t *syncTracker) synced() bool {
+	t.Lock()
+	defer t.Unlock()
+	return t.hasListed && !t.listing && len(t.pending) == 0
+}
+
+func (t *syncTracker) OnAdd(obj interface{}) {
+	t.processed(obj)
+	t.handler.OnAdd(obj)
+}
+
+func (t *syncTracker) OnUpdate(old, new interface{}) {
+	t.processed(new)
+	t.handler.OnUpdate(old, new)
+}
+
+func (t *syncTracker) OnDelete(obj interface{}) {
+	t.processed(obj)
+	t.handler.OnDelete(obj)
+}
+
+// waitForCacheSync waits up to cacheSyncTimeout for the caches to sync, returning false if they haven't.
+func waitForCacheSync(synced ...cache.InformerSynced) bool {
+	allSynced := true
+	for _, s := range synced {
+		allSynced = allSynced && s()
+	}
+	if allSynced {
+		return true
+	}
+
+	stop := make(chan struct{})
+	timer := time.AfterFunc(cacheSyncTimeout, func() { close(stop) })
+	defer timer.Stop()
+	return cache.WaitForCacheSync(stop, synced...)
+}
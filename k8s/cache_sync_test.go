@@ -0,0 +1,86 @@
+package k8s
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+func resyncs(resource string) float64 {
+	initMetrics()
+	var m dto.Metric
+	cacheResyncsCount.WithLabelValues(resource).Write(&m)
+	return m.GetCounter().GetValue()
+}
+
+func TestCacheIsOnlySyncedOnceEveryListedObjectIsProcessed(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	var handled []string
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { handled = append(handled, "add "+obj.(*v1.Service).Name) },
+		UpdateFunc: func(old, new interface{}) { handled = append(handled, "update "+new.(*v1.Service).Name) },
+		DeleteFunc: func(obj interface{}) { handled = append(handled, "delete") },
+	}
+	tracker := newSyncTracker("test-services", handler)
+	var listErr error
+	var syncedWhileListing bool
+	services := &v1.ServiceList{Items: []v1.Service{*service("ns", "dns", "10.0.0.1", ""),
+		*service("ns", "dns", "10.0.0.2", "")}}
+	services.Items[1].Name = "other"
+	lw := tracker.listWatch(&cache.ListWatch{
+		ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+			syncedWhileListing = tracker.synced()
+			return services, listErr
+		},
+		WatchFunc: func(options v1.ListOptions) (watch.Interface, error) { return nil, nil },
+	})
+	first, second := &services.Items[0], &services.Items[1]
+	before := resyncs("test-services")
+
+	// when
+	assert.False(tracker.synced(), "not listed yet")
+	lw.List(v1.ListOptions{})
+	tracker.OnAdd(first)
+	assert.False(tracker.synced(), "only one of the listed services has been processed")
+	tracker.OnAdd(second)
+	assert.True(tracker.synced())
+	assert.Equal(before, resyncs("test-services"), "the first list isn't a resync")
+
+	lw.List(v1.ListOptions{})
+	assert.False(syncedWhileListing, "stale while listing again")
+	assert.False(tracker.synced(), "stale until the relisted services are processed")
+	tracker.OnUpdate(first, first)
+	tracker.OnDelete(cache.DeletedFinalStateUnknown{Key: "ns/other", Obj: second})
+	assert.True(tracker.synced())
+
+	listErr = errors.New("connection refused")
+	lw.List(v1.ListOptions{})
+
+	// then
+	assert.False(tracker.synced(), "stale until a list succeeds")
+	assert.Equal(before+2, resyncs("test-services"))
+	assert.Equal([]string{"add service", "add other", "update service", "delete"}, handled)
+}
+
+func TestWaitForCacheSyncTimesOut(t *testing.T) {
+	assert := assert.New(t)
+	defer func(timeout time.Duration) { cacheSyncTimeout = timeout }(cacheSyncTimeout)
+	cacheSyncTimeout = 200 * time.Millisecond
+
+	assert.True(waitForCacheSync(func() bool { return true }))
+	assert.False(waitForCacheSync(func() bool { return true }, func() bool { return false }))
+}
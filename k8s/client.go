@@ -8,6 +8,7 @@ package k8s
 
 import (
 	"errors"
+	"reflect"
 	"sync"
 	"time"
 
@@ -16,23 +17,29 @@ import (
 	"k8s.io/client-go/pkg/api/v1"
 	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
 	"k8s.io/client-go/pkg/fields"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 // Time to handle multiple updates occurring in a short time period, such as at startup where
 // each existing endpoint / ingress produces a single update.
 const bufferedWatcherDuration = time.Millisecond * 50
 
+// IngressClassAnnotation is the annotation selecting which ingress controller an ingress is for.
+const IngressClassAnnotation = "kubernetes.io/ingress.class"
+
 // Client for connecting to a Kubernetes cluster.
 // Watchers will receive a notification whenever the client connects to the API server,
 // including reconnects, to notify that there may be new ingresses that need to be retrieved.
 // It's intended that client code will call the getters to retrieve the current state when notified.
 type Client interface {
-	// GetIngresses returns all the ingresses in the cluster.
+	// GetIngresses returns all the ingresses in the cluster. It waits for the cache of ingresses to sync, e.g. while
+	// it's listed again after the watch of the apiserver reconnects, and fails if it doesn't sync in time.
 	GetIngresses() ([]*v1beta1.Ingress, error)
 
-	// GetServices returns all the services in the cluster.
+	// GetServices returns all the services in the cluster, waiting for the cache of services to sync like
+	// GetIngresses.
 	GetServices() ([]*v1.Service, error)
 
 	// WatchIngresses watches for updates to ingresses and notifies the Watcher.
@@ -43,23 +50,76 @@ type Client interface {
 
 	// UpdateIngressStatus updates the ingress status with the loadbalancer hostname or ip address.
 	UpdateIngressStatus(*v1beta1.Ingress) error
+
+	// HasSynced returns true once the ingresses and services being watched have been listed from the apiserver. It's
+	// false again while they're listed again after the watch of the apiserver reconnects.
+	HasSynced() bool
 }
 
 type client struct {
 	sync.Mutex
-	clientset         *kubernetes.Clientset
-	resyncPeriod      time.Duration
-	ingressStore      cache.Store
-	ingressController *cache.Controller
-	ingressWatcher    *handlerWatcher
-	serviceStore      cache.Store
-	serviceController *cache.Controller
-	serviceWatcher    *handlerWatcher
+	clientset           *kubernetes.Clientset
+	resyncPeriod        time.Duration
+	ingressStore        cache.Store
+	ingressController   *cache.Controller
+	ingressWatcher      *handlerWatcher
+	ingressSync         *syncTracker
+	serviceStore        cache.Store
+	serviceController   *cache.Controller
+	serviceWatcher      *handlerWatcher
+	serviceSync         *syncTracker
+	namespaceStore      cache.Store
+	namespaceController *cache.Controller
+	namespaceSync       *syncTracker
+	ingressClass        string
+	namespace           string
+	namespaceSelector   labels.Selector
+	serviceWatch        ServiceWatch
+}
+
+// Options restrict the ingresses a client gets and watches, and the service changes it notifies. The zero value
+// includes every ingress and notifies every service change.
+type Options struct {
+	// IngressClass, if set, only includes ingresses with the ingress class annotation set to it.
+	IngressClass string
+	// Namespace, if set, only includes ingresses in the namespace.
+	Namespace string
+	// NamespaceSelector, if set, only includes ingresses in namespaces whose labels it matches. Namespaces are
+	// watched, so ingresses are included or left out straight away when the labels of their namespace change.
+	NamespaceSelector labels.Selector
+	// ServiceWatch selects the service changes notified by WatchServices.
+	ServiceWatch ServiceWatch
+}
+
+// ServiceWatch configures which changes to services are notified by WatchServices. The zero value notifies every
+// change, including resyncs. GetServices returns every service regardless, as ingresses may use any of them.
+type ServiceWatch struct {
+	// AddressChangesOnly only notifies updates to a service which change its cluster IP, or the load balancers in
+	// its status, e.g. when its load balancer is recreated with a new hostname. Services being added or deleted are
+	// always notified, as they change which ingresses have a service.
+	AddressChangesOnly bool
+	// Namespace, if set, restricts the load balancer changes notified with AddressChangesOnly to services in it.
+	Namespace string
+	// Selector, if set, restricts the load balancer changes notified with AddressChangesOnly to services whose
+	// labels it matches.
+	Selector labels.Selector
 }
 
 // New creates a client for the kubernetes apiserver.
-func New(kubeconfig string, resyncPeriod time.Duration) (Client, error) {
-	clientConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+func New(kubeconfig Kubeconfig, resyncPeriod time.Duration) (Client, error) {
+	return NewForIngressClass(kubeconfig, resyncPeriod, "")
+}
+
+// NewForIngressClass creates a client which only gets and watches the ingresses with the ingress class
+// annotation set to ingressClass. All ingresses are included if ingressClass is empty.
+func NewForIngressClass(kubeconfig Kubeconfig, resyncPeriod time.Duration, ingressClass string) (Client, error) {
+	return NewWithOptions(kubeconfig, resyncPeriod, Options{IngressClass: ingressClass})
+}
+
+// NewWithOptions creates a client which only gets and watches the ingresses included by the options, and notifies
+// the service changes selected by their service watch.
+func NewWithOptions(kubeconfig Kubeconfig, resyncPeriod time.Duration, options Options) (Client, error) {
+	clientConfig, err := kubeconfig.clientConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -69,19 +129,31 @@ func New(kubeconfig string, resyncPeriod time.Duration) (Client, error) {
 		return nil, err
 	}
 
-	return &client{clientset: clientset, resyncPeriod: resyncPeriod}, nil
+	return &client{
+		clientset:         clientset,
+		resyncPeriod:      resyncPeriod,
+		ingressClass:      options.IngressClass,
+		namespace:         options.Namespace,
+		namespaceSelector: options.NamespaceSelector,
+		serviceWatch:      options.ServiceWatch,
+	}, nil
 }
 
 func (c *client) GetIngresses() ([]*v1beta1.Ingress, error) {
 	c.createIngressSource()
 
-	if !c.ingressController.HasSynced() {
+	if !waitForCacheSync(c.ingressesSynced) {
 		return nil, errors.New("Ingresses haven't synced yet")
 	}
+	if c.namespaceController != nil && !waitForCacheSync(c.namespacesSynced) {
+		return nil, errors.New("Namespaces haven't synced yet")
+	}
 
 	ingresses := []*v1beta1.Ingress{}
 	for _, obj := range c.ingressStore.List() {
-		ingresses = append(ingresses, obj.(*v1beta1.Ingress))
+		if c.includesIngress(obj) {
+			ingresses = append(ingresses, obj.(*v1beta1.Ingress))
+		}
 	}
 
 	return ingresses, nil
@@ -99,20 +171,122 @@ func (c *client) createIngressSource() {
 		return
 	}
 
-	ingressLW := cache.NewListWatchFromClient(c.clientset.ExtensionsV1beta1().RESTClient(), "ingresses", "",
-		fields.Everything())
-	c.ingressWatcher = &handlerWatcher{bufferedWatcher: newBufferedWatcher(bufferedWatcherDuration)}
-	store, controller := cache.NewInformer(ingressLW, &v1beta1.Ingress{}, c.resyncPeriod, c.ingressWatcher)
+	ingressLW := cache.NewListWatchFromClient(c.clientset.ExtensionsV1beta1().RESTClient(), "ingresses",
+		c.namespace, fields.Everything())
+	c.ingressWatcher = &handlerWatcher{
+		bufferedWatcher: newBufferedWatcher(bufferedWatcherDuration),
+		include:         c.includesIngress,
+	}
+	if c.namespaceSelector != nil {
+		c.createNamespaceSource()
+	}
+	c.ingressSync = newSyncTracker("ingresses", c.ingressWatcher)
+	store, controller := cache.NewInformer(c.ingressSync.listWatch(ingressLW), &v1beta1.Ingress{}, c.resyncPeriod,
+		c.ingressSync)
 
 	c.ingressStore = store
 	c.ingressController = controller
 	go controller.Run(make(chan struct{}))
 }
 
+// createNamespaceSource watches namespaces for the namespace selector, notifying the ingress watcher when the labels
+// of a namespace change, as that changes which ingresses are included.
+func (c *client) createNamespaceSource() {
+	namespaceLW := cache.NewListWatchFromClient(c.clientset.CoreV1().RESTClient(), "namespaces", v1.NamespaceAll,
+		fields.Everything())
+	namespaceWatcher := &handlerWatcher{
+		bufferedWatcher: c.ingressWatcher.bufferedWatcher,
+		changed:         namespaceLabelsChanged,
+	}
+	c.namespaceSync = newSyncTracker("namespaces", namespaceWatcher)
+	store, controller := cache.NewInformer(c.namespaceSync.listWatch(namespaceLW), &v1.Namespace{}, c.resyncPeriod,
+		c.namespaceSync)
+
+	c.namespaceStore = store
+	c.namespaceController = controller
+	go controller.Run(make(chan struct{}))
+}
+
+func namespaceLabelsChanged(old, new interface{}) bool {
+	oldNamespace, oldOK := old.(*v1.Namespace)
+	newNamespace, newOK := new.(*v1.Namespace)
+	return !oldOK || !newOK || !reflect.DeepEqual(oldNamespace.Labels, newNamespace.Labels)
+}
+
+// includesIngress returns true if the object is an ingress of the client's ingress class, in a namespace included by
+// the namespace options.
+func (c *client) includesIngress(obj interface{}) bool {
+	return c.hasIngressClass(obj) && c.inNamespace(obj)
+}
+
+// inNamespace returns true if the object is an ingress in the namespace, and in a namespace matching the namespace
+// selector, if they're set. Objects which aren't ingresses are always included, as for hasIngressClass. Ingresses in
+// namespaces which haven't been seen yet are left out.
+func (c *client) inNamespace(obj interface{}) bool {
+	ingress, ok := obj.(*v1beta1.Ingress)
+	if !ok {
+		return true
+	}
+	if c.namespace != "" && ingress.Namespace != c.namespace {
+		return false
+	}
+	if c.namespaceSelector == nil {
+		return true
+	}
+	item, exists, err := c.namespaceStore.GetByKey(ingress.Namespace)
+	if err != nil || !exists {
+		return false
+	}
+	namespace, ok := item.(*v1.Namespace)
+	return ok && c.namespaceSelector.Matches(labels.Set(namespace.Labels))
+}
+
+// JitterResyncPeriod returns a random resync period between resyncPeriod and resyncPeriod * (1 + jitter), so replicas
+// with the same resync period spread out their resyncs. The resync period is returned unchanged if jitter isn't
+// positive.
+func JitterResyncPeriod(resyncPeriod time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return resyncPeriod
+	}
+	return wait.Jitter(resyncPeriod, jitter)
+}
+
+// hasIngressClass returns true if the object is an ingress of the client's ingress class. Objects which aren't
+// ingresses, such as the final state of an ingress deleted while disconnected, are always included.
+func (c *client) hasIngressClass(obj interface{}) bool {
+	ingress, ok := obj.(*v1beta1.Ingress)
+	if c.ingressClass == "" || !ok {
+		return true
+	}
+	return ingress.Annotations[IngressClassAnnotation] == c.ingressClass
+}
+
+// HasSynced is false while a cache is listed again after its watch disconnects, until the objects listed have been
+// processed.
+func (c *client) HasSynced() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.ingressController != nil && c.ingressesSynced() &&
+		c.serviceController != nil && c.servicesSynced() &&
+		(c.namespaceSelector == nil || c.namespacesSynced())
+}
+
+func (c *client) ingressesSynced() bool {
+	return c.ingressController.HasSynced() && c.ingressSync.synced()
+}
+
+func (c *client) servicesSynced() bool {
+	return c.serviceController.HasSynced() && c.serviceSync.synced()
+}
+
+func (c *client) namespacesSynced() bool {
+	return c.namespaceController.HasSynced() && c.namespaceSync.synced()
+}
+
 func (c *client) GetServices() ([]*v1.Service, error) {
 	c.createServiceSource()
 
-	if !c.serviceController.HasSynced() {
+	if !waitForCacheSync(c.servicesSynced) {
 		return nil, errors.New("Services haven't synced yet")
 	}
 
@@ -138,7 +312,12 @@ func (c *client) createServiceSource() {
 
 	serviceLW := cache.NewListWatchFromClient(c.clientset.CoreV1().RESTClient(), "services", "", fields.Everything())
 	c.serviceWatcher = &handlerWatcher{bufferedWatcher: newBufferedWatcher(bufferedWatcherDuration)}
-	store, controller := cache.NewInformer(serviceLW, &v1.Service{}, c.resyncPeriod, c.serviceWatcher)
+	if c.serviceWatch.AddressChangesOnly {
+		c.serviceWatcher.changed = c.serviceWatch.addressChanged
+	}
+	c.serviceSync = newSyncTracker("services", c.serviceWatcher)
+	store, controller := cache.NewInformer(c.serviceSync.listWatch(serviceLW), &v1.Service{}, c.resyncPeriod,
+		c.serviceSync)
 
 	c.serviceStore = store
 	c.serviceController = controller
@@ -160,9 +339,48 @@ func (c *client) UpdateIngressStatus(ingress *v1beta1.Ingress) error {
 	return err
 }
 
-// Implement cache.ResourceEventHandler
+// addressChanged returns true if an update to a service changes its cluster IP, or the load balancers in its status if
+// the service is watched.
+func (w ServiceWatch) addressChanged(old, new interface{}) bool {
+	oldService, oldOK := old.(*v1.Service)
+	newService, newOK := new.(*v1.Service)
+	if !oldOK || !newOK {
+		return true
+	}
+	if oldService.Spec.ClusterIP != newService.Spec.ClusterIP {
+		return true
+	}
+	if !w.watches(oldService) && !w.watches(newService) {
+		return false
+	}
+	return !reflect.DeepEqual(oldService.Status.LoadBalancer.Ingress, newService.Status.LoadBalancer.Ingress)
+}
+
+func (w ServiceWatch) watches(service *v1.Service) bool {
+	if w.Namespace != "" && service.Namespace != w.Namespace {
+		return false
+	}
+	return w.Selector == nil || w.Selector.Matches(labels.Set(service.Labels))
+}
+
+// Implement cache.ResourceEventHandler. If include is set, only changes to objects it includes are notified. If
+// changed is set, updates are only notified if it returns true, e.g. to ignore resyncs.
 type handlerWatcher struct {
 	*bufferedWatcher
+	include func(obj interface{}) bool
+	changed func(old, new interface{}) bool
+}
+
+func (w *handlerWatcher) includes(objs ...interface{}) bool {
+	if w.include == nil {
+		return true
+	}
+	for _, obj := range objs {
+		if w.include(obj) {
+			return true
+		}
+	}
+	return false
 }
 
 func (w *handlerWatcher) notify() {
@@ -170,16 +388,29 @@ func (w *handlerWatcher) notify() {
 }
 
 func (w *handlerWatcher) OnAdd(obj interface{}) {
+	if !w.includes(obj) {
+		return
+	}
 	log.Debugf("OnAdd called for %v - updating watcher", obj)
 	go w.notify()
 }
 
 func (w *handlerWatcher) OnUpdate(old interface{}, new interface{}) {
+	// Either may be included, as the update may change whether it's included.
+	if !w.includes(old, new) {
+		return
+	}
+	if w.changed != nil && !w.changed(old, new) {
+		return
+	}
 	log.Debugf("OnUpdate called for %v to %v - updating watcher", old, new)
 	go w.notify()
 }
 
 func (w *handlerWatcher) OnDelete(obj interface{}) {
+	if !w.includes(obj) {
+		return
+	}
 	log.Debugf("OnDelete called for %v - updating watcher", obj)
 	go w.notify()
 }
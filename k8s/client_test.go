@@ -0,0 +1,155 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+func ingressOfClass(class string) *v1beta1.Ingress {
+	ingress := &v1beta1.Ingress{ObjectMeta: v1.ObjectMeta{Name: "ingress", Annotations: map[string]string{}}}
+	if class != "" {
+		ingress.Annotations[IngressClassAnnotation] = class
+	}
+	return ingress
+}
+
+func TestIngressesAreFilteredByIngressClass(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &client{ingressClass: "feed"}
+	assert.True(c.hasIngressClass(ingressOfClass("feed")))
+	assert.False(c.hasIngressClass(ingressOfClass("nginx")))
+	assert.False(c.hasIngressClass(ingressOfClass("")))
+	assert.True(c.hasIngressClass(cache.DeletedFinalStateUnknown{Key: "ingress"}))
+
+	all := &client{}
+	assert.True(all.hasIngressClass(ingressOfClass("nginx")))
+	assert.True(all.hasIngressClass(ingressOfClass("")))
+}
+
+func TestWatcherOnlyNotifiesForIncludedIngresses(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &client{ingressClass: "feed"}
+	w := &handlerWatcher{bufferedWatcher: newBufferedWatcher(smallWaitTime), include: c.hasIngressClass}
+
+	assert.False(w.includes(ingressOfClass("nginx")))
+	assert.True(w.includes(ingressOfClass("feed")))
+	assert.True(w.includes(ingressOfClass("nginx"), ingressOfClass("feed")), "class changed from feed")
+	assert.True((&handlerWatcher{}).includes(ingressOfClass("nginx")), "no filter")
+}
+
+func TestResyncPeriodIsJittered(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(time.Minute, JitterResyncPeriod(time.Minute, 0))
+	for i := 0; i < 10; i++ {
+		period := JitterResyncPeriod(time.Minute, 0.5)
+		assert.True(period >= time.Minute && period <= 90*time.Second, "%v not within jitter", period)
+	}
+}
+
+func TestClientHasNotSyncedBeforeWatching(t *testing.T) {
+	assert.False(t, (&client{}).HasSynced())
+}
+
+func service(namespace, team, clusterIP, lbHostname string) *v1.Service {
+	svc := &v1.Service{ObjectMeta: v1.ObjectMeta{Namespace: namespace, Name: "service",
+		Labels: map[string]string{"team": team}}}
+	svc.Spec.ClusterIP = clusterIP
+	if lbHostname != "" {
+		svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{Hostname: lbHostname}}
+	}
+	return svc
+}
+
+func TestServiceWatchOnlyNotifiesAddressChanges(t *testing.T) {
+	assert := assert.New(t)
+	selector, err := labels.Parse("team=dns")
+	assert.NoError(err)
+	watch := ServiceWatch{AddressChangesOnly: true, Namespace: "ingress", Selector: selector}
+
+	assert.False(watch.addressChanged(service("ingress", "dns", "10.0.0.1", "lb-1"),
+		service("ingress", "dns", "10.0.0.1", "lb-1")), "resync")
+	assert.True(watch.addressChanged(service("ingress", "dns", "10.0.0.1", "lb-1"),
+		service("ingress", "dns", "10.0.0.1", "lb-2")), "load balancer recreated")
+	assert.True(watch.addressChanged(service("ingress", "dns", "10.0.0.1", ""),
+		service("ingress", "dns", "10.0.0.1", "lb-1")), "load balancer provisioned")
+	assert.False(watch.addressChanged(service("apps", "dns", "10.0.0.1", "lb-1"),
+		service("apps", "dns", "10.0.0.1", "lb-2")), "other namespace")
+	assert.False(watch.addressChanged(service("ingress", "web", "10.0.0.1", "lb-1"),
+		service("ingress", "web", "10.0.0.1", "lb-2")), "not selected")
+	assert.True(watch.addressChanged(service("apps", "web", "10.0.0.1", ""),
+		service("apps", "web", "10.0.0.2", "")), "cluster IP of any service")
+	assert.True(watch.addressChanged(cache.DeletedFinalStateUnknown{Key: "service"},
+		service("apps", "web", "10.0.0.1", "")), "not a service")
+	assert.True(ServiceWatch{AddressChangesOnly: true}.addressChanged(service("apps", "web", "10.0.0.1", "lb-1"),
+		service("apps", "web", "10.0.0.1", "lb-2")), "every service watched by default")
+}
+
+func TestWatcherIgnoresUnchangedUpdates(t *testing.T) {
+	w := &handlerWatcher{bufferedWatcher: newBufferedWatcher(smallWaitTime),
+		changed: ServiceWatch{AddressChangesOnly: true}.addressChanged}
+
+	w.OnUpdate(service("apps", "web", "10.0.0.1", "lb-1"), service("apps", "web", "10.0.0.1", "lb-1"))
+	time.Sleep(smallWaitTime * 3)
+
+	select {
+	case <-w.Updates():
+		t.Error("should not notify an unchanged service")
+	default:
+	}
+
+	w.OnUpdate(service("apps", "web", "10.0.0.1", "lb-1"), service("apps", "web", "10.0.0.1", "lb-2"))
+	select {
+	case <-w.Updates():
+	case <-time.After(time.Second):
+		t.Error("should notify a changed load balancer")
+	}
+}
+
+func ingressIn(namespace string) *v1beta1.Ingress {
+	return &v1beta1.Ingress{ObjectMeta: v1.ObjectMeta{Namespace: namespace, Name: "ingress"}}
+}
+
+func TestIngressesAreFilteredByNamespace(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &client{namespace: "prod"}
+	assert.True(c.includesIngress(ingressIn("prod")))
+	assert.False(c.includesIngress(ingressIn("dev")))
+	assert.True(c.includesIngress(cache.DeletedFinalStateUnknown{Key: "dev/ingress"}))
+	assert.True((&client{}).includesIngress(ingressIn("dev")), "all namespaces")
+}
+
+func TestIngressesAreFilteredByNamespaceSelector(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	selector, err := labels.Parse("env=prod")
+	assert.NoError(err)
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	store.Add(&v1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "prod-a", Labels: map[string]string{"env": "prod"}}})
+	store.Add(&v1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "dev-a", Labels: map[string]string{"env": "dev"}}})
+	c := &client{namespaceSelector: selector, namespaceStore: store}
+
+	// then
+	assert.True(c.includesIngress(ingressIn("prod-a")))
+	assert.False(c.includesIngress(ingressIn("dev-a")))
+	assert.False(c.includesIngress(ingressIn("unknown")), "namespace not seen yet")
+}
+
+func TestNamespaceLabelChangesAreNotified(t *testing.T) {
+	assert := assert.New(t)
+	namespace := func(env string) *v1.Namespace {
+		return &v1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "a", Labels: map[string]string{"env": env}}}
+	}
+
+	assert.False(namespaceLabelsChanged(namespace("prod"), namespace("prod")))
+	assert.True(namespaceLabelsChanged(namespace("prod"), namespace("dev")))
+}
@@ -0,0 +1,114 @@
+package k8s
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	metav1 "k8s.io/client-go/pkg/apis/meta/v1"
+)
+
+// duplicateEventInterval is how long identical events are suppressed for, so repeated updates making the same
+// changes don't flood the event stream.
+const duplicateEventInterval = 10 * time.Minute
+
+// EventRecorder records Kubernetes events on ingresses, so changes made on their behalf are visible with
+// kubectl describe.
+type EventRecorder interface {
+	// Event records an event of type v1.EventTypeNormal or v1.EventTypeWarning on the ingress. It returns
+	// immediately, without waiting for the event to be created.
+	Event(ingress *v1beta1.Ingress, eventType, reason, message string)
+}
+
+type eventRecorder struct {
+	sync.Mutex
+	component string
+	create    func(*v1.Event) (*v1.Event, error)
+	now       func() time.Time
+	recorded  map[eventKey]time.Time
+	pending   sync.WaitGroup
+}
+
+type eventKey struct {
+	namespace, name, eventType, reason, message string
+}
+
+// NewEventRecorder creates an EventRecorder which records events from the component, e.g. feed-dns.
+func NewEventRecorder(kubeconfig Kubeconfig, component string) (EventRecorder, error) {
+	clientConfig, err := kubeconfig.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEventRecorder(component, func(event *v1.Event) (*v1.Event, error) {
+		return clientset.CoreV1().Events(event.Namespace).Create(event)
+	}), nil
+}
+
+func newEventRecorder(component string, create func(*v1.Event) (*v1.Event, error)) *eventRecorder {
+	return &eventRecorder{
+		component: component,
+		create:    create,
+		now:       time.Now,
+		recorded:  make(map[eventKey]time.Time),
+	}
+}
+
+func (r *eventRecorder) Event(ingress *v1beta1.Ingress, eventType, reason, message string) {
+	key := eventKey{ingress.Namespace, ingress.Name, eventType, reason, message}
+	now := r.now()
+
+	r.Lock()
+	for k, recorded := range r.recorded {
+		if now.Sub(recorded) >= duplicateEventInterval {
+			delete(r.recorded, k)
+		}
+	}
+	if _, duplicate := r.recorded[key]; duplicate {
+		r.Unlock()
+		log.Debugf("Suppressing duplicate event on %s/%s: %s", ingress.Namespace, ingress.Name, message)
+		return
+	}
+	r.recorded[key] = now
+	r.Unlock()
+
+	timestamp := metav1.NewTime(now)
+	event := &v1.Event{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: ingress.Namespace,
+			Name:      fmt.Sprintf("%s.%x", ingress.Name, now.UnixNano()),
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind:            "Ingress",
+			APIVersion:      "extensions/v1beta1",
+			Namespace:       ingress.Namespace,
+			Name:            ingress.Name,
+			UID:             ingress.UID,
+			ResourceVersion: ingress.ResourceVersion,
+		},
+		Type:           eventType,
+		Reason:         reason,
+		Message:        message,
+		Source:         v1.EventSource{Component: r.component},
+		FirstTimestamp: timestamp,
+		LastTimestamp:  timestamp,
+		Count:          1,
+	}
+
+	r.pending.Add(1)
+	go func() {
+		defer r.pending.Done()
+		if _, err := r.create(event); err != nil {
+			log.Warnf("Unable to record event on %s/%s: %v", ingress.Namespace, ingress.Name, err)
+		}
+	}()
+}
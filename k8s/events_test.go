@@ -0,0 +1,66 @@
+package k8s
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+type fakeEvents struct {
+	sync.Mutex
+	created []*v1.Event
+}
+
+func (f *fakeEvents) create(event *v1.Event) (*v1.Event, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.created = append(f.created, event)
+	return event, nil
+}
+
+func testIngress() *v1beta1.Ingress {
+	return &v1beta1.Ingress{ObjectMeta: v1.ObjectMeta{Namespace: "happysky", Name: "foo", UID: "1234"}}
+}
+
+func TestEventsAreRecordedOnTheIngress(t *testing.T) {
+	assert := assert.New(t)
+	events := &fakeEvents{}
+	recorder := newEventRecorder("feed-dns", events.create)
+
+	recorder.Event(testIngress(), v1.EventTypeNormal, "DNSRecordCreated", "Created A record foo.com.")
+	recorder.pending.Wait()
+
+	if assert.Len(events.created, 1) {
+		event := events.created[0]
+		assert.Equal("happysky", event.Namespace)
+		assert.Equal(v1.ObjectReference{Kind: "Ingress", APIVersion: "extensions/v1beta1", Namespace: "happysky",
+			Name: "foo", UID: "1234"}, event.InvolvedObject)
+		assert.Equal(v1.EventTypeNormal, event.Type)
+		assert.Equal("DNSRecordCreated", event.Reason)
+		assert.Equal("Created A record foo.com.", event.Message)
+		assert.Equal("feed-dns", event.Source.Component)
+	}
+}
+
+func TestDuplicateEventsAreSuppressed(t *testing.T) {
+	assert := assert.New(t)
+	events := &fakeEvents{}
+	recorder := newEventRecorder("feed-dns", events.create)
+	clock := &fakeClock{time: time.Now()}
+	recorder.now = clock.now
+
+	recorder.Event(testIngress(), v1.EventTypeWarning, "DNSUpdateFailed", "kaboom")
+	recorder.Event(testIngress(), v1.EventTypeWarning, "DNSUpdateFailed", "kaboom")
+	recorder.Event(testIngress(), v1.EventTypeWarning, "DNSUpdateFailed", "different kaboom")
+	recorder.pending.Wait()
+	assert.Len(events.created, 2, "should suppress the duplicate")
+
+	clock.time = clock.time.Add(duplicateEventInterval)
+	recorder.Event(testIngress(), v1.EventTypeWarning, "DNSUpdateFailed", "kaboom")
+	recorder.pending.Wait()
+	assert.Len(events.created, 3, "should record the event again after the interval")
+}
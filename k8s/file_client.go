@@ -0,0 +1,117 @@
+package k8s
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/pkg/util/yaml"
+)
+
+type fileClient struct {
+	ingresses []*v1beta1.Ingress
+	services  []*v1.Service
+	watcher   *watcher
+}
+
+// NewFromFile creates a client of the ingresses and services in a file of YAML or JSON manifests, instead of the
+// apiserver, e.g. to see the records feed-dns computes for them. Documents can be separated with "---", or be a
+// List. Other kinds of object are ignored. Only the ingresses with the ingress class annotation set to ingressClass
+// are included, unless ingressClass is empty. The client has synced straight away, and never notifies its watchers.
+func NewFromFile(path string, ingressClass string) (Client, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	c := &fileClient{services: []*v1.Service{}, watcher: newWatcher()}
+	decoder := yaml.NewYAMLOrJSONDecoder(file, 4096)
+	for {
+		var doc json.RawMessage
+		if err := decoder.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %v", path, err)
+		}
+		if err := c.add(doc); err != nil {
+			return nil, fmt.Errorf("unable to read %s: %v", path, err)
+		}
+	}
+
+	ingresses := []*v1beta1.Ingress{}
+	for _, ingress := range c.ingresses {
+		if ingressClass == "" || ingress.Annotations[IngressClassAnnotation] == ingressClass {
+			ingresses = append(ingresses, ingress)
+		}
+	}
+	c.ingresses = ingresses
+	return c, nil
+}
+
+func (c *fileClient) add(doc json.RawMessage) error {
+	if len(doc) == 0 || string(doc) == "null" {
+		return nil
+	}
+
+	var object struct {
+		Kind  string            `json:"kind"`
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(doc, &object); err != nil {
+		return err
+	}
+
+	switch object.Kind {
+	case "Ingress":
+		ingress := &v1beta1.Ingress{}
+		if err := json.Unmarshal(doc, ingress); err != nil {
+			return fmt.Errorf("invalid ingress: %v", err)
+		}
+		c.ingresses = append(c.ingresses, ingress)
+	case "Service":
+		service := &v1.Service{}
+		if err := json.Unmarshal(doc, service); err != nil {
+			return fmt.Errorf("invalid service: %v", err)
+		}
+		c.services = append(c.services, service)
+	case "List":
+		for _, item := range object.Items {
+			if err := c.add(item); err != nil {
+				return err
+			}
+		}
+	default:
+		log.Debugf("Ignoring %s in manifests", object.Kind)
+	}
+	return nil
+}
+
+func (c *fileClient) GetIngresses() ([]*v1beta1.Ingress, error) {
+	return c.ingresses, nil
+}
+
+func (c *fileClient) GetServices() ([]*v1.Service, error) {
+	return c.services, nil
+}
+
+func (c *fileClient) WatchIngresses() Watcher {
+	return c.watcher
+}
+
+func (c *fileClient) WatchServices() Watcher {
+	return c.watcher
+}
+
+func (c *fileClient) UpdateIngressStatus(*v1beta1.Ingress) error {
+	return errors.New("ingresses read from a file can't be updated")
+}
+
+func (c *fileClient) HasSynced() bool {
+	return true
+}
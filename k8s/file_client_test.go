@@ -0,0 +1,100 @@
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testManifests = `apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: web
+  namespace: default
+  annotations:
+    kubernetes.io/ingress.class: feed
+spec:
+  rules:
+  - host: web.example.com
+---
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: other
+  namespace: default
+  annotations:
+    kubernetes.io/ingress.class: nginx
+---
+apiVersion: apps/v1beta1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: web
+    namespace: default
+  spec:
+    clusterIP: 10.0.0.1
+`
+
+func writeManifests(t *testing.T, manifests string) string {
+	file, err := ioutil.TempFile("", "manifests")
+	assert.NoError(t, err)
+	_, err = file.WriteString(manifests)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	return file.Name()
+}
+
+func TestFileClientReadsIngressesAndServices(t *testing.T) {
+	assert := assert.New(t)
+	path := writeManifests(t, testManifests)
+	defer os.Remove(path)
+
+	client, err := NewFromFile(path, "")
+	assert.NoError(err)
+
+	ingresses, err := client.GetIngresses()
+	assert.NoError(err)
+	if assert.Len(ingresses, 2) {
+		assert.Equal("web", ingresses[0].Name)
+		assert.Equal("web.example.com", ingresses[0].Spec.Rules[0].Host)
+		assert.Equal("other", ingresses[1].Name)
+	}
+	services, err := client.GetServices()
+	assert.NoError(err)
+	if assert.Len(services, 1) {
+		assert.Equal("10.0.0.1", services[0].Spec.ClusterIP)
+	}
+	assert.True(client.HasSynced())
+}
+
+func TestFileClientOnlyIncludesIngressesOfTheIngressClass(t *testing.T) {
+	assert := assert.New(t)
+	path := writeManifests(t, testManifests)
+	defer os.Remove(path)
+
+	client, err := NewFromFile(path, "feed")
+	assert.NoError(err)
+
+	ingresses, err := client.GetIngresses()
+	assert.NoError(err)
+	if assert.Len(ingresses, 1) {
+		assert.Equal("web", ingresses[0].Name)
+	}
+}
+
+func TestFileClientFailsOnInvalidManifests(t *testing.T) {
+	path := writeManifests(t, "kind: Ingress\nspec: [not, an, ingress]\n")
+	defer os.Remove(path)
+
+	_, err := NewFromFile(path, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,38 @@
+package k8s
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Kubeconfig selects the apiserver to connect to. The zero value connects from inside a cluster.
+type Kubeconfig struct {
+	// Path of the kubeconfig file. Empty connects from inside a cluster, unless Context is set.
+	Path string
+	// Context of the kubeconfig to connect with. Empty uses the current context. If Path is empty, the context is
+	// found in the default kubeconfig files, e.g. $KUBECONFIG or ~/.kube/config.
+	Context string
+}
+
+func (k Kubeconfig) clientConfig() (*rest.Config, error) {
+	if k.Context == "" {
+		return clientcmd.BuildConfigFromFlags("", k.Path)
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if k.Path != "" {
+		rules.ExplicitPath = k.Path
+	}
+	config, err := rules.Load()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load kubeconfig: %v", err)
+	}
+	if _, ok := config.Contexts[k.Context]; !ok {
+		return nil, fmt.Errorf("context %q doesn't exist in the kubeconfig", k.Context)
+	}
+
+	return clientcmd.NewNonInteractiveClientConfig(*config, k.Context, &clientcmd.ConfigOverrides{}, rules).
+		ClientConfig()
+}
@@ -0,0 +1,72 @@
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+- name: prod
+  cluster:
+    server: https://prod.example.com
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: feed
+- name: prod
+  context:
+    cluster: prod
+    user: feed
+users:
+- name: feed
+  user:
+    token: secret
+`
+
+func writeKubeconfig(t *testing.T) string {
+	file, err := ioutil.TempFile("", "kubeconfig")
+	assert.NoError(t, err)
+	_, err = file.WriteString(testKubeconfig)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	return file.Name()
+}
+
+func TestKubeconfigUsesTheCurrentContextByDefault(t *testing.T) {
+	path := writeKubeconfig(t)
+	defer os.Remove(path)
+
+	config, err := Kubeconfig{Path: path}.clientConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://dev.example.com", config.Host)
+}
+
+func TestKubeconfigUsesTheSelectedContext(t *testing.T) {
+	path := writeKubeconfig(t)
+	defer os.Remove(path)
+
+	config, err := Kubeconfig{Path: path, Context: "prod"}.clientConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://prod.example.com", config.Host)
+}
+
+func TestKubeconfigWithAnUnknownContextIsAnError(t *testing.T) {
+	path := writeKubeconfig(t)
+	defer os.Remove(path)
+
+	_, err := Kubeconfig{Path: path, Context: "staging"}.clientConfig()
+
+	assert.EqualError(t, err, `context "staging" doesn't exist in the kubeconfig`)
+}
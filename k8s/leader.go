@@ -0,0 +1,209 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/errors"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// leaderAnnotation is the same annotation used by the Kubernetes leader election of this era, so existing tooling
+// can show the current leader.
+const leaderAnnotation = "control-plane.alpha.kubernetes.io/leader"
+
+// LeaderLock is a lock held by at most one replica at a time, used to elect a leader.
+type LeaderLock interface {
+	// TryAcquireOrRenew acquires the lock if it's free or expired, or renews it if already held.
+	// Returns true if the lock is held by this replica.
+	TryAcquireOrRenew() (bool, error)
+	// Release the lock if held by this replica, so another replica can acquire it without waiting for it to expire.
+	Release() error
+}
+
+// leaderRecord is stored in the leader annotation.
+type leaderRecord struct {
+	HolderIdentity       string    `json:"holderIdentity"`
+	LeaseDurationSeconds int       `json:"leaseDurationSeconds"`
+	AcquireTime          time.Time `json:"acquireTime"`
+	RenewTime            time.Time `json:"renewTime"`
+}
+
+func (r leaderRecord) equal(other leaderRecord) bool {
+	return r.HolderIdentity == other.HolderIdentity && r.LeaseDurationSeconds == other.LeaseDurationSeconds &&
+		r.AcquireTime.Equal(other.AcquireTime) && r.RenewTime.Equal(other.RenewTime)
+}
+
+// configMaps is the subset of ConfigMapInterface used by the lock.
+type configMaps interface {
+	Get(name string) (*v1.ConfigMap, error)
+	Create(*v1.ConfigMap) (*v1.ConfigMap, error)
+	Update(*v1.ConfigMap) (*v1.ConfigMap, error)
+}
+
+type configMapLock struct {
+	sync.Mutex
+	configMaps    configMaps
+	namespace     string
+	name          string
+	identity      string
+	leaseDuration time.Duration
+	now           func() time.Time
+	// Expiry is judged against when the record last changed locally, rather than the renew time written by the
+	// holder, so it doesn't depend on the clocks of the replicas agreeing.
+	observedRecord leaderRecord
+	observedTime   time.Time
+}
+
+// NewLeaderLock creates a LeaderLock stored in the namespace/name config map, which is created if needed.
+// The lock expires if its holder doesn't renew it within leaseDuration.
+func NewLeaderLock(kubeconfig Kubeconfig, namespace, name, identity string,
+	leaseDuration time.Duration) (LeaderLock, error) {
+
+	clientConfig, err := kubeconfig.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return newConfigMapLock(clientset.CoreV1().ConfigMaps(namespace), namespace, name, identity, leaseDuration), nil
+}
+
+func newConfigMapLock(configMaps configMaps, namespace, name, identity string,
+	leaseDuration time.Duration) *configMapLock {
+	return &configMapLock{
+		configMaps:    configMaps,
+		namespace:     namespace,
+		name:          name,
+		identity:      identity,
+		leaseDuration: leaseDuration,
+		now:           time.Now,
+	}
+}
+
+func (l *configMapLock) TryAcquireOrRenew() (bool, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	desired := leaderRecord{
+		HolderIdentity:       l.identity,
+		LeaseDurationSeconds: int(l.leaseDuration / time.Second),
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+
+	configMap, err := l.configMaps.Get(l.name)
+	if errors.IsNotFound(err) {
+		configMap = &v1.ConfigMap{ObjectMeta: v1.ObjectMeta{Namespace: l.namespace, Name: l.name}}
+		if err := setLeaderRecord(configMap, desired); err != nil {
+			return false, err
+		}
+		if _, err := l.configMaps.Create(configMap); err != nil {
+			if errors.IsAlreadyExists(err) {
+				return false, nil
+			}
+			return false, fmt.Errorf("unable to create leader lock %s/%s: %v", l.namespace, l.name, err)
+		}
+		l.observe(desired, now)
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to get leader lock %s/%s: %v", l.namespace, l.name, err)
+	}
+
+	current, err := getLeaderRecord(configMap)
+	if err != nil {
+		return false, err
+	}
+	if !current.equal(l.observedRecord) {
+		l.observe(current, now)
+	}
+
+	held := current.HolderIdentity == l.identity
+	expired := l.observedTime.Add(l.leaseDuration).Before(now)
+	if !held && current.HolderIdentity != "" && !expired {
+		return false, nil
+	}
+
+	if held {
+		desired.AcquireTime = current.AcquireTime
+	}
+	if err := setLeaderRecord(configMap, desired); err != nil {
+		return false, err
+	}
+	if _, err := l.configMaps.Update(configMap); err != nil {
+		// A conflict means another replica updated the lock first.
+		if errors.IsConflict(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to update leader lock %s/%s: %v", l.namespace, l.name, err)
+	}
+	l.observe(desired, now)
+	return true, nil
+}
+
+func (l *configMapLock) Release() error {
+	l.Lock()
+	defer l.Unlock()
+
+	configMap, err := l.configMaps.Get(l.name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get leader lock %s/%s: %v", l.namespace, l.name, err)
+	}
+
+	current, err := getLeaderRecord(configMap)
+	if err != nil {
+		return err
+	}
+	if current.HolderIdentity != l.identity {
+		return nil
+	}
+
+	if err := setLeaderRecord(configMap, leaderRecord{}); err != nil {
+		return err
+	}
+	if _, err := l.configMaps.Update(configMap); err != nil {
+		return fmt.Errorf("unable to release leader lock %s/%s: %v", l.namespace, l.name, err)
+	}
+	return nil
+}
+
+func (l *configMapLock) observe(record leaderRecord, now time.Time) {
+	l.observedRecord = record
+	l.observedTime = now
+}
+
+func getLeaderRecord(configMap *v1.ConfigMap) (leaderRecord, error) {
+	var record leaderRecord
+	value, ok := configMap.Annotations[leaderAnnotation]
+	if !ok || value == "" {
+		return record, nil
+	}
+	if err := json.Unmarshal([]byte(value), &record); err != nil {
+		return record, fmt.Errorf("unable to parse leader lock %s/%s: %v", configMap.Namespace, configMap.Name, err)
+	}
+	return record, nil
+}
+
+func setLeaderRecord(configMap *v1.ConfigMap, record leaderRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if configMap.Annotations == nil {
+		configMap.Annotations = make(map[string]string)
+	}
+	configMap.Annotations[leaderAnnotation] = string(value)
+	return nil
+}
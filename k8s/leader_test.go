@@ -0,0 +1,148 @@
+package k8s
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	k8s_errors "k8s.io/client-go/pkg/api/errors"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/runtime/schema"
+)
+
+const leaseDuration = 15 * time.Second
+
+var configMapResource = schema.GroupResource{Resource: "configmaps"}
+
+// fakeConfigMaps stores a single config map, rejecting updates from stale copies like the apiserver.
+type fakeConfigMaps struct {
+	configMap *v1.ConfigMap
+	version   int
+	err       error
+}
+
+func (f *fakeConfigMaps) Get(name string) (*v1.ConfigMap, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.configMap == nil {
+		return nil, k8s_errors.NewNotFound(configMapResource, name)
+	}
+	copy := *f.configMap
+	copy.Annotations = make(map[string]string)
+	for k, v := range f.configMap.Annotations {
+		copy.Annotations[k] = v
+	}
+	return &copy, nil
+}
+
+func (f *fakeConfigMaps) Create(configMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	if f.configMap != nil {
+		return nil, k8s_errors.NewAlreadyExists(configMapResource, configMap.Name)
+	}
+	return f.store(configMap), nil
+}
+
+func (f *fakeConfigMaps) Update(configMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	if configMap.ResourceVersion != f.configMap.ResourceVersion {
+		return nil, k8s_errors.NewConflict(configMapResource, configMap.Name, errors.New("stale"))
+	}
+	return f.store(configMap), nil
+}
+
+func (f *fakeConfigMaps) store(configMap *v1.ConfigMap) *v1.ConfigMap {
+	f.version++
+	configMap.ResourceVersion = strconv.Itoa(f.version)
+	f.configMap = configMap
+	return configMap
+}
+
+type fakeClock struct {
+	time time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.time
+}
+
+func newTestLock(configMaps *fakeConfigMaps, identity string, clock *fakeClock) *configMapLock {
+	lock := newConfigMapLock(configMaps, "kube-system", "feed-dns-leader", identity, leaseDuration)
+	lock.now = clock.now
+	return lock
+}
+
+func TestLeaderLockIsCreatedAndHeldByFirstReplica(t *testing.T) {
+	assert := assert.New(t)
+	configMaps := &fakeConfigMaps{}
+	clock := &fakeClock{time: time.Now()}
+	first := newTestLock(configMaps, "first", clock)
+	second := newTestLock(configMaps, "second", clock)
+
+	held, err := first.TryAcquireOrRenew()
+	assert.NoError(err)
+	assert.True(held)
+
+	held, err = second.TryAcquireOrRenew()
+	assert.NoError(err)
+	assert.False(held)
+
+	held, err = first.TryAcquireOrRenew()
+	assert.NoError(err)
+	assert.True(held, "should renew")
+	assert.Contains(configMaps.configMap.Annotations[leaderAnnotation], `"holderIdentity":"first"`)
+}
+
+func TestLeaderLockIsAcquiredByAnotherReplicaWhenExpired(t *testing.T) {
+	assert := assert.New(t)
+	configMaps := &fakeConfigMaps{}
+	clock := &fakeClock{time: time.Now()}
+	first := newTestLock(configMaps, "first", clock)
+	second := newTestLock(configMaps, "second", clock)
+
+	_, err := first.TryAcquireOrRenew()
+	assert.NoError(err)
+	held, err := second.TryAcquireOrRenew()
+	assert.NoError(err)
+	assert.False(held)
+
+	clock.time = clock.time.Add(leaseDuration + time.Second)
+	held, err = second.TryAcquireOrRenew()
+	assert.NoError(err)
+	assert.True(held)
+
+	held, err = first.TryAcquireOrRenew()
+	assert.NoError(err)
+	assert.False(held, "former leader should have lost the lock")
+}
+
+func TestLeaderLockCanBeAcquiredAfterRelease(t *testing.T) {
+	assert := assert.New(t)
+	configMaps := &fakeConfigMaps{}
+	clock := &fakeClock{time: time.Now()}
+	first := newTestLock(configMaps, "first", clock)
+	second := newTestLock(configMaps, "second", clock)
+
+	_, err := first.TryAcquireOrRenew()
+	assert.NoError(err)
+	assert.NoError(second.Release(), "releasing a lock held by another replica does nothing")
+	held, err := second.TryAcquireOrRenew()
+	assert.NoError(err)
+	assert.False(held)
+
+	assert.NoError(first.Release())
+	held, err = second.TryAcquireOrRenew()
+	assert.NoError(err)
+	assert.True(held)
+}
+
+func TestLeaderLockIsNotHeldOnError(t *testing.T) {
+	configMaps := &fakeConfigMaps{err: errors.New("apiserver unavailable")}
+	lock := newTestLock(configMaps, "first", &fakeClock{time: time.Now()})
+
+	held, err := lock.TryAcquireOrRenew()
+
+	assert.Error(t, err)
+	assert.False(t, held)
+}
@@ -58,6 +58,10 @@ func (s *status) Health() error {
 	return nil
 }
 
+func (s *status) String() string {
+	return "merlin status updater"
+}
+
 func (s *status) Update(ingresses controller.IngressEntries) error {
 	return k8s_status.Update(ingresses, s.loadBalancers, s.kubernetesClient)
 }
@@ -0,0 +1,126 @@
+// Package awscreds adds the web identity credentials of IAM roles for service accounts (IRSA) on EKS to AWS sessions,
+// which this version of the AWS SDK doesn't support itself.
+package awscreds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	log "github.com/sirupsen/logrus"
+)
+
+// The environment variables EKS sets for pods whose service account has an IAM role.
+const (
+	WebIdentityTokenFileEnvVar = "AWS_WEB_IDENTITY_TOKEN_FILE"
+	RoleARNEnvVar              = "AWS_ROLE_ARN"
+	RoleSessionNameEnvVar      = "AWS_ROLE_SESSION_NAME"
+)
+
+const (
+	// WebIdentityProviderName is the ProviderName of web identity credentials.
+	WebIdentityProviderName = "WebIdentityProvider"
+	defaultRoleSessionName  = "feed"
+	// STS is global, so it's used through us-east-1 if the session has no region.
+	defaultSTSRegion = "us-east-1"
+	expiryWindow     = time.Minute
+)
+
+// STS represents the subset of STS operations needed for web identity credentials.
+type STS interface {
+	AssumeRoleWithWebIdentity(input *sts.AssumeRoleWithWebIdentityInput) (*sts.AssumeRoleWithWebIdentityOutput, error)
+}
+
+// WebIdentityProvider retrieves credentials by assuming a role with the web identity token in a file. The file is
+// read each time the credentials are retrieved, as the token is rotated by Kubernetes. Credentials are refreshed
+// shortly before they expire.
+type WebIdentityProvider struct {
+	credentials.Expiry
+	client          STS
+	roleARN         string
+	roleSessionName string
+	tokenFile       string
+}
+
+// NewWebIdentityProvider creates a WebIdentityProvider which assumes the role with the token in the token file.
+func NewWebIdentityProvider(client STS, roleARN, roleSessionName, tokenFile string) *WebIdentityProvider {
+	return &WebIdentityProvider{
+		client:          client,
+		roleARN:         roleARN,
+		roleSessionName: roleSessionName,
+		tokenFile:       tokenFile,
+	}
+}
+
+// Retrieve assumes the role, with the current token.
+func (p *WebIdentityProvider) Retrieve() (credentials.Value, error) {
+	token, err := ioutil.ReadFile(p.tokenFile)
+	if err != nil {
+		return credentials.Value{ProviderName: WebIdentityProviderName},
+			fmt.Errorf("unable to read web identity token file: %v", err)
+	}
+
+	out, err := p.client.AssumeRoleWithWebIdentity(&sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(p.roleARN),
+		RoleSessionName:  aws.String(p.roleSessionName),
+		WebIdentityToken: aws.String(strings.TrimSpace(string(token))),
+	})
+	if err != nil {
+		return credentials.Value{ProviderName: WebIdentityProviderName},
+			fmt.Errorf("unable to assume role %s with web identity: %v", p.roleARN, err)
+	}
+
+	p.SetExpiration(aws.TimeValue(out.Credentials.Expiration), expiryWindow)
+	return credentials.Value{
+		AccessKeyID:     aws.StringValue(out.Credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(out.Credentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(out.Credentials.SessionToken),
+		ProviderName:    WebIdentityProviderName,
+	}, nil
+}
+
+// Providers returns the credential providers of a session, in the order they're tried: static credentials in the
+// environment, web identity credentials if AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN are set, the shared
+// credentials file, then the ECS or EC2 role.
+func Providers(sess *session.Session) []credentials.Provider {
+	providers := []credentials.Provider{&credentials.EnvProvider{}}
+
+	tokenFile, roleARN := os.Getenv(WebIdentityTokenFileEnvVar), os.Getenv(RoleARNEnvVar)
+	if tokenFile != "" && roleARN != "" {
+		roleSessionName := os.Getenv(RoleSessionNameEnvVar)
+		if roleSessionName == "" {
+			roleSessionName = defaultRoleSessionName
+		}
+		stsConfig := aws.NewConfig()
+		if aws.StringValue(sess.Config.Region) == "" {
+			stsConfig.Region = aws.String(defaultSTSRegion)
+		}
+		providers = append(providers,
+			NewWebIdentityProvider(sts.New(sess, stsConfig), roleARN, roleSessionName, tokenFile))
+	}
+
+	return append(providers,
+		&credentials.SharedCredentialsProvider{},
+		defaults.RemoteCredProvider(*sess.Config, sess.Handlers))
+}
+
+// UseWebIdentity makes the session use web identity credentials if AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN
+// are set, unless there are static credentials in the environment. Otherwise the session is left alone.
+func UseWebIdentity(sess *session.Session) {
+	if os.Getenv(WebIdentityTokenFileEnvVar) == "" || os.Getenv(RoleARNEnvVar) == "" {
+		return
+	}
+
+	log.Debugf("Using web identity credentials for role %s", os.Getenv(RoleARNEnvVar))
+	sess.Config.Credentials = credentials.NewCredentials(&credentials.ChainProvider{
+		VerboseErrors: true,
+		Providers:     Providers(sess),
+	})
+}
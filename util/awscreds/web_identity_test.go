@@ -0,0 +1,107 @@
+package awscreds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSTS struct {
+	tokens []string
+}
+
+func (f *fakeSTS) AssumeRoleWithWebIdentity(input *sts.AssumeRoleWithWebIdentityInput) (
+	*sts.AssumeRoleWithWebIdentityOutput, error) {
+	f.tokens = append(f.tokens, aws.StringValue(input.WebIdentityToken))
+	return &sts.AssumeRoleWithWebIdentityOutput{Credentials: &sts.Credentials{
+		AccessKeyId:     aws.String("access-key"),
+		SecretAccessKey: aws.String("secret-key"),
+		SessionToken:    aws.String("session-" + aws.StringValue(input.WebIdentityToken)),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	}}, nil
+}
+
+func setWebIdentityEnv(t *testing.T, tokenFile, roleARN string) {
+	for name, value := range map[string]string{WebIdentityTokenFileEnvVar: tokenFile, RoleARNEnvVar: roleARN} {
+		previous, set := os.LookupEnv(name)
+		os.Setenv(name, value)
+		name := name
+		t.Cleanup(func() {
+			if set {
+				os.Setenv(name, previous)
+			} else {
+				os.Unsetenv(name)
+			}
+		})
+	}
+}
+
+func TestProvidersIncludeWebIdentityWhenConfigured(t *testing.T) {
+	setWebIdentityEnv(t, "/var/run/secrets/token", "arn:aws:iam::123456789012:role/feed")
+	sess := session.New(&aws.Config{Region: aws.String("eu-west-1")})
+
+	var webIdentity []*WebIdentityProvider
+	for _, provider := range Providers(sess) {
+		if p, ok := provider.(*WebIdentityProvider); ok {
+			webIdentity = append(webIdentity, p)
+		}
+	}
+
+	assert.Len(t, webIdentity, 1)
+	assert.Equal(t, "arn:aws:iam::123456789012:role/feed", webIdentity[0].roleARN)
+	assert.Equal(t, "/var/run/secrets/token", webIdentity[0].tokenFile)
+	assert.Equal(t, defaultRoleSessionName, webIdentity[0].roleSessionName)
+}
+
+func TestProvidersDoNotIncludeWebIdentityWithoutTheEnvironment(t *testing.T) {
+	setWebIdentityEnv(t, "", "")
+	sess := session.New(&aws.Config{Region: aws.String("eu-west-1")})
+	credentials := sess.Config.Credentials
+
+	UseWebIdentity(sess)
+
+	for _, provider := range Providers(sess) {
+		assert.NotEqual(t, "*awscreds.WebIdentityProvider", fmt.Sprintf("%T", provider))
+	}
+	assert.Equal(t, credentials, sess.Config.Credentials)
+}
+
+func TestTokenFileIsReadEachTimeCredentialsAreRetrieved(t *testing.T) {
+	// given
+	tokenFile, err := ioutil.TempFile("", "token")
+	assert.NoError(t, err)
+	defer os.Remove(tokenFile.Name())
+	client := &fakeSTS{}
+	provider := NewWebIdentityProvider(client, "arn:aws:iam::123456789012:role/feed", "feed", tokenFile.Name())
+
+	// when
+	assert.NoError(t, ioutil.WriteFile(tokenFile.Name(), []byte("first\n"), 0600))
+	first, err := provider.Retrieve()
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(tokenFile.Name(), []byte("rotated\n"), 0600))
+	second, err := provider.Retrieve()
+	assert.NoError(t, err)
+
+	// then
+	assert.Equal(t, []string{"first", "rotated"}, client.tokens)
+	assert.Equal(t, "session-first", first.SessionToken)
+	assert.Equal(t, "session-rotated", second.SessionToken)
+	assert.Equal(t, WebIdentityProviderName, second.ProviderName)
+	assert.False(t, provider.IsExpired())
+}
+
+func TestRetrieveFailsWithoutTheTokenFile(t *testing.T) {
+	provider := NewWebIdentityProvider(&fakeSTS{}, "arn:aws:iam::123456789012:role/feed", "feed", "/does/not/exist")
+
+	_, err := provider.Retrieve()
+
+	assert.Error(t, err)
+	assert.True(t, provider.IsExpired())
+}
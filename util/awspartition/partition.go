@@ -0,0 +1,105 @@
+// Package awspartition resolves the endpoints of AWS services within a partition, such as GovCloud or China, whose
+// regions, endpoints and ARNs are separate from the standard partition.
+package awspartition
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// The partitions feed can run in.
+const (
+	Standard = endpoints.AwsPartitionID
+	GovCloud = endpoints.AwsUsGovPartitionID
+	China    = endpoints.AwsCnPartitionID
+)
+
+// Partition describes an AWS partition.
+// Route53Region is the region of the partition's global Route53 endpoint, which requests to it are signed for.
+// CloudFrontHostedZoneID is the hosted zone of CloudFront distributions in the partition, used for ALIAS records to
+// them. It's empty if the partition has no CloudFront.
+type Partition struct {
+	ID                     string
+	Route53Region          string
+	CloudFrontHostedZoneID string
+	regions                *regexp.Regexp
+	endpoints              endpoints.Partition
+	// route53Endpoint is the Route53 endpoint of partitions the SDK doesn't know it for.
+	route53Endpoint string
+}
+
+// The region patterns are those of the SDK, which doesn't expose them.
+var partitions = map[string]Partition{
+	Standard: {
+		ID:                     Standard,
+		Route53Region:          "us-east-1",
+		CloudFrontHostedZoneID: "Z2FDTNDATAQYW2",
+		regions:                regexp.MustCompile(`^(us|eu|ap|sa|ca)\-\w+\-\d+$`),
+		endpoints:              endpoints.AwsPartition(),
+	},
+	GovCloud: {
+		ID:              GovCloud,
+		Route53Region:   "us-gov-west-1",
+		regions:         regexp.MustCompile(`^us\-gov\-\w+\-\d+$`),
+		endpoints:       endpoints.AwsUsGovPartition(),
+		route53Endpoint: "https://route53.us-gov.amazonaws.com",
+	},
+	China: {
+		ID:                     China,
+		Route53Region:          "cn-northwest-1",
+		CloudFrontHostedZoneID: "Z3RFFRIM2A3IF5",
+		regions:                regexp.MustCompile(`^cn\-\w+\-\d+$`),
+		endpoints:              endpoints.AwsCnPartition(),
+		route53Endpoint:        "https://route53.amazonaws.com.cn",
+	},
+}
+
+// IDs are the ids of the supported partitions.
+var IDs = []string{Standard, GovCloud, China}
+
+// Lookup returns the partition with the id, where empty is the standard partition. It fails for unknown partitions,
+// returning the standard partition with the error.
+func Lookup(id string) (Partition, error) {
+	if id == "" {
+		id = Standard
+	}
+	partition, ok := partitions[id]
+	if !ok {
+		return partitions[Standard], fmt.Errorf("unknown AWS partition %q, must be one of %s", id,
+			strings.Join(IDs, ", "))
+	}
+	return partition, nil
+}
+
+// ValidateRegion checks the region is in the partition, so requests aren't sent to another partition's endpoints.
+func (p Partition) ValidateRegion(region string) error {
+	if !p.regions.MatchString(region) {
+		return fmt.Errorf("region %q isn't in the %s partition", region, p.ID)
+	}
+	return nil
+}
+
+// ValidateARN checks the ARN is in the partition, e.g. arn:aws-us-gov:iam::123456789012:role/feed for GovCloud.
+func (p Partition) ValidateARN(arn string) error {
+	parts := strings.SplitN(arn, ":", 3)
+	if len(parts) < 3 || parts[0] != "arn" {
+		return fmt.Errorf("%q isn't an ARN", arn)
+	}
+	if parts[1] != p.ID {
+		return fmt.Errorf("ARN %q isn't in the %s partition", arn, p.ID)
+	}
+	return nil
+}
+
+// EndpointFor resolves the endpoints of services within the partition, so it can be the EndpointResolver of an AWS
+// session.
+func (p Partition) EndpointFor(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint,
+	error) {
+	if service == endpoints.Route53ServiceID && p.route53Endpoint != "" {
+		return endpoints.ResolvedEndpoint{URL: p.route53Endpoint, SigningRegion: p.Route53Region}, nil
+	}
+	return p.endpoints.EndpointFor(service, region, opts...)
+}
@@ -0,0 +1,86 @@
+package awspartition
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupFailsForUnknownPartitions(t *testing.T) {
+	standard, err := Lookup("")
+	assert.NoError(t, err)
+	assert.Equal(t, Standard, standard.ID)
+
+	partition, err := Lookup("aws-iso")
+	assert.EqualError(t, err, `unknown AWS partition "aws-iso", must be one of aws, aws-us-gov, aws-cn`)
+	assert.Equal(t, Standard, partition.ID)
+}
+
+func TestRegionsMustBeInThePartition(t *testing.T) {
+	var tests = []struct {
+		partition string
+		region    string
+		valid     bool
+	}{
+		{Standard, "eu-west-1", true},
+		{Standard, "us-gov-west-1", false},
+		{Standard, "cn-north-1", false},
+		{GovCloud, "us-gov-west-1", true},
+		{GovCloud, "us-east-1", false},
+		{China, "cn-northwest-1", true},
+		{China, "eu-west-1", false},
+	}
+
+	for _, test := range tests {
+		name := fmt.Sprintf("%s in %s", test.region, test.partition)
+		fmt.Printf("=== test: %s\n", name)
+		partition, _ := Lookup(test.partition)
+		err := partition.ValidateRegion(test.region)
+		if test.valid {
+			assert.NoError(t, err, name)
+		} else {
+			assert.EqualError(t, err, fmt.Sprintf("region %q isn't in the %s partition", test.region, test.partition),
+				name)
+		}
+	}
+}
+
+func TestARNsMustBeInThePartition(t *testing.T) {
+	govCloud, _ := Lookup(GovCloud)
+
+	assert.NoError(t, govCloud.ValidateARN("arn:aws-us-gov:iam::123456789012:role/feed"))
+	assert.EqualError(t, govCloud.ValidateARN("arn:aws:iam::123456789012:role/feed"),
+		`ARN "arn:aws:iam::123456789012:role/feed" isn't in the aws-us-gov partition`)
+	assert.EqualError(t, govCloud.ValidateARN("role/feed"), `"role/feed" isn't an ARN`)
+}
+
+func TestEndpointsAreResolvedWithinThePartition(t *testing.T) {
+	var tests = []struct {
+		partition      string
+		service        string
+		region         string
+		expectedURL    string
+		expectedRegion string
+	}{
+		{Standard, endpoints.Route53ServiceID, "us-east-1", "https://route53.amazonaws.com", "us-east-1"},
+		{GovCloud, endpoints.Route53ServiceID, "us-gov-west-1", "https://route53.us-gov.amazonaws.com",
+			"us-gov-west-1"},
+		{China, endpoints.Route53ServiceID, "cn-northwest-1", "https://route53.amazonaws.com.cn", "cn-northwest-1"},
+		{GovCloud, endpoints.ElasticloadbalancingServiceID, "us-gov-west-1",
+			"https://elasticloadbalancing.us-gov-west-1.amazonaws.com", "us-gov-west-1"},
+		{China, endpoints.ElasticloadbalancingServiceID, "cn-north-1",
+			"https://elasticloadbalancing.cn-north-1.amazonaws.com.cn", "cn-north-1"},
+	}
+
+	for _, test := range tests {
+		name := test.service + " in " + test.partition
+		fmt.Printf("=== test: %s\n", name)
+		partition, _ := Lookup(test.partition)
+		resolved, err := partition.EndpointFor(test.service, test.region)
+		assert.NoError(t, err, name)
+		assert.Equal(t, test.expectedURL, resolved.URL, name)
+		assert.Equal(t, test.expectedRegion, resolved.SigningRegion, name)
+	}
+}
@@ -0,0 +1,60 @@
+// Package awsretry retries AWS requests with capped exponential backoff.
+package awsretry
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Default delays between retries.
+const (
+	DefaultBaseDelay = 100 * time.Millisecond
+	DefaultMaxDelay  = 20 * time.Second
+)
+
+type retryer struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+// New creates a retryer which retries throttled, timed out and 5xx requests up to maxRetries times. The delay
+// before each retry doubles from baseDelay up to maxDelay, and is jittered so concurrent requests don't retry in
+// lockstep. Other errors, such as validation errors, aren't retried. Non-positive delays use the defaults.
+func New(maxRetries int, baseDelay, maxDelay time.Duration) request.Retryer {
+	if baseDelay <= 0 {
+		baseDelay = DefaultBaseDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxDelay
+	}
+	if maxDelay < baseDelay {
+		maxDelay = baseDelay
+	}
+	return &retryer{maxRetries: maxRetries, baseDelay: baseDelay, maxDelay: maxDelay}
+}
+
+func (r *retryer) MaxRetries() int {
+	return r.maxRetries
+}
+
+func (r *retryer) ShouldRetry(req *request.Request) bool {
+	if req.HTTPResponse != nil && req.HTTPResponse.StatusCode >= 500 {
+		return true
+	}
+	return req.IsErrorRetryable() || req.IsErrorThrottle()
+}
+
+func (r *retryer) RetryRules(req *request.Request) time.Duration {
+	ceiling := r.baseDelay
+	for i := 0; i < req.RetryCount && ceiling < r.maxDelay; i++ {
+		ceiling *= 2
+	}
+	if ceiling > r.maxDelay {
+		ceiling = r.maxDelay
+	}
+	// Use a random delay between half and all of the ceiling.
+	return ceiling/2 + time.Duration(rand.Int63n(int64(ceiling/2)+1))
+}
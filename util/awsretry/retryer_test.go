@@ -0,0 +1,50 @@
+package awsretry
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func requestWith(status int, err error) *request.Request {
+	return &request.Request{HTTPResponse: &http.Response{StatusCode: status}, Error: err}
+}
+
+func TestOnlyRetryableErrorsAreRetried(t *testing.T) {
+	var tests = []struct {
+		description string
+		req         *request.Request
+		retry       bool
+	}{
+		{"throttled", requestWith(400, awserr.New("Throttling", "Rate exceeded", nil)), true},
+		{"prior request not complete", requestWith(400, awserr.New("PriorRequestNotComplete", "", nil)), true},
+		{"server error", requestWith(503, awserr.New("ServiceUnavailable", "", nil)), true},
+		{"connection error", requestWith(0, awserr.New("RequestError", "", errors.New("refused"))), true},
+		{"validation error", requestWith(400, awserr.New("InvalidChangeBatch", "", nil)), false},
+		{"access denied", requestWith(403, awserr.New("AccessDenied", "", nil)), false},
+	}
+
+	r := New(3, time.Millisecond, time.Second)
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			assert.Equal(t, test.retry, r.ShouldRetry(test.req))
+		})
+	}
+}
+
+func TestRetryDelayDoublesUpToTheMaximum(t *testing.T) {
+	assert := assert.New(t)
+	r := New(10, 100*time.Millisecond, time.Second)
+
+	for retry, ceiling := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		ceiling *= time.Millisecond
+		delay := r.RetryRules(&request.Request{RetryCount: retry})
+		assert.True(delay >= ceiling/2 && delay <= ceiling, "retry %d: %v not within %v", retry, delay, ceiling)
+	}
+	assert.Equal(10, r.MaxRetries())
+}
@@ -1,12 +1,17 @@
 package cmd
 
 import (
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -24,21 +29,172 @@ type Pulse interface {
 	Stop() error
 }
 
-// AddHealthPort is used to expose the health over http.
-func AddHealthPort(pulse Pulse, healthPort int) {
+// Readiness is implemented by a Pulse which isn't ready to serve straight away, e.g. until its first sync.
+type Readiness interface {
+	// Ready returns nil once ready. Unlike Health, this is not expected to change back once ready.
+	Ready() error
+}
+
+// UpdaterHealthReporter is implemented by a Pulse which delegates to updaters, such as a controller.
+type UpdaterHealthReporter interface {
+	// UpdaterHealth returns the current health of each updater by name, nil if healthy.
+	UpdaterHealth() map[string]error
+}
+
+// SyncStatusReporter is implemented by a Pulse which syncs with the apiserver and applies updates, such as a
+// controller.
+type SyncStatusReporter interface {
+	// SyncStatus returns whether the initial sync with the apiserver has completed, when an update last succeeded,
+	// zero if none have, and the error of the last failed update, nil if none have failed.
+	SyncStatus() (synced bool, lastSuccess time.Time, lastErr error)
+}
+
+// Reconciler is something which can be asked to reconcile straight away, instead of waiting for the next update.
+type Reconciler interface {
+	// Reconcile blocks until the reconcile completes, returning nil if it succeeded.
+	Reconcile() error
+}
+
+// AddReconcileEndpoint serves POST /reconcile on the health port, which reconciles and returns the outcome as JSON.
+// Requests must have an "Authorization: Bearer <token>" header, with the token read from tokenFile, e.g. a mounted
+// secret. Does nothing if tokenFile is empty.
+func AddReconcileEndpoint(reconciler Reconciler, tokenFile string) error {
+	if tokenFile == "" {
+		return nil
+	}
+
+	contents, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return fmt.Errorf("unable to read reconcile token: %v", err)
+	}
+	token := strings.TrimSpace(string(contents))
+	if token == "" {
+		return fmt.Errorf("reconcile token file %s is empty", tokenFile)
+	}
+
+	http.HandleFunc("/reconcile", reconcileHandler(reconciler, token))
+	return nil
+}
+
+type reconcileResult struct {
+	Reconciled bool   `json:"reconciled"`
+	Error      string `json:"error,omitempty"`
+}
+
+func reconcileHandler(reconciler Reconciler, token string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		authorization := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(authorization, []byte("Bearer "+token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		log.Info("Reconcile requested over http")
+		result := reconcileResult{Reconciled: true}
+		status := http.StatusOK
+		if err := reconciler.Reconcile(); err != nil {
+			result = reconcileResult{Error: err.Error()}
+			status = http.StatusInternalServerError
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// AddRecordsEndpoint serves GET /records on the health port, which returns what records returns as JSON, e.g. the
+// records feed-dns manages.
+func AddRecordsEndpoint(records func() interface{}) {
+	http.HandleFunc("/records", jsonHandler(records))
+}
+
+// AddCapabilitiesEndpoint serves GET /capabilities on the health port, which returns what capabilities returns as
+// JSON, e.g. the capabilities of the DNS provider feed-dns manages records with.
+func AddCapabilitiesEndpoint(capabilities func() interface{}) {
+	http.HandleFunc("/capabilities", jsonHandler(capabilities))
+}
+
+// jsonHandler serves GET requests with what value returns as JSON.
+func jsonHandler(value func() interface{}) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(value())
+	}
+}
+
+// AddHealthPort is used to expose the health over http, on the health port of the bind address. An empty bind address
+// listens on all interfaces. If the pulse implements Readiness, its readiness is exposed on /ready. If it implements
+// UpdaterHealthReporter or SyncStatusReporter, /health returns the health of each updater and the sync status as
+// JSON. /health has a 500 status whenever the pulse is unhealthy. Returns an error if the address can't be bound.
+func AddHealthPort(pulse Pulse, bindAddress string, healthPort int) error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(bindAddress, strconv.Itoa(healthPort)))
+	if err != nil {
+		return fmt.Errorf("unable to listen on the health port: %v", err)
+	}
+
 	http.HandleFunc("/health", healthHandler(pulse))
+	if readiness, ok := pulse.(Readiness); ok {
+		http.HandleFunc("/ready", readyHandler(readiness))
+	}
 	http.Handle("/metrics", prometheus.Handler())
 	http.HandleFunc("/alive", okHandler)
 
 	go func() {
-		log.Error(http.ListenAndServe(":"+strconv.Itoa(healthPort), nil))
+		log.Error(http.Serve(listener, nil))
 		log.Info(pulse.Stop())
 		os.Exit(-1)
 	}()
+	return nil
+}
+
+type healthResponse struct {
+	Healthy  bool                     `json:"healthy"`
+	Error    string                   `json:"error,omitempty"`
+	Updaters map[string]updaterHealth `json:"updaters,omitempty"`
+	Sync     *syncStatus              `json:"sync,omitempty"`
+}
+
+type updaterHealth struct {
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+type syncStatus struct {
+	Synced      bool       `json:"synced"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
 }
 
 func healthHandler(pulse Pulse) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		updaterReporter, reportsUpdaters := pulse.(UpdaterHealthReporter)
+		syncReporter, reportsSync := pulse.(SyncStatusReporter)
+		if reportsUpdaters || reportsSync {
+			resp := newHealthResponse(pulse.Health())
+			if reportsUpdaters {
+				resp.addUpdaters(updaterReporter.UpdaterHealth())
+			}
+			if reportsSync {
+				resp.addSyncStatus(syncReporter.SyncStatus())
+			}
+			writeHealth(w, resp)
+			return
+		}
+
 		if err := pulse.Health(); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			io.WriteString(w, fmt.Sprintf("%v\n", err))
@@ -50,6 +206,59 @@ func healthHandler(pulse Pulse) func(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func newHealthResponse(err error) *healthResponse {
+	resp := &healthResponse{Healthy: err == nil}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
+
+func (resp *healthResponse) addUpdaters(updaters map[string]error) {
+	resp.Updaters = make(map[string]updaterHealth)
+	for name, updaterErr := range updaters {
+		health := updaterHealth{Healthy: updaterErr == nil}
+		if updaterErr != nil {
+			health.Error = updaterErr.Error()
+		}
+		resp.Updaters[name] = health
+	}
+}
+
+func (resp *healthResponse) addSyncStatus(synced bool, lastSuccess time.Time, lastErr error) {
+	resp.Sync = &syncStatus{Synced: synced}
+	if !lastSuccess.IsZero() {
+		resp.Sync.LastSuccess = &lastSuccess
+	}
+	if lastErr != nil {
+		resp.Sync.LastError = lastErr.Error()
+	}
+}
+
+func writeHealth(w http.ResponseWriter, resp *healthResponse) {
+	status := http.StatusOK
+	if !resp.Healthy {
+		status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func readyHandler(readiness Readiness) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := readiness.Ready(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, fmt.Sprintf("%v\n", err))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "ready\n")
+	}
+}
+
 func okHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	io.WriteString(w, "ok\n")
@@ -97,8 +306,24 @@ func AddSignalHandler(pulse Pulse) {
 	}()
 }
 
-// ConfigureLogging sets logging to Stdout and manages setting debug level
-func ConfigureLogging(debug bool) {
+// Log formats supported by ConfigureLogging.
+const (
+	TextLogFormat = "text"
+	JSONLogFormat = "json"
+)
+
+// ConfigureLogging sets logging to Stdout and manages setting debug level and the log format, either
+// TextLogFormat or JSONLogFormat.
+func ConfigureLogging(debug bool, format string) error {
+	switch format {
+	case TextLogFormat:
+		log.SetFormatter(&log.TextFormatter{})
+	case JSONLogFormat:
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format %q, must be %s or %s", format, TextLogFormat, JSONLogFormat)
+	}
+
 	// logging is the main output, so write it all to stdout
 	log.SetOutput(os.Stdout)
 	if debug {
@@ -107,6 +332,7 @@ func ConfigureLogging(debug bool) {
 	filenameHook := filename.NewHook()
 	filenameHook.Field = "source"
 	log.AddHook(filenameHook)
+	return nil
 }
 
 // ConfigureMetrics sets up metrics pushing and default labels. This must be called before any metrics
@@ -140,6 +366,21 @@ func createUnhealthyCounter(subsystem string) prometheus.Counter {
 	return unhealthyCounter
 }
 
+// AddMetricsListener serves metrics on /metrics at the listen address, e.g. ":9090", for Prometheus to scrape.
+// The metrics are the same as those pushed to the pushgateway, so both can be used while migrating.
+// Does nothing if the listen address is empty.
+func AddMetricsListener(listenAddress string) {
+	if listenAddress == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", prometheus.Handler())
+	go func() {
+		log.Errorf("Metrics listener on %s stopped: %v", listenAddress, http.ListenAndServe(listenAddress, mux))
+	}()
+}
+
 // AddMetricsPusher starts a periodic push of metrics to a prometheus pushgateway.
 func addMetricsPusher(job, pushgatewayURL string, interval time.Duration) {
 	if pushgatewayURL == "" {
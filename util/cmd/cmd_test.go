@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLogFormatIncludesFields(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	assert.NoError(ConfigureLogging(false, JSONLogFormat))
+	defer ConfigureLogging(false, TextLogFormat)
+	var out bytes.Buffer
+	log.SetOutput(&out)
+
+	// when
+	log.WithField("ingress", "happysky/foo").Info("Updated")
+
+	// then
+	var logged map[string]interface{}
+	assert.NoError(json.Unmarshal(out.Bytes(), &logged))
+	assert.Equal("info", logged["level"])
+	assert.Equal("Updated", logged["msg"])
+	assert.Equal("happysky/foo", logged["ingress"])
+	assert.NotEmpty(logged["time"])
+}
+
+func TestUnknownLogFormatIsAnError(t *testing.T) {
+	assert.Error(t, ConfigureLogging(false, "xml"))
+}
+
+func TestMetricsListenerServesMetrics(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	// when
+	AddMetricsListener(address)
+
+	// then
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = http.Get("http://" + address + "/metrics"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if assert.NoError(err) {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal(http.StatusOK, resp.StatusCode)
+		assert.Contains(string(body), "go_goroutines")
+	}
+}
+
+func TestHealthPortFailsIfTheAddressCantBeBound(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	healthPort, _ := strconv.Atoi(port)
+
+	// when
+	inUseErr := AddHealthPort(&fakePulse{}, "127.0.0.1", healthPort)
+	invalidErr := AddHealthPort(&fakePulse{}, "not an address", healthPort)
+
+	// then
+	assert.Error(inUseErr, "port in use")
+	assert.Error(invalidErr, "invalid address")
+}
+
+type fakeReconciler struct {
+	err   error
+	calls int
+}
+
+func (r *fakeReconciler) Reconcile() error {
+	r.calls++
+	return r.err
+}
+
+func TestReconcileEndpoint(t *testing.T) {
+	var tests = []struct {
+		description   string
+		method        string
+		authorization string
+		err           error
+		status        int
+		body          string
+		calls         int
+	}{
+		{"successful reconcile", "POST", "Bearer secret", nil, http.StatusOK, `{"reconciled":true}` + "\n", 1},
+		{"failed reconcile", "POST", "Bearer secret", errors.New("kaboom"), http.StatusInternalServerError,
+			`{"reconciled":false,"error":"kaboom"}` + "\n", 1},
+		{"wrong token", "POST", "Bearer guess", nil, http.StatusUnauthorized, "", 0},
+		{"missing token", "POST", "", nil, http.StatusUnauthorized, "", 0},
+		{"not a post", "GET", "Bearer secret", nil, http.StatusMethodNotAllowed, "", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			// given
+			reconciler := &fakeReconciler{err: test.err}
+			req := httptest.NewRequest(test.method, "/reconcile", nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			// when
+			reconcileHandler(reconciler, "secret")(w, req)
+
+			// then
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, test.body, w.Body.String())
+			assert.Equal(t, test.calls, reconciler.calls)
+		})
+	}
+}
+
+type fakePulse struct {
+	health        error
+	updaterHealth map[string]error
+}
+
+func (p *fakePulse) Health() error {
+	return p.health
+}
+
+func (p *fakePulse) Stop() error {
+	return nil
+}
+
+func (p *fakePulse) UpdaterHealth() map[string]error {
+	return p.updaterHealth
+}
+
+func TestHealthEndpointReportsEachUpdater(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	pulse := &fakePulse{
+		health: errors.New("internal updater: kaboom"),
+		updaterHealth: map[string]error{
+			"internal updater": errors.New("kaboom"),
+			"external updater": nil,
+		},
+	}
+	w := httptest.NewRecorder()
+
+	// when
+	healthHandler(pulse)(w, httptest.NewRequest("GET", "/health", nil))
+
+	// then
+	assert.Equal(http.StatusInternalServerError, w.Code)
+	assert.Equal("application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(`{
+		"healthy": false,
+		"error": "internal updater: kaboom",
+		"updaters": {
+			"external updater": {"healthy": true},
+			"internal updater": {"healthy": false, "error": "kaboom"}
+		}
+	}`, w.Body.String())
+}
+
+type fakeSyncingPulse struct {
+	fakePulse
+	synced      bool
+	lastSuccess time.Time
+	lastErr     error
+}
+
+func (p *fakeSyncingPulse) SyncStatus() (bool, time.Time, error) {
+	return p.synced, p.lastSuccess, p.lastErr
+}
+
+func TestHealthEndpointReportsSyncStatus(t *testing.T) {
+	var tests = []struct {
+		name   string
+		pulse  *fakeSyncingPulse
+		status int
+		body   string
+	}{
+		{
+			"before the initial sync",
+			&fakeSyncingPulse{fakePulse: fakePulse{health: errors.New("controller has not started")}},
+			http.StatusInternalServerError,
+			`{"healthy": false, "error": "controller has not started", "sync": {"synced": false}}`,
+		},
+		{
+			"healthy after an earlier failure",
+			&fakeSyncingPulse{
+				synced:      true,
+				lastSuccess: time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC),
+				lastErr:     errors.New("kaboom"),
+			},
+			http.StatusOK,
+			`{"healthy": true, "sync": {"synced": true, "lastSuccess": "2017-03-01T12:00:00Z", "lastError": "kaboom"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// given
+			w := httptest.NewRecorder()
+
+			// when
+			healthHandler(test.pulse)(w, httptest.NewRequest("GET", "/health", nil))
+
+			// then
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.JSONEq(t, test.body, w.Body.String())
+		})
+	}
+}
+
+func TestRecordsEndpoint(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	records := func() interface{} {
+		return []map[string]string{{"host": "foo.example.com.", "type": "CNAME"}}
+	}
+
+	// when
+	get := httptest.NewRecorder()
+	jsonHandler(records)(get, httptest.NewRequest("GET", "/records", nil))
+	post := httptest.NewRecorder()
+	jsonHandler(records)(post, httptest.NewRequest("POST", "/records", nil))
+
+	// then
+	assert.Equal(http.StatusOK, get.Code)
+	assert.Equal("application/json", get.Header().Get("Content-Type"))
+	assert.JSONEq(`[{"host": "foo.example.com.", "type": "CNAME"}]`, get.Body.String())
+	assert.Equal(http.StatusMethodNotAllowed, post.Code)
+}
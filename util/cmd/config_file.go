@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/pkg/util/yaml"
+)
+
+// LoadConfigFile sets flags from a YAML or JSON file of flag names to values, e.g. "r53-hosted-zone: Z1234". Flags
+// set on the command line take precedence over the file, so it must be loaded after the flags are parsed. Lists are
+// joined with commas for CommaSeparatedValues, and set one item at a time for other flags, such as KeyValues.
+// Mappings are set as key=value pairs. Keys which aren't flags are an error, rather than ignored.
+func LoadConfigFile(flags *flag.FlagSet, path string) error {
+	config, err := readConfigFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %v", path, err)
+	}
+
+	setOnCommandLine := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+
+	var unknown []string
+	for name := range config {
+		if flags.Lookup(name) == nil {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown keys in %s: %s", path, strings.Join(unknown, ", "))
+	}
+
+	var names []string
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if setOnCommandLine[name] {
+			continue
+		}
+		values, err := flagValues(flags.Lookup(name), config[name])
+		if err != nil {
+			return fmt.Errorf("invalid %s in %s: %v", name, path, err)
+		}
+		for _, value := range values {
+			if err := flags.Set(name, value); err != nil {
+				return fmt.Errorf("invalid %s in %s: %v", name, path, err)
+			}
+		}
+	}
+	return nil
+}
+
+func readConfigFile(path string) (map[string]interface{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config := make(map[string]interface{})
+	if err := yaml.NewYAMLOrJSONDecoder(file, 4096).Decode(&config); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return config, nil
+}
+
+// flagValues converts a value of the config file to the values to set the flag to.
+func flagValues(f *flag.Flag, value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			s, err := scalarValue(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, s)
+		}
+		if _, ok := f.Value.(*CommaSeparatedValues); ok {
+			return []string{strings.Join(values, ",")}, nil
+		}
+		return values, nil
+	case map[string]interface{}:
+		var keys []string
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var values []string
+		for _, key := range keys {
+			s, err := scalarValue(v[key])
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, key+"="+s)
+		}
+		return values, nil
+	default:
+		s, err := scalarValue(value)
+		if err != nil {
+			return nil, err
+		}
+		return []string{s}, nil
+	}
+}
+
+func scalarValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testFlags struct {
+	flags    *flag.FlagSet
+	region   string
+	retries  int
+	debug    bool
+	ttl      time.Duration
+	zones    CommaSeparatedValues
+	labels   KeyValues
+	hostname string
+}
+
+func newTestFlags() *testFlags {
+	f := &testFlags{flags: flag.NewFlagSet("test", flag.ContinueOnError)}
+	f.flags.StringVar(&f.region, "elb-region", "eu-west-1", "")
+	f.flags.IntVar(&f.retries, "aws-api-retries", 5, "")
+	f.flags.BoolVar(&f.debug, "debug", false, "")
+	f.flags.DurationVar(&f.ttl, "cname-ttl", time.Minute, "")
+	f.flags.Var(&f.zones, "r53-hosted-zone", "")
+	f.flags.Var(&f.labels, "pushgateway-label", "")
+	f.flags.StringVar(&f.hostname, "internal-hostname", "", "")
+	return f
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "feed-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func TestLoadConfigFileSetsFlags(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	f := newTestFlags()
+	path := writeConfigFile(t, `
+elb-region: us-east-1
+aws-api-retries: 3
+debug: true
+cname-ttl: 30s
+r53-hosted-zone:
+  - Z1
+  - Z2
+pushgateway-label:
+  team: dns
+  env: prod
+`)
+	defer os.Remove(path)
+	f.flags.Parse(nil)
+
+	// when
+	err := LoadConfigFile(f.flags, path)
+
+	// then
+	assert.NoError(err)
+	assert.Equal("us-east-1", f.region)
+	assert.Equal(3, f.retries)
+	assert.True(f.debug)
+	assert.Equal(30*time.Second, f.ttl)
+	assert.Equal(CommaSeparatedValues{"Z1", "Z2"}, f.zones)
+	assert.Equal(map[string]string{"team": "dns", "env": "prod"}, f.labels.Map())
+}
+
+func TestFlagsOverrideTheConfigFile(t *testing.T) {
+	// given
+	assert := assert.New(t)
+	f := newTestFlags()
+	path := writeConfigFile(t, "elb-region: us-east-1\naws-api-retries: 3\n")
+	defer os.Remove(path)
+	f.flags.Parse([]string{"-elb-region=ap-southeast-2"})
+
+	// when
+	err := LoadConfigFile(f.flags, path)
+
+	// then
+	assert.NoError(err)
+	assert.Equal("ap-southeast-2", f.region)
+	assert.Equal(3, f.retries)
+}
+
+func TestLoadConfigFileRejectsUnknownKeys(t *testing.T) {
+	// given
+	f := newTestFlags()
+	path := writeConfigFile(t, "elb-region: us-east-1\nhosted-zone: Z1\nelb_label: foo\n")
+	defer os.Remove(path)
+	f.flags.Parse(nil)
+
+	// when
+	err := LoadConfigFile(f.flags, path)
+
+	// then
+	assert.EqualError(t, err, "unknown keys in "+path+": elb_label, hosted-zone")
+	assert.Equal(t, "eu-west-1", f.region, "should not set any flags")
+}
+
+func TestLoadConfigFileReportsInvalidValues(t *testing.T) {
+	// given
+	f := newTestFlags()
+	path := writeConfigFile(t, "aws-api-retries: lots\n")
+	defer os.Remove(path)
+	f.flags.Parse(nil)
+
+	// when
+	err := LoadConfigFile(f.flags, path)
+
+	// then
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid aws-api-retries in "+path)
+	}
+}
+
+func TestLoadConfigFileReadsJSON(t *testing.T) {
+	// given
+	f := newTestFlags()
+	path := writeConfigFile(t, `{"internal-hostname": "internal.james.com", "r53-hosted-zone": ["Z1"]}`)
+	defer os.Remove(path)
+	f.flags.Parse(nil)
+
+	// when
+	err := LoadConfigFile(f.flags, path)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "internal.james.com", f.hostname)
+	assert.Equal(t, CommaSeparatedValues{"Z1"}, f.zones)
+}
+
+func TestLoadConfigFileFailsIfTheFileDoesntExist(t *testing.T) {
+	f := newTestFlags()
+
+	assert.Error(t, LoadConfigFile(f.flags, "/does/not/exist.yml"))
+}
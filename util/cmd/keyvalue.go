@@ -30,3 +30,12 @@ func (kv *KeyValues) Set(value string) error {
 
 	return nil
 }
+
+// Map returns the pairs as a map of key to value. Later pairs replace earlier pairs with the same key.
+func (kv *KeyValues) Map() map[string]string {
+	m := make(map[string]string)
+	for _, pair := range *kv {
+		m[pair.key] = pair.value
+	}
+	return m
+}
@@ -14,6 +14,8 @@ const (
 	PrometheusIngressSubsystem = "ingress"
 	// PrometheusDNSSubsystem is the metric subsystem for feed-dns.
 	PrometheusDNSSubsystem = "dns"
+	// PrometheusKubernetesSubsystem is the metric subsystem for the kubernetes client of feed binaries.
+	PrometheusKubernetesSubsystem = "k8s"
 )
 
 var labelsLock sync.Mutex
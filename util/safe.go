@@ -2,6 +2,7 @@ package util
 
 import (
 	"sync"
+	"time"
 )
 
 // SafeBool is a thread safe boolean
@@ -72,3 +73,23 @@ func (s *SafeInt) Set(val int) int {
 	s.val = val
 	return s.val
 }
+
+// SafeTime is a thread safe time
+type SafeTime struct {
+	val time.Time
+	sync.Mutex
+}
+
+// Get the value inside the SafeTime
+func (s *SafeTime) Get() time.Time {
+	s.Lock()
+	defer s.Unlock()
+	return s.val
+}
+
+// Set the value inside the SafeTime
+func (s *SafeTime) Set(newVal time.Time) {
+	s.Lock()
+	s.val = newVal
+	s.Unlock()
+}
@@ -42,6 +42,12 @@ func (c *FakeClient) UpdateIngressStatus(*v1beta1.Ingress) error {
 	return r.Error(0)
 }
 
+// HasSynced mocks out calls to HasSynced
+func (c *FakeClient) HasSynced() bool {
+	r := c.Called()
+	return r.Bool(0)
+}
+
 func (c *FakeClient) String() string {
 	return "FakeClient"
 }
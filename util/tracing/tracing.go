@@ -0,0 +1,321 @@
+// Package tracing records spans of controller updates and exports them to an OpenTelemetry collector, using OTLP over
+// HTTP with JSON encoding. A nil Tracer or Span does nothing, so tracing has no overhead when it's disabled.
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	tracesPath     = "/v1/traces"
+	scopeName      = "github.com/sky-uk/feed"
+	exportInterval = 5 * time.Second
+	exportTimeout  = 10 * time.Second
+	maxBatchSize   = 512
+	maxQueuedSpans = 4096
+
+	spanKindInternal = 1
+	statusCodeOK     = 1
+	statusCodeError  = 2
+)
+
+// Tracer exports ended spans to a collector in batches, in the background.
+type Tracer struct {
+	url     string
+	service string
+	client  *http.Client
+	spansCh chan *Span
+	stopCh  chan struct{}
+	stop    sync.Once
+	done    sync.WaitGroup
+}
+
+// New creates a Tracer which exports the spans of the service to the OTLP/HTTP endpoint of a collector, e.g.
+// http://otel-collector:4318. It returns nil if the endpoint is empty, which disables tracing.
+func New(endpoint, service string) *Tracer {
+	if endpoint == "" {
+		return nil
+	}
+
+	t := &Tracer{
+		url:     strings.TrimSuffix(endpoint, "/") + tracesPath,
+		service: service,
+		client:  &http.Client{Timeout: exportTimeout},
+		spansCh: make(chan *Span, maxQueuedSpans),
+		stopCh:  make(chan struct{}),
+	}
+	t.done.Add(1)
+	go t.export()
+	return t
+}
+
+// Start starts a span in a new trace.
+func (t *Tracer) Start(name string) *Span {
+	if t == nil {
+		return nil
+	}
+	return t.newSpan(name, randomID(16), "")
+}
+
+// Stop exports the spans which have ended, and stops exporting. Spans ending afterwards are dropped.
+func (t *Tracer) Stop() {
+	if t == nil {
+		return
+	}
+	t.stop.Do(func() { close(t.stopCh) })
+	t.done.Wait()
+}
+
+func (t *Tracer) newSpan(name, traceID, parentID string) *Span {
+	return &Span{
+		tracer:   t,
+		traceID:  traceID,
+		spanID:   randomID(8),
+		parentID: parentID,
+		name:     name,
+		start:    time.Now(),
+	}
+}
+
+func (t *Tracer) export() {
+	defer t.done.Done()
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case span := <-t.spansCh:
+			batch = append(batch, span)
+			if len(batch) >= maxBatchSize {
+				t.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			t.send(batch)
+			batch = nil
+		case <-t.stopCh:
+			for {
+				select {
+				case span := <-t.spansCh:
+					batch = append(batch, span)
+				default:
+					t.send(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *Tracer) send(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(t.request(batch))
+	if err != nil {
+		log.Warnf("Unable to encode %d spans: %v", len(batch), err)
+		return
+	}
+
+	resp, err := t.client.Post(t.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Warnf("Unable to export %d spans to %s: %v", len(batch), t.url, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Warnf("Unable to export %d spans to %s: %s", len(batch), t.url, resp.Status)
+	}
+}
+
+// Span is an operation in a trace. Its methods are safe to call on a nil Span, which does nothing.
+type Span struct {
+	sync.Mutex
+	tracer     *Tracer
+	traceID    string
+	spanID     string
+	parentID   string
+	name       string
+	start      time.Time
+	end        time.Time
+	attributes []attribute
+	err        error
+	ended      bool
+}
+
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+// Child starts a span within this span.
+func (s *Span) Child(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.newSpan(name, s.traceID, s.spanID)
+}
+
+// SetAttribute sets an attribute of the span. The value is a string, bool, int, int64 or float64.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.attributes = append(s.attributes, attribute{key, value})
+}
+
+// SetError marks the span as failed with the error, if it isn't nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.err = err
+}
+
+// End ends the span, so it's exported. Spans are dropped if too many are waiting to be exported.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	if s.ended {
+		s.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.Unlock()
+
+	select {
+	case s.tracer.spansCh <- s:
+	default:
+		log.Debugf("Dropping span %s, too many spans are waiting to be exported", s.name)
+	}
+}
+
+// The OTLP/HTTP JSON request, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []spanJSON `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type spanJSON struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (t *Tracer) request(batch []*Span) exportRequest {
+	var spans []spanJSON
+	for _, s := range batch {
+		s.Lock()
+		span := spanJSON{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            status{Code: statusCodeOK},
+		}
+		for _, a := range s.attributes {
+			span.Attributes = append(span.Attributes, keyValue{a.key, valueOf(a.value)})
+		}
+		if s.err != nil {
+			span.Status = status{Code: statusCodeError, Message: s.err.Error()}
+		}
+		s.Unlock()
+		spans = append(spans, span)
+	}
+
+	return exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: []keyValue{{"service.name", valueOf(t.service)}}},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: scopeName}, Spans: spans}},
+	}}}
+}
+
+func valueOf(value interface{}) anyValue {
+	switch v := value.(type) {
+	case string:
+		return anyValue{StringValue: &v}
+	case bool:
+		return anyValue{BoolValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+		return anyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return anyValue{IntValue: &s}
+	case float64:
+		return anyValue{DoubleValue: &v}
+	default:
+		s := fmt.Sprint(v)
+		return anyValue{StringValue: &s}
+	}
+}
+
+func randomID(bytes int) string {
+	id := make([]byte, bytes)
+	if _, err := rand.Read(id); err != nil {
+		log.Warnf("Unable to generate a random span id: %v", err)
+	}
+	return hex.EncodeToString(id)
+}
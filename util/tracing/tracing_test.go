@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNilTracerAndSpansDoNothing(t *testing.T) {
+	tracer := New("", "feed-dns")
+	assert.Nil(t, tracer)
+
+	span := tracer.Start("reconcile")
+	child := span.Child("update")
+	child.SetAttribute("entries", 1)
+	child.SetError(errors.New("failed"))
+	child.End()
+	span.End()
+	tracer.Stop()
+
+	assert.Nil(t, span)
+	assert.Nil(t, child)
+}
+
+func TestSpansAreExportedWhenStopped(t *testing.T) {
+	// given
+	var requests []exportRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, tracesPath, r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+		var request exportRequest
+		assert.NoError(t, json.Unmarshal(body, &request))
+		requests = append(requests, request)
+	}))
+	defer collector.Close()
+	tracer := New(collector.URL+"/", "feed-dns")
+
+	// when
+	span := tracer.Start("reconcile")
+	child := span.Child("update")
+	child.SetAttribute("provider", "aws")
+	child.SetAttribute("records", 2)
+	child.SetError(errors.New("throttled"))
+	child.End()
+	span.End()
+	tracer.Stop()
+
+	// then
+	assert.Len(t, requests, 1)
+	resourceSpans := requests[0].ResourceSpans[0]
+	assert.Equal(t, "service.name", resourceSpans.Resource.Attributes[0].Key)
+	assert.Equal(t, "feed-dns", *resourceSpans.Resource.Attributes[0].Value.StringValue)
+
+	spans := resourceSpans.ScopeSpans[0].Spans
+	assert.Len(t, spans, 2)
+	exportedChild, exportedSpan := spans[0], spans[1]
+	assert.Equal(t, "update", exportedChild.Name)
+	assert.Equal(t, exportedSpan.TraceID, exportedChild.TraceID)
+	assert.Equal(t, exportedSpan.SpanID, exportedChild.ParentSpanID)
+	assert.Len(t, exportedSpan.TraceID, 32)
+	assert.Len(t, exportedSpan.SpanID, 16)
+	assert.Equal(t, "aws", *exportedChild.Attributes[0].Value.StringValue)
+	assert.Equal(t, "2", *exportedChild.Attributes[1].Value.IntValue)
+	assert.Equal(t, status{Code: statusCodeError, Message: "throttled"}, exportedChild.Status)
+	assert.Equal(t, status{Code: statusCodeOK}, exportedSpan.Status)
+	assert.Empty(t, exportedSpan.ParentSpanID)
+}
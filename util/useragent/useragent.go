@@ -0,0 +1,31 @@
+// Package useragent identifies feed in the User-Agent of its AWS requests, so they can be told apart from other
+// tooling in CloudTrail.
+package useragent
+
+import (
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Version of feed, set at build time with
+// -ldflags "-X github.com/sky-uk/feed/util/useragent.Version=<version>".
+var Version = "dev"
+
+const handlerName = "feed.UserAgentHandler"
+
+// Default is the User-Agent of the named command, e.g. feed-dns/<version>.
+func Default(name string) string {
+	return name + "/" + Version
+}
+
+// Add appends userAgent to the User-Agent of every request made by clients of the session, after the SDK's own.
+// Empty leaves the User-Agent unchanged.
+func Add(sess *session.Session, userAgent string) {
+	if userAgent == "" {
+		return
+	}
+	sess.Handlers.Build.PushBackNamed(request.NamedHandler{
+		Name: handlerName,
+		Fn:   request.MakeAddToUserAgentFreeFormHandler(userAgent),
+	})
+}
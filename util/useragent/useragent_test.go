@@ -0,0 +1,44 @@
+package useragent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+)
+
+func buildRequest(sess *session.Session) *request.Request {
+	req, _ := route53.New(sess).GetHostedZoneRequest(&route53.GetHostedZoneInput{Id: aws.String("1234")})
+	req.Build()
+	return req
+}
+
+func TestDefaultIncludesTheVersion(t *testing.T) {
+	Version = "1.2.3"
+	defer func() { Version = "dev" }()
+
+	assert.Equal(t, "feed-dns/1.2.3", Default("feed-dns"))
+}
+
+func TestAddAppendsToTheUserAgentOfRequests(t *testing.T) {
+	sess := session.New(&aws.Config{Region: aws.String("eu-west-1")})
+
+	Add(sess, "feed-dns/1.2.3")
+
+	userAgent := buildRequest(sess).HTTPRequest.Header.Get("User-Agent")
+	assert.True(t, strings.HasPrefix(userAgent, aws.SDKName+"/"), userAgent)
+	assert.True(t, strings.HasSuffix(userAgent, " feed-dns/1.2.3"), userAgent)
+}
+
+func TestAddLeavesTheUserAgentIfEmpty(t *testing.T) {
+	sess := session.New(&aws.Config{Region: aws.String("eu-west-1")})
+	before := buildRequest(sess).HTTPRequest.Header.Get("User-Agent")
+
+	Add(sess, "")
+
+	assert.Equal(t, before, buildRequest(sess).HTTPRequest.Header.Get("User-Agent"))
+}